@@ -4,7 +4,9 @@ import (
 	"cedra_back_end/internal/cache"
 	"cedra_back_end/internal/config"
 	"cedra_back_end/internal/database"
+	pa "cedra_back_end/internal/handlers/payement"
 	"cedra_back_end/internal/routes"
+	"cedra_back_end/internal/services"
 	"context"
 	"errors"
 	"log"
@@ -44,6 +46,18 @@ func main() {
 	// ✅ Pré-chauffer le cache Redis
 	warmupRedisCache()
 
+	// ✅ Intégrations transporteurs (étiquettes, suivi)
+	services.InitCarriers()
+
+	// ✅ Libérer les réservations de stock expirées
+	pa.StartReservationSweeper(time.Minute)
+
+	// ✅ Reprendre l'émission des factures de commandes sur facture restées sans facture
+	pa.StartInvoiceRetrier(5 * time.Minute)
+
+	// ✅ Relancer les factures payables sur facture arrivées à échéance
+	services.StartDunningScheduler(time.Hour)
+
 	initOAuthProviders()
 
 	r := gin.Default()
@@ -0,0 +1,437 @@
+package admin
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+)
+
+type priceListRequest struct {
+	Name        string             `json:"name" binding:"required,max=100"`
+	Description string             `json:"description" binding:"max=500"`
+	IsActive    *bool              `json:"is_active"`
+	Rules       []models.PriceRule `json:"rules"`
+}
+
+// =========================
+// Listes de prix
+// =========================
+
+// ListPriceLists retourne les listes de prix et leurs règles
+func ListPriceLists(c *gin.Context) {
+	lists, err := services.ListPriceLists()
+	if err != nil {
+		log.Printf("❌ Erreur lecture listes de prix: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"price_lists": lists, "count": len(lists)})
+}
+
+// GetPriceList retourne une liste de prix
+func GetPriceList(c *gin.Context) {
+	list, ok := loadPriceListParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// CreatePriceList crée une liste de prix (prix fixes ou remises par produit, variante ou catégorie)
+func CreatePriceList(c *gin.Context) {
+	var req priceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if err := services.ValidatePriceRules(req.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list := &models.PriceList{
+		ID:          gocql.TimeUUID(),
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		IsActive:    req.IsActive == nil || *req.IsActive,
+		Rules:       req.Rules,
+		CreatedAt:   time.Now(),
+	}
+	if err := services.SavePriceList(list); err != nil {
+		log.Printf("❌ Erreur création liste de prix: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_PRICE_LIST_CREATE, utils.RESOURCE_PRICING, list.ID.String(), nil, *list)
+	log.Printf("💰 Liste de prix %s créée (%d règles)", list.Name, len(list.Rules))
+	c.JSON(http.StatusCreated, list)
+}
+
+// UpdatePriceList remplace le nom, l'état et les règles d'une liste de prix
+func UpdatePriceList(c *gin.Context) {
+	list, ok := loadPriceListParam(c)
+	if !ok {
+		return
+	}
+
+	var req priceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if err := services.ValidatePriceRules(req.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous := *list
+	now := time.Now()
+	list.Name = strings.TrimSpace(req.Name)
+	list.Description = strings.TrimSpace(req.Description)
+	if req.IsActive != nil {
+		list.IsActive = *req.IsActive
+	}
+	list.Rules = req.Rules
+	list.UpdatedAt = &now
+	if err := services.SavePriceList(list); err != nil {
+		log.Printf("❌ Erreur mise à jour liste de prix %s: %v", list.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_PRICE_LIST_UPDATE, utils.RESOURCE_PRICING, list.ID.String(), previous, *list)
+	c.JSON(http.StatusOK, list)
+}
+
+// DeletePriceList supprime une liste de prix qui n'est plus attribuée à aucune société ni aucun groupe
+func DeletePriceList(c *gin.Context) {
+	list, ok := loadPriceListParam(c)
+	if !ok {
+		return
+	}
+
+	inUse, err := services.PriceListInUse(list.ID)
+	if err != nil {
+		log.Printf("❌ Erreur vérification liste de prix %s: %v", list.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Liste de prix encore attribuée à une société ou à un groupe de clients (la désactiver ou la retirer d'abord)"})
+		return
+	}
+
+	if err := services.DeletePriceList(list.ID); err != nil {
+		log.Printf("❌ Erreur suppression liste de prix %s: %v", list.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_PRICE_LIST_DELETE, utils.RESOURCE_PRICING, list.ID.String(), *list, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Liste de prix supprimée"})
+}
+
+func loadPriceListParam(c *gin.Context) (*models.PriceList, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID liste de prix invalide"})
+		return nil, false
+	}
+	list, err := services.GetPriceList(gocql.UUID(id))
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Liste de prix introuvable"})
+			return nil, false
+		}
+		log.Printf("❌ Erreur lecture liste de prix %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return nil, false
+	}
+	return list, true
+}
+
+// priceListExists vérifie la liste de prix référencée par une attribution ; en cas d'erreur la réponse est écrite
+func priceListExists(c *gin.Context, id *gocql.UUID) bool {
+	if id == nil {
+		return true
+	}
+	if _, err := services.GetPriceList(*id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Liste de prix introuvable"})
+		return false
+	}
+	return true
+}
+
+// customerGroupExists vérifie le groupe de clients référencé par une attribution ; en cas d'erreur la réponse est écrite
+func customerGroupExists(c *gin.Context, id *gocql.UUID) bool {
+	if id == nil {
+		return true
+	}
+	if _, err := services.GetCustomerGroup(*id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Groupe de clients introuvable"})
+		return false
+	}
+	return true
+}
+
+// =========================
+// Groupes de clients
+// =========================
+
+// ListCustomerGroups retourne les groupes de clients
+func ListCustomerGroups(c *gin.Context) {
+	groups, err := services.ListCustomerGroups()
+	if err != nil {
+		log.Printf("❌ Erreur lecture groupes de clients: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"customer_groups": groups, "count": len(groups)})
+}
+
+// SaveCustomerGroup crée (POST) ou modifie (PUT /:id) un groupe de clients et sa liste de prix
+func SaveCustomerGroup(c *gin.Context) {
+	var req struct {
+		Name        string      `json:"name" binding:"required,max=100"`
+		Description string      `json:"description" binding:"max=500"`
+		PriceListID *gocql.UUID `json:"price_list_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if !priceListExists(c, req.PriceListID) {
+		return
+	}
+
+	group := &models.CustomerGroup{ID: gocql.TimeUUID(), CreatedAt: time.Now()}
+	var previous *models.CustomerGroup
+	status := http.StatusCreated
+	if c.Param("id") != "" {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID groupe invalide"})
+			return
+		}
+		existing, err := services.GetCustomerGroup(gocql.UUID(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Groupe de clients introuvable"})
+			return
+		}
+		snapshot := *existing
+		previous = &snapshot
+		group = existing
+		status = http.StatusOK
+	}
+
+	group.Name = strings.TrimSpace(req.Name)
+	group.Description = strings.TrimSpace(req.Description)
+	group.PriceListID = req.PriceListID
+	if err := services.SaveCustomerGroup(group); err != nil {
+		log.Printf("❌ Erreur enregistrement groupe de clients %s: %v", group.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_CUSTOMER_GROUP_SAVE, utils.RESOURCE_PRICING, group.ID.String(), previous, *group)
+	c.JSON(status, group)
+}
+
+// DeleteCustomerGroup supprime un groupe de clients ; ses membres reviennent au prix catalogue
+func DeleteCustomerGroup(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID groupe invalide"})
+		return
+	}
+	group, err := services.GetCustomerGroup(gocql.UUID(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Groupe de clients introuvable"})
+		return
+	}
+
+	if err := services.DeleteCustomerGroup(group.ID); err != nil {
+		log.Printf("❌ Erreur suppression groupe de clients %s: %v", group.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_CUSTOMER_GROUP_DELETE, utils.RESOURCE_PRICING, group.ID.String(), *group, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Groupe de clients supprimé"})
+}
+
+// =========================
+// Attributions
+// =========================
+
+// UpdateCompanyPricing attribue à une société une liste de prix et/ou un groupe de clients (null : aucun).
+// La liste de prix de la société prime sur celle de son groupe, qui prime sur le groupe propre de l'employé.
+func UpdateCompanyPricing(c *gin.Context) {
+	companyUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID entreprise invalide"})
+		return
+	}
+	companyID := gocql.UUID(companyUID)
+
+	var req struct {
+		PriceListID     *gocql.UUID `json:"price_list_id"`
+		CustomerGroupID *gocql.UUID `json:"customer_group_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if !priceListExists(c, req.PriceListID) || !customerGroupExists(c, req.CustomerGroupID) {
+		return
+	}
+
+	if _, err := services.GetCompanyCreditTerms(companyID); err != nil {
+		if err == gocql.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entreprise introuvable"})
+			return
+		}
+		log.Printf("❌ Erreur lecture société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	if err := services.SetCompanyPricing(companyID, req.PriceListID, req.CustomerGroupID); err != nil {
+		log.Printf("❌ Erreur attribution tarif société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_PRICE_LIST_ASSIGN, utils.RESOURCE_COMPANY, companyID.String(), nil, req)
+	log.Printf("💰 Tarif de la société %s : liste %v, groupe %v (par %s)", companyID, req.PriceListID, req.CustomerGroupID, c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Tarif de la société mis à jour", "price_list_id": req.PriceListID, "customer_group_id": req.CustomerGroupID})
+}
+
+// UpdateUserCustomerGroup place un client dans un groupe de clients (null : aucun)
+func UpdateUserCustomerGroup(c *gin.Context) {
+	userUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID utilisateur invalide"})
+		return
+	}
+	userID := gocql.UUID(userUID)
+
+	var req struct {
+		CustomerGroupID *gocql.UUID `json:"customer_group_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if !customerGroupExists(c, req.CustomerGroupID) {
+		return
+	}
+
+	if _, err := services.GetPurchasePolicy(userID.String()); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Utilisateur introuvable"})
+		return
+	}
+
+	if err := services.SetUserCustomerGroup(userID, req.CustomerGroupID); err != nil {
+		log.Printf("❌ Erreur attribution groupe client %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_PRICE_LIST_ASSIGN, utils.RESOURCE_USER, userID.String(), nil, req)
+	c.JSON(http.StatusOK, gin.H{"message": "Groupe de clients mis à jour", "customer_group_id": req.CustomerGroupID})
+}
+
+// =========================
+// Prix dégressifs
+// =========================
+
+// GetProductPriceTiers retourne les paliers de quantité d'un produit et de ses variantes
+func GetProductPriceTiers(c *gin.Context) {
+	tiers, err := services.GetPriceTiers(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID produit invalide"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tiers": tiers, "count": len(tiers)})
+}
+
+// ReplaceProductPriceTiers remplace les paliers de quantité d'un produit (liste vide : aucun palier)
+func ReplaceProductPriceTiers(c *gin.Context) {
+	productUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID produit invalide"})
+		return
+	}
+	productID := gocql.UUID(productUID)
+
+	var req struct {
+		Tiers []models.PriceTier `json:"tiers"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+
+	session, err := database.GetProductsSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+	var exists gocql.UUID
+	if err := session.Query("SELECT product_id FROM products WHERE product_id = ?", productID).Scan(&exists); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := range req.Tiers {
+		tier := &req.Tiers[i]
+		tier.ProductID = productID.String()
+		if tier.MinQuantity < 1 || tier.UnitPrice.Amount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Palier invalide : quantité minimale d'au moins 1 et prix positif"})
+			return
+		}
+		if tier.VariantID != "" {
+			variantUID, err := uuid.Parse(tier.VariantID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ID variante invalide: " + tier.VariantID})
+				return
+			}
+			var variantProductID gocql.UUID
+			err = session.Query("SELECT product_id FROM ks_products.product_variants WHERE id = ?", gocql.UUID(variantUID)).Scan(&variantProductID)
+			if err != nil || variantProductID != productID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Variante introuvable pour ce produit: " + tier.VariantID})
+				return
+			}
+		}
+		key := fmt.Sprintf("%s/%d", tier.VariantID, tier.MinQuantity)
+		if seen[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Deux paliers avec la même quantité minimale"})
+			return
+		}
+		seen[key] = true
+	}
+
+	previous, _ := services.GetPriceTiers(productID.String())
+	if err := services.ReplacePriceTiers(productID, req.Tiers); err != nil {
+		log.Printf("❌ Erreur enregistrement paliers produit %s: %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_PRICE_TIERS_UPDATE, utils.RESOURCE_PRODUCT, productID.String(), previous, req.Tiers)
+	GetProductPriceTiers(c)
+}
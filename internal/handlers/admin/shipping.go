@@ -0,0 +1,264 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+)
+
+// GetShippingConfig retourne toute la configuration des tarifs de livraison
+// (zones, transporteurs, services, grilles, classes et règles de gratuité)
+func GetShippingConfig(c *gin.Context) {
+	services.InvalidateShippingConfig()
+	cfg, err := services.GetShippingConfig()
+	if err != nil {
+		log.Printf("❌ Erreur lecture configuration livraison: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	carriers := make([]models.ShippingCarrier, 0, len(cfg.Carriers))
+	for _, carrier := range cfg.Carriers {
+		carriers = append(carriers, carrier)
+	}
+	classes := make([]models.ShippingClass, 0, len(cfg.Classes))
+	for _, class := range cfg.Classes {
+		classes = append(classes, class)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"zones":      cfg.Zones,
+		"carriers":   carriers,
+		"services":   cfg.Services,
+		"rates":      cfg.Rates,
+		"classes":    classes,
+		"free_rules": cfg.FreeRules,
+	})
+}
+
+// SaveShippingZone crée (POST) ou remplace (PUT /:id) une zone de livraison
+func SaveShippingZone(c *gin.Context) {
+	var zone models.ShippingZone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if zone.Name == "" || (len(zone.Countries) == 0 && len(zone.PostalRanges) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Une zone doit avoir un nom et au moins un pays ou une plage de codes postaux"})
+		return
+	}
+	for i := range zone.Countries {
+		zone.Countries[i] = strings.ToUpper(strings.TrimSpace(zone.Countries[i]))
+	}
+	for i, r := range zone.PostalRanges {
+		if r.Country == "" || r.From == "" || r.To == "" || r.From > r.To {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Plage de codes postaux invalide"})
+			return
+		}
+		zone.PostalRanges[i].Country = strings.ToUpper(r.Country)
+	}
+	zone.ID = shippingEntityID(c)
+
+	rangesJSON, err := json.Marshal(zone.PostalRanges)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plages de codes postaux invalides"})
+		return
+	}
+
+	saveShippingEntity(c, zone,
+		"INSERT INTO shipping_zones (id, name, countries, postal_ranges, priority, active) VALUES (?, ?, ?, ?, ?, ?)",
+		zone.ID, zone.Name, zone.Countries, string(rangesJSON), zone.Priority, zone.Active)
+}
+
+// SaveShippingCarrier crée ou remplace un transporteur
+func SaveShippingCarrier(c *gin.Context) {
+	var carrier models.ShippingCarrier
+	if err := c.ShouldBindJSON(&carrier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if carrier.Code == "" || carrier.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Le code et le nom du transporteur sont obligatoires"})
+		return
+	}
+	carrier.ID = shippingEntityID(c)
+
+	saveShippingEntity(c, carrier,
+		"INSERT INTO shipping_carriers (id, code, name, tracking_url, active) VALUES (?, ?, ?, ?, ?)",
+		carrier.ID, carrier.Code, carrier.Name, carrier.TrackingURL, carrier.Active)
+}
+
+// SaveShippingService crée ou remplace un service de transporteur (option proposée au checkout)
+func SaveShippingService(c *gin.Context) {
+	var service models.ShippingService
+	if err := c.ShouldBindJSON(&service); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if service.Code == "" || service.Name == "" || service.CarrierID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Le transporteur, le code et le nom du service sont obligatoires"})
+		return
+	}
+	if !shippingEntityExists("shipping_carriers", service.CarrierID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transporteur introuvable"})
+		return
+	}
+	service.ID = shippingEntityID(c)
+
+	saveShippingEntity(c, service,
+		"INSERT INTO shipping_services (id, carrier_id, code, name, description, estimated_days, active) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		service.ID, service.CarrierID, service.Code, service.Name, service.Description, service.EstimatedDays, service.Active)
+}
+
+// SaveShippingRate crée ou remplace une ligne de grille tarifaire
+func SaveShippingRate(c *gin.Context) {
+	var rate models.ShippingRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if rate.MinWeight < 0 || (rate.MaxWeight > 0 && rate.MaxWeight <= rate.MinWeight) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tranche de poids invalide"})
+		return
+	}
+	if rate.Price.Amount < 0 || (!rate.MaxCartValue.IsZero() && rate.MaxCartValue.Amount <= rate.MinCartValue.Amount) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prix ou tranche de montant invalide"})
+		return
+	}
+	if !shippingEntityExists("shipping_zones", rate.ZoneID) || !shippingEntityExists("shipping_services", rate.ServiceID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Zone ou service introuvable"})
+		return
+	}
+	rate.ID = shippingEntityID(c)
+
+	saveShippingEntity(c, rate,
+		"INSERT INTO shipping_rates (id, zone_id, service_id, min_weight, max_weight, min_cart_value, max_cart_value, price) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		rate.ID, rate.ZoneID, rate.ServiceID, rate.MinWeight, rate.MaxWeight, rate.MinCartValue, rate.MaxCartValue, rate.Price)
+}
+
+// SaveShippingClass crée ou remplace une classe de livraison (identifiée par son code)
+func SaveShippingClass(c *gin.Context) {
+	var class models.ShippingClass
+	if err := c.ShouldBindJSON(&class); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if code := c.Param("id"); code != "" {
+		class.Code = code
+	}
+	if class.Code == "" || class.Name == "" || class.Surcharge.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Le code, le nom et un supplément positif sont obligatoires"})
+		return
+	}
+
+	saveShippingEntity(c, class,
+		"INSERT INTO shipping_classes (code, name, surcharge, per_item, allowed_services) VALUES (?, ?, ?, ?, ?)",
+		class.Code, class.Name, class.Surcharge, class.PerItem, class.AllowedServices)
+}
+
+// SaveFreeShippingRule crée ou remplace une règle de livraison gratuite
+func SaveFreeShippingRule(c *gin.Context) {
+	var rule models.FreeShippingRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if rule.Name == "" || rule.MinCartValue.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Le nom et un montant minimum positif sont obligatoires"})
+		return
+	}
+	if rule.ZoneID != "" && !shippingEntityExists("shipping_zones", rule.ZoneID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Zone introuvable"})
+		return
+	}
+	if rule.ServiceID != "" && !shippingEntityExists("shipping_services", rule.ServiceID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service introuvable"})
+		return
+	}
+	rule.ID = shippingEntityID(c)
+
+	saveShippingEntity(c, rule,
+		"INSERT INTO shipping_free_rules (id, name, zone_id, service_id, min_cart_value, excluded_classes, active) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		rule.ID, rule.Name, rule.ZoneID, rule.ServiceID, rule.MinCartValue, rule.ExcludedClasses, rule.Active)
+}
+
+// shippingTables associe le segment d'URL à la table et à sa clé primaire
+var shippingTables = map[string][2]string{
+	"zones":      {"shipping_zones", "id"},
+	"carriers":   {"shipping_carriers", "id"},
+	"services":   {"shipping_services", "id"},
+	"rates":      {"shipping_rates", "id"},
+	"classes":    {"shipping_classes", "code"},
+	"free-rules": {"shipping_free_rules", "id"},
+}
+
+// DeleteShippingEntity supprime un élément de configuration : DELETE /admin/shipping/:kind/:id
+func DeleteShippingEntity(c *gin.Context) {
+	table, ok := shippingTables[c.Param("kind")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Type de configuration inconnu"})
+		return
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	if err := session.Query("DELETE FROM "+table[0]+" WHERE "+table[1]+" = ?", c.Param("id")).Exec(); err != nil {
+		log.Printf("❌ Erreur suppression %s %s: %v", table[0], c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la suppression"})
+		return
+	}
+	services.InvalidateShippingConfig()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Élément supprimé"})
+}
+
+// shippingEntityID reprend l'ID de l'URL (mise à jour) ou en génère un nouveau (création)
+func shippingEntityID(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	return gocql.TimeUUID().String()
+}
+
+func shippingEntityExists(table, id string) bool {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false
+	}
+	var found string
+	return session.Query("SELECT id FROM "+table+" WHERE id = ?", id).Scan(&found) == nil
+}
+
+// saveShippingEntity exécute l'upsert, invalide le cache des tarifs et renvoie l'élément enregistré
+func saveShippingEntity(c *gin.Context, entity interface{}, query string, values ...interface{}) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	if err := session.Query(query, values...).Exec(); err != nil {
+		log.Printf("❌ Erreur enregistrement configuration livraison: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	services.InvalidateShippingConfig()
+
+	status := http.StatusOK
+	if c.Request.Method == http.MethodPost {
+		status = http.StatusCreated
+	}
+	c.JSON(status, entity)
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+)
+
+// GetTaxRates retourne les taux de TVA appliqués par pays et par classe, et les réglages fiscaux
+func GetTaxRates(c *gin.Context) {
+	services.InvalidateTaxRates()
+	c.JSON(http.StatusOK, gin.H{
+		"shop_country":       services.ShopCountry(),
+		"prices_include_tax": services.PricesIncludeTax(),
+		"rates":              services.VATRates(),
+	})
+}
+
+// SaveTaxRate surcharge le taux d'une classe de TVA pour un pays (PUT /:country/:class)
+func SaveTaxRate(c *gin.Context) {
+	country, class, ok := taxRateParams(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Rate *float64 `json:"rate" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides: " + err.Error()})
+		return
+	}
+	if *req.Rate < 0 || *req.Rate > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Le taux doit être compris entre 0 et 100"})
+		return
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+	if err := session.Query("INSERT INTO tax_rates (country, tax_class, rate) VALUES (?, ?, ?)", country, class, *req.Rate).Exec(); err != nil {
+		log.Printf("❌ Erreur enregistrement taux TVA %s/%s: %v", country, class, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	services.InvalidateTaxRates()
+
+	log.Printf("🧾 Taux de TVA %s/%s fixé à %g%%", country, class, *req.Rate)
+	c.JSON(http.StatusOK, models.TaxRate{Country: country, TaxClass: class, Rate: *req.Rate, Override: true})
+}
+
+// DeleteTaxRate supprime une surcharge : le taux par défaut s'applique à nouveau
+func DeleteTaxRate(c *gin.Context) {
+	country, class, ok := taxRateParams(c)
+	if !ok {
+		return
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+	if err := session.Query("DELETE FROM tax_rates WHERE country = ? AND tax_class = ?", country, class).Exec(); err != nil {
+		log.Printf("❌ Erreur suppression taux TVA %s/%s: %v", country, class, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	services.InvalidateTaxRates()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Taux par défaut rétabli"})
+}
+
+// taxRateParams valide le pays (UE) et la classe de TVA passés dans l'URL
+func taxRateParams(c *gin.Context) (string, string, bool) {
+	country := strings.ToUpper(c.Param("country"))
+	class := strings.ToLower(c.Param("class"))
+	if !services.IsEUCountry(country) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pays hors UE: " + country})
+		return "", "", false
+	}
+	if class == "" || !models.IsTaxClass(class) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Classe de TVA invalide (standard, reduced, zero)"})
+		return "", "", false
+	}
+	return country, class, true
+}
@@ -0,0 +1,142 @@
+package company
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// Les adresses de livraison partagées sont des adresses portant le company_id de la société :
+// tous les employés les voient dans leurs adresses et peuvent s'y faire livrer.
+
+// 🟢 GET /api/company/addresses
+func ListCompanyAddresses(c *gin.Context) {
+	companyID, err := services.UserCompanyID(c.GetString("user_id"))
+	if err != nil || companyID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune société associée"})
+		return
+	}
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		log.Printf("❌ Erreur session ScyllaDB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	addresses := []models.Address{}
+	iter := session.Query(`SELECT address_id, user_id, street, postal_code, city, country, type, is_default
+	                       FROM addresses WHERE company_id = ? ALLOW FILTERING`, companyID.String()).Iter()
+	companyIDStr := companyID.String()
+	var address models.Address
+	for iter.Scan(&address.ID, &address.UserID, &address.Street, &address.PostalCode, &address.City, &address.Country, &address.Type, &address.IsDefault) {
+		if address.Type == "billing" {
+			continue
+		}
+		address.CompanyID = &companyIDStr
+		addresses = append(addresses, address)
+	}
+	if err := iter.Close(); err != nil {
+		log.Printf("⚠️ Erreur fermeture iter: %v", err)
+	}
+
+	c.JSON(http.StatusOK, addresses)
+}
+
+// 🟢 POST /api/company/addresses
+// CreateCompanyAddress ajoute une adresse de livraison partagée par tous les employés de la société
+func CreateCompanyAddress(c *gin.Context) {
+	var input struct {
+		Street     string `json:"street" binding:"required"`
+		PostalCode string `json:"postalCode" binding:"required"`
+		City       string `json:"city" binding:"required"`
+		Country    string `json:"country" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	companyID, err := services.UserCompanyID(userID)
+	if err != nil || companyID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune société associée"})
+		return
+	}
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		log.Printf("❌ Erreur session ScyllaDB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	companyIDStr := companyID.String()
+	address := models.Address{
+		ID:         gocql.TimeUUID(),
+		UserID:     userID,
+		CompanyID:  &companyIDStr,
+		Street:     strings.TrimSpace(input.Street),
+		PostalCode: strings.TrimSpace(input.PostalCode),
+		City:       strings.TrimSpace(input.City),
+		Country:    strings.ToUpper(strings.TrimSpace(input.Country)),
+		Type:       "company",
+	}
+	err = session.Query(`INSERT INTO addresses (address_id, user_id, company_id, street, postal_code, city, country, type, is_default)
+	                     VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		address.ID, address.UserID, companyIDStr, address.Street, address.PostalCode, address.City, address.Country, address.Type, false).Exec()
+	if err != nil {
+		log.Printf("❌ Erreur insertion adresse société: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Impossible d'ajouter l'adresse"})
+		return
+	}
+
+	log.Printf("✅ Adresse partagée %s ajoutée pour la société %s", address.ID, companyIDStr)
+	c.JSON(http.StatusCreated, gin.H{"message": "Adresse partagée créée", "address": address})
+}
+
+// 🟢 DELETE /api/company/addresses/:id
+func DeleteCompanyAddress(c *gin.Context) {
+	companyID, err := services.UserCompanyID(c.GetString("user_id"))
+	if err != nil || companyID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune société associée"})
+		return
+	}
+
+	addressUID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID invalide"})
+		return
+	}
+	addressUUID := gocql.UUID(addressUID)
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		log.Printf("❌ Erreur session ScyllaDB: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	// Seules les adresses partagées de la société de l'administrateur peuvent être supprimées ici
+	var addressCompanyID string
+	err = session.Query("SELECT company_id FROM addresses WHERE address_id = ?", addressUUID).Scan(&addressCompanyID)
+	if err != nil || addressCompanyID != companyID.String() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Adresse non trouvée"})
+		return
+	}
+
+	if err := session.Query("DELETE FROM addresses WHERE address_id = ?", addressUUID).Exec(); err != nil {
+		log.Printf("❌ Erreur suppression adresse société: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Suppression impossible"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Adresse partagée supprimée"})
+}
@@ -2,11 +2,14 @@ package company
 
 import (
 	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 	"cedra_back_end/internal/utils"
 	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -67,12 +70,14 @@ func GetMyCompany(c *gin.Context) {
 	// 🔹 Récupérer la société
 	var (
 		companyNameDB, billingStreet, billingPostalCode, billingCity, billingCountry string
+		vatNumber, vatStatus, peppolID                                               string
 		companyCreatedAt                                                             time.Time
+		vatCheckedAt                                                                 *time.Time
 	)
 
-	err = session.Query(`SELECT name, billing_street, billing_postal_code, billing_city, billing_country, created_at 
+	err = session.Query(`SELECT name, billing_street, billing_postal_code, billing_city, billing_country, vat_number, vat_status, vat_checked_at, peppol_id, created_at 
 	                     FROM companies WHERE company_id = ?`, *companyID).Scan(
-		&companyNameDB, &billingStreet, &billingPostalCode, &billingCity, &billingCountry, &companyCreatedAt)
+		&companyNameDB, &billingStreet, &billingPostalCode, &billingCity, &billingCountry, &vatNumber, &vatStatus, &vatCheckedAt, &peppolID, &companyCreatedAt)
 	if err != nil {
 		log.Printf("❌ Société non trouvée: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Société introuvable"})
@@ -89,6 +94,10 @@ func GetMyCompany(c *gin.Context) {
 		"billingPostalCode": billingPostalCode,
 		"billingCity":       billingCity,
 		"billingCountry":    billingCountry,
+		"vatNumber":         vatNumber,
+		"vatStatus":         vatStatus,
+		"vatCheckedAt":      vatCheckedAt,
+		"peppolId":          peppolID,
 		"createdAt":         companyCreatedAt,
 	}
 
@@ -99,10 +108,12 @@ func UpdateCompanyBilling(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var input struct {
-		BillingStreet     string `json:"billingStreet"`
-		BillingPostalCode string `json:"billingPostalCode"`
-		BillingCity       string `json:"billingCity"`
-		BillingCountry    string `json:"billingCountry"`
+		BillingStreet     string  `json:"billingStreet"`
+		BillingPostalCode string  `json:"billingPostalCode"`
+		BillingCity       string  `json:"billingCity"`
+		BillingCountry    string  `json:"billingCountry"`
+		VATNumber         *string `json:"vatNumber"` // Numéro de TVA intracommunautaire (autoliquidation)
+		PeppolID          *string `json:"peppolId"`  // Identifiant Peppol (0208:0123456789) si différent de celui déduit du n° de TVA
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -131,6 +142,37 @@ func UpdateCompanyBilling(c *gin.Context) {
 		return
 	}
 
+	// Numéro de TVA : validé (format, clé de contrôle, VIES) avant enregistrement, "" le supprime
+	var verification *models.VATVerification
+	if input.VATNumber != nil {
+		if strings.TrimSpace(*input.VATNumber) != "" {
+			verification, err = services.VerifyVATNumber(*input.VATNumber)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := services.SaveCompanyVAT(*companyID, verification); err != nil {
+			log.Printf("❌ Erreur enregistrement numéro de TVA: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour"})
+			return
+		}
+	}
+
+	// Identifiant Peppol pour la réception des factures électroniques, "" revient à celui déduit du n° de TVA
+	if input.PeppolID != nil {
+		peppolID := strings.TrimSpace(*input.PeppolID)
+		if peppolID != "" && !services.ValidatePeppolParticipantID(peppolID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "identifiant Peppol invalide (format attendu : 0208:0123456789)"})
+			return
+		}
+		if err := session.Query("UPDATE companies SET peppol_id = ? WHERE company_id = ?", peppolID, *companyID).Exec(); err != nil {
+			log.Printf("❌ Erreur enregistrement identifiant Peppol: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour"})
+			return
+		}
+	}
+
 	// Mettre à jour la société
 	err = session.Query(`UPDATE companies SET billing_street = ?, billing_postal_code = ?, billing_city = ?, billing_country = ? 
 	                     WHERE company_id = ?`,
@@ -140,7 +182,14 @@ func UpdateCompanyBilling(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Adresse de facturation mise à jour"})
+	response := gin.H{"message": "Adresse de facturation mise à jour"}
+	if verification != nil {
+		response["vat"] = verification
+		if verification.Status == models.VATStatusPending {
+			response["warning"] = "VIES indisponible : le numéro de TVA sera vérifié à la prochaine commande"
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func ListCompanyEmployees(c *gin.Context) {
@@ -170,16 +219,17 @@ func ListCompanyEmployees(c *gin.Context) {
 
 	// Récupérer tous les employés de la société
 	var employees []map[string]interface{}
-	iter := session.Query(`SELECT user_id, email, name, role, provider, provider_id, company_id, company_name, is_company_admin, created_at, updated_at 
+	iter := session.Query(`SELECT user_id, email, name, role, provider, provider_id, company_id, company_name, is_company_admin, spending_limit, created_at, updated_at 
 	                       FROM users WHERE company_id = ? ALLOW FILTERING`, *companyID).Iter()
 	var (
 		empID                                                                  gocql.UUID
 		empEmail, empName, empRole, empProvider, empProviderID, empCompanyName string
 		empCompanyID                                                           *gocql.UUID
 		empIsAdmin                                                             bool
+		empSpendingLimit                                                       *models.Money
 		empCreatedAt, empUpdatedAt                                             time.Time
 	)
-	for iter.Scan(&empID, &empEmail, &empName, &empRole, &empProvider, &empProviderID, &empCompanyID, &empCompanyName, &empIsAdmin, &empCreatedAt, &empUpdatedAt) {
+	for iter.Scan(&empID, &empEmail, &empName, &empRole, &empProvider, &empProviderID, &empCompanyID, &empCompanyName, &empIsAdmin, &empSpendingLimit, &empCreatedAt, &empUpdatedAt) {
 		var empCompanyIDStr *string
 		if empCompanyID != nil {
 			s := empCompanyID.String()
@@ -194,6 +244,7 @@ func ListCompanyEmployees(c *gin.Context) {
 			"companyId":      empCompanyIDStr,
 			"companyName":    empCompanyName,
 			"isCompanyAdmin": empIsAdmin,
+			"spendingLimit":  empSpendingLimit,
 			"created_at":     empCreatedAt,
 			"updated_at":     empUpdatedAt,
 		})
@@ -0,0 +1,98 @@
+package company
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// GET /api/company/credit
+// GetCompanyCredit retourne à l'administrateur de la société ses conditions de paiement sur facture, son encours,
+// ses factures ouvertes (avec relances et frais de retard) et le blocage éventuel des commandes sur facture
+func GetCompanyCredit(c *gin.Context) {
+	companyID, err := services.UserCompanyID(c.GetString("user_id"))
+	if err != nil || companyID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune entreprise associée"})
+		return
+	}
+	respondCompanyCredit(c, *companyID)
+}
+
+// GET /api/admin/companies/:id/credit
+func AdminGetCompanyCredit(c *gin.Context) {
+	companyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID entreprise invalide"})
+		return
+	}
+	respondCompanyCredit(c, gocql.UUID(companyID))
+}
+
+// PUT /api/admin/companies/:id/credit
+// AdminUpdateCompanyCredit approuve (ou retire) le paiement sur facture d'une société, avec son plafond et son délai
+func AdminUpdateCompanyCredit(c *gin.Context) {
+	companyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID entreprise invalide"})
+		return
+	}
+
+	var req struct {
+		InvoicePaymentEnabled bool         `json:"invoice_payment_enabled"`
+		CreditLimit           models.Money `json:"credit_limit"`
+		PaymentTermsDays      int          `json:"payment_terms_days" binding:"min=0,max=120"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+	if req.CreditLimit.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plafond de crédit invalide"})
+		return
+	}
+
+	existing, err := services.GetCompanyCreditTerms(gocql.UUID(companyID))
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entreprise introuvable"})
+			return
+		}
+		log.Printf("❌ Erreur lecture conditions société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	existing.InvoicePaymentEnabled = req.InvoicePaymentEnabled
+	existing.CreditLimit = req.CreditLimit
+	if req.PaymentTermsDays > 0 {
+		existing.PaymentTermsDays = req.PaymentTermsDays
+	}
+	if err := services.SaveCompanyCreditTerms(existing); err != nil {
+		log.Printf("❌ Erreur enregistrement conditions société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	log.Printf("💰 Paiement sur facture société %s : actif=%t, plafond %s€, %d jours (par %s)",
+		companyID, existing.InvoicePaymentEnabled, existing.CreditLimit, existing.PaymentTermsDays, c.GetString("user_id"))
+	respondCompanyCredit(c, gocql.UUID(companyID))
+}
+
+func respondCompanyCredit(c *gin.Context, companyID gocql.UUID) {
+	status, err := services.GetCompanyCreditStatus(companyID)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entreprise introuvable"})
+			return
+		}
+		log.Printf("❌ Erreur encours société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"credit": status})
+}
@@ -0,0 +1,64 @@
+package company
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// 🟢 PUT /api/company/employees/:userId/spending-limit
+// UpdateEmployeeSpendingLimit fixe le plafond par commande d'un employé : au-delà, la commande attend l'approbation
+// d'un administrateur de la société. Un plafond null le supprime.
+func UpdateEmployeeSpendingLimit(c *gin.Context) {
+	var input struct {
+		SpendingLimit *models.Money `json:"spendingLimit"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.SpendingLimit != nil && input.SpendingLimit.Amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Plafond d'achat invalide"})
+		return
+	}
+
+	adminCompanyID, err := services.UserCompanyID(c.GetString("user_id"))
+	if err != nil || adminCompanyID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune société associée"})
+		return
+	}
+
+	employeeUID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID employé invalide"})
+		return
+	}
+	employeeUUID := gocql.UUID(employeeUID)
+
+	policy, err := services.GetPurchasePolicy(employeeUUID.String())
+	if err != nil || policy.CompanyID == nil || *policy.CompanyID != *adminCompanyID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Employé introuvable ou n'appartient pas à votre société"})
+		return
+	}
+
+	if err := services.SetSpendingLimit(employeeUUID, input.SpendingLimit); err != nil {
+		log.Printf("❌ Erreur mise à jour plafond d'achat %s: %v", employeeUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour"})
+		return
+	}
+
+	utils.LogAction(c, utils.ACTION_USER_SPENDING_LIMIT, utils.RESOURCE_USER, employeeUUID.String(),
+		gin.H{"spendingLimit": policy.SpendingLimit}, gin.H{"spendingLimit": input.SpendingLimit})
+
+	response := gin.H{"message": "Plafond d'achat mis à jour", "spendingLimit": input.SpendingLimit}
+	if policy.IsCompanyAdmin {
+		response["warning"] = "Les administrateurs de la société ne sont pas soumis au plafond d'achat"
+	}
+	c.JSON(http.StatusOK, response)
+}
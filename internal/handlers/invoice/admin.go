@@ -0,0 +1,370 @@
+package invoice
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// GET /api/admin/invoices?year=2026&q=dupont&limit=50&offset=0
+// ListInvoices liste les factures d'un exercice (recherche sur le numéro, la commande, le client et son n° de TVA)
+func ListInvoices(c *gin.Context) {
+	year := services.FiscalYear(time.Now())
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 2000 || parsed > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "exercice invalide"})
+			return
+		}
+		year = parsed
+	}
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	invoices, err := services.ListInvoices(year)
+	if err != nil {
+		log.Printf("❌ Erreur lecture factures: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture factures"})
+		return
+	}
+
+	matches := []models.Invoice{}
+	for _, inv := range invoices {
+		if query == "" || invoiceMatches(inv, query) {
+			matches = append(matches, inv)
+		}
+	}
+
+	total := len(matches)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	page := matches[offset:end]
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices": page,
+		"count":    len(page),
+		"total":    total,
+		"year":     year,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// invoiceMatches : recherche (déjà en minuscules) dans les champs utiles au service comptable
+func invoiceMatches(inv models.Invoice, query string) bool {
+	return containsAny([]string{
+		inv.Number,
+		inv.OrderID.String(),
+		inv.UserID,
+		inv.PaymentReference,
+		inv.Buyer.Name,
+		inv.Buyer.Email,
+		inv.Buyer.VATNumber,
+	}, query)
+}
+
+func containsAny(fields []string, query string) bool {
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/admin/invoices/:number
+// GetInvoice retourne une facture et un lien de téléchargement signé
+func GetInvoice(c *gin.Context) {
+	inv, ok := loadInvoiceParam(c)
+	if !ok {
+		return
+	}
+
+	url, err := services.InvoiceDownloadURL(c.Request.Context(), inv, invoiceURLTTL)
+	if err != nil {
+		log.Printf("❌ Erreur URL signée facture %s: %v", inv.Number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "facture indisponible"})
+		return
+	}
+
+	creditNotes, err := services.ListInvoiceCreditNotes(inv.Number)
+	if err != nil {
+		log.Printf("⚠️ Notes de crédit de la facture %s illisibles: %v", inv.Number, err)
+		creditNotes = []models.CreditNote{}
+	}
+
+	response := gin.H{
+		"invoice":      inv,
+		"credit_notes": creditNotes,
+		"url":          url,
+		"expires_at":   time.Now().Add(invoiceURLTTL),
+	}
+	if delivery, err := services.GetPeppolDelivery(inv.Number); err == nil {
+		response["peppol"] = delivery
+	}
+	if paidAt, transactionID, err := services.GetInvoicePayment(inv); err == nil {
+		response["paid_at"] = paidAt
+		if transactionID != "" {
+			response["bank_transaction_id"] = transactionID
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /api/admin/invoices/:number/send
+// ResendInvoice renvoie par email une facture déjà émise (même numéro, même PDF)
+func ResendInvoice(c *gin.Context) {
+	inv, ok := loadInvoiceParam(c)
+	if !ok {
+		return
+	}
+
+	order, err := loadInvoiceOrder(inv.OrderID.String())
+	if err != nil {
+		log.Printf("❌ Commande %s de la facture %s introuvable: %v", inv.OrderID, inv.Number, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "commande introuvable"})
+		return
+	}
+
+	userEmail, err := sendInvoiceEmail(order, inv)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("🧾 Facture %s renvoyée par %s", inv.Number, c.GetString("email"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "facture envoyée",
+		"number":  inv.Number,
+		"to":      userEmail,
+	})
+}
+
+// loadInvoiceParam charge la facture désignée par :number (répond lui-même en cas d'erreur)
+func loadInvoiceParam(c *gin.Context) (*models.Invoice, bool) {
+	number := strings.TrimSpace(c.Param("number"))
+	inv, err := services.GetInvoice(number)
+	if err == gocql.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "facture introuvable"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Erreur lecture facture %s: %v", number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture facture"})
+		return nil, false
+	}
+	return inv, true
+}
+
+// GET /api/admin/invoices/credit-notes?year=2026&q=F2026-000012
+// ListCreditNotes liste les notes de crédit d'un exercice (recherche sur les numéros, la commande et le client)
+func ListCreditNotes(c *gin.Context) {
+	year := services.FiscalYear(time.Now())
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 2000 || parsed > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "exercice invalide"})
+			return
+		}
+		year = parsed
+	}
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+
+	notes, err := services.ListCreditNotes(year)
+	if err != nil {
+		log.Printf("❌ Erreur lecture notes de crédit: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture notes de crédit"})
+		return
+	}
+
+	matches := []models.CreditNote{}
+	total := models.Money{}
+	for _, note := range notes {
+		fields := []string{note.Number, note.InvoiceNumber, note.OrderID.String(), note.RefundID.String(), note.UserID, note.Buyer.Name, note.Buyer.Email}
+		if query == "" || containsAny(fields, query) {
+			matches = append(matches, note)
+			total = total.Add(note.GrossTotal)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credit_notes": matches,
+		"count":        len(matches),
+		"gross_total":  total,
+		"year":         year,
+	})
+}
+
+// GET /api/admin/invoices/credit-notes/:number
+// GetCreditNote retourne une note de crédit et un lien de téléchargement signé
+func GetCreditNote(c *gin.Context) {
+	note, ok := loadCreditNoteParam(c)
+	if !ok {
+		return
+	}
+
+	url, err := services.CreditNoteDownloadURL(c.Request.Context(), note, invoiceURLTTL)
+	if err != nil {
+		log.Printf("❌ Erreur URL signée note de crédit %s: %v", note.Number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "note de crédit indisponible"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credit_note": note,
+		"url":         url,
+		"expires_at":  time.Now().Add(invoiceURLTTL),
+	})
+}
+
+// GET /api/admin/invoices/:number/ubl
+// GetInvoiceUBL télécharge la facture au format UBL 2.1 / Peppol BIS Billing 3.0
+func GetInvoiceUBL(c *gin.Context) {
+	inv, ok := loadInvoiceParam(c)
+	if !ok {
+		return
+	}
+	data, err := services.InvoiceUBL(inv)
+	if err != nil {
+		respondUBLError(c, inv.Number, err)
+		return
+	}
+	sendUBL(c, inv.Number, data)
+}
+
+// POST /api/admin/invoices/:number/peppol
+// SendInvoicePeppol transmet la facture à la société acheteuse via le point d'accès Peppol
+func SendInvoicePeppol(c *gin.Context) {
+	inv, ok := loadInvoiceParam(c)
+	if !ok {
+		return
+	}
+	delivery, err := services.SendInvoiceToPeppol(inv)
+	if err != nil {
+		respondPeppolError(c, inv.Number, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "facture transmise sur Peppol", "delivery": delivery})
+}
+
+// GET /api/admin/invoices/credit-notes/:number/ubl
+// GetCreditNoteUBL télécharge la note de crédit au format UBL 2.1 / Peppol BIS Billing 3.0
+func GetCreditNoteUBL(c *gin.Context) {
+	note, ok := loadCreditNoteParam(c)
+	if !ok {
+		return
+	}
+	data, err := services.CreditNoteUBL(note)
+	if err != nil {
+		respondUBLError(c, note.Number, err)
+		return
+	}
+	sendUBL(c, note.Number, data)
+}
+
+// POST /api/admin/invoices/credit-notes/:number/peppol
+// SendCreditNotePeppol transmet la note de crédit via le point d'accès Peppol
+func SendCreditNotePeppol(c *gin.Context) {
+	note, ok := loadCreditNoteParam(c)
+	if !ok {
+		return
+	}
+	delivery, err := services.SendCreditNoteToPeppol(note)
+	if err != nil {
+		respondPeppolError(c, note.Number, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "note de crédit transmise sur Peppol", "delivery": delivery})
+}
+
+// respondPeppolError : erreurs d'export en 422, échec du point d'accès en 502
+func respondPeppolError(c *gin.Context, number string, err error) {
+	var validation *services.UBLValidationError
+	if err == services.ErrNotB2BInvoice || errors.As(err, &validation) {
+		respondUBLError(c, number, err)
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": "transmission Peppol échouée", "details": err.Error()})
+}
+
+// loadCreditNoteParam charge la note de crédit désignée par :number (répond lui-même en cas d'erreur)
+func loadCreditNoteParam(c *gin.Context) (*models.CreditNote, bool) {
+	number := strings.TrimSpace(c.Param("number"))
+	note, err := services.GetCreditNote(number)
+	if err == gocql.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "note de crédit introuvable"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Erreur lecture note de crédit %s: %v", number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture note de crédit"})
+		return nil, false
+	}
+	return note, true
+}
+
+// GET /api/admin/invoices/orphan-numbers
+// ListOrphanNumbers liste les numéros attribués mais jamais inscrits sur un document (trous de la série à justifier)
+func ListOrphanNumbers(c *gin.Context) {
+	numbers, err := services.ListOrphanDocumentNumbers()
+	if err != nil {
+		log.Printf("❌ Erreur lecture numéros orphelins: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture numéros orphelins"})
+		return
+	}
+	pending := 0
+	for _, n := range numbers {
+		if n.VoidedAt == nil {
+			pending++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"numbers": numbers, "total": len(numbers), "to_void": pending})
+}
+
+// POST /api/admin/invoices/orphan-numbers/:number/void
+// VoidOrphanNumber enregistre l'annulation explicite d'un numéro orphelin
+func VoidOrphanNumber(c *gin.Context) {
+	var req struct {
+		Note string `json:"note" binding:"required,max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "motif d'annulation requis"})
+		return
+	}
+
+	number := strings.TrimSpace(c.Param("number"))
+	err := services.VoidOrphanDocumentNumber(number, c.GetString("email"), req.Note)
+	switch {
+	case err == gocql.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "numéro orphelin introuvable"})
+	case err == services.ErrNumberAlreadyVoided:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("❌ Erreur annulation numéro %s: %v", number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur annulation numéro"})
+	default:
+		log.Printf("🧾 Numéro %s annulé par %s", number, c.GetString("email"))
+		c.JSON(http.StatusOK, gin.H{"message": "numéro annulé", "number": number})
+	}
+}
@@ -3,12 +3,12 @@ package invoice
 import (
 	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 	"cedra_back_end/internal/utils"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,64 +16,69 @@ import (
 	"github.com/google/uuid"
 )
 
-// POST /api/invoice/:id/send
+// POST /api/admin/invoices/orders/:id/send
+// SendInvoice émet si besoin la facture d'une commande payée et l'envoie au client
 func SendInvoice(c *gin.Context) {
-	id := c.Param("id")
-	orderUUID, err := uuid.Parse(id)
+	order, err := loadInvoiceOrder(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id invalide"})
+		if err == errInvalidOrderID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id invalide"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "commande introuvable"})
 		return
 	}
 
-	session, err := database.GetOrdersSession()
-	if err != nil {
-		log.Printf("❌ Erreur session ScyllaDB: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db non initialisée"})
+	// Seule une commande payée est facturée
+	if !isInvoiceable(order) {
+		c.JSON(http.StatusConflict, gin.H{"error": "commande non payée"})
 		return
 	}
 
-	// Récupérer la commande
-	var (
-		userID, paymentIntentID, itemsJSON string
-		totalPrice                         float64
-		status                             string
-		createdAt                          time.Time
-		updatedAt                          *time.Time
-	)
-
-	err = session.Query(`SELECT user_id, payment_intent_id, items, total_price, status, created_at, updated_at 
-	                     FROM orders WHERE order_id = ?`, gocql.UUID(orderUUID)).Scan(
-		&userID, &paymentIntentID, &itemsJSON, &totalPrice, &status, &createdAt, &updatedAt)
+	// Émettre la facture (ou reprendre celle déjà émise)
+	inv, err := services.IssueInvoice(order)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "commande introuvable"})
+		log.Println("❌ erreur émission facture:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "facture indisponible"})
 		return
 	}
 
-	// Désérialiser les items
-	var items []models.OrderItem
-	if itemsJSON != "" {
-		if err := json.Unmarshal([]byte(itemsJSON), &items); err != nil {
-			log.Printf("⚠️ Erreur désérialisation items: %v", err)
-			items = []models.OrderItem{}
-		}
+	userEmail, err := sendInvoiceEmail(order, inv)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	order := models.Order{
-		ID:              gocql.UUID(orderUUID),
-		UserID:          userID,
-		PaymentIntentID: paymentIntentID,
-		Items:           items,
-		TotalPrice:      totalPrice,
-		Status:          status,
-		CreatedAt:       createdAt,
-		UpdatedAt:       updatedAt,
+	c.JSON(http.StatusOK, gin.H{
+		"message": "facture envoyée",
+		"number":  inv.Number,
+		"to":      userEmail,
+	})
+}
+
+var errInvalidOrderID = errors.New("id invalide")
+
+// loadInvoiceOrder charge la commande avec tout ce qui figure sur la facture (lignes, TVA, adresse, bon de commande, centre de coût)
+func loadInvoiceOrder(id string) (*models.Order, error) {
+	orderUUID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errInvalidOrderID
 	}
+	return services.LoadOrder(gocql.UUID(orderUUID))
+}
+
+// isInvoiceable indique si la commande peut être facturée : payée, ou payable sur facture (invoiced)
+func isInvoiceable(order *models.Order) bool {
+	return order.Status == models.OrderStatusInvoiced || services.IsPaidOrderStatus(order.Status)
+}
 
+// sendInvoiceEmail envoie la facture (PDF figé) au client et retourne son adresse
+func sendInvoiceEmail(order *models.Order, inv *models.Invoice) (string, error) {
 	// Récupérer l'email de l'utilisateur depuis la table users
 	userSession, err := database.GetUsersSession()
 	var userEmail string
 	if err == nil {
-		userUID, err := uuid.Parse(userID)
+		userUID, err := uuid.Parse(order.UserID)
 		if err == nil {
 			err = userSession.Query("SELECT email FROM users WHERE user_id = ?", gocql.UUID(userUID)).Scan(&userEmail)
 			if err != nil {
@@ -83,51 +88,147 @@ func SendInvoice(c *gin.Context) {
 	}
 
 	if userEmail == "" {
-		userEmail = "client@inconnu.tld"
+		return "", errors.New("email client introuvable")
 	}
 
-	// 1. Générer le QR SEPA
-	iban := os.Getenv("COMPANY_IBAN")
-	if iban == "" {
-		iban = "BE12345678901234"
+	// 1. PDF stocké à l'émission
+	pdfBytes, err := services.GetInvoicePDF(inv)
+	if err != nil {
+		log.Println("❌ erreur PDF:", err)
+		return "", errors.New("pdf fail")
 	}
-	bic := os.Getenv("COMPANY_BIC")
-	if bic == "" {
-		bic = "KREDBEBB"
+
+	// 2. Corps HTML (récapitulatif de la commande)
+	htmlBody := utils.GenerateOrderConfirmationHTML(*order, userEmail)
+
+	// 3. Envoi
+	if err := utils.SendConfirmationEmail(userEmail, "Votre facture Cedra "+inv.Number, htmlBody, pdfBytes); err != nil {
+		log.Println("❌ erreur envoi mail:", err)
+		return "", errors.New("mail fail")
 	}
-	companyName := os.Getenv("COMPANY_NAME")
-	if companyName == "" {
-		companyName = "Cedra SRL"
+
+	log.Printf("📧 Facture %s envoyée à %s", inv.Number, userEmail)
+	return userEmail, nil
+}
+
+// invoiceURLTTL : durée de validité des liens de téléchargement signés
+const invoiceURLTTL = 15 * time.Minute
+
+// GET /api/orders/:id/invoice
+// GetOrderInvoice retourne la facture d'une commande avec un lien de téléchargement signé.
+// Accessible au client et aux administrateurs de sa société.
+func GetOrderInvoice(c *gin.Context) {
+	inv, ok := loadOrderInvoiceForUser(c)
+	if !ok {
+		return
 	}
-	ref := fmt.Sprintf("FACT-%s", id)
 
-	qrBase64, err := utils.GenerateSepaQR(iban, bic, companyName, ref, order.TotalPrice)
+	url, err := services.InvoiceDownloadURL(c.Request.Context(), inv, invoiceURLTTL)
 	if err != nil {
-		log.Println("❌ erreur QR:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "qr fail"})
+		log.Printf("❌ Erreur URL signée facture %s: %v", inv.Number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "facture indisponible"})
 		return
 	}
 
-	// 2. Rendre la page React → PDF
-	frontURL := utils.GetFrontendInvoiceBaseURL()
-	pdfBytes, err := utils.RenderReactInvoicePDF(frontURL, id, qrBase64)
+	c.JSON(http.StatusOK, gin.H{
+		"invoice":    inv,
+		"url":        url,
+		"expires_at": time.Now().Add(invoiceURLTTL),
+	})
+}
+
+// GET /api/orders/:id/invoice/ubl
+// GetOrderInvoiceUBL télécharge la facture électronique (UBL 2.1 / Peppol BIS Billing 3.0) d'une commande société
+func GetOrderInvoiceUBL(c *gin.Context) {
+	inv, ok := loadOrderInvoiceForUser(c)
+	if !ok {
+		return
+	}
+
+	data, err := services.InvoiceUBL(inv)
 	if err != nil {
-		log.Println("❌ erreur PDF:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "pdf fail"})
+		respondUBLError(c, inv.Number, err)
 		return
 	}
+	sendUBL(c, inv.Number, data)
+}
 
-	// 3. Corps HTML (tu as déjà un générateur d'e-mail de confirmation)
-	htmlBody := utils.GenerateOrderConfirmationHTML(order, userEmail)
+// loadOrderInvoiceForUser charge la facture de la commande :id pour l'utilisateur connecté (émise au besoin).
+// Répond lui-même en cas d'erreur.
+func loadOrderInvoiceForUser(c *gin.Context) (*models.Invoice, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur non authentifié"})
+		return nil, false
+	}
 
-	// 4. Envoi
-	if err := utils.SendConfirmationEmail(userEmail, "Votre facture Cedra", htmlBody, pdfBytes); err != nil {
-		log.Println("❌ erreur envoi mail:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "mail fail"})
-		return
+	order, err := loadInvoiceOrder(c.Param("id"))
+	if err != nil {
+		if err == errInvalidOrderID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID commande invalide"})
+			return nil, false
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "facture envoyée",
-	})
+	// ⚠️ Même réponse qu'une commande inexistante : ne pas révéler les commandes des autres
+	if !canAccessOrderInvoice(c, userID, order) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return nil, false
+	}
+
+	if !isInvoiceable(order) {
+		c.JSON(http.StatusConflict, gin.H{"error": "commande non payée"})
+		return nil, false
+	}
+
+	// La facture est normalement émise au paiement ; on l'émet ici si ce n'est pas encore le cas
+	inv, err := services.IssueInvoice(order)
+	if err != nil {
+		if err == services.ErrInvoiceInProgress {
+			c.JSON(http.StatusConflict, gin.H{"error": "facture en cours d'émission, réessayez dans quelques instants"})
+			return nil, false
+		}
+		log.Println("❌ erreur émission facture:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "facture indisponible"})
+		return nil, false
+	}
+	return inv, true
+}
+
+// respondUBLError : particulier ou document non conforme → 422, le reste → 500
+func respondUBLError(c *gin.Context, number string, err error) {
+	var validation *services.UBLValidationError
+	switch {
+	case err == services.ErrNotB2BInvoice:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.As(err, &validation):
+		log.Printf("⚠️ %s non exportable en UBL: %v", number, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "document non conforme Peppol BIS", "violations": validation.Violations})
+	default:
+		log.Printf("❌ Erreur export UBL %s: %v", number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "export UBL indisponible"})
+	}
+}
+
+func sendUBL(c *gin.Context, number string, data []byte) {
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", number+".xml"))
+	c.Data(http.StatusOK, "application/xml", data)
+}
+
+// canAccessOrderInvoice : le client lui-même, ou un administrateur de la société rattachée à la commande
+func canAccessOrderInvoice(c *gin.Context, userID string, order *models.Order) bool {
+	if order.UserID == userID {
+		return true
+	}
+	if !c.GetBool("isCompanyAdmin") || order.CompanyID == nil {
+		return false
+	}
+
+	adminCompany, err := services.UserCompanyID(userID)
+	if err != nil || adminCompany == nil {
+		return false
+	}
+	return *adminCompany == *order.CompanyID
 }
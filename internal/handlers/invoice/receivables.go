@@ -0,0 +1,60 @@
+package invoice
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// GET /api/admin/invoices/receivables?company_id=...&overdue=true
+// ListReceivables liste les factures ouvertes (paiement sur facture et virements attendus), de la plus ancienne échéance
+func ListReceivables(c *gin.Context) {
+	var companyID *gocql.UUID
+	if value := c.Query("company_id"); value != "" {
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID entreprise invalide"})
+			return
+		}
+		id := gocql.UUID(parsed)
+		companyID = &id
+	}
+	overdueOnly := c.Query("overdue") == "true"
+
+	receivables, err := services.ListReceivables(companyID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture factures ouvertes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	now := time.Now()
+	matches := []models.Receivable{}
+	outstanding := models.Cents(0)
+	for _, r := range receivables {
+		if overdueOnly && (r.Invoice.DueDate == nil || r.DaysOverdue(now) <= 0) {
+			continue
+		}
+		matches = append(matches, r)
+		outstanding = outstanding.Add(r.AmountDue())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"receivables": matches,
+		"count":       len(matches),
+		"outstanding": outstanding,
+	})
+}
+
+// POST /api/admin/invoices/receivables/dunning
+// RunDunning envoie immédiatement les relances dues (sans attendre le passage planifié)
+func RunDunning(c *gin.Context) {
+	sent := services.RunDunning(time.Now())
+	c.JSON(http.StatusOK, gin.H{"message": "Relances traitées", "sent": sent})
+}
@@ -3,23 +3,28 @@ package pa
 import (
 	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
-	"cedra_back_end/internal/utils"
+	"cedra_back_end/internal/services"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
-	"github.com/google/uuid"
 )
 
-// UpdateOrderStatus permet à un admin de mettre à jour le statut d'une commande
+// manualOrderStatuses : statuts de préparation qu'un admin peut appliquer directement
+var manualOrderStatuses = map[string]bool{
+	models.OrderStatusProcessing: true,
+	models.OrderStatusShipped:    true,
+	models.OrderStatusDelivered:  true,
+}
+
+// UpdateOrderStatus permet à un admin de faire avancer une commande dans la machine à états
 func UpdateOrderStatus(c *gin.Context) {
-	orderID := c.Param("id")
-	
 	var req struct {
 		Status         string `json:"status" binding:"required"`
 		TrackingNumber string `json:"tracking_number"`
+		Note           string `json:"note"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -27,104 +32,120 @@ func UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Valider le statut
-	validStatuses := map[string]bool{
-		"pending":   true,
-		"paid":      true,
-		"shipped":   true,
-		"delivered": true,
-		"cancelled": true,
+	if !services.IsOrderStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Statut invalide"})
+		return
 	}
-
-	if !validStatuses[req.Status] {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Statut invalide",
-			"valid_statuses": []string{"pending", "paid", "shipped", "delivered", "cancelled"},
+	// Paiement, annulation et remboursement passent par leurs propres flux (Stripe, stock, coupon, note de crédit)
+	if !manualOrderStatuses[req.Status] {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Ce statut ne peut pas être appliqué manuellement",
+			"allowed": []string{models.OrderStatusProcessing, models.OrderStatusShipped, models.OrderStatusDelivered},
 		})
 		return
 	}
 
-	orderUUID, err := uuid.Parse(orderID)
+	order, err := loadOrderByParam(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID commande invalide"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
 		return
 	}
 
-	session, err := database.GetOrdersSession()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
-		return
+	// Commande expédiée en colis : son statut d'expédition est déduit des colis et de leur suivi
+	if req.Status != models.OrderStatusProcessing {
+		shipments, err := services.GetOrderShipments(order.ID)
+		if err != nil {
+			log.Printf("❌ Erreur lecture envois %s: %v", order.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+			return
+		}
+		if len(shipments) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Le statut de cette commande suit ses colis"})
+			return
+		}
 	}
 
-	// Vérifier que la commande existe et récupérer le user_id
-	var userID string
-	err = session.Query("SELECT user_id FROM orders WHERE order_id = ?", gocql.UUID(orderUUID)).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
-		return
+	payload := map[string]interface{}{}
+	if req.TrackingNumber != "" {
+		payload["tracking_number"] = req.TrackingNumber
+	}
+	if req.Note != "" {
+		payload["note"] = req.Note
 	}
 
-	now := time.Now()
-
-	// Mettre à jour dans orders
-	query := "UPDATE orders SET status = ?, updated_at = ? WHERE order_id = ?"
-	err = session.Query(query, req.Status, now, gocql.UUID(orderUUID)).Exec()
-	if err != nil {
-		log.Printf("❌ Erreur mise à jour orders: %v", err)
+	previousStatus := order.Status
+	if err := transitionOrder(order, req.Status, adminActor(c), payload); err != nil {
+		if transitionErr, ok := err.(*services.InvalidTransitionError); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "Transition de statut non autorisée",
+				"current_status": transitionErr.From,
+				"allowed":        transitionErr.Allowed,
+			})
+			return
+		}
+		log.Printf("❌ Erreur mise à jour commande %s: %v", order.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour commande"})
 		return
 	}
 
-	// Mettre à jour dans orders_by_user
-	query = "UPDATE orders_by_user SET status = ? WHERE user_id = ? AND order_id = ?"
-	err = session.Query(query, req.Status, userID, gocql.UUID(orderUUID)).Exec()
-	if err != nil {
-		log.Printf("⚠️ Erreur mise à jour orders_by_user: %v", err)
+	if req.TrackingNumber != "" {
+		if err := setOrderTrackingNumber(order, req.TrackingNumber); err != nil {
+			log.Printf("⚠️ Erreur enregistrement numéro de suivi %s: %v", order.ID, err)
+		}
 	}
 
-	log.Printf("✅ Commande %s mise à jour: %s", orderID, req.Status)
+	log.Printf("✅ Commande %s mise à jour: %s → %s", order.ID, previousStatus, order.Status)
 
 	// Envoyer une notification email à l'utilisateur
-	usersSession, err := database.GetUsersSession()
-	if err == nil {
-		var userEmail string
-		err = usersSession.Query("SELECT email FROM users WHERE user_id = ?", userID).Scan(&userEmail)
-		if err == nil && userEmail != "" {
-			// Créer un objet order pour l'email
-			order := models.Order{
-				ID:         gocql.UUID(orderUUID),
-				UserID:     userID,
-				Status:     req.Status,
-			}
-			
-			// Récupérer le total de la commande
-			var totalPrice float64
-			session.Query("SELECT total_price FROM orders WHERE order_id = ?", gocql.UUID(orderUUID)).Scan(&totalPrice)
-			order.TotalPrice = totalPrice
-
-			// Envoyer l'email de notification (async)
-			go func() {
-				if err := utils.SendOrderStatusEmail(order, userEmail, req.Status); err != nil {
-					log.Printf("⚠️ Erreur envoi email notification: %v", err)
-				}
-			}()
-		}
-	}
+	notifyOrderStatus(order, order.Status)
 
 	response := gin.H{
-		"success": true,
-		"order_id": orderID,
-		"status": req.Status,
-		"updated_at": now,
+		"success":         true,
+		"order_id":        order.ID.String(),
+		"previous_status": previousStatus,
+		"status":          order.Status,
+		"updated_at":      order.UpdatedAt,
 	}
 
-	if req.TrackingNumber != "" {
-		response["tracking_number"] = req.TrackingNumber
+	if order.TrackingNumber != "" {
+		response["tracking_number"] = order.TrackingNumber
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// GetOrderDetails retourne une commande complète avec l'historique de ses statuts (admin)
+func GetOrderDetails(c *gin.Context) {
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	history, err := services.GetOrderEvents(order.ID)
+	if err != nil {
+		log.Printf("⚠️ Historique commande %s indisponible: %v", order.ID, err)
+	}
+	order.History = history
+
+	refunds, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		log.Printf("⚠️ Remboursements commande %s indisponibles: %v", order.ID, err)
+	}
+
+	shipments, err := services.GetOrderShipments(order.ID)
+	if err != nil {
+		log.Printf("⚠️ Envois commande %s indisponibles: %v", order.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order":               order,
+		"refunds":             refunds,
+		"shipments":           shipments,
+		"allowed_transitions": services.AllowedOrderTransitions(order.Status),
+	})
+}
+
 // GetAllOrders permet à un admin de récupérer toutes les commandes
 func GetAllOrders(c *gin.Context) {
 	session, err := database.GetOrdersSession()
@@ -141,7 +162,7 @@ func GetAllOrders(c *gin.Context) {
 		UserID          string    `json:"user_id"`
 		PaymentIntentID string    `json:"payment_intent_id"`
 		Items           string    `json:"items"`
-		TotalPrice      float64   `json:"total_price"`
+		TotalPrice      models.Money `json:"total_price"`
 		Status          string    `json:"status"`
 		CreatedAt       time.Time `json:"created_at"`
 		UpdatedAt       *time.Time `json:"updated_at,omitempty"`
@@ -178,17 +199,17 @@ func GetOrderStats(c *gin.Context) {
 
 	// Compter les commandes par statut
 	stats := make(map[string]int)
-	var totalRevenue float64
+	var totalRevenue models.Money
 	var totalOrders int
 
 	iter := session.Query("SELECT status, total_price FROM orders").Iter()
 	
 	var status string
-	var price float64
+	var price models.Money
 	
 	for iter.Scan(&status, &price) {
 		stats[status]++
-		totalRevenue += price
+		totalRevenue = totalRevenue.Add(price)
 		totalOrders++
 	}
 
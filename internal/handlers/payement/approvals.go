@@ -0,0 +1,292 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/paymentintent"
+)
+
+// holdOrderForApproval enregistre une commande qui dépasse le plafond de l'employé en attente d'approbation :
+// ni réservation de stock ni PaymentIntent tant qu'un administrateur de la société ne l'a pas approuvée
+func holdOrderForApproval(c *gin.Context, order *models.Order, policy *models.PurchasePolicy) bool {
+	order.Status = models.OrderStatusPendingApproval
+	if err := insertOrder(order); err != nil {
+		log.Printf("❌ Erreur création commande: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création commande"})
+		return false
+	}
+
+	approval := &models.OrderApproval{
+		OrderID:       order.ID,
+		CompanyID:     *policy.CompanyID,
+		RequestedBy:   order.UserID,
+		Amount:        order.TotalPrice,
+		SpendingLimit: *policy.SpendingLimit,
+		RequestedAt:   order.CreatedAt,
+	}
+	if err := services.CreateOrderApproval(approval); err != nil {
+		log.Printf("❌ Erreur création demande d'approbation %s: %v", order.ID, err)
+		deleteOrder(order)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création commande"})
+		return false
+	}
+
+	employeeEmail := getUserEmail(order.UserID)
+	go notifyCompanyAdmins(approval, employeeEmail)
+
+	log.Printf("🕒 Commande %s en attente d'approbation (%s€ > plafond %s€) pour %s",
+		order.ID, approval.Amount, approval.SpendingLimit, order.UserID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":        "Votre commande dépasse votre plafond d'achat : elle a été transmise à un administrateur de votre société",
+		"order_id":       order.ID.String(),
+		"status":         order.Status,
+		"amount":         order.TotalPrice,
+		"spending_limit": approval.SpendingLimit,
+		"shipping_cost":  order.ShippingCost,
+		"tax_amount":     order.TaxAmount,
+		"items_count":    len(order.Items),
+	})
+	return true
+}
+
+// notifyCompanyAdmins envoie la demande d'approbation à chaque administrateur de la société
+func notifyCompanyAdmins(approval *models.OrderApproval, employeeEmail string) {
+	emails, err := services.ListCompanyAdminEmails(approval.CompanyID)
+	if err != nil {
+		log.Printf("⚠️ Administrateurs de la société %s introuvables: %v", approval.CompanyID, err)
+		return
+	}
+	for _, email := range emails {
+		if err := utils.SendOrderApprovalRequestEmail(email, employeeEmail, approval); err != nil {
+			log.Printf("⚠️ Erreur envoi demande d'approbation à %s: %v", email, err)
+		}
+	}
+}
+
+// GET /api/company/approvals?status=pending
+// ListCompanyApprovals liste les demandes d'approbation de la société de l'administrateur, avec leurs commandes
+func ListCompanyApprovals(c *gin.Context) {
+	companyID, ok := companyAdminCompany(c)
+	if !ok {
+		return
+	}
+
+	approvals, err := services.ListCompanyOrderApprovals(companyID, c.Query("status"))
+	if err != nil {
+		log.Printf("❌ Erreur lecture demandes d'approbation société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	for i := range approvals {
+		order, err := services.LoadOrder(approvals[i].OrderID)
+		if err != nil {
+			log.Printf("⚠️ Commande %s de la demande d'approbation introuvable: %v", approvals[i].OrderID, err)
+			continue
+		}
+		approvals[i].Order = order
+	}
+
+	c.JSON(http.StatusOK, gin.H{"approvals": approvals, "count": len(approvals)})
+}
+
+// POST /api/company/approvals/:id/approve
+// ApproveOrder autorise la commande d'un employé : elle passe en attente de paiement, l'employé la règle ensuite
+func ApproveOrder(c *gin.Context) {
+	decideOrderApproval(c, models.ApprovalStatusApproved)
+}
+
+// POST /api/company/approvals/:id/reject
+// RejectOrder refuse la commande d'un employé (commentaire obligatoire) : elle est annulée
+func RejectOrder(c *gin.Context) {
+	decideOrderApproval(c, models.ApprovalStatusRejected)
+}
+
+func decideOrderApproval(c *gin.Context, decision string) {
+	var req struct {
+		Comment string `json:"comment" binding:"max=1000"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+			return
+		}
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if decision == models.ApprovalStatusRejected && req.Comment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Un commentaire est requis pour refuser une commande"})
+		return
+	}
+
+	companyID, ok := companyAdminCompany(c)
+	if !ok {
+		return
+	}
+
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID commande invalide"})
+		return
+	}
+	approval, err := services.GetOrderApproval(gocql.UUID(orderID))
+	if err != nil || approval.CompanyID != companyID {
+		if err != nil && err != gocql.ErrNotFound {
+			log.Printf("❌ Erreur lecture demande d'approbation %s: %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demande d'approbation introuvable"})
+		return
+	}
+	if approval.Status != models.ApprovalStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrApprovalDecided.Error(), "status": approval.Status})
+		return
+	}
+
+	order, err := services.LoadOrder(approval.OrderID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture commande %s: %v", approval.OrderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	target := models.OrderStatusPendingPayment
+	if decision == models.ApprovalStatusRejected {
+		target = models.OrderStatusCancelled
+	}
+	if err := services.CheckOrderTransition(order.Status, target); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cette commande n'attend plus d'approbation", "current_status": order.Status})
+		return
+	}
+
+	// La décision est enregistrée en compare-and-set : deux administrateurs ne peuvent pas trancher la même demande
+	adminID := c.GetString("user_id")
+	before := *approval
+	if err := services.DecideOrderApproval(approval, decision, adminID, req.Comment); err != nil {
+		if err == services.ErrApprovalDecided {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("❌ Erreur enregistrement décision %s: %v", approval.OrderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	actor := models.OrderActor{Type: models.ActorCompanyAdmin, ID: adminID}
+	payload := map[string]interface{}{"approval": decision}
+	if req.Comment != "" {
+		payload["comment"] = req.Comment
+	}
+	if err := transitionOrder(order, target, actor, payload); err != nil {
+		log.Printf("❌ Décision %s enregistrée mais commande %s non mise à jour: %v", decision, order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour commande"})
+		return
+	}
+
+	action := utils.ACTION_ORDER_APPROVE
+	if decision == models.ApprovalStatusRejected {
+		action = utils.ACTION_ORDER_REJECT
+	}
+	utils.LogAction(c, action, utils.RESOURCE_ORDER, order.ID.String(), before, *approval)
+
+	if email := getUserEmail(order.UserID); email != "" {
+		decided := *approval
+		go func() {
+			if err := utils.SendOrderApprovalDecisionEmail(email, &decided); err != nil {
+				log.Printf("⚠️ Erreur envoi décision d'approbation à %s: %v", email, err)
+			}
+		}()
+	}
+
+	log.Printf("✅ Commande %s %s par l'administrateur société %s", order.ID, decision, adminID)
+
+	approval.Order = order
+	c.JSON(http.StatusOK, gin.H{"message": "Décision enregistrée", "approval": approval})
+}
+
+// companyAdminCompany retourne la société de l'administrateur connecté, relue en base : le rôle porté par le jeton
+// peut avoir été retiré depuis sa délivrance. En cas d'erreur la réponse est écrite.
+func companyAdminCompany(c *gin.Context) (gocql.UUID, bool) {
+	policy, err := services.GetPurchasePolicy(c.GetString("user_id"))
+	if err != nil || policy.CompanyID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune société associée"})
+		return gocql.UUID{}, false
+	}
+	if !policy.IsCompanyAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Accès réservé aux administrateurs de la société"})
+		return gocql.UUID{}, false
+	}
+	return *policy.CompanyID, true
+}
+
+// POST /api/orders/:id/pay
+// PayApprovedOrder lance le paiement d'une commande approuvée : réservation du stock puis PaymentIntent Stripe
+// (ou facture émise pour une commande sur facture), comme au checkout
+func PayApprovedOrder(c *gin.Context) {
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil || order.UserID != c.GetString("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+	if order.Status != models.OrderStatusPendingPayment {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cette commande n'est pas en attente de paiement", "current_status": order.Status})
+		return
+	}
+
+	// Paiement déjà lancé : le client reprend le même PaymentIntent tant qu'il attend une action
+	if order.PaymentIntentID != "" {
+		intent, err := paymentintent.Get(order.PaymentIntentID, nil)
+		if err != nil {
+			log.Printf("❌ Erreur lecture PaymentIntent %s: %v", order.PaymentIntentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture paiement"})
+			return
+		}
+		switch intent.Status {
+		case stripe.PaymentIntentStatusRequiresPaymentMethod, stripe.PaymentIntentStatusRequiresConfirmation, stripe.PaymentIntentStatusRequiresAction:
+			c.JSON(http.StatusOK, gin.H{
+				"client_secret": intent.ClientSecret,
+				"payment_id":    intent.ID,
+				"order_id":      order.ID.String(),
+				"status":        order.Status,
+				"amount":        order.TotalPrice,
+				"currency":      strings.ToLower(order.TotalPrice.CurrencyCode()),
+			})
+		default:
+			c.JSON(http.StatusConflict, gin.H{"error": "Le paiement de cette commande est déjà en cours", "payment_status": intent.Status})
+		}
+		return
+	}
+
+	items := make([]services.ReservationItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, services.ReservationItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	reservationItems, err := withPhysicalStock(items)
+	if err != nil {
+		log.Printf("❌ Erreur lecture stock commande %s: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture du stock"})
+		return
+	}
+
+	// Livraison et TVA restent celles calculées à la commande, approuvées avec son montant
+	shippingOption := &models.ShippingOption{
+		ID:    order.ShippingOptionID,
+		Name:  order.ShippingOptionName,
+		Price: order.ShippingCost,
+	}
+	email := c.GetString("email")
+	if email == "" {
+		email = getUserEmail(order.UserID)
+	}
+	if submitOrder(c, order, reservationItems, shippingOption, email, "order-pay", false) {
+		log.Printf("💳 Paiement lancé pour la commande approuvée %s", order.ID)
+	}
+}
@@ -0,0 +1,215 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// maxBankStatementSize : un extrait CODA ou camt.053 dépasse rarement quelques centaines de Ko
+const maxBankStatementSize = 10 << 20
+
+// POST /api/admin/bank/statements (multipart, champ "file")
+// ImportBankStatement importe un extrait CODA ou camt.053 : les virements qui désignent une facture ouverte au bon
+// montant la marquent payée et font avancer la commande ; les autres rejoignent la file de rapprochement manuel.
+func ImportBankStatement(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier manquant"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBankStatementSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fichier illisible"})
+		return
+	}
+	if len(data) > maxBankStatementSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Fichier trop volumineux"})
+		return
+	}
+
+	parsed, err := services.ParseBankStatement(data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	statement, transactions, err := services.ImportBankStatement(parsed, header.Filename, c.GetString("user_id"))
+	if err != nil {
+		if err == services.ErrForeignBankAccount {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "account": parsed.Account})
+			return
+		}
+		log.Printf("❌ Erreur import extrait %s: %v", header.Filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import impossible"})
+		return
+	}
+
+	for i := range transactions {
+		if transactions[i].Status == models.BankTxStatusMatched {
+			settleBankPayment(&transactions[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"statement":    statement,
+		"transactions": transactions,
+	})
+}
+
+// GET /api/admin/bank/statements
+func ListBankStatements(c *gin.Context) {
+	statements, err := services.ListBankStatements()
+	if err != nil {
+		log.Printf("❌ Erreur lecture extraits bancaires: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"statements": statements})
+}
+
+// GET /api/admin/bank/transactions?status=unmatched|matched|ignored|all
+// ListBankTransactions retourne la file de rapprochement manuel (par défaut) ou l'historique des virements
+func ListBankTransactions(c *gin.Context) {
+	status := c.DefaultQuery("status", models.BankTxStatusUnmatched)
+	switch status {
+	case models.BankTxStatusUnmatched, models.BankTxStatusMatched, models.BankTxStatusIgnored:
+	case "all":
+		status = ""
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "statut invalide"})
+		return
+	}
+
+	transactions, err := services.ListBankTransactions(status)
+	if err != nil {
+		log.Printf("❌ Erreur lecture virements: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transactions": transactions, "count": len(transactions)})
+}
+
+// POST /api/admin/bank/transactions/:id/match
+// MatchBankTransaction rapproche manuellement un virement d'une facture ouverte
+func MatchBankTransaction(c *gin.Context) {
+	var req struct {
+		InvoiceNumber    string `json:"invoice_number" binding:"required"`
+		Note             string `json:"note" binding:"max=500"`
+		AcceptDifference bool   `json:"accept_difference"` // Paiement partiel ou frais bancaires déduits
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Requête invalide"})
+		return
+	}
+
+	tx, inv, err := services.MatchBankTransactionManually(c.Param("id"), req.InvoiceNumber, c.GetString("user_id"), req.Note, req.AcceptDifference)
+	switch {
+	case err == nil:
+	case err == gocql.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Virement ou facture introuvable"})
+		return
+	case err == services.ErrBankAmountMismatch:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    err.Error(),
+			"amount":   tx.Amount,
+			"expected": inv.GrossTotal,
+		})
+		return
+	case err == services.ErrBankTxResolved, err == services.ErrInvoiceAlreadyPaid:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		log.Printf("❌ Erreur rapprochement virement %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	settleBankPayment(tx)
+	c.JSON(http.StatusOK, gin.H{"message": "Virement rapproché", "transaction": tx})
+}
+
+// POST /api/admin/bank/transactions/:id/ignore
+// IgnoreBankTransaction retire de la file un virement sans rapport avec une facture
+func IgnoreBankTransaction(c *gin.Context) {
+	var req struct {
+		Note string `json:"note" binding:"required,max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Une raison est requise"})
+		return
+	}
+
+	tx, err := services.IgnoreBankTransaction(c.Param("id"), c.GetString("user_id"), req.Note)
+	switch {
+	case err == nil:
+	case err == gocql.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Virement introuvable"})
+		return
+	case err == services.ErrBankTxResolved:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		log.Printf("❌ Erreur mise à l'écart virement %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Virement écarté", "transaction": tx})
+}
+
+// settleBankPayment fait avancer la commande d'une facture payée par virement : en attente de paiement (ou facturée) → payée
+func settleBankPayment(tx *models.BankTransaction) {
+	if tx.OrderID == nil {
+		return
+	}
+	order, err := services.LoadOrder(*tx.OrderID)
+	if err != nil {
+		log.Printf("⚠️ Commande %s du virement %s introuvable: %v", tx.OrderID, tx.ID, err)
+		return
+	}
+
+	fulfill := true
+	switch order.Status {
+	case models.OrderStatusPendingPayment, models.OrderStatusPaymentProcessing, models.OrderStatusPaymentFailed:
+	case models.OrderStatusInvoiced:
+		// Commande sur facture : déjà préparée à la commande, le virement solde seulement la facture
+		fulfill = false
+	case models.OrderStatusCancelled:
+		// Le stock a été libéré : la commande doit être reprise ou le virement remboursé manuellement
+		log.Printf("⚠️ Virement %s reçu pour la commande annulée %s", tx.ID, order.ID)
+		return
+	default:
+		return
+	}
+
+	payload := map[string]interface{}{
+		"bank_transaction_id": tx.ID,
+		"invoice_number":      tx.InvoiceNumber,
+		"amount":              tx.Amount,
+	}
+	// Rapprochement automatique : l'extrait bancaire est l'auteur de la transition ; sinon l'administrateur
+	actor := models.OrderActor{Type: models.ActorBank, ID: tx.ID}
+	if tx.MatchedBy != "auto" {
+		actor = models.OrderActor{Type: models.ActorAdmin, ID: tx.MatchedBy}
+	}
+	if err := transitionOrder(order, models.OrderStatusPaid, actor, payload); err != nil {
+		log.Printf("❌ Commande %s non passée en payée après virement %s: %v", order.ID, tx.ID, err)
+		return
+	}
+
+	log.Printf("✅ Commande %s payée par virement (%s)", order.ID, tx.InvoiceNumber)
+	if fulfill {
+		if err := fulfillPaidOrder(order, actor); err != nil {
+			log.Printf("❌ Commande %s payée par virement, stock à régulariser: %v", order.ID, err)
+		}
+	}
+	notifyOrderStatus(order, models.OrderStatusPaid)
+}
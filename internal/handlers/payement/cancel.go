@@ -0,0 +1,170 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CancelOrder permet au client d'annuler une commande payée qui n'a pas encore été expédiée.
+// La commande est remboursée intégralement, les articles retournent en stock et le coupon est libéré.
+func CancelOrder(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+			return
+		}
+	}
+
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	if order.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cette commande ne vous appartient pas"})
+		return
+	}
+
+	reason := "Annulation par le client"
+	if req.Reason != "" {
+		reason += " : " + req.Reason
+	}
+
+	cancelPaidOrder(c, order, models.OrderActor{Type: models.ActorCustomer, ID: userID}, reason)
+}
+
+// AdminCancelOrder annule une commande payée non expédiée pour le compte du client (même traitement que CancelOrder :
+// remboursement intégral, remise en stock, coupon libéré)
+func AdminCancelOrder(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+			return
+		}
+	}
+
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	reason := "Annulation par le service client"
+	if req.Reason != "" {
+		reason += " : " + req.Reason
+	}
+
+	cancelPaidOrder(c, order, adminActor(c), reason)
+}
+
+// cancelPaidOrder annule une commande payée pas encore expédiée, la rembourse et écrit la réponse
+func cancelPaidOrder(c *gin.Context, order *models.Order, actor models.OrderActor, reason string) {
+	if order.Status != models.OrderStatusPaid && order.Status != models.OrderStatusProcessing {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Cette commande ne peut plus être annulée",
+			"current_status": order.Status,
+		})
+		return
+	}
+
+	// ✅ Annuler d'abord : le webhook charge.refunded ne remettra pas le stock une seconde fois
+	payload := map[string]interface{}{"reason": reason, "amount": order.TotalPrice}
+	if err := transitionOrder(order, models.OrderStatusCancelled, actor, payload); err != nil {
+		var invalid *services.InvalidTransitionError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cette commande ne peut plus être annulée", "current_status": order.Status})
+			return
+		}
+		log.Printf("❌ Erreur annulation commande %s: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur annulation commande"})
+		return
+	}
+
+	restockOrder(order, "Annulation commande", actor.ID)
+
+	if order.CouponCode != "" {
+		if err := releaseCouponUsage(order.CouponCode, order.ID); err != nil {
+			log.Printf("⚠️ Erreur libération coupon %s: %v", order.CouponCode, err)
+		}
+	}
+
+	refundRecord, refundErr := refundCancelledOrder(order, actor, reason)
+
+	userEmail := getUserEmail(order.UserID)
+	if userEmail != "" {
+		orderID := order.ID.String()
+		go func() {
+			var err error
+			if refundErr != nil || refundRecord == nil {
+				err = utils.SendRefundRequestEmail(userEmail, orderID, reason)
+			} else {
+				number, pdf := refundCreditNoteAttachment(refundRecord)
+				err = utils.SendRefundApprovedEmail(userEmail, orderID, refundRecord.RefundAmount, number, pdf)
+			}
+			if err != nil {
+				log.Printf("⚠️ Erreur envoi email remboursement: %v", err)
+			}
+		}()
+	}
+
+	if refundErr != nil {
+		// La demande reste visible dans /admin/refunds (statut failed) pour être traitée manuellement
+		log.Printf("❌ Remboursement Stripe échoué pour la commande annulée %s: %v", order.ID, refundErr)
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Commande annulée, le remboursement sera traité manuellement",
+			"order":   order,
+			"refund":  refundRecord,
+		})
+		return
+	}
+
+	log.Printf("🚫 Commande %s annulée (%s %s), remboursement %s", order.ID, actor.Type, actor.ID, refundRecord.StripeRefundID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Commande annulée et remboursée",
+		"order":   order,
+		"refund":  refundRecord,
+	})
+}
+
+// refundCancelledOrder rembourse via Stripe tout ce qui reste à rembourser sur une commande annulée.
+// Les demandes en attente ou en échec sont rejetées (remplacées par ce remboursement) et les articles ont déjà été remis en stock par l'annulation.
+func refundCancelledOrder(order *models.Order, actor models.OrderActor, reason string) (*models.Refund, error) {
+	previous, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range previous {
+		if p.Status == models.RefundStatusPending || p.Status == models.RefundStatusFailed {
+			if err := setRefundStatus(p.ID, models.RefundStatusRejected); err != nil {
+				log.Printf("⚠️ Erreur mise à jour refund %s: %v", p.ID, err)
+			}
+		}
+	}
+
+	r, err := newRefund(order, refundRequest{Reason: reason}, models.RefundTypeRefund, models.RefundStatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	markRefundRestocked(r)
+
+	if err := executeRefund(order, r, actor, false); err != nil {
+		return r, err
+	}
+	return r, nil
+}
@@ -2,11 +2,16 @@ package pa
 
 import (
 	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/middleware"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
@@ -19,8 +24,12 @@ import (
 // Checkout crée une commande complète avec validation stock et coupons
 func Checkout(c *gin.Context) {
 	var req struct {
-		AddressID  string `json:"address_id" binding:"required"`
-		CouponCode string `json:"coupon_code"` // Optionnel
+		AddressID        string `json:"address_id" binding:"required"`
+		CouponCode       string `json:"coupon_code"`                  // Optionnel
+		ShippingOptionID string `json:"shipping_option_id"`           // Optionnel, "standard" par défaut
+		PaymentMethod    string `json:"payment_method"`               // "card" (défaut) ou "invoice" (sociétés approuvées)
+		PONumber         string `json:"po_number" binding:"max=50"`   // Optionnel, bon de commande repris sur la facture
+		CostCenter       string `json:"cost_center" binding:"max=50"` // Optionnel, centre de coût repris sur la facture
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -36,6 +45,15 @@ func Checkout(c *gin.Context) {
 		return
 	}
 
+	switch req.PaymentMethod {
+	case "":
+		req.PaymentMethod = models.PaymentMethodCard
+	case models.PaymentMethodCard, models.PaymentMethodInvoice:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode de paiement invalide"})
+		return
+	}
+
 	// ✅ 1. Récupérer le panier depuis Redis
 	ctx := context.Background()
 	cartKey := "cart:" + userID
@@ -58,141 +76,346 @@ func Checkout(c *gin.Context) {
 	}
 
 	// ✅ 2. Vérifier l'adresse existe et appartient à l'utilisateur
-	addressUUID, err := uuid.Parse(req.AddressID)
+	address, err := loadUserAddress(req.AddressID, userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID adresse invalide"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Adresse introuvable ou non autorisée"})
 		return
 	}
 
-	usersSession, err := database.GetUsersSession()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+	// ✅ 3. Vérifier le stock pour chaque produit
+	reservationItems, taxClasses, ok := priceCartItems(c, cartItems, services.LoadPricingContext(userID))
+	if !ok {
 		return
 	}
+	for i, item := range cartItems {
+		// Vérifier stock suffisant (hors réservations des autres clients)
+		if available := services.AvailableStock(item.ProductID, item.VariantID, reservationItems[i].Stock); available < item.Quantity {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Stock insuffisant",
+				"product":   item.Name,
+				"available": available,
+				"requested": item.Quantity,
+			})
+			return
+		}
+	}
 
-	var addressUserID string
-	err = usersSession.Query("SELECT user_id FROM addresses WHERE address_id = ?", gocql.UUID(addressUUID)).Scan(&addressUserID)
-	if err != nil || addressUserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Adresse introuvable ou non autorisée"})
+	// ✅ 4. Calculer le total
+	totalPrice := calcTotal(cartItems)
+
+	// ✅ 5. Valider et appliquer le coupon (si fourni)
+	var discountAmount models.Money
+	var couponCode string
+
+	if req.CouponCode != "" {
+		validation := validateCoupon(req.CouponCode, totalPrice, userID)
+		if !validation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validation.ErrorMessage})
+			return
+		}
+
+		discountAmount = validation.Discount
+		couponCode = validation.Code
+		log.Printf("✅ Coupon appliqué: %s (%s€ de réduction)", couponCode, discountAmount)
+	}
+
+	goodsTotal := models.MaxMoney(totalPrice.Sub(discountAmount), models.Money{})
+
+	// ✅ 5b. Recalculer le prix de la livraison choisie (le prix envoyé par le client est ignoré)
+	shippingOption, ok := selectCheckoutShipping(c, cartItems, address, req.ShippingOptionID, goodsTotal)
+	if !ok {
 		return
 	}
 
-	// ✅ 3. Vérifier le stock pour chaque produit
+	order := &models.Order{
+		ID:                 idempotentOrderID(c, "checkout"),
+		UserID:             userID,
+		Items:              orderItemsFromCart(cartItems),
+		Subtotal:           totalPrice,
+		DiscountAmount:     discountAmount,
+		CouponCode:         couponCode,
+		AddressID:          req.AddressID,
+		ShippingAddress:    address,
+		ShippingOptionID:   shippingOption.ID,
+		ShippingOptionName: shippingOption.Name,
+		ShippingCost:       shippingOption.Price,
+		Status:             models.OrderStatusPendingPayment,
+		PaymentMethod:      req.PaymentMethod,
+		PONumber:           strings.TrimSpace(req.PONumber),
+		CostCenter:         strings.TrimSpace(req.CostCenter),
+		CreatedAt:          time.Now(),
+	}
+	for i := range order.Items {
+		order.Items[i].TaxClass = taxClasses[i]
+	}
+
+	placeOrder(c, order, reservationItems, shippingOption, email, "checkout")
+}
+
+// idempotentOrderID attribue l'ID de la nouvelle commande ; un retry avec la même Idempotency-Key reprend celui
+// de la première tentative, repris dans les métadonnées du PaymentIntent (même clé Stripe, mêmes paramètres)
+func idempotentOrderID(c *gin.Context, scope string) gocql.UUID {
+	orderID := gocql.TimeUUID()
+	if stored, err := gocql.ParseUUID(middleware.IdempotentResourceID(c, scope+":order", orderID.String())); err == nil {
+		return stored
+	}
+	return orderID
+}
+
+// priceCartItems relit chaque ligne dans le catalogue (nom, prix, classe de TVA et stock de la variante éventuelle)
+// et met le panier à jour. Retourne les lignes à réserver et les classes de TVA ; en cas d'erreur la réponse est écrite.
+func priceCartItems(c *gin.Context, cartItems []models.CartItem, pricing *services.PricingContext) ([]services.ReservationItem, []string, bool) {
 	productsSession, err := database.GetProductsSession()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
-		return
+		return nil, nil, false
 	}
 
+	reservationItems := make([]services.ReservationItem, 0, len(cartItems))
+	taxClasses := make([]string, len(cartItems))
+
 	for i, item := range cartItems {
 		productUUID, err := uuid.Parse(item.ProductID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "ID produit invalide: " + item.ProductID})
-			return
+			return nil, nil, false
 		}
 
 		var stock int
-		var name string
-		var price float64
-		err = productsSession.Query("SELECT stock, name, price FROM products WHERE product_id = ?", gocql.UUID(productUUID)).
-			Scan(&stock, &name, &price)
+		var name, taxClass string
+		var price models.Money
+		var categoryID gocql.UUID
+		err = productsSession.Query("SELECT stock, name, price, tax_class, category_id FROM products WHERE product_id = ?", gocql.UUID(productUUID)).
+			Scan(&stock, &name, &price, &taxClass, &categoryID)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable: " + item.ProductID})
-			return
+			return nil, nil, false
 		}
 
-		// Vérifier stock suffisant
-		if stock < item.Quantity {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":     "Stock insuffisant",
-				"product":   name,
-				"available": stock,
-				"requested": item.Quantity,
-			})
-			return
+		// Les variantes ont leur propre stock et leur propre prix
+		if item.VariantID != "" {
+			variantUUID, err := uuid.Parse(item.VariantID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ID variante invalide: " + item.VariantID})
+				return nil, nil, false
+			}
+			var variantProductID gocql.UUID
+			err = productsSession.Query("SELECT product_id, stock, price FROM ks_products.product_variants WHERE id = ?", gocql.UUID(variantUUID)).
+				Scan(&variantProductID, &stock, &price)
+			if err != nil || variantProductID != gocql.UUID(productUUID) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Variante introuvable: " + item.VariantID})
+				return nil, nil, false
+			}
 		}
 
-		// Mettre à jour les infos du panier avec les données actuelles
+		// Mettre à jour les infos du panier avec les données actuelles (palier de quantité et tarif négocié compris)
 		cartItems[i].Name = name
-		cartItems[i].Price = price
+		pricing.PriceCartItem(&cartItems[i], categoryID.String(), price)
+		taxClasses[i] = taxClass
+
+		reservationItems = append(reservationItems, services.ReservationItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Stock:     stock,
+		})
 	}
+	return reservationItems, taxClasses, true
+}
 
-	// ✅ 4. Calculer le total
-	totalPrice := calcTotal(cartItems)
-
-	// ✅ 5. Valider et appliquer le coupon (si fourni)
-	var discountAmount float64
-	var couponCode string
-	var couponType string
-
-	if req.CouponCode != "" {
-		validation := validateCoupon(req.CouponCode, totalPrice, userID)
-		if !validation.IsValid {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validation.ErrorMessage})
-			return
+// selectCheckoutShipping recalcule l'option de livraison choisie pour l'adresse et les articles ; en cas d'erreur la réponse est écrite
+func selectCheckoutShipping(c *gin.Context, cartItems []models.CartItem, address *models.Address, optionID string, goodsTotal models.Money) (*models.ShippingOption, bool) {
+	shippingItems, err := services.ShippingItemsFromCart(cartItems)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	shippingOption, err := services.SelectShippingOption(optionID, services.ShippingQuote{
+		Country:    address.Country,
+		PostalCode: address.PostalCode,
+		Items:      shippingItems,
+		GoodsTotal: goodsTotal,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrNoShippingZone) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return nil, false
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return shippingOption, true
+}
 
-		discountAmount = validation.Discount
-		couponCode = validation.Code
-		couponType = validation.Type
-		log.Printf("✅ Coupon appliqué: %s (%.2f€ de réduction)", couponCode, discountAmount)
+// placeOrder soumet une commande construite (panier ou devis accepté) : TVA, approbation d'achat si l'employé dépasse
+// son plafond, sinon paiement (submitOrder). La réponse est écrite dans tous les cas ; retourne true si la commande a été enregistrée.
+func placeOrder(c *gin.Context, order *models.Order, reservationItems []services.ReservationItem, shippingOption *models.ShippingOption, email, idempotencyScope string) bool {
+	// ✅ 5c. Calculer la TVA (taux du pays de livraison, autoliquidation pour les sociétés intra-UE)
+	if err := services.ApplyOrderTax(order, services.LoadTaxCustomer(order.UserID, order.ShippingAddress.Country)); err != nil {
+		log.Printf("❌ Erreur calcul TVA: %v", err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Calcul de la TVA impossible pour cette adresse"})
+		return false
+	}
+
+	// ✅ 5d. Achat d'un employé au-delà de son plafond : en attente d'un administrateur de la société, sans paiement
+	// La société est rattachée à la commande pour l'historique des commandes de la société
+	policy, required, err := services.PurchaseApprovalRequired(order.UserID, order.TotalPrice)
+	if err != nil {
+		log.Printf("❌ Erreur lecture plafond d'achat %s: %v", order.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur vérification du plafond d'achat"})
+		return false
+	}
+	if policy != nil && policy.CompanyID != nil {
+		order.CompanyID = policy.CompanyID
+	}
+	if required {
+		return holdOrderForApproval(c, order, policy)
 	}
 
-	finalPrice := totalPrice - discountAmount
-	if finalPrice < 0 {
-		finalPrice = 0
+	return submitOrder(c, order, reservationItems, shippingOption, email, idempotencyScope, true)
+}
+
+// submitOrder met une commande en paiement : contrôle du crédit pour le paiement sur facture, réservation du stock,
+// enregistrement (nouvelle commande) puis PaymentIntent Stripe ou facture émise. Une commande approuvée existe déjà
+// (isNew à false) : elle n'est ni réinsérée ni supprimée en cas d'échec.
+func submitOrder(c *gin.Context, order *models.Order, reservationItems []services.ReservationItem, shippingOption *models.ShippingOption, email, idempotencyScope string, isNew bool) bool {
+	orderID := order.ID
+	userID := order.UserID
+	totalPrice := order.Subtotal
+	finalPrice := order.TotalPrice
+
+	// ✅ 5e. Paiement sur facture : société approuvée, sans blocage, commande sous le plafond de crédit.
+	// Le montant est réservé sur le crédit de la société jusqu'à l'émission de la facture ; libéré si la commande échoue.
+	onInvoice := order.PaymentMethod == models.PaymentMethodInvoice
+	if onInvoice {
+		if _, err := services.ReserveInvoiceCredit(userID, orderID, finalPrice); err != nil {
+			var holdErr *services.CreditHoldError
+			switch {
+			case err == services.ErrInvoicePaymentNotAllowed:
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.As(err, &holdErr):
+				c.JSON(http.StatusConflict, gin.H{
+					"error":       err.Error(),
+					"outstanding": holdErr.Status.Outstanding,
+					"available":   holdErr.Status.Available,
+				})
+			default:
+				log.Printf("❌ Erreur vérification crédit %s: %v", userID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur vérification du crédit"})
+			}
+			return false
+		}
 	}
 
-	// ✅ 6. Sérialiser le panier pour Stripe metadata
-	cartJSON, err := json.Marshal(cartItems)
+	// ✅ 6. Réserver le stock le temps du paiement (vérification atomique)
+	// La réservation porte l'ID de la commande : le webhook la retrouve sans autre métadonnée
+	reservationID := orderID.String()
+	reservation, err := services.ReserveStock(reservationID, userID, reservationItems, services.ReservationTTL())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur sérialisation panier"})
-		return
+		if stockErr, ok := err.(*services.InsufficientStockError); ok {
+			productName := stockErr.ProductID
+			for _, item := range order.Items {
+				if item.ProductID == stockErr.ProductID && item.VariantID == stockErr.VariantID {
+					productName = item.Name
+				}
+			}
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "Stock insuffisant",
+				"product":   productName,
+				"available": stockErr.Available,
+				"requested": stockErr.Requested,
+			})
+		} else {
+			log.Printf("❌ Erreur réservation stock: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur réservation stock"})
+		}
+		if onInvoice {
+			services.ReleaseInvoiceCredit(userID, orderID)
+		}
+		return false
 	}
 
-	// ✅ 7. Créer le PaymentIntent Stripe
-	metadata := map[string]string{
-		"user_id":    userID,
-		"email":      email,
-		"address_id": req.AddressID,
-		"cart":       string(cartJSON),
+	// ✅ 7. Enregistrer la commande en attente de paiement
+	if isNew {
+		if err := insertOrder(order); err != nil {
+			log.Printf("❌ Erreur création commande: %v", err)
+			services.ReleaseReservation(reservationID)
+			if onInvoice {
+				services.ReleaseInvoiceCredit(userID, orderID)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création commande"})
+			return false
+		}
 	}
 
-	// Ajouter le coupon dans les métadonnées si présent
-	if couponCode != "" {
-		metadata["coupon_code"] = couponCode
-		metadata["coupon_type"] = couponType
-		metadata["discount_amount"] = string(rune(int(discountAmount * 100)))
+	// ✅ 7b. Commande sur facture : confirmée et facturée immédiatement, pas de paiement en ligne
+	if onInvoice {
+		if !checkoutOnInvoice(c, order, email) {
+			services.ReleaseReservation(reservationID)
+			services.ReleaseInvoiceCredit(userID, orderID)
+			if isNew {
+				deleteOrder(order)
+			}
+			return false
+		}
+		return true
 	}
 
+	// ✅ 8. Créer le PaymentIntent Stripe (seul l'ID de commande voyage dans les métadonnées)
 	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(finalPrice * 100)),
-		Currency: stripe.String("eur"),
+		Amount:   stripe.Int64(finalPrice.Amount),
+		Currency: stripe.String(strings.ToLower(finalPrice.CurrencyCode())),
 		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
 		},
-		Metadata: metadata,
+		Metadata: map[string]string{
+			"order_id": orderID.String(),
+		},
+	}
+
+	// Un retry du client avec la même Idempotency-Key ne crée pas de second PaymentIntent
+	if key := middleware.StripeIdempotencyKey(c, idempotencyScope); key != "" {
+		params.SetIdempotencyKey(key)
 	}
 
 	intent, err := paymentintent.New(params)
 	if err != nil {
 		log.Printf("❌ Erreur Stripe: %v", err)
+		services.ReleaseReservation(reservationID)
+		if isNew {
+			deleteOrder(order)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création paiement", "details": err.Error()})
-		return
+		return false
+	}
+
+	if err := setOrderPaymentIntent(order, intent.ID); err != nil {
+		log.Printf("⚠️ Erreur liaison commande %s → %s: %v", orderID, intent.ID, err)
+	}
+	if err := services.AttachPaymentIntent(reservationID, intent.ID); err != nil {
+		log.Printf("⚠️ Erreur liaison réservation %s → %s: %v", reservationID, intent.ID, err)
 	}
 
-	log.Printf("💳 Checkout créé: %s (%.2f€ → %.2f€) pour %s", intent.ID, totalPrice, finalPrice, email)
+	log.Printf("💳 Checkout créé: %s / commande %s (%s€ → %s€) pour %s", intent.ID, orderID, totalPrice, finalPrice, email)
 
-	// ✅ 8. Réponse avec détails
+	// ✅ 9. Réponse avec détails
 	c.JSON(http.StatusOK, gin.H{
-		"client_secret":   intent.ClientSecret,
-		"payment_id":      intent.ID,
-		"amount":          finalPrice,
-		"original_amount": totalPrice,
-		"discount":        discountAmount,
-		"currency":        "eur",
-		"items_count":     len(cartItems),
+		"client_secret":          intent.ClientSecret,
+		"payment_id":             intent.ID,
+		"order_id":               orderID.String(),
+		"status":                 order.Status,
+		"amount":                 finalPrice,
+		"original_amount":        totalPrice,
+		"discount":               order.DiscountAmount,
+		"shipping_option":        shippingOption,
+		"shipping_cost":          order.ShippingCost,
+		"tax_amount":             order.TaxAmount,
+		"tax":                    order.Tax,
+		"currency":               strings.ToLower(finalPrice.CurrencyCode()),
+		"items_count":            len(order.Items),
+		"reservation_expires_at": reservation.ExpiresAt,
 	})
+	return true
 }
 
 // ValidateCoupon vérifie si un code promo est valide
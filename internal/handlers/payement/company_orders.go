@@ -0,0 +1,93 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// companyOrder est une commande de l'historique société, avec l'employé qui l'a passée
+type companyOrder struct {
+	*models.Order
+	PlacedBy string `json:"placed_by"`
+}
+
+// GET /api/company/orders?status=&user_id=&po_number=&cost_center=&from=2026-01-01&to=2026-03-31
+// ListCompanyOrders retourne à l'administrateur les commandes de tous les employés de sa société, filtrées par statut,
+// employé, bon de commande (recherche partielle), centre de coût et période de commande
+func ListCompanyOrders(c *gin.Context) {
+	companyID, ok := companyAdminCompany(c)
+	if !ok {
+		return
+	}
+
+	var from, to time.Time
+	if value := c.Query("from"); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Date de début invalide (AAAA-MM-JJ)"})
+			return
+		}
+		from = day
+	}
+	if value := c.Query("to"); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Date de fin invalide (AAAA-MM-JJ)"})
+			return
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	status := c.Query("status")
+	userID := c.Query("user_id")
+	poNumber := strings.ToLower(strings.TrimSpace(c.Query("po_number")))
+	costCenter := strings.TrimSpace(c.Query("cost_center"))
+
+	ids, err := services.ListCompanyOrderIDs(companyID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture commandes société %s: %v", companyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	names, err := services.CompanyMemberNames(companyID)
+	if err != nil {
+		log.Printf("⚠️ Employés de la société %s introuvables: %v", companyID, err)
+	}
+
+	orders := []companyOrder{}
+	total := models.Cents(0)
+	for _, id := range ids {
+		order, err := services.LoadOrder(id)
+		if err != nil {
+			log.Printf("⚠️ Commande %s de la société %s illisible: %v", id, companyID, err)
+			continue
+		}
+		switch {
+		case status != "" && order.Status != status,
+			userID != "" && order.UserID != userID,
+			poNumber != "" && !strings.Contains(strings.ToLower(order.PONumber), poNumber),
+			costCenter != "" && !strings.EqualFold(order.CostCenter, costCenter),
+			!from.IsZero() && order.CreatedAt.Before(from),
+			!to.IsZero() && !order.CreatedAt.Before(to):
+			continue
+		}
+
+		placedBy, found := names[order.UserID]
+		if !found {
+			placedBy = "Ancien employé"
+		}
+		orders = append(orders, companyOrder{Order: order, PlacedBy: placedBy})
+		if order.Status != models.OrderStatusCancelled && order.Status != models.OrderStatusPendingApproval {
+			total = total.Add(order.TotalPrice.Sub(order.RefundedAmount))
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	c.JSON(http.StatusOK, gin.H{"orders": orders, "count": len(orders), "total": total})
+}
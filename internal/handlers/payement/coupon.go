@@ -18,18 +18,18 @@ import (
 // CreateCoupon - Créer un nouveau coupon (Admin seulement)
 func CreateCoupon(c *gin.Context) {
 	var req struct {
-		Code            string    `json:"code" binding:"required"`
-		Type            string    `json:"type" binding:"required"` // "percentage", "fixed", "free_shipping"
-		Value           float64   `json:"value" binding:"required"`
-		MinAmount       float64   `json:"min_amount"`
-		MaxAmount       *float64  `json:"max_amount"`
-		MaxUses         int       `json:"max_uses"`
-		MaxUsesPerUser  int       `json:"max_uses_per_user"`
-		ApplicableToAll bool      `json:"applicable_to_all"`
-		ProductIDs      []string  `json:"product_ids"`
-		CategoryIDs     []string  `json:"category_ids"`
-		ExpiresAt       time.Time `json:"expires_at" binding:"required"`
-		StartsAt        time.Time `json:"starts_at"`
+		Code            string        `json:"code" binding:"required"`
+		Type            string        `json:"type" binding:"required"`  // "percentage", "fixed", "free_shipping"
+		Value           float64       `json:"value" binding:"required"` // Pourcentage ou montant en euros selon le type
+		MinAmount       models.Money  `json:"min_amount"`
+		MaxAmount       *models.Money `json:"max_amount"`
+		MaxUses         int           `json:"max_uses"`
+		MaxUsesPerUser  int           `json:"max_uses_per_user"`
+		ApplicableToAll bool          `json:"applicable_to_all"`
+		ProductIDs      []string      `json:"product_ids"`
+		CategoryIDs     []string      `json:"category_ids"`
+		ExpiresAt       time.Time     `json:"expires_at" binding:"required"`
+		StartsAt        time.Time     `json:"starts_at"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -142,7 +142,7 @@ func ValidateCouponDetailed(c *gin.Context) {
 		return
 	}
 
-	validation := validateCoupon(code, cartTotal, userID.(string))
+	validation := validateCoupon(code, models.MoneyFromFloat(cartTotal), userID.(string))
 	c.JSON(http.StatusOK, validation)
 }
 
@@ -276,7 +276,7 @@ func DeleteCoupon(c *gin.Context) {
 }
 
 // validateCoupon - Fonction utilitaire pour valider un coupon
-func validateCoupon(code string, cartTotal float64, userID string) models.CouponValidation {
+func validateCoupon(code string, cartTotal models.Money, userID string) models.CouponValidation {
 	// Récupérer le coupon
 	var coupon models.Coupon
 	query := `SELECT id, code, type, value, min_amount, max_amount, max_uses, used_count,
@@ -333,10 +333,10 @@ func validateCoupon(code string, cartTotal float64, userID string) models.Coupon
 		}
 	}
 
-	if cartTotal < coupon.MinAmount {
+	if cartTotal.Amount < coupon.MinAmount.Amount {
 		return models.CouponValidation{
 			IsValid:      false,
-			ErrorMessage: fmt.Sprintf("Montant minimum requis: %.2f€", coupon.MinAmount),
+			ErrorMessage: fmt.Sprintf("Montant minimum requis: %s€", coupon.MinAmount),
 		}
 	}
 
@@ -355,20 +355,17 @@ func validateCoupon(code string, cartTotal float64, userID string) models.Coupon
 	}
 
 	// Calculer la réduction
-	var discount float64
+	var discount models.Money
 	switch coupon.Type {
 	case "percentage":
-		discount = cartTotal * (coupon.Value / 100)
-		if coupon.MaxAmount != nil && discount > *coupon.MaxAmount {
-			discount = *coupon.MaxAmount
+		discount = cartTotal.Percent(coupon.Value)
+		if coupon.MaxAmount != nil {
+			discount = models.MinMoney(discount, *coupon.MaxAmount)
 		}
 	case "fixed":
-		discount = coupon.Value
-		if discount > cartTotal {
-			discount = cartTotal
-		}
+		discount = models.MinMoney(models.MoneyFromFloat(coupon.Value), cartTotal)
 	case "free_shipping":
-		discount = 0 // Géré séparément dans le checkout
+		discount = models.Money{} // Géré séparément dans le checkout
 	}
 
 	return models.CouponValidation{
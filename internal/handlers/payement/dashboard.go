@@ -2,6 +2,7 @@ package pa
 
 import (
 	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
 	"log"
 	"net/http"
 	"time"
@@ -19,16 +20,16 @@ func GetDashboardStats(c *gin.Context) {
 
 	// Statistiques des commandes
 	var totalOrders int
-	var totalRevenue float64
+	var totalRevenue models.Money
 	statusCount := make(map[string]int)
 
 	iter := session.Query("SELECT status, total_price FROM orders").Iter()
 	var status string
-	var price float64
+	var price models.Money
 
 	for iter.Scan(&status, &price) {
 		totalOrders++
-		totalRevenue += price
+		totalRevenue = totalRevenue.Add(price)
 		statusCount[status]++
 	}
 
@@ -83,9 +84,9 @@ func GetDashboardStats(c *gin.Context) {
 	}
 
 	// Calculer les moyennes
-	var averageOrderValue float64
+	var averageOrderValue models.Money
 	if totalOrders > 0 {
-		averageOrderValue = totalRevenue / float64(totalOrders)
+		averageOrderValue = models.Cents(totalRevenue.Amount / int64(totalOrders))
 	}
 
 	// Statistiques des remboursements
@@ -145,12 +146,12 @@ func GetRecentOrders(c *gin.Context) {
 	`, limit).Iter()
 
 	type RecentOrder struct {
-		ID              string    `json:"id"`
-		UserID          string    `json:"user_id"`
-		PaymentIntentID string    `json:"payment_intent_id"`
-		TotalPrice      float64   `json:"total_price"`
-		Status          string    `json:"status"`
-		CreatedAt       time.Time `json:"created_at"`
+		ID              string       `json:"id"`
+		UserID          string       `json:"user_id"`
+		PaymentIntentID string       `json:"payment_intent_id"`
+		TotalPrice      models.Money `json:"total_price"`
+		Status          string       `json:"status"`
+		CreatedAt       time.Time    `json:"created_at"`
 	}
 
 	var orders []RecentOrder
@@ -3,10 +3,27 @@ package pa
 import "cedra_back_end/internal/models"
 
 // calcTotal calcule le montant total d'un panier
-func calcTotal(items []models.CartItem) float64 {
-	var total float64
+func calcTotal(items []models.CartItem) models.Money {
+	var total models.Money
 	for _, item := range items {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Mul(item.Quantity))
 	}
 	return total
 }
+
+// orderItemsFromCart convertit les lignes du panier en lignes de commande
+func orderItemsFromCart(items []models.CartItem) []models.OrderItem {
+	orderItems := make([]models.OrderItem, 0, len(items))
+	for _, item := range items {
+		orderItems = append(orderItems, models.OrderItem{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Quantity:    item.Quantity,
+			Price:       item.Price,
+			ListPrice:   item.ListPrice,
+			PriceSource: item.PriceSource,
+			Name:        item.Name,
+		})
+	}
+	return orderItems
+}
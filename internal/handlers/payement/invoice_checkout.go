@@ -0,0 +1,156 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+)
+
+// checkoutOnInvoice confirme une commande payable sur facture : la commande passe en "invoiced", le stock est
+// engagé comme pour une commande payée, et la facture (avec son échéance) est émise tout de suite.
+// Le virement sera rapproché depuis les extraits bancaires ; les relances suivent l'échéance.
+func checkoutOnInvoice(c *gin.Context, order *models.Order, email string) bool {
+	actor := models.OrderActor{Type: models.ActorCustomer, ID: order.UserID}
+	payload := map[string]interface{}{"payment_method": order.PaymentMethod, "amount": order.TotalPrice}
+	if err := transitionOrder(order, models.OrderStatusInvoiced, actor, payload); err != nil {
+		log.Printf("❌ Commande %s non confirmée sur facture: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création commande"})
+		return false
+	}
+
+	if err := fulfillPaidOrder(order, actor); err != nil {
+		log.Printf("❌ Commande %s confirmée sur facture, stock à régulariser: %v", order.ID, err)
+	}
+
+	// La facture fait office de demande de paiement : elle est émise avant de répondre.
+	// La commande est confirmée et son numéro peut déjà être réservé : un échec est repris en arrière-plan, pas annulé.
+	inv, err := services.IssueInvoice(order)
+	if err != nil {
+		log.Printf("❌ Erreur émission facture commande %s, reprise planifiée: %v", order.ID, err)
+		if err := services.QueueInvoiceRetry(order.ID, err); err != nil {
+			log.Printf("❌ Commande %s non inscrite pour la reprise de sa facture: %v", order.ID, err)
+		}
+	}
+
+	userEmail := getUserEmail(order.UserID)
+	if userEmail == "" {
+		userEmail = email
+	}
+	html := utils.GenerateOrderConfirmationHTML(*order, userEmail)
+	go func() {
+		var pdf []byte
+		if inv != nil {
+			data, err := services.GetInvoicePDF(inv)
+			if err != nil {
+				log.Println("❌ Erreur génération PDF :", err)
+			} else {
+				pdf = data
+			}
+		}
+		if err := utils.SendConfirmationEmail(userEmail, "Confirmation de votre commande Cedra", html, pdf); err != nil {
+			log.Println("❌ Erreur envoi e-mail confirmation :", err)
+		} else {
+			log.Println("📧 E-mail de confirmation envoyé à", userEmail)
+		}
+	}()
+
+	log.Printf("🧾 Commande %s confirmée sur facture (%s€) pour %s", order.ID, order.TotalPrice, email)
+
+	response := gin.H{
+		"order_id":       order.ID.String(),
+		"status":         order.Status,
+		"payment_method": order.PaymentMethod,
+		"amount":         order.TotalPrice,
+		"discount":       order.DiscountAmount,
+		"shipping_cost":  order.ShippingCost,
+		"tax_amount":     order.TaxAmount,
+		"tax":            order.Tax,
+		"currency":       strings.ToLower(order.TotalPrice.CurrencyCode()),
+		"items_count":    len(order.Items),
+	}
+	if inv != nil {
+		response["invoice_number"] = inv.Number
+		response["due_date"] = inv.DueDate
+		response["payment_reference"] = inv.PaymentReference
+		response["iban"] = inv.IBAN
+		response["bic"] = inv.BIC
+	} else {
+		response["invoice_pending"] = true
+	}
+	c.JSON(http.StatusOK, response)
+	return true
+}
+
+// StartInvoiceRetrier reprend périodiquement l'émission des factures des commandes sur facture restées sans facture
+func StartInvoiceRetrier(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			retryPendingInvoices()
+		}
+	}()
+	log.Printf("✅ Reprise des factures en attente active (toutes les %s)", interval)
+}
+
+func retryPendingInvoices() {
+	ids, err := services.PendingInvoiceOrders()
+	if err != nil {
+		log.Printf("⚠️ Erreur lecture factures en attente: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		order, err := services.LoadOrder(id)
+		if err == gocql.ErrNotFound || (err == nil && order.Status == models.OrderStatusCancelled) {
+			log.Printf("⚠️ Commande %s introuvable ou annulée, facture abandonnée", id)
+			services.ClearPendingInvoice(id)
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️ Erreur lecture commande %s: %v", id, err)
+			continue
+		}
+
+		inv, err := services.IssueInvoice(order)
+		if err != nil {
+			log.Printf("⚠️ Facture de la commande %s toujours non émise: %v", id, err)
+			if err := services.QueueInvoiceRetry(id, err); err != nil {
+				log.Printf("⚠️ Erreur mise à jour reprise facture %s: %v", id, err)
+			}
+			continue
+		}
+		if err := services.ClearPendingInvoice(id); err != nil {
+			log.Printf("⚠️ Commande %s non retirée des factures en attente: %v", id, err)
+		}
+		sendPendingInvoice(order, inv)
+	}
+}
+
+// sendPendingInvoice envoie au client la facture émise après coup
+func sendPendingInvoice(order *models.Order, inv *models.Invoice) {
+	userEmail := getUserEmail(order.UserID)
+	if userEmail == "" {
+		log.Printf("⚠️ Facture %s émise, email client introuvable", inv.Number)
+		return
+	}
+	pdf, err := services.GetInvoicePDF(inv)
+	if err != nil {
+		log.Println("❌ Erreur génération PDF :", err)
+		return
+	}
+	html := utils.GenerateOrderConfirmationHTML(*order, userEmail)
+	if err := utils.SendConfirmationEmail(userEmail, "Votre facture Cedra "+inv.Number, html, pdf); err != nil {
+		log.Println("❌ Erreur envoi facture :", err)
+		return
+	}
+	log.Printf("📧 Facture %s envoyée à %s", inv.Number, userEmail)
+}
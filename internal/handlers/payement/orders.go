@@ -0,0 +1,226 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v83"
+)
+
+// insertOrder enregistre une commande dans orders et dans l'index orders_by_user
+func insertOrder(order *models.Order) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	itemsJSON, err := json.Marshal(order.Items)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation items: %v", err)
+	}
+
+	var addressJSON string
+	if order.ShippingAddress != nil {
+		data, err := json.Marshal(order.ShippingAddress)
+		if err != nil {
+			return fmt.Errorf("erreur sérialisation adresse: %v", err)
+		}
+		addressJSON = string(data)
+	}
+
+	var taxJSON string
+	if order.Tax != nil {
+		data, err := json.Marshal(order.Tax)
+		if err != nil {
+			return fmt.Errorf("erreur sérialisation TVA: %v", err)
+		}
+		taxJSON = string(data)
+	}
+
+	err = session.Query(`INSERT INTO orders (order_id, user_id, payment_intent_id, payment_method, quote_id, company_id, po_number, cost_center, items, subtotal,
+	                     discount_amount, coupon_code, address_id, shipping_address, shipping_option_id, shipping_option_name, shipping_cost, tax_amount,
+	                     tax_details, total_price, status, created_at, updated_at)
+	                     VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.ID, order.UserID, order.PaymentIntentID, order.PaymentMethod, order.QuoteID, order.CompanyID, order.PONumber, order.CostCenter, string(itemsJSON), order.Subtotal, order.DiscountAmount, order.CouponCode,
+		order.AddressID, addressJSON, order.ShippingOptionID, order.ShippingOptionName, order.ShippingCost, order.TaxAmount, taxJSON,
+		order.TotalPrice, order.Status, order.CreatedAt, order.CreatedAt).Exec()
+	if err != nil {
+		return err
+	}
+
+	err = session.Query(`INSERT INTO orders_by_user (user_id, order_id, payment_intent_id, items, total_price, status, created_at)
+	                     VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		order.UserID, order.ID, order.PaymentIntentID, string(itemsJSON), order.TotalPrice, order.Status, order.CreatedAt).Exec()
+	if err != nil {
+		log.Printf("⚠️ Erreur insertion index orders_by_user: %v", err)
+	}
+
+	actor := models.OrderActor{Type: models.ActorCustomer, ID: order.UserID}
+	if _, err := services.RecordOrderEvent(order.ID, "", order.Status, actor, nil); err != nil {
+		log.Printf("⚠️ Erreur enregistrement création commande %s: %v", order.ID, err)
+	}
+
+	return nil
+}
+
+// deleteOrder supprime une commande qui n'a jamais pu être soumise au paiement
+func deleteOrder(order *models.Order) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return
+	}
+	session.Query("DELETE FROM orders WHERE order_id = ?", order.ID).Exec()
+	session.Query("DELETE FROM orders_by_user WHERE user_id = ? AND order_id = ?", order.UserID, order.ID).Exec()
+}
+
+// setOrderPaymentIntent associe le PaymentIntent Stripe à la commande
+func setOrderPaymentIntent(order *models.Order, paymentIntentID string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	order.PaymentIntentID = paymentIntentID
+	if err := session.Query("UPDATE orders SET payment_intent_id = ? WHERE order_id = ?", paymentIntentID, order.ID).Exec(); err != nil {
+		return err
+	}
+	if err := session.Query("UPDATE orders_by_user SET payment_intent_id = ? WHERE user_id = ? AND order_id = ?",
+		paymentIntentID, order.UserID, order.ID).Exec(); err != nil {
+		log.Printf("⚠️ Erreur mise à jour orders_by_user: %v", err)
+	}
+	return nil
+}
+
+// loadOrderByParam récupère une commande à partir de l'ID passé dans l'URL
+func loadOrderByParam(orderID string) (*models.Order, error) {
+	orderUUID, err := uuid.Parse(orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ID commande invalide")
+	}
+	return services.LoadOrder(gocql.UUID(orderUUID))
+}
+
+// saveOrderStatus enregistre le nouveau statut dans orders et orders_by_user, à condition que la commande soit
+// toujours dans le statut from (LWT). Sinon rien n'est écrit, order.Status reçoit le statut réel et applied vaut false.
+func saveOrderStatus(order *models.Order, from, status string) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	current := map[string]interface{}{}
+	applied, err := session.Query("UPDATE orders SET status = ?, updated_at = ? WHERE order_id = ? IF status = ?",
+		status, now, order.ID, from).MapScanCAS(current)
+	if err != nil {
+		return false, err
+	}
+	if !applied {
+		actual, _ := current["status"].(string)
+		order.Status = actual
+		return false, nil
+	}
+
+	if err := session.Query("UPDATE orders_by_user SET status = ?, updated_at = ? WHERE user_id = ? AND order_id = ?",
+		status, now, order.UserID, order.ID).Exec(); err != nil {
+		log.Printf("⚠️ Erreur mise à jour orders_by_user: %v", err)
+	}
+
+	order.Status = status
+	order.UpdatedAt = &now
+	return true, nil
+}
+
+// transitionOrder fait passer une commande dans un nouveau statut si la machine à états l'autorise,
+// puis enregistre la transition dans order_events. Si un webhook, un administrateur ou le transporteur a fait évoluer
+// la commande entre-temps, la transition est revérifiée depuis le statut réel : refusée, elle retourne une InvalidTransitionError.
+func transitionOrder(order *models.Order, status string, actor models.OrderActor, payload map[string]interface{}) error {
+	for {
+		if err := services.CheckOrderTransition(order.Status, status); err != nil {
+			return err
+		}
+
+		from := order.Status
+		applied, err := saveOrderStatus(order, from, status)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			log.Printf("⚠️ Commande %s passée de %s à %s entre-temps, transition vers %s revérifiée", order.ID, from, order.Status, status)
+			continue
+		}
+
+		if _, err := services.RecordOrderEvent(order.ID, from, status, actor, payload); err != nil {
+			log.Printf("⚠️ Erreur enregistrement transition %s (%s → %s): %v", order.ID, from, status, err)
+		}
+		return nil
+	}
+}
+
+// setOrderTrackingNumber enregistre le numéro de suivi du colis
+func setOrderTrackingNumber(order *models.Order, trackingNumber string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	if err := session.Query("UPDATE orders SET tracking_number = ? WHERE order_id = ?", trackingNumber, order.ID).Exec(); err != nil {
+		return err
+	}
+	order.TrackingNumber = trackingNumber
+	return nil
+}
+
+// stripeActor identifie le webhook Stripe comme auteur d'une transition
+func stripeActor(event stripe.Event) models.OrderActor {
+	return models.OrderActor{Type: models.ActorStripe, ID: event.ID}
+}
+
+// adminActor identifie l'administrateur connecté comme auteur d'une transition
+func adminActor(c *gin.Context) models.OrderActor {
+	return models.OrderActor{Type: models.ActorAdmin, ID: c.GetString("user_id")}
+}
+
+// getUserEmail récupère l'email d'un utilisateur (vide si introuvable)
+func getUserEmail(userID string) string {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return ""
+	}
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return ""
+	}
+
+	var email string
+	if err := session.Query("SELECT email FROM users WHERE user_id = ?", gocql.UUID(uid)).Scan(&email); err != nil {
+		log.Printf("⚠️ Email introuvable pour %s: %v", userID, err)
+		return ""
+	}
+	return email
+}
+
+// notifyOrderStatus envoie (en asynchrone) l'email de changement de statut au client
+func notifyOrderStatus(order *models.Order, status string) {
+	userEmail := getUserEmail(order.UserID)
+	if userEmail == "" {
+		return
+	}
+
+	orderCopy := *order
+	go func() {
+		if err := utils.SendOrderStatusEmail(orderCopy, userEmail, status); err != nil {
+			log.Printf("⚠️ Erreur envoi email notification: %v", err)
+		}
+	}()
+}
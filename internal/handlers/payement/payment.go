@@ -2,10 +2,13 @@ package pa
 
 import (
 	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/middleware"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 	"cedra_back_end/internal/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,9 +18,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
-	"github.com/google/uuid"
 	"github.com/stripe/stripe-go/v83"
 	"github.com/stripe/stripe-go/v83/paymentintent"
+	"github.com/stripe/stripe-go/v83/refund"
 	"github.com/stripe/stripe-go/v83/webhook"
 )
 
@@ -31,7 +34,6 @@ func CreatePaymentIntent(c *gin.Context) {
 		return
 	}
 
-	total := calcTotal(req.Items)
 	userID := c.GetString("user_id")
 	email := c.GetString("email")
 
@@ -40,38 +42,97 @@ func CreatePaymentIntent(c *gin.Context) {
 		return
 	}
 
-	// ✅ Sérialise le panier en JSON pour le stocker dans Stripe
-	cartJSON, err := json.Marshal(req.Items)
+	// ✅ Seuls les produits et quantités viennent du client : nom, prix (palier et tarif négocié) et stock sont relus
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Quantité invalide pour le produit " + item.ProductID})
+			return
+		}
+	}
+	reservationItems, taxClasses, ok := priceCartItems(c, req.Items, services.LoadPricingContext(userID))
+	if !ok {
+		return
+	}
+	total := calcTotal(req.Items)
+
+	// ✅ Réserve le stock le temps du paiement (la réservation porte l'ID de la commande)
+	orderID := idempotentOrderID(c, "create-intent")
+	reservationID := orderID.String()
+	reservation, err := services.ReserveStock(reservationID, userID, reservationItems, services.ReservationTTL())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serialisation panier"})
+		if stockErr, ok := err.(*services.InsufficientStockError); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "Stock insuffisant",
+				"product":   stockErr.ProductID,
+				"available": stockErr.Available,
+				"requested": stockErr.Requested,
+			})
+			return
+		}
+		log.Printf("❌ Erreur réservation stock: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Impossible de réserver le stock"})
+		return
+	}
+
+	// ✅ Enregistre la commande en attente de paiement
+	order := &models.Order{
+		ID:         orderID,
+		UserID:     userID,
+		Items:      orderItemsFromCart(req.Items),
+		Subtotal:   total,
+		TotalPrice: total,
+		Status:     models.OrderStatusPendingPayment,
+		CreatedAt:  time.Now(),
+	}
+	for i := range order.Items {
+		order.Items[i].TaxClass = taxClasses[i]
+	}
+	if err := insertOrder(order); err != nil {
+		log.Printf("❌ Erreur création commande: %v", err)
+		services.ReleaseReservation(reservationID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création commande"})
 		return
 	}
 
 	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(total * 100)),
-		Currency: stripe.String("eur"),
+		Amount:   stripe.Int64(total.Amount),
+		Currency: stripe.String(strings.ToLower(total.CurrencyCode())),
 		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
 		},
 		Metadata: map[string]string{
-			"user_id": userID,
-			"email":   email,
-			"cart":    string(cartJSON), // ✅ Sauvegarde le panier ici
+			"order_id": orderID.String(),
 		},
 	}
 
+	// Un retry du client avec la même Idempotency-Key ne crée pas de second PaymentIntent
+	if key := middleware.StripeIdempotencyKey(c, "create-intent"); key != "" {
+		params.SetIdempotencyKey(key)
+	}
+
 	intent, err := paymentintent.New(params)
 	if err != nil {
 		log.Println("❌ Erreur Stripe:", err)
+		services.ReleaseReservation(reservationID)
+		deleteOrder(order)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	log.Printf("💳 PaymentIntent créé : %s (%.2f€) pour %s", intent.ID, total, email)
+	if err := setOrderPaymentIntent(order, intent.ID); err != nil {
+		log.Printf("⚠️ Erreur liaison commande %s → %s: %v", orderID, intent.ID, err)
+	}
+	if err := services.AttachPaymentIntent(reservationID, intent.ID); err != nil {
+		log.Printf("⚠️ Erreur liaison réservation %s → %s: %v", reservationID, intent.ID, err)
+	}
+
+	log.Printf("💳 PaymentIntent créé : %s / commande %s (%s€) pour %s", intent.ID, orderID, total, email)
 
 	c.JSON(http.StatusOK, gin.H{
-		"clientSecret": intent.ClientSecret,
-		"paymentId":    intent.ID,
+		"clientSecret":         intent.ClientSecret,
+		"paymentId":            intent.ID,
+		"orderId":              orderID.String(),
+		"reservationExpiresAt": reservation.ExpiresAt,
 	})
 }
 
@@ -91,7 +152,13 @@ func StripeWebhook(c *gin.Context) {
 	var event stripe.Event
 
 	if secret == "" {
-		log.Println("⚠️ Pas de STRIPE_WEBHOOK_SECRET — mode test")
+		// Les événements pilotent paiements, remboursements et litiges : sans secret, refus sauf mode développement explicite
+		if os.Getenv("STRIPE_WEBHOOK_UNSIGNED_ENABLED") != "true" {
+			log.Println("❌ STRIPE_WEBHOOK_SECRET non configuré, événement refusé")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhook non configuré"})
+			return
+		}
+		log.Println("⚠️ Pas de STRIPE_WEBHOOK_SECRET — événement non signé accepté (STRIPE_WEBHOOK_UNSIGNED_ENABLED)")
 		if err := json.Unmarshal(payload, &event); err != nil {
 			log.Println("❌ JSON invalide:", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "JSON invalide"})
@@ -106,189 +173,230 @@ func StripeWebhook(c *gin.Context) {
 		}
 	}
 
-	log.Printf("📥 Événement Stripe reçu : %s", event.Type)
-	handleStripeEvent(event)
+	log.Printf("📥 Événement Stripe reçu : %s (%s)", event.Type, event.ID)
+
+	// Stripe renvoie les événements tant qu'il ne reçoit pas de 2xx : chaque événement n'est traité qu'une fois
+	process, err := beginStripeEvent(event)
+	if err != nil {
+		log.Printf("❌ Erreur enregistrement événement %s: %v", event.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur enregistrement événement"})
+		return
+	}
+	if !process {
+		log.Printf("🔁 Événement %s déjà reçu, on ignore.", event.ID)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	orderID, err := handleStripeEvent(event)
+	switch {
+	case err == errEventIgnored:
+		finishStripeEvent(event.ID, EventStatusIgnored, orderID, nil)
+	case err != nil:
+		log.Printf("❌ Erreur traitement événement %s (%s): %v", event.ID, event.Type, err)
+		finishStripeEvent(event.ID, EventStatusFailed, orderID, err)
+		// Une réponse 5xx déclenche un nouvel envoi par Stripe
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur traitement événement"})
+		return
+	default:
+		finishStripeEvent(event.ID, EventStatusProcessed, orderID, nil)
+	}
 
 	c.Status(http.StatusOK)
 }
 
 // ✅ Traitement de l’événement Stripe
-func handleStripeEvent(event stripe.Event) {
-	log.Println("✅ handleStripeEvent déclenché")
-
-	if event.Type != "payment_intent.succeeded" {
+// Retourne l'ID de la commande concernée, errEventIgnored si l'événement ne nous concerne pas
+func handleStripeEvent(event stripe.Event) (*gocql.UUID, error) {
+	switch event.Type {
+	case "payment_intent.succeeded":
+		return handlePaymentSucceeded(event)
+	case "payment_intent.processing":
+		return handlePaymentProcessing(event)
+	case "payment_intent.payment_failed":
+		return handlePaymentFailed(event)
+	case "payment_intent.canceled":
+		return handlePaymentCanceled(event)
+	case "charge.refunded":
+		return handleChargeRefunded(event)
+	case "charge.dispute.created":
+		return handleDisputeCreated(event)
+	case "charge.dispute.closed":
+		return handleDisputeClosed(event)
+	default:
 		log.Printf("ℹ️ Événement ignoré : %s", event.Type)
-		return
+		return nil, errEventIgnored
 	}
+}
 
-	var pi stripe.PaymentIntent
-	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
-		log.Println("❌ Erreur décodage PaymentIntent:", err)
-		return
+// handlePaymentSucceeded valide la commande, convertit la réservation en vente et envoie la confirmation
+func handlePaymentSucceeded(event stripe.Event) (*gocql.UUID, error) {
+	pi, order, err := intentOrder(event)
+	if err != nil {
+		return nil, err
 	}
 	log.Printf("🧠 PaymentIntent reçu : %s", pi.ID)
 
-	userID := pi.Metadata["user_id"]
-	userEmail := pi.Metadata["email"]
-	cartData := pi.Metadata["cart"] // ✅ Récupère depuis Stripe
-	couponCode := pi.Metadata["coupon_code"]
-
-	if userID == "" || userEmail == "" || cartData == "" {
-		log.Println("⚠️ Métadonnées incomplètes")
-		return
+	switch order.Status {
+	case models.OrderStatusPendingPayment, models.OrderStatusPaymentProcessing, models.OrderStatusPaymentFailed:
+	case models.OrderStatusCancelled:
+		// Le stock a été libéré : le paiement est remboursé, l'événement est traité (Stripe ne doit pas le renvoyer)
+		refundLatePayment(order, pi, stripeActor(event))
+		return &order.ID, nil
+	default:
+		log.Printf("🔁 Commande %s déjà traitée (%s), on ignore.", order.ID, order.Status)
+		return &order.ID, nil
 	}
-	log.Printf("👤 User ID = %s | 📧 Email = %s", userID, userEmail)
 
-	// Vérifier si la commande existe déjà
-	session, err := database.GetOrdersSession()
-	if err != nil {
-		log.Printf("❌ Erreur session ScyllaDB: %v", err)
-		return
+	// Montant différent du total : la commande n'est pas payée, elle reste en attente d'un contrôle manuel
+	if expected := order.TotalPrice.Amount; pi.Amount != expected {
+		log.Printf("❌ Montant Stripe (%d) différent du total commande %s (%d), commande bloquée", pi.Amount, order.ID, expected)
+		flagOrder(order, stripeActor(event), "payment_amount_mismatch", map[string]interface{}{
+			"payment_intent_id": pi.ID, "amount": models.Cents(pi.Amount), "expected": order.TotalPrice,
+		})
+		return &order.ID, nil
 	}
 
-	// Vérifier si une commande avec ce payment_intent_id existe déjà
-	var existingOrderID gocql.UUID
-	err = session.Query("SELECT order_id FROM orders WHERE payment_intent_id = ? ALLOW FILTERING", pi.ID).Scan(&existingOrderID)
-	if err == nil {
-		log.Println("🔁 Commande déjà enregistrée, on ignore.")
-		return
+	payload := map[string]interface{}{"payment_intent_id": pi.ID, "amount": models.Cents(pi.Amount)}
+	if err := transitionOrder(order, models.OrderStatusPaid, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
 	}
 
-	// ✅ Désérialise le panier depuis Stripe (pas depuis Redis)
-	var cartItems []models.CartItem
-	if err := json.Unmarshal([]byte(cartData), &cartItems); err != nil {
-		log.Println("❌ Erreur JSON panier:", err)
-		return
-	}
-	log.Printf("🛒 Articles dans le panier : %d", len(cartItems))
+	log.Printf("✅ Commande %s payée", order.ID.String())
 
-	// Créer les items de commande
-	var orderItems []models.OrderItem
-	for _, item := range cartItems {
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     item.Price,
-			Name:      item.Name,
-		})
+	if err := fulfillPaidOrder(order, stripeActor(event)); err != nil {
+		log.Printf("❌ Commande %s payée, stock à régulariser: %v", order.ID, err)
 	}
 
-	// Sérialiser les items en JSON pour ScyllaDB
-	itemsJSON, err := json.Marshal(orderItems)
-	if err != nil {
-		log.Printf("❌ Erreur sérialisation items: %v", err)
-		return
+	userEmail := getUserEmail(order.UserID)
+	if userEmail == "" {
+		log.Printf("⚠️ Pas d'email pour l'utilisateur %s, confirmation non envoyée", order.UserID)
+		return &order.ID, nil
 	}
 
-	// Créer la commande
-	orderID := gocql.TimeUUID()
-	now := time.Now()
-	totalPrice := calcTotal(cartItems)
+	// Générer l'HTML, émettre la facture (numéro définitif, PDF stocké), puis envoyer l'e-mail
+	html := utils.GenerateOrderConfirmationHTML(*order, userEmail)
 
-	log.Println("📤 Insertion commande ScyllaDB...")
+	go func() {
+		var pdf []byte
+		if inv, err := services.IssueInvoice(order); err != nil {
+			log.Printf("❌ Erreur émission facture commande %s: %v", order.ID, err)
+		} else if pdf, err = services.GetInvoicePDF(inv); err != nil {
+			log.Println("❌ Erreur génération PDF :", err)
+			pdf = nil
+		}
 
-	// Insert dans orders
-	err = session.Query(`INSERT INTO orders (order_id, user_id, payment_intent_id, items, total_price, status, created_at, updated_at) 
-	                     VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		orderID, userID, pi.ID, string(itemsJSON), totalPrice, "paid", now, now).Exec()
+		if err := utils.SendConfirmationEmail(userEmail, "Confirmation de votre commande Cedra", html, pdf); err != nil {
+			log.Println("❌ Erreur envoi e-mail confirmation :", err)
+			log.Printf("❌ Détails erreur : %+v", err)
+		} else {
+			log.Println("📧 E-mail de confirmation envoyé à", userEmail)
+		}
+	}()
+
+	return &order.ID, nil
+}
+
+// refundLatePayment rembourse intégralement un paiement reçu pour une commande déjà annulée.
+// Un échec Stripe est signalé sur la commande pour un remboursement manuel.
+func refundLatePayment(order *models.Order, pi *stripe.PaymentIntent, actor models.OrderActor) {
+	payload := map[string]interface{}{"payment_intent_id": pi.ID, "amount": models.Cents(pi.Amount)}
+
+	params := &stripe.RefundParams{PaymentIntent: stripe.String(pi.ID)}
+	params.AddMetadata("order_id", order.ID.String())
+	params.SetIdempotencyKey("late-payment-" + pi.ID)
+	stripeRefund, err := refund.New(params)
 	if err != nil {
-		log.Printf("❌ Erreur insertion ScyllaDB : %v", err)
+		log.Printf("❌ Paiement %s de la commande annulée %s non remboursé (à rembourser manuellement): %v", pi.ID, order.ID, err)
+		payload["error"] = err.Error()
+		flagOrder(order, actor, "late_payment_refund_failed", payload)
 		return
 	}
 
-	// Insert dans orders_by_user pour l'index
-	err = session.Query(`INSERT INTO orders_by_user (user_id, order_id, payment_intent_id, items, total_price, status, created_at) 
-	                     VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		userID, orderID, pi.ID, string(itemsJSON), totalPrice, "paid", now).Exec()
-	if err != nil {
-		log.Printf("⚠️ Erreur insertion index orders_by_user: %v", err)
-	}
+	log.Printf("💰 Paiement %s reçu pour la commande annulée %s, remboursé (%s)", pi.ID, order.ID, stripeRefund.ID)
+	payload["stripe_refund_id"] = stripeRefund.ID
+	flagOrder(order, actor, "late_payment_refunded", payload)
+}
 
-	log.Printf("✅ Commande insérée avec ID = %s", orderID.String())
+// flagOrderPayment signale sur l'historique de la commande (sans changer son statut) un paiement à contrôler
+func flagOrder(order *models.Order, actor models.OrderActor, flag string, payload map[string]interface{}) {
+	payload["flag"] = flag
+	if _, err := services.RecordOrderEvent(order.ID, order.Status, order.Status, actor, payload); err != nil {
+		log.Printf("⚠️ Signalement %s non enregistré pour la commande %s: %v", flag, order.ID, err)
+	}
+}
 
+// fulfillPaidOrder convertit la commande payée en vente : stock, réservation, coupon et panier.
+// Si une ligne n'a pas pu être décrémentée, la réservation est conservée et l'anomalie signalée sur la commande.
+func fulfillPaidOrder(order *models.Order, actor models.OrderActor) error {
 	// ✅ Décrémenter le stock pour chaque produit
-	if err := decrementStock(orderItems); err != nil {
-		log.Printf("⚠️ Erreur décrémentation stock: %v", err)
+	failed, stockErr := decrementStock(order.Items, order.ID, order.UserID)
+	if stockErr != nil {
+		log.Printf("❌ Stock non décrémenté pour %d ligne(s) de la commande %s, réservation conservée: %v", len(failed), order.ID, stockErr)
+		flagOrder(order, actor, "stock_decrement_failed", map[string]interface{}{"items": failed, "error": stockErr.Error()})
 	} else {
 		log.Println("✅ Stock décrémenté avec succès")
+
+		// ✅ Les réservations sont converties en ventes
+		if err := services.CommitReservation(order.ID.String()); err != nil {
+			log.Printf("⚠️ Erreur clôture réservation %s: %v", order.ID, err)
+		}
 	}
 
 	// ✅ Enregistrer l'utilisation du coupon si présent
-	if couponCode != "" {
-		if err := recordCouponUsage(couponCode, userID, orderID); err != nil {
+	if order.CouponCode != "" {
+		if err := recordCouponUsage(order.CouponCode, order.UserID, order.ID); err != nil {
 			log.Printf("⚠️ Erreur enregistrement coupon: %v", err)
 		} else {
-			log.Printf("✅ Utilisation coupon enregistrée: %s", couponCode)
+			log.Printf("✅ Utilisation coupon enregistrée: %s", order.CouponCode)
 		}
 	}
 
-	// Créer l'objet order pour les fonctions utils
-	order := models.Order{
-		ID:              orderID,
-		UserID:          userID,
-		PaymentIntentID: pi.ID,
-		TotalPrice:      totalPrice,
-		Status:          "paid",
-		CreatedAt:       now,
-		Items:           orderItems,
+	// ✅ Supprimer le panier Redis APRÈS la commande (une commande issue d'un devis ne vient pas du panier)
+	if order.QuoteID == "" {
+		ctx := context.Background()
+		key := "cart:" + order.UserID
+		if err := database.RedisClient.Del(ctx, key).Err(); err == nil {
+			log.Printf("🧹 Panier supprimé Redis pour %s", order.UserID)
+		}
 	}
+	return stockErr
+}
 
-	// ✅ Supprimer le panier Redis APRÈS la commande
-	ctx := context.Background()
-	key := "cart:" + userID
-	if err := database.RedisClient.Del(ctx, key).Err(); err == nil {
-		log.Printf("🧹 Panier supprimé Redis pour %s", userID)
+// orderFromIntent retrouve la commande associée à un PaymentIntent
+func orderFromIntent(pi *stripe.PaymentIntent) (*models.Order, error) {
+	orderID := pi.Metadata["order_id"]
+	if orderID == "" {
+		return nil, fmt.Errorf("métadonnée order_id absente")
 	}
 
-	// Générer l'HTML et le PDF, puis envoyer l'e-mail
-	html := utils.GenerateOrderConfirmationHTML(order, userEmail)
-
-	pdf, err := utils.GenerateInvoicePDF(order, userEmail)
+	order, err := loadOrderByParam(orderID)
 	if err != nil {
-		log.Println("❌ Erreur génération PDF :", err)
-		pdf = nil
+		return nil, err
 	}
-
-	go func() {
-		if err := utils.SendConfirmationEmail(userEmail, "Confirmation de votre commande Cedra", html, pdf); err != nil {
-			log.Println("❌ Erreur envoi e-mail confirmation :", err)
-			log.Printf("❌ Détails erreur : %+v", err)
-		} else {
-			log.Println("📧 E-mail de confirmation envoyé à", userEmail)
-		}
-	}()
-}
-
-// decrementStock décrémente le stock des produits après un paiement réussi
-func decrementStock(orderItems []models.OrderItem) error {
-	productsSession, err := database.GetProductsSession()
-	if err != nil {
-		return err
+	if order.PaymentIntentID != "" && order.PaymentIntentID != pi.ID {
+		return nil, fmt.Errorf("la commande %s est liée à un autre paiement (%s)", orderID, order.PaymentIntentID)
 	}
+	return order, nil
+}
 
+// decrementStock décrémente le stock des produits après un paiement réussi. Toutes les lignes sont traitées :
+// retourne celles qui ont échoué et leurs erreurs réunies.
+func decrementStock(orderItems []models.OrderItem, orderID gocql.UUID, userID string) ([]models.OrderItem, error) {
+	var failed []models.OrderItem
+	var errs []error
 	for _, item := range orderItems {
-		productUUID, parseErr := uuid.Parse(item.ProductID)
-		if parseErr != nil {
-			log.Printf("⚠️ ID produit invalide: %s", item.ProductID)
+		if err := adjustStock(item, -item.Quantity, "sale", "Vente", &orderID, userID); err != nil {
+			log.Printf("❌ Erreur décrémentation stock pour %s: %v", item.ProductID, err)
+			failed = append(failed, item)
+			errs = append(errs, fmt.Errorf("%s: %w", item.ProductID, err))
 			continue
 		}
 
-		// Décrémenter le stock
-		execErr := productsSession.Query(
-			"UPDATE products SET stock = stock - ? WHERE product_id = ?",
-			item.Quantity,
-			gocql.UUID(productUUID),
-		).Exec()
-
-		if execErr != nil {
-			log.Printf("❌ Erreur décrémentation stock pour %s: %v", item.ProductID, execErr)
-			return execErr
-		}
-
 		log.Printf("📦 Stock décrémenté: %s (-%d)", item.Name, item.Quantity)
 	}
 
-	return nil
+	return failed, errors.Join(errs...)
 }
 
 // recordCouponUsage enregistre l'utilisation d'un coupon après paiement réussi
@@ -326,3 +434,34 @@ func recordCouponUsage(couponCode, userID string, orderID gocql.UUID) error {
 
 	return nil
 }
+
+// releaseCouponUsage annule l'utilisation d'un coupon enregistrée par recordCouponUsage
+func releaseCouponUsage(couponCode string, orderID gocql.UUID) error {
+	ordersSession, err := database.GetOrdersSession()
+	if err != nil {
+		return fmt.Errorf("erreur connexion base de données: %v", err)
+	}
+
+	var usageID, couponID gocql.UUID
+	err = ordersSession.Query(`SELECT id, coupon_id FROM ks_orders.coupon_usage WHERE order_id = ? LIMIT 1 ALLOW FILTERING`, orderID).
+		Scan(&usageID, &couponID)
+	if err == gocql.ErrNotFound {
+		log.Printf("ℹ️ Aucune utilisation du coupon %s pour la commande %s", couponCode, orderID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("erreur lecture usage: %v", err)
+	}
+
+	if err := ordersSession.Query(`DELETE FROM ks_orders.coupon_usage WHERE id = ?`, usageID).Exec(); err != nil {
+		return fmt.Errorf("erreur suppression usage: %v", err)
+	}
+
+	// Décrémenter le compteur d'utilisation du coupon
+	updateCountQuery := `UPDATE ks_orders.coupons SET used_count = used_count - 1 WHERE id = ?`
+	if err := ordersSession.Query(updateCountQuery, couponID).Exec(); err != nil {
+		log.Printf("⚠️ Erreur mise à jour compteur coupon: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,363 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/charge"
+	"github.com/stripe/stripe-go/v83/paymentintent"
+	"github.com/stripe/stripe-go/v83/refund"
+)
+
+// errEventIgnored signale un événement Stripe qui ne concerne aucune commande Cedra
+var errEventIgnored = errors.New("événement ignoré")
+
+// intentOrder décode le PaymentIntent d'un événement et retrouve la commande associée
+func intentOrder(event stripe.Event) (*stripe.PaymentIntent, *models.Order, error) {
+	var pi stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+		return nil, nil, fmt.Errorf("erreur décodage PaymentIntent: %v", err)
+	}
+
+	// PaymentIntent créé hors du tunnel de commande
+	if pi.Metadata["order_id"] == "" {
+		return nil, nil, errEventIgnored
+	}
+
+	order, err := orderFromIntent(&pi)
+	if err != nil {
+		return nil, nil, fmt.Errorf("commande introuvable pour %s: %v", pi.ID, err)
+	}
+	return &pi, order, nil
+}
+
+// orderForPaymentIntentID récupère le PaymentIntent chez Stripe puis la commande associée
+func orderForPaymentIntentID(paymentIntentID string) (*models.Order, error) {
+	if paymentIntentID == "" {
+		return nil, errEventIgnored
+	}
+
+	pi, err := paymentintent.Get(paymentIntentID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("PaymentIntent %s introuvable: %v", paymentIntentID, err)
+	}
+	if pi.Metadata["order_id"] == "" {
+		return nil, errEventIgnored
+	}
+
+	order, err := orderFromIntent(pi)
+	if err != nil {
+		return nil, fmt.Errorf("commande introuvable pour %s: %v", paymentIntentID, err)
+	}
+	return order, nil
+}
+
+// handlePaymentProcessing : paiement asynchrone (SEPA, Bancontact...) en cours de confirmation
+func handlePaymentProcessing(event stripe.Event) (*gocql.UUID, error) {
+	pi, order, err := intentOrder(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.OrderStatusPendingPayment && order.Status != models.OrderStatusPaymentFailed {
+		log.Printf("🔁 Commande %s en statut %s, on ignore le traitement en cours.", order.ID, order.Status)
+		return &order.ID, nil
+	}
+
+	payload := map[string]interface{}{"payment_intent_id": pi.ID}
+	if err := transitionOrder(order, models.OrderStatusPaymentProcessing, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+	}
+
+	log.Printf("⏳ Paiement en cours de traitement pour la commande %s", order.ID)
+	notifyOrderStatus(order, models.OrderStatusPaymentProcessing)
+	return &order.ID, nil
+}
+
+// handlePaymentFailed : la tentative de paiement a échoué.
+// La réservation est conservée jusqu'à son expiration pour permettre un nouvel essai.
+func handlePaymentFailed(event stripe.Event) (*gocql.UUID, error) {
+	pi, order, err := intentOrder(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.OrderStatusPendingPayment && order.Status != models.OrderStatusPaymentProcessing {
+		log.Printf("🔁 Commande %s en statut %s, on ignore l'échec de paiement.", order.ID, order.Status)
+		return &order.ID, nil
+	}
+
+	payload := map[string]interface{}{"payment_intent_id": pi.ID}
+	if pi.LastPaymentError != nil {
+		payload["error"] = pi.LastPaymentError.Msg
+	}
+
+	if err := transitionOrder(order, models.OrderStatusPaymentFailed, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+	}
+
+	log.Printf("⚠️ Paiement échoué pour la commande %s", order.ID)
+
+	notifyOrderStatus(order, models.OrderStatusPaymentFailed)
+	return &order.ID, nil
+}
+
+// handlePaymentCanceled : PaymentIntent annulé, la commande est annulée et le stock réservé libéré
+func handlePaymentCanceled(event stripe.Event) (*gocql.UUID, error) {
+	pi, order, err := intentOrder(event)
+	if err != nil {
+		return nil, err
+	}
+
+	switch order.Status {
+	case models.OrderStatusPendingPayment, models.OrderStatusPaymentProcessing, models.OrderStatusPaymentFailed:
+	default:
+		log.Printf("🔁 Commande %s en statut %s, on ignore l'annulation.", order.ID, order.Status)
+		return &order.ID, nil
+	}
+
+	previousStatus := order.Status
+	payload := map[string]interface{}{"payment_intent_id": pi.ID, "reason": string(pi.CancellationReason)}
+	if err := transitionOrder(order, models.OrderStatusCancelled, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+	}
+
+	if err := services.ReleaseReservation(order.ID.String()); err != nil {
+		log.Printf("⚠️ Erreur libération réservation %s: %v", order.ID, err)
+	} else {
+		log.Printf("🔓 Réservation %s libérée (%s)", order.ID, event.Type)
+	}
+
+	// Un panier abandonné sans tentative de paiement ne mérite pas d'email
+	if previousStatus != models.OrderStatusPendingPayment {
+		notifyOrderStatus(order, models.OrderStatusCancelled)
+	}
+	return &order.ID, nil
+}
+
+// handleChargeRefunded synchronise les remboursements Stripe (y compris ceux faits depuis le dashboard)
+func handleChargeRefunded(event stripe.Event) (*gocql.UUID, error) {
+	var ch stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+		return nil, fmt.Errorf("erreur décodage Charge: %v", err)
+	}
+	if ch.PaymentIntent == nil {
+		return nil, errEventIgnored
+	}
+
+	order, err := orderForPaymentIntentID(ch.PaymentIntent.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// ✅ Enregistrer les remboursements Stripe absents de la table refunds
+	created := false
+	params := &stripe.RefundListParams{Charge: stripe.String(ch.ID)}
+	iter := refund.List(params)
+	for iter.Next() {
+		r := iter.Refund()
+		if r.Status != stripe.RefundStatusSucceeded && r.Status != stripe.RefundStatusPending {
+			continue
+		}
+		isNew, err := syncStripeRefund(order, r)
+		if err != nil {
+			return &order.ID, err
+		}
+		created = created || isNew
+	}
+	if err := iter.Err(); err != nil {
+		return &order.ID, fmt.Errorf("erreur lecture remboursements Stripe: %v", err)
+	}
+
+	// Remboursement total fait depuis le dashboard sur une commande pas encore expédiée :
+	// les articles retournent en stock (les remboursements créés par l'API gèrent leur propre remise en stock)
+	if created && (ch.Refunded || ch.AmountRefunded >= ch.Amount) && order.Status == models.OrderStatusPaid {
+		restockOrder(order, "Remboursement", order.UserID)
+	}
+
+	payload := map[string]interface{}{
+		"charge_id":       ch.ID,
+		"amount_refunded": models.Cents(ch.AmountRefunded),
+	}
+	if err := syncOrderRefunds(order, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+	}
+	return &order.ID, nil
+}
+
+// syncStripeRefund marque comme effectué le remboursement local correspondant, ou le crée s'il est inconnu.
+// Retourne true si le remboursement n'existait pas encore en base.
+func syncStripeRefund(order *models.Order, r *stripe.Refund) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+
+	var refundID gocql.UUID
+	err = session.Query("SELECT refund_id FROM refunds WHERE stripe_refund_id = ? ALLOW FILTERING", r.ID).Scan(&refundID)
+	if err == gocql.ErrNotFound {
+		// Remboursement créé par l'API (annulation, remboursement partiel...) dont l'ID Stripe n'est pas encore enregistré
+		if localID, parseErr := gocql.ParseUUID(r.Metadata["refund_id"]); parseErr == nil {
+			refundID = localID
+			err = session.Query("SELECT refund_id FROM refunds WHERE refund_id = ?", localID).Scan(&refundID)
+		}
+	}
+	if err == nil {
+		_, err := completeRefund(refundID, r.ID)
+		return false, err
+	}
+	if err != gocql.ErrNotFound {
+		return false, err
+	}
+
+	reason := "Remboursement effectué depuis Stripe"
+	if r.Reason != "" {
+		reason += " (" + string(r.Reason) + ")"
+	}
+
+	record := &models.Refund{
+		ID:           gocql.TimeUUID(),
+		OrderID:      order.ID,
+		UserID:       order.UserID,
+		Reason:       reason,
+		Status:       models.RefundStatusCompleted,
+		RefundAmount: models.Cents(r.Amount),
+		CreatedAt:    time.Now(),
+	}
+	if err := insertRefund(record); err != nil {
+		return false, fmt.Errorf("erreur enregistrement remboursement %s: %v", r.ID, err)
+	}
+	if err := session.Query("UPDATE refunds SET stripe_refund_id = ?, updated_at = ? WHERE refund_id = ?",
+		r.ID, record.CreatedAt, record.ID).Exec(); err != nil {
+		return true, err
+	}
+
+	log.Printf("💰 Remboursement Stripe %s enregistré pour la commande %s", r.ID, order.ID)
+	issueRefundCreditNote(order, record)
+	return true, nil
+}
+
+// disputeOrder retrouve la commande d'un litige (via le PaymentIntent ou la charge contestée)
+func disputeOrder(event stripe.Event) (*stripe.Dispute, *models.Order, error) {
+	var dispute stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		return nil, nil, fmt.Errorf("erreur décodage Dispute: %v", err)
+	}
+
+	paymentIntentID := ""
+	if dispute.PaymentIntent != nil {
+		paymentIntentID = dispute.PaymentIntent.ID
+	} else if dispute.Charge != nil {
+		ch, err := charge.Get(dispute.Charge.ID, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("charge %s introuvable: %v", dispute.Charge.ID, err)
+		}
+		if ch.PaymentIntent != nil {
+			paymentIntentID = ch.PaymentIntent.ID
+		}
+	}
+
+	order, err := orderForPaymentIntentID(paymentIntentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &dispute, order, nil
+}
+
+// handleDisputeCreated : le client conteste le paiement auprès de sa banque
+func handleDisputeCreated(event stripe.Event) (*gocql.UUID, error) {
+	dispute, order, err := disputeOrder(event)
+	if err != nil {
+		return nil, err
+	}
+	if !services.CanTransitionOrder(order.Status, models.OrderStatusDisputed) {
+		log.Printf("ℹ️ Commande %s en statut %s, litige %s non appliqué", order.ID, order.Status, dispute.ID)
+		return &order.ID, nil
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return &order.ID, err
+	}
+
+	// Le statut courant est conservé pour être rétabli si le litige est gagné
+	if err := session.Query("UPDATE orders SET status_before_dispute = ? WHERE order_id = ?", order.Status, order.ID).Exec(); err != nil {
+		return &order.ID, fmt.Errorf("erreur sauvegarde statut commande %s: %v", order.ID, err)
+	}
+	payload := map[string]interface{}{"dispute_id": dispute.ID, "reason": string(dispute.Reason), "amount": models.Cents(dispute.Amount)}
+	if err := transitionOrder(order, models.OrderStatusDisputed, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+	}
+
+	log.Printf("⚖️ Litige %s ouvert sur la commande %s (%s)", dispute.ID, order.ID, dispute.Reason)
+	notifyOrderStatus(order, models.OrderStatusDisputed)
+	return &order.ID, nil
+}
+
+// handleDisputeClosed : litige gagné (statut précédent rétabli) ou perdu (fonds repris par la banque)
+func handleDisputeClosed(event stripe.Event) (*gocql.UUID, error) {
+	dispute, order, err := disputeOrder(event)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderStatusDisputed {
+		log.Printf("🔁 Commande %s en statut %s, on ignore la clôture du litige.", order.ID, order.Status)
+		return &order.ID, nil
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return &order.ID, err
+	}
+
+	var newStatus string
+	switch dispute.Status {
+	case stripe.DisputeStatusWon, stripe.DisputeStatusWarningClosed:
+		var previousStatus string
+		session.Query("SELECT status_before_dispute FROM orders WHERE order_id = ?", order.ID).Scan(&previousStatus)
+		if previousStatus == "" {
+			previousStatus = models.OrderStatusPaid
+		}
+		newStatus = previousStatus
+	case stripe.DisputeStatusLost:
+		// Les fonds sont repris : on trace la perte comme un remboursement
+		lost := &models.Refund{
+			ID:           gocql.TimeUUID(),
+			OrderID:      order.ID,
+			UserID:       order.UserID,
+			Reason:       "Litige perdu (" + string(dispute.Reason) + ")",
+			Status:       models.RefundStatusCompleted,
+			RefundAmount: models.Cents(dispute.Amount),
+			CreatedAt:    time.Now(),
+		}
+		if err := insertRefund(lost); err != nil {
+			return &order.ID, fmt.Errorf("erreur enregistrement litige perdu: %v", err)
+		}
+
+		payload := map[string]interface{}{"dispute_id": dispute.ID, "dispute_status": string(dispute.Status)}
+		if err := syncOrderRefunds(order, stripeActor(event), payload); err != nil {
+			return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+		}
+		log.Printf("⚖️ Litige %s perdu → commande %s %s", dispute.ID, order.ID, order.Status)
+		return &order.ID, nil
+	default:
+		return &order.ID, fmt.Errorf("statut de litige inattendu: %s", dispute.Status)
+	}
+
+	payload := map[string]interface{}{"dispute_id": dispute.ID, "dispute_status": string(dispute.Status)}
+	if err := transitionOrder(order, newStatus, stripeActor(event), payload); err != nil {
+		return &order.ID, fmt.Errorf("erreur mise à jour commande %s: %v", order.ID, err)
+	}
+
+	log.Printf("⚖️ Litige %s clôturé (%s) → commande %s %s", dispute.ID, dispute.Status, order.ID, newStatus)
+	notifyOrderStatus(order, newStatus)
+	return &order.ID, nil
+}
@@ -0,0 +1,605 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// =========================
+// Acheteur (compte société)
+// =========================
+
+// POST /api/quotes
+// RequestQuote transforme le panier d'un compte société en demande de devis (le panier est conservé)
+func RequestQuote(c *gin.Context) {
+	var req struct {
+		Note string `json:"note" binding:"max=2000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	companyID, err := services.UserCompanyID(userID)
+	if err != nil || companyID == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Les devis sont réservés aux comptes société"})
+		return
+	}
+
+	cartData, err := database.Redis.Get(context.Background(), "cart:"+userID).Result()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Panier vide ou introuvable"})
+		return
+	}
+	var cartItems []models.CartItem
+	if err := json.Unmarshal([]byte(cartData), &cartItems); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture panier"})
+		return
+	}
+	if len(cartItems) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Panier vide"})
+		return
+	}
+
+	// Prix actuels du client (tarif négocié compris) : point de départ de l'équipe commerciale
+	if _, _, ok := priceCartItems(c, cartItems, services.LoadPricingContext(userID)); !ok {
+		return
+	}
+
+	quote := &models.Quote{
+		CompanyID: *companyID,
+		UserID:    userID,
+		Items:     quoteItemsFromCart(cartItems),
+		BuyerNote: req.Note,
+	}
+	if err := services.CreateQuote(quote); err != nil {
+		log.Printf("❌ Erreur création devis: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création devis"})
+		return
+	}
+
+	log.Printf("📄 Demande de devis %s (%d article(s), %s€ au catalogue) par %s", quote.Number, len(quote.Items), quote.Total, userID)
+	c.JSON(http.StatusCreated, gin.H{"message": "Demande de devis enregistrée", "quote": quote})
+}
+
+// GET /api/quotes
+func ListMyQuotes(c *gin.Context) {
+	quotes, err := services.ListUserQuotes(c.GetString("user_id"))
+	if err != nil {
+		log.Printf("❌ Erreur lecture devis: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quotes": quotes, "count": len(quotes)})
+}
+
+// GET /api/quotes/:id
+func GetMyQuote(c *gin.Context) {
+	quote, ok := loadOwnQuote(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quote": quote})
+}
+
+// GET /api/quotes/:id/pdf
+func GetMyQuotePDF(c *gin.Context) {
+	quote, ok := loadOwnQuote(c)
+	if !ok {
+		return
+	}
+	if quote.Status == models.QuoteStatusRequested {
+		c.JSON(http.StatusConflict, gin.H{"error": "Le devis est en cours de préparation"})
+		return
+	}
+	respondQuotePDF(c, quote)
+}
+
+// POST /api/quotes/:id/accept
+// AcceptQuote convertit le devis envoyé en commande aux prix du devis, par le même chemin que le checkout :
+// TVA selon l'adresse de livraison, livraison recalculée, paiement par carte (Stripe) ou sur facture
+func AcceptQuote(c *gin.Context) {
+	var req struct {
+		AddressID        string `json:"address_id" binding:"required"`
+		ShippingOptionID string `json:"shipping_option_id"`
+		PaymentMethod    string `json:"payment_method"`
+		PONumber         string `json:"po_number" binding:"max=50"`
+		CostCenter       string `json:"cost_center" binding:"max=50"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+	switch req.PaymentMethod {
+	case "":
+		req.PaymentMethod = models.PaymentMethodCard
+	case models.PaymentMethodCard, models.PaymentMethodInvoice:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode de paiement invalide"})
+		return
+	}
+
+	quote, ok := loadOwnQuote(c)
+	if !ok {
+		return
+	}
+	switch quote.Status {
+	case models.QuoteStatusSent:
+	case models.QuoteStatusExpired:
+		c.JSON(http.StatusGone, gin.H{"error": "Ce devis a expiré", "valid_until": quote.ValidUntil})
+		return
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce devis ne peut pas être accepté", "status": quote.Status})
+		return
+	}
+
+	userID := quote.UserID
+	address, err := loadUserAddress(req.AddressID, userID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Adresse introuvable ou non autorisée"})
+		return
+	}
+
+	// Les produits doivent toujours exister ; les prix restent ceux du devis
+	cartItems := make([]models.CartItem, len(quote.Items))
+	for i, item := range quote.Items {
+		cartItems[i] = models.CartItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+	}
+	reservationItems, taxClasses, ok := priceCartItems(c, cartItems, services.LoadPricingContext(userID))
+	if !ok {
+		return
+	}
+	for i, item := range quote.Items {
+		cartItems[i].Name = item.Name
+		cartItems[i].Price = item.UnitPrice
+		cartItems[i].ListPrice = nil
+		cartItems[i].PriceSource = ""
+	}
+	totalPrice := calcTotal(cartItems)
+
+	shippingOption, ok := selectCheckoutShipping(c, cartItems, address, req.ShippingOptionID, totalPrice)
+	if !ok {
+		return
+	}
+
+	// Le devis est réservé avant la commande : deux acceptations simultanées ne créent pas deux commandes
+	now := time.Now()
+	quote.Status = models.QuoteStatusAccepted
+	quote.AcceptedAt = &now
+	if err := services.SaveQuote(quote, models.QuoteStatusSent); err != nil {
+		if err == services.ErrQuoteConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("❌ Erreur acceptation devis %s: %v", quote.Number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	// La commande reprend l'ID réservé par le devis : la réservation de stock éventuelle est prolongée, pas doublée
+	order := &models.Order{
+		ID:                 quote.OrderID,
+		UserID:             userID,
+		QuoteID:            quote.ID.String(),
+		Items:              orderItemsFromCart(cartItems),
+		Subtotal:           totalPrice,
+		AddressID:          req.AddressID,
+		ShippingAddress:    address,
+		ShippingOptionID:   shippingOption.ID,
+		ShippingOptionName: shippingOption.Name,
+		ShippingCost:       shippingOption.Price,
+		Status:             models.OrderStatusPendingPayment,
+		PaymentMethod:      req.PaymentMethod,
+		PONumber:           strings.TrimSpace(req.PONumber),
+		CostCenter:         strings.TrimSpace(req.CostCenter),
+		CreatedAt:          now,
+	}
+	for i := range order.Items {
+		order.Items[i].TaxClass = taxClasses[i]
+	}
+
+	if !placeOrder(c, order, reservationItems, shippingOption, c.GetString("email"), "quote-accept") {
+		reopenQuote(quote)
+		return
+	}
+	log.Printf("✅ Devis %s accepté : commande %s (%s)", quote.Number, order.ID, order.PaymentMethod)
+}
+
+// reopenQuote remet en attente un devis dont la commande n'a pas pu être créée (et sa réservation de stock)
+func reopenQuote(quote *models.Quote) {
+	quote.Status = models.QuoteStatusSent
+	quote.AcceptedAt = nil
+	if err := services.SaveQuote(quote, models.QuoteStatusAccepted); err != nil {
+		log.Printf("⚠️ Devis %s non rouvert après l'échec de la commande: %v", quote.Number, err)
+		return
+	}
+	if quote.ReserveStock {
+		if items, err := quoteReservationItems(quote); err == nil {
+			if _, err := services.ReserveQuoteStock(quote, items); err != nil {
+				log.Printf("⚠️ Réservation du devis %s non rétablie: %v", quote.Number, err)
+			}
+		}
+	}
+}
+
+// POST /api/quotes/:id/decline
+func DeclineQuote(c *gin.Context) {
+	quote, ok := loadOwnQuote(c)
+	if !ok {
+		return
+	}
+	closeQuote(c, quote, models.QuoteStatusDeclined, c.GetString("user_id"))
+}
+
+// =========================
+// Équipe commerciale
+// =========================
+
+// GET /api/admin/quotes?status=requested
+func AdminListQuotes(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.QuoteStatusRequested, models.QuoteStatusSent, models.QuoteStatusAccepted,
+		models.QuoteStatusDeclined, models.QuoteStatusCancelled, models.QuoteStatusExpired:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "statut invalide"})
+		return
+	}
+
+	quotes, err := services.ListQuotes(status)
+	if err != nil {
+		log.Printf("❌ Erreur lecture devis: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quotes": quotes, "count": len(quotes)})
+}
+
+// GET /api/admin/quotes/:id
+func AdminGetQuote(c *gin.Context) {
+	quote, ok := loadQuoteParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"quote": quote})
+}
+
+// GET /api/admin/quotes/:id/pdf
+func AdminGetQuotePDF(c *gin.Context) {
+	quote, ok := loadQuoteParam(c)
+	if !ok {
+		return
+	}
+	respondQuotePDF(c, quote)
+}
+
+// PUT /api/admin/quotes/:id
+// AdminUpdateQuote ajuste les lignes (quantités, prix consentis), la validité, les conditions et la réservation du stock.
+// Un devis déjà envoyé repasse en préparation : il doit être renvoyé pour que l'acheteur voie la nouvelle version.
+func AdminUpdateQuote(c *gin.Context) {
+	var req struct {
+		Items []struct {
+			ProductID string        `json:"productId" binding:"required"`
+			VariantID string        `json:"variant_id"`
+			Quantity  int           `json:"quantity" binding:"required,min=1"`
+			UnitPrice *models.Money `json:"unit_price"` // Prix catalogue si absent
+		} `json:"items" binding:"omitempty,dive"`
+		ValidUntil   string  `json:"valid_until"` // AAAA-MM-JJ, valable jusqu'à la fin de la journée
+		StaffNote    *string `json:"staff_note" binding:"omitempty,max=2000"`
+		ReserveStock *bool   `json:"reserve_stock"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+
+	quote, ok := loadQuoteParam(c)
+	if !ok {
+		return
+	}
+	if !quote.IsOpen() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce devis n'est plus modifiable", "status": quote.Status})
+		return
+	}
+	previousStatus := quote.Status
+
+	if len(req.Items) > 0 {
+		cartItems := make([]models.CartItem, len(req.Items))
+		for i, item := range req.Items {
+			cartItems[i] = models.CartItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+		}
+		if _, _, ok := priceCartItems(c, cartItems, services.LoadPricingContext(quote.UserID)); !ok {
+			return
+		}
+		items := quoteItemsFromCart(cartItems)
+		for i, item := range req.Items {
+			if item.UnitPrice != nil {
+				if item.UnitPrice.Amount < 0 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Prix invalide pour " + items[i].Name})
+					return
+				}
+				items[i].UnitPrice = *item.UnitPrice
+			}
+		}
+		quote.Items = items
+	}
+	if req.ValidUntil != "" {
+		day, err := time.ParseInLocation("2006-01-02", req.ValidUntil, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Date de validité invalide (AAAA-MM-JJ)"})
+			return
+		}
+		validUntil := day.AddDate(0, 0, 1).Add(-time.Second)
+		if validUntil.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "La date de validité est dépassée"})
+			return
+		}
+		quote.ValidUntil = &validUntil
+	}
+	if req.StaffNote != nil {
+		quote.StaffNote = *req.StaffNote
+	}
+	if req.ReserveStock != nil {
+		quote.ReserveStock = *req.ReserveStock
+	}
+
+	now := time.Now()
+	quote.Status = models.QuoteStatusRequested
+	quote.UpdatedAt = &now
+	quote.UpdatedBy = c.GetString("user_id")
+	if err := services.SaveQuote(quote, previousStatus); err != nil {
+		respondQuoteSaveError(c, quote, err)
+		return
+	}
+	// La réservation suit le devis envoyé : elle sera reposée au prochain envoi
+	if previousStatus == models.QuoteStatusSent {
+		services.ReleaseQuoteStock(quote)
+	}
+
+	log.Printf("📝 Devis %s modifié par %s (%s€)", quote.Number, quote.UpdatedBy, quote.Total)
+	c.JSON(http.StatusOK, gin.H{"message": "Devis mis à jour", "quote": quote})
+}
+
+// POST /api/admin/quotes/:id/send
+// SendQuote fige la version du devis, réserve le stock si demandé et envoie le PDF à l'acheteur
+func SendQuote(c *gin.Context) {
+	quote, ok := loadQuoteParam(c)
+	if !ok {
+		return
+	}
+	if quote.Status != models.QuoteStatusRequested {
+		c.JSON(http.StatusConflict, gin.H{"error": "Seul un devis en préparation peut être envoyé", "status": quote.Status})
+		return
+	}
+	if quote.ValidUntil == nil || quote.ValidUntil.Before(time.Now()) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Une date de validité future est requise"})
+		return
+	}
+	if len(quote.Items) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Le devis ne contient aucun article"})
+		return
+	}
+
+	var reservation *services.Reservation
+	if quote.ReserveStock {
+		items, err := quoteReservationItems(quote)
+		if err != nil {
+			log.Printf("❌ Erreur lecture stock devis %s: %v", quote.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture du stock"})
+			return
+		}
+		reservation, err = services.ReserveQuoteStock(quote, items)
+		if err != nil {
+			if stockErr, ok := err.(*services.InsufficientStockError); ok {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":     "Stock insuffisant pour réserver le devis",
+					"product":   stockErr.ProductID,
+					"available": stockErr.Available,
+					"requested": stockErr.Requested,
+				})
+				return
+			}
+			log.Printf("❌ Erreur réservation stock devis %s: %v", quote.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur réservation stock"})
+			return
+		}
+	}
+
+	now := time.Now()
+	quote.Status = models.QuoteStatusSent
+	quote.SentAt = &now
+	quote.UpdatedBy = c.GetString("user_id")
+	if err := services.SaveQuote(quote, models.QuoteStatusRequested); err != nil {
+		if reservation != nil {
+			services.ReleaseQuoteStock(quote)
+		}
+		respondQuoteSaveError(c, quote, err)
+		return
+	}
+
+	userEmail := getUserEmail(quote.UserID)
+	if userEmail == "" {
+		log.Printf("⚠️ Pas d'email pour l'utilisateur %s, devis %s non envoyé", quote.UserID, quote.Number)
+	} else {
+		quoteCopy := *quote
+		go func() {
+			pdf, err := services.GetQuotePDF(&quoteCopy)
+			if err != nil {
+				log.Printf("❌ Erreur génération PDF devis %s: %v", quoteCopy.Number, err)
+				return
+			}
+			if err := utils.SendQuoteEmail(userEmail, &quoteCopy, pdf); err != nil {
+				log.Printf("❌ Erreur envoi devis %s: %v", quoteCopy.Number, err)
+				return
+			}
+			log.Printf("📧 Devis %s envoyé à %s", quoteCopy.Number, userEmail)
+		}()
+	}
+
+	response := gin.H{"message": "Devis envoyé", "quote": quote}
+	if reservation != nil {
+		response["reservation_expires_at"] = reservation.ExpiresAt
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /api/admin/quotes/:id/cancel
+func CancelQuote(c *gin.Context) {
+	quote, ok := loadQuoteParam(c)
+	if !ok {
+		return
+	}
+	closeQuote(c, quote, models.QuoteStatusCancelled, c.GetString("user_id"))
+}
+
+// =========================
+// Helpers
+// =========================
+
+// closeQuote clôt un devis ouvert (refusé ou retiré) et libère sa réservation de stock
+func closeQuote(c *gin.Context, quote *models.Quote, status, actorID string) {
+	if !quote.IsOpen() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce devis est déjà clos", "status": quote.Status})
+		return
+	}
+	previousStatus := quote.Status
+	now := time.Now()
+	quote.Status = status
+	quote.UpdatedAt = &now
+	quote.UpdatedBy = actorID
+	if err := services.SaveQuote(quote, previousStatus); err != nil {
+		respondQuoteSaveError(c, quote, err)
+		return
+	}
+	services.ReleaseQuoteStock(quote)
+
+	log.Printf("📄 Devis %s clos (%s) par %s", quote.Number, status, actorID)
+	c.JSON(http.StatusOK, gin.H{"message": "Devis clos", "quote": quote})
+}
+
+// quoteItemsFromCart crée les lignes d'un devis au prix catalogue (panier déjà relu dans le catalogue)
+func quoteItemsFromCart(cartItems []models.CartItem) []models.QuoteItem {
+	items := make([]models.QuoteItem, 0, len(cartItems))
+	for _, item := range cartItems {
+		listPrice := item.Price
+		if item.ListPrice != nil {
+			listPrice = *item.ListPrice
+		}
+		items = append(items, models.QuoteItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			ListPrice: listPrice,
+			UnitPrice: item.Price,
+		})
+	}
+	return items
+}
+
+// quoteReservationItems relit le stock physique des lignes du devis pour leur réservation
+func quoteReservationItems(quote *models.Quote) ([]services.ReservationItem, error) {
+	items := make([]services.ReservationItem, 0, len(quote.Items))
+	for _, item := range quote.Items {
+		items = append(items, services.ReservationItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	return withPhysicalStock(items)
+}
+
+// withPhysicalStock complète des lignes à réserver avec le stock physique du produit ou de la variante
+func withPhysicalStock(items []services.ReservationItem) ([]services.ReservationItem, error) {
+	productsSession, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		var stock int
+		if item.VariantID != "" {
+			variantUUID, err := uuid.Parse(item.VariantID)
+			if err != nil {
+				return nil, err
+			}
+			err = productsSession.Query("SELECT stock FROM ks_products.product_variants WHERE id = ?", gocql.UUID(variantUUID)).Scan(&stock)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			productUUID, err := uuid.Parse(item.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			if err := productsSession.Query("SELECT stock FROM products WHERE product_id = ?", gocql.UUID(productUUID)).Scan(&stock); err != nil {
+				return nil, err
+			}
+		}
+		items[i].Stock = stock
+	}
+	return items, nil
+}
+
+// loadQuoteParam charge le devis désigné par :id ; en cas d'erreur la réponse est écrite
+func loadQuoteParam(c *gin.Context) (*models.Quote, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID devis invalide"})
+		return nil, false
+	}
+	quote, err := services.GetQuote(gocql.UUID(id))
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Devis introuvable"})
+			return nil, false
+		}
+		log.Printf("❌ Erreur lecture devis %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return nil, false
+	}
+	return quote, true
+}
+
+// loadOwnQuote charge le devis désigné par :id s'il a été demandé par l'utilisateur connecté
+func loadOwnQuote(c *gin.Context) (*models.Quote, bool) {
+	quote, ok := loadQuoteParam(c)
+	if !ok {
+		return nil, false
+	}
+	if quote.UserID != c.GetString("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Devis introuvable"})
+		return nil, false
+	}
+	return quote, true
+}
+
+func respondQuotePDF(c *gin.Context, quote *models.Quote) {
+	pdf, err := services.GetQuotePDF(quote)
+	if err != nil {
+		log.Printf("❌ Erreur génération PDF devis %s: %v", quote.Number, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur génération du devis"})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="devis_`+quote.Number+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+func respondQuoteSaveError(c *gin.Context, quote *models.Quote, err error) {
+	if err == services.ErrQuoteConflict {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("❌ Erreur enregistrement devis %s: %v", quote.Number, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+}
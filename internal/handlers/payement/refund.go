@@ -3,6 +3,9 @@ package pa
 import (
 	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -10,99 +13,151 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
 	"github.com/google/uuid"
-	"github.com/stripe/stripe-go/v83"
-	"github.com/stripe/stripe-go/v83/refund"
 )
 
-// RequestRefund permet à un utilisateur de demander un remboursement
-func RequestRefund(c *gin.Context) {
-	userID := c.GetString("user_id")
-	orderID := c.Param("orderId")
+// refundableStatuses liste les statuts de commande pour lesquels un remboursement peut être demandé
+var refundableStatuses = map[string]bool{
+	models.OrderStatusPaid:              true,
+	models.OrderStatusProcessing:        true,
+	models.OrderStatusPartiallyShipped:  true,
+	models.OrderStatusShipped:           true,
+	models.OrderStatusDelivered:         true,
+	models.OrderStatusPartiallyRefunded: true,
+}
 
-	var req struct {
-		Reason string `json:"reason" binding:"required,min=10,max=500"`
-	}
+// refundRequest décrit les lignes à rembourser ; sans lignes, tout ce qui reste est remboursé
+type refundRequest struct {
+	Reason          string                `json:"reason" binding:"required,min=10,max=500"`
+	Items           []services.RefundLine `json:"items" binding:"dive"`
+	IncludeShipping bool                  `json:"include_shipping"`
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
-		return
+// newRefund calcule une demande de remboursement pour la commande à partir de ses prix enregistrés
+func newRefund(order *models.Order, req refundRequest, refundType, status string) (*models.Refund, error) {
+	previous, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	orderUUID, err := uuid.Parse(orderID)
+	items, shipping, amount, err := services.ComputeRefund(order, previous, req.Items, req.IncludeShipping)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID commande invalide"})
-		return
+		return nil, err
 	}
 
-	// Vérifier que la commande existe et appartient à l'utilisateur
-	session, err := database.GetOrdersSession()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
-		return
+	r := &models.Refund{
+		ID:             gocql.TimeUUID(),
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		Type:           refundType,
+		Reason:         req.Reason,
+		Status:         status,
+		Items:          items,
+		ShippingAmount: shipping,
+		RefundAmount:   amount,
+		CreatedAt:      time.Now(),
 	}
+	if err := insertRefund(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
 
-	var orderUserID string
-	var paymentIntentID string
-	var totalPrice float64
-	var status string
+// RequestRefund permet à un utilisateur de demander le remboursement de tout ou partie d'une commande
+func RequestRefund(c *gin.Context) {
+	userID := c.GetString("user_id")
 
-	err = session.Query(`
-		SELECT user_id, payment_intent_id, total_price, status
-		FROM orders WHERE order_id = ?
-	`, gocql.UUID(orderUUID)).Scan(&orderUserID, &paymentIntentID, &totalPrice, &status)
+	var req refundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
 
+	order, err := loadOrderByParam(c.Param("orderId"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
 		return
 	}
 
-	if orderUserID != userID {
+	if order.UserID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Cette commande ne vous appartient pas"})
 		return
 	}
 
 	// Vérifier que la commande est éligible au remboursement
-	if status != "paid" && status != "shipped" {
+	if !refundableStatuses[order.Status] {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cette commande n'est pas éligible au remboursement"})
 		return
 	}
 
-	// Vérifier qu'il n'y a pas déjà une demande de remboursement
-	var existingRefundID gocql.UUID
-	err = session.Query("SELECT refund_id FROM refunds WHERE order_id = ? ALLOW FILTERING", gocql.UUID(orderUUID)).Scan(&existingRefundID)
-	if err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Une demande de remboursement existe déjà pour cette commande"})
+	// Plusieurs demandes sont possibles tant que les quantités demandées n'ont pas déjà été remboursées
+	r, err := newRefund(order, req, models.RefundTypeRefund, models.RefundStatusPending)
+	if err != nil {
+		var refundErr *services.RefundError
+		if errors.As(err, &refundErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": refundErr.Error()})
+			return
+		}
+		log.Printf("❌ Erreur création demande remboursement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création demande"})
 		return
 	}
 
-	// Créer la demande de remboursement
-	refundID := gocql.TimeUUID()
-	now := time.Now()
+	log.Printf("💰 Demande de remboursement créée: %s pour commande %s (%s€)", r.ID, order.ID, r.RefundAmount)
 
-	err = session.Query(`
-		INSERT INTO refunds (refund_id, order_id, user_id, reason, status, refund_amount, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, refundID, gocql.UUID(orderUUID), userID, req.Reason, "pending", totalPrice, now).Exec()
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Demande de remboursement créée",
+		"refund":  r,
+	})
+}
+
+// CreateOrderRefund rembourse immédiatement tout ou partie d'une commande (admin)
+func CreateOrderRefund(c *gin.Context) {
+	var req struct {
+		refundRequest
+		Restock *bool `json:"restock"` // true par défaut
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
 
+	order, err := loadOrderByParam(c.Param("id"))
 	if err != nil {
-		log.Printf("❌ Erreur création demande remboursement: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création demande"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	if !refundableStatuses[order.Status] {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cette commande n'est pas remboursable", "current_status": order.Status})
+		return
+	}
+
+	r, err := newRefund(order, req.refundRequest, models.RefundTypeRefund, models.RefundStatusApproved)
+	if err != nil {
+		var refundErr *services.RefundError
+		if errors.As(err, &refundErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": refundErr.Error()})
+			return
+		}
+		log.Printf("❌ Erreur création remboursement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création remboursement"})
 		return
 	}
 
-	log.Printf("💰 Demande de remboursement créée: %s pour commande %s", refundID, orderID)
+	restock := req.Restock == nil || *req.Restock
+	if err := executeRefund(order, r, adminActor(c), restock); err != nil {
+		log.Printf("❌ Erreur Stripe refund: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Erreur traitement remboursement Stripe", "details": err.Error(), "refund": r})
+		return
+	}
+
+	sendRefundApproved(order, r)
+	log.Printf("✅ Remboursement %s effectué sur la commande %s (%s€)", r.ID, order.ID, r.RefundAmount)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Demande de remboursement créée",
-		"refund": models.Refund{
-			ID:           refundID,
-			OrderID:      gocql.UUID(orderUUID),
-			UserID:       userID,
-			Reason:       req.Reason,
-			Status:       "pending",
-			RefundAmount: totalPrice,
-			CreatedAt:    now,
-		},
+		"message": "Remboursement effectué",
+		"refund":  r,
+		"order":   order,
 	})
 }
 
@@ -111,7 +166,8 @@ func ProcessRefund(c *gin.Context) {
 	refundID := c.Param("refundId")
 
 	var req struct {
-		Action string `json:"action" binding:"required"` // approve, reject
+		Action  string `json:"action" binding:"required"` // approve, reject
+		Restock *bool  `json:"restock"`                   // true par défaut
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -130,41 +186,26 @@ func ProcessRefund(c *gin.Context) {
 		return
 	}
 
-	session, err := database.GetOrdersSession()
+	r, err := loadRefund(gocql.UUID(refundUUID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Demande de remboursement introuvable"})
 		return
 	}
 
-	// Récupérer les infos du remboursement
-	var orderID gocql.UUID
-	var refundAmount float64
-	var refundStatus string
-
-	err = session.Query(`
-		SELECT order_id, refund_amount, status
-		FROM refunds WHERE refund_id = ?
-	`, gocql.UUID(refundUUID)).Scan(&orderID, &refundAmount, &refundStatus)
-
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Demande de remboursement introuvable"})
+	// Retour de marchandise : la validation délivre un numéro RA, le remboursement suit la réception
+	if r.IsReturn() && r.Status == models.ReturnStatusRequested {
+		processReturnRequest(c, r, req.Action)
 		return
 	}
 
-	if refundStatus != "pending" {
+	if r.Status != models.RefundStatusPending && r.Status != models.RefundStatusFailed {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cette demande a déjà été traitée"})
 		return
 	}
 
-	now := time.Now()
-
 	if req.Action == "reject" {
 		// Rejeter la demande
-		err = session.Query(`
-			UPDATE refunds SET status = ?, updated_at = ? WHERE refund_id = ?
-		`, "rejected", now, gocql.UUID(refundUUID)).Exec()
-
-		if err != nil {
+		if err := setRefundStatus(r.ID, models.RefundStatusRejected); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
 			return
 		}
@@ -173,55 +214,111 @@ func ProcessRefund(c *gin.Context) {
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Demande de remboursement rejetée",
-			"status":  "rejected",
+			"status":  models.RefundStatusRejected,
 		})
 		return
 	}
 
 	// Approuver et traiter le remboursement via Stripe
-	var paymentIntentID string
-	err = session.Query("SELECT payment_intent_id FROM orders WHERE order_id = ?", orderID).Scan(&paymentIntentID)
+	order, err := services.LoadOrder(r.OrderID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur récupération commande"})
 		return
 	}
 
-	// Créer le remboursement Stripe
-	params := &stripe.RefundParams{
-		PaymentIntent: stripe.String(paymentIntentID),
-		Amount:        stripe.Int64(int64(refundAmount * 100)),
-		Reason:        stripe.String("requested_by_customer"),
-	}
-
-	stripeRefund, err := refund.New(params)
-	if err != nil {
+	restock := req.Restock == nil || *req.Restock
+	if err := executeRefund(order, r, adminActor(c), restock); err != nil {
 		log.Printf("❌ Erreur Stripe refund: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur traitement remboursement Stripe", "details": err.Error()})
 		return
 	}
 
-	// Mettre à jour le statut
-	err = session.Query(`
-		UPDATE refunds SET status = ?, stripe_refund_id = ?, updated_at = ? WHERE refund_id = ?
-	`, "completed", stripeRefund.ID, now, gocql.UUID(refundUUID)).Exec()
+	sendRefundApproved(order, r)
+	log.Printf("✅ Remboursement traité: %s (Stripe: %s)", refundID, r.StripeRefundID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Remboursement traité avec succès",
+		"status":           r.Status,
+		"stripe_refund_id": r.StripeRefundID,
+		"amount":           r.RefundAmount,
+		"refunded_amount":  order.RefundedAmount,
+		"order_status":     order.Status,
+	})
+}
+
+// IssueRefundCreditNote émet la note de crédit d'un remboursement effectué dont l'émission a échoué (admin).
+// Idempotent : retourne la note déjà émise.
+func IssueRefundCreditNote(c *gin.Context) {
+	refundUUID, err := uuid.Parse(c.Param("refundId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID remboursement invalide"})
+		return
+	}
 
+	r, err := loadRefund(gocql.UUID(refundUUID))
 	if err != nil {
-		log.Printf("⚠️ Erreur mise à jour refund: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Remboursement introuvable"})
+		return
+	}
+	if r.Status != models.RefundStatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce remboursement n'est pas effectué", "current_status": r.Status})
+		return
 	}
 
-	// Mettre à jour le statut de la commande
-	session.Query("UPDATE orders SET status = ? WHERE order_id = ?", "refunded", orderID).Exec()
+	order, err := services.LoadOrder(r.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur récupération commande"})
+		return
+	}
 
-	log.Printf("✅ Remboursement traité: %s (Stripe: %s)", refundID, stripeRefund.ID)
+	note, err := services.IssueCreditNote(order, r)
+	if err != nil {
+		if err == services.ErrInvoiceInProgress {
+			c.JSON(http.StatusConflict, gin.H{"error": "Note de crédit en cours d'émission, réessayer dans quelques minutes"})
+			return
+		}
+		log.Printf("❌ Note de crédit du remboursement %s non émise: %v", r.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Note de crédit indisponible", "details": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":          "Remboursement traité avec succès",
-		"status":           "completed",
-		"stripe_refund_id": stripeRefund.ID,
-		"amount":           refundAmount,
+		"message":     "Note de crédit émise",
+		"credit_note": note,
 	})
 }
 
+// sendRefundApproved envoie (en asynchrone) l'email de remboursement effectué au client,
+// avec la note de crédit du remboursement en pièce jointe
+func sendRefundApproved(order *models.Order, r *models.Refund) {
+	userEmail := getUserEmail(order.UserID)
+	if userEmail == "" {
+		return
+	}
+
+	orderID, amount := order.ID.String(), r.RefundAmount
+	go func() {
+		number, pdf := refundCreditNoteAttachment(r)
+		if err := utils.SendRefundApprovedEmail(userEmail, orderID, amount, number, pdf); err != nil {
+			log.Printf("⚠️ Erreur envoi email remboursement: %v", err)
+		}
+	}()
+}
+
+// refundCreditNoteAttachment retourne le numéro et le PDF de la note de crédit du remboursement (vides si absente)
+func refundCreditNoteAttachment(r *models.Refund) (string, []byte) {
+	note, err := services.GetRefundCreditNote(r.ID)
+	if err != nil {
+		return "", nil
+	}
+	data, err := services.GetCreditNotePDF(note)
+	if err != nil {
+		log.Printf("⚠️ PDF de la note de crédit %s indisponible: %v", note.Number, err)
+		return "", nil
+	}
+	return note.Number, data
+}
+
 // GetUserRefunds récupère les demandes de remboursement d'un utilisateur
 func GetUserRefunds(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -232,20 +329,8 @@ func GetUserRefunds(c *gin.Context) {
 		return
 	}
 
-	iter := session.Query(`
-		SELECT refund_id, order_id, reason, status, refund_amount, stripe_refund_id, created_at, updated_at
-		FROM refunds WHERE user_id = ? ALLOW FILTERING
-	`, userID).Iter()
-
-	var refunds []models.Refund
-	var refund models.Refund
-
-	for iter.Scan(&refund.ID, &refund.OrderID, &refund.Reason, &refund.Status, &refund.RefundAmount, &refund.StripeRefundID, &refund.CreatedAt, &refund.UpdatedAt) {
-		refund.UserID = userID
-		refunds = append(refunds, refund)
-	}
-
-	if err := iter.Close(); err != nil {
+	refunds, err := scanRefunds(session.Query("SELECT "+refundColumns+" FROM refunds WHERE user_id = ? ALLOW FILTERING", userID).Iter())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture remboursements"})
 		return
 	}
@@ -264,19 +349,8 @@ func GetAllRefunds(c *gin.Context) {
 		return
 	}
 
-	iter := session.Query(`
-		SELECT refund_id, order_id, user_id, reason, status, refund_amount, stripe_refund_id, created_at, updated_at
-		FROM refunds
-	`).Iter()
-
-	var refunds []models.Refund
-	var refund models.Refund
-
-	for iter.Scan(&refund.ID, &refund.OrderID, &refund.UserID, &refund.Reason, &refund.Status, &refund.RefundAmount, &refund.StripeRefundID, &refund.CreatedAt, &refund.UpdatedAt) {
-		refunds = append(refunds, refund)
-	}
-
-	if err := iter.Close(); err != nil {
+	refunds, err := scanRefunds(session.Query("SELECT " + refundColumns + " FROM refunds").Iter())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture remboursements"})
 		return
 	}
@@ -0,0 +1,304 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/refund"
+)
+
+// refundColumns liste les colonnes lues par scanRefunds (table refunds)
+const refundColumns = `refund_id, order_id, user_id, type, reason, status, items, shipping_amount, refund_amount,
+	restocked, stripe_refund_id, ra_number, inspection_notes, approved_at, received_at, created_at, updated_at`
+
+// scanRefunds lit toutes les lignes d'une requête SELECT refundColumns
+func scanRefunds(iter *gocql.Iter) ([]models.Refund, error) {
+	refunds := []models.Refund{}
+	var (
+		r         models.Refund
+		itemsJSON string
+	)
+	for iter.Scan(&r.ID, &r.OrderID, &r.UserID, &r.Type, &r.Reason, &r.Status, &itemsJSON, &r.ShippingAmount, &r.RefundAmount,
+		&r.Restocked, &r.StripeRefundID, &r.RANumber, &r.InspectionNotes, &r.ApprovedAt, &r.ReceivedAt, &r.CreatedAt, &r.UpdatedAt) {
+		// Demandes antérieures aux retours
+		if r.Type == "" {
+			r.Type = models.RefundTypeRefund
+		}
+		if itemsJSON != "" {
+			if err := json.Unmarshal([]byte(itemsJSON), &r.Items); err != nil {
+				log.Printf("⚠️ Lignes illisibles pour le remboursement %s: %v", r.ID, err)
+			}
+		}
+		refunds = append(refunds, r)
+		r = models.Refund{}
+		itemsJSON = ""
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// loadRefund récupère une demande de remboursement
+func loadRefund(refundID gocql.UUID) (*models.Refund, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := scanRefunds(session.Query("SELECT "+refundColumns+" FROM refunds WHERE refund_id = ?", refundID).Iter())
+	if err != nil {
+		return nil, err
+	}
+	if len(refunds) == 0 {
+		return nil, gocql.ErrNotFound
+	}
+	return &refunds[0], nil
+}
+
+// loadOrderRefunds récupère tous les remboursements d'une commande
+func loadOrderRefunds(orderID gocql.UUID) ([]models.Refund, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+	return scanRefunds(session.Query("SELECT "+refundColumns+" FROM refunds WHERE order_id = ? ALLOW FILTERING", orderID).Iter())
+}
+
+// insertRefund enregistre une nouvelle demande de remboursement
+func insertRefund(r *models.Refund) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	itemsJSON, err := refundItemsJSON(r.Items)
+	if err != nil {
+		return err
+	}
+	if r.Type == "" {
+		r.Type = models.RefundTypeRefund
+	}
+
+	return session.Query(`
+		INSERT INTO refunds (refund_id, order_id, user_id, type, reason, status, items, shipping_amount, refund_amount, restocked, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.ID, r.OrderID, r.UserID, r.Type, r.Reason, r.Status, itemsJSON, r.ShippingAmount, r.RefundAmount, r.Restocked, r.CreatedAt).Exec()
+}
+
+// refundItemsJSON sérialise les lignes d'un remboursement (colonne items)
+func refundItemsJSON(items []models.RefundItem) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", fmt.Errorf("erreur sérialisation lignes: %v", err)
+	}
+	return string(data), nil
+}
+
+// completeRefund marque un remboursement comme effectué. Seul le premier appel est appliqué :
+// la requête API et le webhook charge.refunded peuvent arriver dans n'importe quel ordre.
+func completeRefund(refundID gocql.UUID, stripeRefundID string) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+
+	applied, err := session.Query(`UPDATE refunds SET status = ?, stripe_refund_id = ?, updated_at = ? WHERE refund_id = ? IF status != ?`,
+		models.RefundStatusCompleted, stripeRefundID, time.Now(), refundID, models.RefundStatusCompleted).
+		MapScanCAS(map[string]interface{}{})
+	return applied, err
+}
+
+// setRefundStatus met à jour le statut d'une demande (rejet, échec Stripe...)
+func setRefundStatus(refundID gocql.UUID, status string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("UPDATE refunds SET status = ?, updated_at = ? WHERE refund_id = ?", status, time.Now(), refundID).Exec()
+}
+
+// executeRefund rembourse une demande via Stripe, remet éventuellement les articles en stock,
+// puis met à jour le total remboursé et le statut de la commande
+func executeRefund(order *models.Order, r *models.Refund, actor models.OrderActor, restock bool) error {
+	if order.PaymentIntentID == "" {
+		failRefund(r)
+		return fmt.Errorf("aucun PaymentIntent associé à la commande %s", order.ID)
+	}
+
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(order.PaymentIntentID),
+		Amount:        stripe.Int64(r.RefundAmount.Amount),
+		Reason:        stripe.String("requested_by_customer"),
+	}
+	params.AddMetadata("refund_id", r.ID.String())
+	params.AddMetadata("order_id", order.ID.String())
+	// Une double validation de la même demande ne rembourse qu'une fois
+	params.SetIdempotencyKey("refund-" + r.ID.String())
+
+	stripeRefund, err := refund.New(params)
+	if err != nil {
+		failRefund(r)
+		return err
+	}
+
+	now := time.Now()
+	if _, err := completeRefund(r.ID, stripeRefund.ID); err != nil {
+		log.Printf("⚠️ Erreur mise à jour refund %s: %v", r.ID, err)
+	}
+	r.Status = models.RefundStatusCompleted
+	r.StripeRefundID = stripeRefund.ID
+	r.UpdatedAt = &now
+
+	if restock && !r.Restocked {
+		restockRefundItems(order, r, actor.ID)
+	}
+
+	payload := map[string]interface{}{"refund_id": r.ID.String(), "stripe_refund_id": stripeRefund.ID, "amount": r.RefundAmount}
+	if err := syncOrderRefunds(order, actor, payload); err != nil {
+		log.Printf("⚠️ Total remboursé non mis à jour pour %s: %v", order.ID, err)
+	}
+
+	issueRefundCreditNote(order, r)
+	return nil
+}
+
+// issueRefundCreditNote émet la note de crédit d'un remboursement effectué (l'échec n'annule pas le remboursement ;
+// l'émission est relancée par POST /api/admin/refunds/:refundId/credit-note)
+func issueRefundCreditNote(order *models.Order, r *models.Refund) {
+	if _, err := services.IssueCreditNote(order, r); err != nil {
+		log.Printf("❌ Note de crédit du remboursement %s non émise (à relancer): %v", r.ID, err)
+	}
+}
+
+// failRefund marque une demande en échec : elle reste visible et peut être relancée par un admin
+func failRefund(r *models.Refund) {
+	if err := setRefundStatus(r.ID, models.RefundStatusFailed); err != nil {
+		log.Printf("⚠️ Erreur mise à jour refund %s: %v", r.ID, err)
+	}
+	r.Status = models.RefundStatusFailed
+}
+
+// restockRefundItems remet en stock les lignes d'un remboursement (mouvement "return").
+// La remise en stock est réservée par une écriture conditionnelle : deux validations concurrentes ne la font qu'une fois.
+func restockRefundItems(order *models.Order, r *models.Refund, userID string) {
+	claimed, err := claimRefundRestock(r)
+	if err != nil {
+		log.Printf("⚠️ Remise en stock du remboursement %s non réservée: %v", r.ID, err)
+		return
+	}
+	if !claimed {
+		log.Printf("🔁 Remboursement %s déjà remis en stock", r.ID)
+		return
+	}
+
+	for _, item := range r.Items {
+		orderItem := models.OrderItem{ProductID: item.ProductID, VariantID: item.VariantID, Name: item.Name, Quantity: item.Quantity}
+		if err := adjustStock(orderItem, item.Quantity, "return", "Remboursement "+r.ID.String(), &order.ID, userID); err != nil {
+			log.Printf("⚠️ Erreur remise en stock %s: %v", item.ProductID, err)
+			continue
+		}
+		log.Printf("📦 Stock réintégré: %s (+%d)", item.Name, item.Quantity)
+	}
+}
+
+// claimRefundRestock marque le remboursement comme remis en stock s'il ne l'était pas ; false si déjà fait
+func claimRefundRestock(r *models.Refund) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+	previous := map[string]interface{}{}
+	applied, err := session.Query("UPDATE refunds SET restocked = ? WHERE refund_id = ? IF restocked = ?", true, r.ID, false).MapScanCAS(previous)
+	if err != nil {
+		return false, err
+	}
+	// Demandes antérieures à la colonne restocked (valeur nulle)
+	if !applied && previous["restocked"] == nil {
+		applied, err = session.Query("UPDATE refunds SET restocked = ? WHERE refund_id = ? IF restocked = null", true, r.ID).
+			MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			return false, err
+		}
+	}
+	if applied {
+		r.Restocked = true
+	}
+	return applied, nil
+}
+
+// markRefundRestocked indique que les articles du remboursement sont revenus en stock
+func markRefundRestocked(r *models.Refund) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return
+	}
+	if err := session.Query("UPDATE refunds SET restocked = ? WHERE refund_id = ?", true, r.ID).Exec(); err != nil {
+		log.Printf("⚠️ Erreur mise à jour refund %s: %v", r.ID, err)
+	}
+	r.Restocked = true
+}
+
+// syncOrderRefunds recalcule le total remboursé de la commande à partir des remboursements effectués
+// et la fait passer en partially_refunded ou refunded si la machine à états l'autorise
+func syncOrderRefunds(order *models.Order, actor models.OrderActor, payload map[string]interface{}) error {
+	refunds, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		return err
+	}
+
+	refunded := models.Money{}
+	for _, r := range refunds {
+		if r.Status == models.RefundStatusCompleted {
+			refunded = refunded.Add(r.RefundAmount)
+		}
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	if err := session.Query("UPDATE orders SET refunded_amount = ? WHERE order_id = ?", refunded, order.ID).Exec(); err != nil {
+		return err
+	}
+	order.RefundedAmount = refunded
+
+	if refunded.IsZero() {
+		return nil
+	}
+
+	newStatus := models.OrderStatusPartiallyRefunded
+	if services.IsFullyRefunded(order) {
+		newStatus = models.OrderStatusRefunded
+	}
+	if order.Status == newStatus && newStatus == models.OrderStatusRefunded {
+		return nil
+	}
+	// Commande annulée ou déjà remboursée : seul le total est mis à jour
+	if !services.CanTransitionOrder(order.Status, newStatus) {
+		log.Printf("ℹ️ Commande %s en statut %s, statut %s non appliqué", order.ID, order.Status, newStatus)
+		return nil
+	}
+
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	payload["refunded_amount"] = refunded
+	if err := transitionOrder(order, newStatus, actor, payload); err != nil {
+		return err
+	}
+
+	log.Printf("💰 Commande %s → %s (%s€ remboursés sur %s€)", order.ID, newStatus, refunded, order.TotalPrice)
+	notifyOrderStatus(order, newStatus)
+	return nil
+}
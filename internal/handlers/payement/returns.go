@@ -0,0 +1,387 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"cedra_back_end/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// returnableStatuses liste les statuts de commande pour lesquels un retour peut être ouvert
+var returnableStatuses = map[string]bool{
+	models.OrderStatusPartiallyShipped:  true,
+	models.OrderStatusShipped:           true,
+	models.OrderStatusDelivered:         true,
+	models.OrderStatusPartiallyRefunded: true,
+}
+
+// RequestReturn permet à un client d'ouvrir un retour pour des articles reçus
+func RequestReturn(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Reason string                `json:"reason" binding:"required,min=10,max=500"`
+		Items  []services.RefundLine `json:"items" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+
+	order, err := loadOrderByParam(c.Param("orderId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	if order.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cette commande ne vous appartient pas"})
+		return
+	}
+
+	if !returnableStatuses[order.Status] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Les articles de cette commande ne peuvent pas être retournés", "current_status": order.Status})
+		return
+	}
+
+	// Les frais de port ne sont pas remboursés lors d'un retour
+	r, err := newRefund(order, refundRequest{Reason: req.Reason, Items: req.Items}, models.RefundTypeReturn, models.ReturnStatusRequested)
+	if err != nil {
+		var refundErr *services.RefundError
+		if errors.As(err, &refundErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": refundErr.Error()})
+			return
+		}
+		log.Printf("❌ Erreur création retour: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur création retour"})
+		return
+	}
+
+	if userEmail := getUserEmail(userID); userEmail != "" {
+		orderID, items := order.ID.String(), r.Items
+		go func() {
+			if err := utils.SendReturnRequestEmail(userEmail, orderID, items); err != nil {
+				log.Printf("⚠️ Erreur envoi email retour: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("📦 Retour demandé: %s pour commande %s", r.ID, order.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Demande de retour créée",
+		"refund":  r,
+	})
+}
+
+// processReturnRequest valide (numéro RA + bon de retour) ou refuse une demande de retour (admin)
+func processReturnRequest(c *gin.Context, r *models.Refund, action string) {
+	userEmail := getUserEmail(r.UserID)
+
+	if action == "reject" {
+		if err := setRefundStatus(r.ID, models.RefundStatusRejected); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
+			return
+		}
+		if userEmail != "" {
+			orderID := r.OrderID.String()
+			go func() {
+				if err := utils.SendRefundRejectedEmail(userEmail, orderID, "Retour refusé"); err != nil {
+					log.Printf("⚠️ Erreur envoi email retour: %v", err)
+				}
+			}()
+		}
+
+		log.Printf("❌ Retour rejeté: %s", r.ID)
+		c.JSON(http.StatusOK, gin.H{"message": "Demande de retour rejetée", "status": models.RefundStatusRejected})
+		return
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	now := time.Now()
+	r.RANumber = returnAuthorizationNumber(r.ID, now)
+	r.Status = models.ReturnStatusAuthorized
+	r.ApprovedAt = &now
+	r.UpdatedAt = &now
+
+	applied, err := session.Query(`UPDATE refunds SET status = ?, ra_number = ?, approved_at = ?, updated_at = ? WHERE refund_id = ? IF status = ?`,
+		r.Status, r.RANumber, now, now, r.ID, models.ReturnStatusRequested).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		log.Printf("❌ Erreur autorisation retour %s: %v", r.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
+		return
+	}
+	if !applied {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cette demande a déjà été traitée"})
+		return
+	}
+
+	if userEmail != "" {
+		orderID, items := r.OrderID.String(), r.Items
+		go func() {
+			if err := utils.SendReturnAuthorizedEmail(userEmail, orderID, r.RANumber, r.ID.String(), items); err != nil {
+				log.Printf("⚠️ Erreur envoi email retour: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("✅ Retour autorisé: %s (%s)", r.ID, r.RANumber)
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Retour autorisé",
+		"status":    r.Status,
+		"ra_number": r.RANumber,
+		"refund":    r,
+	})
+}
+
+// returnAuthorizationNumber construit le numéro RA imprimé sur le bon de retour
+func returnAuthorizationNumber(refundID gocql.UUID, at time.Time) string {
+	return fmt.Sprintf("RA-%s-%s", at.Format("060102"), strings.ToUpper(refundID.String()[:8]))
+}
+
+// ReceiveReturn enregistre la réception et l'inspection d'un retour par l'entrepôt (admin).
+// Les articles en bon état retournent en stock et le remboursement des lignes reçues est effectué.
+func ReceiveReturn(c *gin.Context) {
+	var req struct {
+		Items []struct {
+			services.RefundLine
+			Condition string `json:"condition" binding:"omitempty,oneof=resellable damaged"`
+		} `json:"items" binding:"dive"` // Vide : tout est reçu en bon état
+		Notes string `json:"notes" binding:"max=1000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+
+	refundUUID, err := uuid.Parse(c.Param("refundId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID retour invalide"})
+		return
+	}
+
+	r, err := loadRefund(gocql.UUID(refundUUID))
+	if err != nil || !r.IsReturn() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Retour introuvable"})
+		return
+	}
+	if r.Status != models.ReturnStatusAuthorized {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce retour n'est pas en attente de réception", "current_status": r.Status})
+		return
+	}
+
+	order, err := services.LoadOrder(r.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur récupération commande"})
+		return
+	}
+
+	// Quantités reçues : jamais plus que ce qui a été autorisé
+	authorized := make(map[string]models.RefundItem)
+	for _, item := range r.Items {
+		authorized[item.ProductID+"|"+item.VariantID] = item
+	}
+
+	lines := []services.RefundLine{}
+	conditions := make(map[string]string)
+	if len(req.Items) == 0 {
+		for _, item := range r.Items {
+			lines = append(lines, services.RefundLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+		}
+	}
+	for _, item := range req.Items {
+		key := item.ProductID + "|" + item.VariantID
+		auth, ok := authorized[key]
+		if !ok || item.Quantity > auth.Quantity {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("quantité reçue invalide pour %s", item.ProductID)})
+			return
+		}
+		lines = append(lines, item.RefundLine)
+		conditions[key] = item.Condition
+	}
+
+	// Le montant est recalculé sur les quantités reçues, hors ce retour
+	previous, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture remboursements"})
+		return
+	}
+	others := make([]models.Refund, 0, len(previous))
+	for _, p := range previous {
+		if p.ID != r.ID {
+			others = append(others, p)
+		}
+	}
+
+	items, _, amount, err := services.ComputeRefund(order, others, lines, false)
+	if err != nil {
+		var refundErr *services.RefundError
+		if errors.As(err, &refundErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": refundErr.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur calcul remboursement"})
+		return
+	}
+	for i := range items {
+		items[i].Condition = conditions[items[i].ProductID+"|"+items[i].VariantID]
+		if items[i].Condition == "" {
+			items[i].Condition = models.ItemConditionResellable
+		}
+	}
+
+	now := time.Now()
+	r.Items = items
+	r.RefundAmount = amount
+	r.InspectionNotes = req.Notes
+	r.ReceivedAt = &now
+	r.UpdatedAt = &now
+	r.Status = models.ReturnStatusReceived
+	applied, err := saveReturnReception(r)
+	if err != nil {
+		log.Printf("❌ Erreur enregistrement réception retour %s: %v", r.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur mise à jour"})
+		return
+	}
+	// Une réception concurrente a déjà remis en stock et remboursé
+	if !applied {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce retour a déjà été réceptionné"})
+		return
+	}
+
+	// ✅ Mouvement "return" pour les articles revendables uniquement
+	actor := adminActor(c)
+	restocked := false
+	for _, item := range r.Items {
+		if item.Condition != models.ItemConditionResellable {
+			log.Printf("🗑️ Article %s (%d) reçu endommagé, non remis en stock", item.Name, item.Quantity)
+			continue
+		}
+		orderItem := models.OrderItem{ProductID: item.ProductID, VariantID: item.VariantID, Name: item.Name, Quantity: item.Quantity}
+		if err := adjustStock(orderItem, item.Quantity, "return", "Retour "+r.RANumber, &order.ID, actor.ID); err != nil {
+			log.Printf("⚠️ Erreur remise en stock %s: %v", item.ProductID, err)
+			continue
+		}
+		restocked = true
+	}
+	// Le drapeau ne reflète que les remises en stock effectives (rien si tout est arrivé endommagé)
+	if restocked {
+		markRefundRestocked(r)
+	}
+
+	if err := executeRefund(order, r, actor, false); err != nil {
+		log.Printf("❌ Erreur Stripe refund retour %s: %v", r.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Retour réceptionné mais remboursement Stripe échoué",
+			"details": err.Error(),
+			"refund":  r,
+		})
+		return
+	}
+
+	sendRefundApproved(order, r)
+	log.Printf("📦 Retour %s réceptionné, %s€ remboursés", r.RANumber, r.RefundAmount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Retour réceptionné et remboursé",
+		"refund":  r,
+		"order":   order,
+	})
+}
+
+// saveReturnReception enregistre les quantités reçues, leur état et le montant recalculé, uniquement si le retour
+// est encore autorisé (LWT) : applied vaut false s'il a déjà été réceptionné
+func saveReturnReception(r *models.Refund) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+
+	itemsJSON, err := refundItemsJSON(r.Items)
+	if err != nil {
+		return false, err
+	}
+
+	return session.Query(`
+		UPDATE refunds SET status = ?, items = ?, refund_amount = ?, inspection_notes = ?, received_at = ?, updated_at = ?
+		WHERE refund_id = ? IF status = ?
+	`, r.Status, itemsJSON, r.RefundAmount, r.InspectionNotes, r.ReceivedAt, r.UpdatedAt, r.ID,
+		models.ReturnStatusAuthorized).MapScanCAS(map[string]interface{}{})
+}
+
+// GetReturnSlip retourne le bon de retour imprimable (HTML) d'un retour autorisé
+func GetReturnSlip(c *gin.Context) {
+	refundUUID, err := uuid.Parse(c.Param("refundId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID retour invalide"})
+		return
+	}
+
+	r, err := loadRefund(gocql.UUID(refundUUID))
+	if err != nil || !r.IsReturn() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Retour introuvable"})
+		return
+	}
+
+	if r.UserID != c.GetString("user_id") && c.GetString("role") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Ce retour ne vous appartient pas"})
+		return
+	}
+
+	if r.RANumber == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ce retour n'a pas encore été autorisé"})
+		return
+	}
+
+	order, err := services.LoadOrder(r.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur récupération commande"})
+		return
+	}
+
+	slip, err := utils.GenerateReturnSlipHTML(*r, *order)
+	if err != nil {
+		log.Printf("❌ Erreur génération bon de retour %s: %v", r.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur génération bon de retour"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(slip))
+}
+
+// GetReturnByRA retrouve un retour à partir du numéro RA scanné sur le bon de retour (admin)
+func GetReturnByRA(c *gin.Context) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	raNumber := strings.ToUpper(strings.TrimSpace(c.Param("raNumber")))
+	refunds, err := scanRefunds(session.Query("SELECT "+refundColumns+" FROM refunds WHERE ra_number = ?", raNumber).Iter())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture retours"})
+		return
+	}
+	if len(refunds) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Retour introuvable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund": refunds[0]})
+}
@@ -0,0 +1,381 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// shippableStatuses : une commande peut être expédiée (éventuellement en plusieurs colis) une fois payée (ou facturée pour une commande sur facture)
+var shippableStatuses = map[string]bool{
+	models.OrderStatusPaid:              true,
+	models.OrderStatusInvoiced:          true,
+	models.OrderStatusProcessing:        true,
+	models.OrderStatusPartiallyShipped:  true,
+	models.OrderStatusPartiallyRefunded: true,
+}
+
+// CreateShipment crée un colis chez le transporteur pour tout ou partie des articles restant à expédier,
+// stocke l'étiquette PDF et met à jour le statut d'expédition de la commande (admin)
+func CreateShipment(c *gin.Context) {
+	var req struct {
+		Carrier     string                  `json:"carrier"`      // Défaut : transporteur de l'option choisie au checkout
+		ServiceCode string                  `json:"service_code"` // Défaut : option choisie au checkout
+		Weight      float64                 `json:"weight"`       // kg, défaut : poids des articles du colis
+		Items       []services.ShipmentLine `json:"items"`        // Défaut : tout ce qui reste à expédier
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Données invalides", "details": err.Error()})
+		return
+	}
+
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+	if !shippableStatuses[order.Status] {
+		c.JSON(http.StatusConflict, gin.H{"error": "La commande ne peut pas être expédiée", "status": order.Status})
+		return
+	}
+	if order.ShippingAddress == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Adresse de livraison manquante"})
+		return
+	}
+
+	// Lignes du colis : uniquement ce qui n'a pas encore été expédié
+	shipments, err := services.GetOrderShipments(order.ID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture envois %s: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	refunds, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture remboursements %s: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+	items, err := services.ComputeShipmentItems(order, services.QuantitiesToShip(order, shipments, refunds), req.Items)
+	if err != nil {
+		var shipmentErr *services.ShipmentError
+		if errors.As(err, &shipmentErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": shipmentErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	if req.ServiceCode == "" {
+		req.ServiceCode = order.ShippingOptionID
+	}
+	if req.Carrier == "" {
+		req.Carrier = services.CarrierForShippingOption(req.ServiceCode)
+	}
+	carrier, err := services.GetCarrier(req.Carrier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "carriers": services.CarrierCodes()})
+		return
+	}
+
+	if req.Weight <= 0 {
+		if req.Weight, err = shipmentWeight(items); err != nil {
+			log.Printf("⚠️ Poids du colis %s indisponible: %v", order.ID, err)
+		}
+	}
+
+	name, email := getUserContact(order.UserID)
+	result, err := carrier.CreateShipment(services.ShipmentRequest{
+		Reference:     order.ID.String()[:8],
+		ServiceCode:   req.ServiceCode,
+		RecipientName: name,
+		Email:         email,
+		Address:       *order.ShippingAddress,
+		Weight:        req.Weight,
+	})
+	if err != nil {
+		log.Printf("❌ Erreur création envoi %s chez %s: %v", order.ID, carrier.Code(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Le transporteur a refusé l'envoi", "details": err.Error()})
+		return
+	}
+
+	shipment := &models.Shipment{
+		ID:             gocql.TimeUUID(),
+		OrderID:        order.ID,
+		Carrier:        carrier.Code(),
+		ServiceCode:    req.ServiceCode,
+		TrackingNumber: result.TrackingNumber,
+		Status:         models.TrackingStatusLabelCreated,
+		Weight:         req.Weight,
+		Items:          items,
+		CreatedAt:      time.Now(),
+	}
+
+	shipment.LabelKey = fmt.Sprintf("labels/%s/%s.pdf", order.ID, shipment.ID)
+	if err := services.StoreDocument(shipment.LabelKey, result.Label, "application/pdf"); err != nil {
+		// L'envoi existe chez le transporteur : on le conserve, l'étiquette pourra être réimprimée chez lui
+		log.Printf("⚠️ Erreur stockage étiquette %s: %v", shipment.ID, err)
+		shipment.LabelKey = ""
+	}
+
+	if err := services.InsertShipment(shipment); err != nil {
+		log.Printf("❌ Erreur enregistrement envoi %s (suivi %s): %v", order.ID, shipment.TrackingNumber, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur enregistrement envoi"})
+		return
+	}
+
+	if err := setOrderTrackingNumber(order, shipment.TrackingNumber); err != nil {
+		log.Printf("⚠️ Erreur enregistrement numéro de suivi %s: %v", order.ID, err)
+	}
+
+	payload := map[string]interface{}{
+		"shipment_id":     shipment.ID.String(),
+		"carrier":         shipment.Carrier,
+		"tracking_number": shipment.TrackingNumber,
+	}
+	if err := syncOrderFulfillment(order, append(shipments, *shipment), refunds, adminActor(c), payload); err != nil {
+		log.Printf("⚠️ Statut d'expédition de la commande %s non mis à jour: %v", order.ID, err)
+	}
+
+	log.Printf("📦 Envoi %s créé chez %s pour la commande %s (suivi %s)", shipment.ID, shipment.Carrier, order.ID, shipment.TrackingNumber)
+
+	shipment.TrackingURL = services.TrackingURL(shipment.Carrier, shipment.TrackingNumber)
+	c.JSON(http.StatusCreated, gin.H{
+		"shipment":     shipment,
+		"order_status": order.Status,
+		"label_url":    fmt.Sprintf("/api/admin/shipments/%s/label", shipment.ID),
+	})
+}
+
+// GetOrderShipments liste les envois d'une commande et leur suivi (admin)
+func GetOrderShipments(c *gin.Context) {
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	shipments, err := services.GetOrderShipments(order.ID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture envois %s: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shipments": shipments, "total": len(shipments)})
+}
+
+// GetOrderTracking retourne le suivi des colis d'une commande à son propriétaire
+func GetOrderTracking(c *gin.Context) {
+	order, err := loadOrderByParam(c.Param("id"))
+	if err != nil || order.UserID != c.GetString("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Commande introuvable"})
+		return
+	}
+
+	shipments, err := services.GetOrderShipments(order.ID)
+	if err != nil {
+		log.Printf("❌ Erreur lecture envois %s: %v", order.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur serveur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_id":  order.ID,
+		"status":    order.Status,
+		"shipments": shipments,
+	})
+}
+
+// GetShipmentLabel renvoie l'étiquette PDF d'un envoi (admin)
+func GetShipmentLabel(c *gin.Context) {
+	shipmentUUID, err := uuid.Parse(c.Param("shipmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID envoi invalide"})
+		return
+	}
+
+	shipment, err := services.GetShipment(gocql.UUID(shipmentUUID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Envoi introuvable"})
+		return
+	}
+	if shipment.LabelKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aucune étiquette enregistrée pour cet envoi"})
+		return
+	}
+
+	label, err := services.GetDocument(shipment.LabelKey)
+	if err != nil {
+		log.Printf("❌ Erreur lecture étiquette %s: %v", shipment.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Étiquette indisponible"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=etiquette-%s.pdf", shipment.TrackingNumber))
+	c.Data(http.StatusOK, "application/pdf", label)
+}
+
+// CarrierWebhook reçoit les événements de suivi d'un transporteur : POST /api/shipping/webhooks/:carrier
+// ⚠️ Pas d'auth : chaque intégration vérifie la signature du transporteur
+func CarrierWebhook(c *gin.Context) {
+	carrier, err := services.GetCarrier(c.Param("carrier"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lecture du corps impossible"})
+		return
+	}
+
+	events, err := carrier.ParseTrackingWebhook(c.Request.Header, body)
+	if err != nil {
+		log.Printf("⚠️ Webhook %s rejeté: %v", carrier.Code(), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	processed := 0
+	for _, event := range events {
+		ok, err := applyTrackingEvent(carrier.Code(), event)
+		if err != nil {
+			// Erreur technique : le transporteur rejouera le webhook
+			log.Printf("❌ Erreur traitement suivi %s %s: %v", carrier.Code(), event.TrackingNumber, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur traitement événement"})
+			return
+		}
+		if ok {
+			processed++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": len(events), "processed": processed})
+}
+
+// applyTrackingEvent enregistre un événement de suivi et fait avancer la commande selon l'état de tous ses colis.
+// Retourne false pour un envoi inconnu ou un événement déjà reçu.
+func applyTrackingEvent(carrierCode string, event services.TrackingEvent) (bool, error) {
+	shipment, err := services.GetShipmentByTracking(carrierCode, event.TrackingNumber)
+	if err == gocql.ErrNotFound {
+		log.Printf("⚠️ Suivi %s %s: envoi inconnu", carrierCode, event.TrackingNumber)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	isNew, err := services.RecordShipmentEvent(shipment.ID, event)
+	if err != nil || !isNew {
+		return false, err
+	}
+
+	// Un colis livré le reste, même si un événement plus ancien arrive en retard
+	if shipment.Status != models.TrackingStatusDelivered {
+		if err := services.SetShipmentStatus(shipment, event.Status); err != nil {
+			return false, err
+		}
+	}
+
+	order, err := services.LoadOrder(shipment.OrderID)
+	if err != nil {
+		return false, err
+	}
+	shipments, err := services.GetOrderShipments(order.ID)
+	if err != nil {
+		return false, err
+	}
+	refunds, err := loadOrderRefunds(order.ID)
+	if err != nil {
+		return false, err
+	}
+
+	payload := map[string]interface{}{
+		"shipment_id":     shipment.ID.String(),
+		"tracking_number": event.TrackingNumber,
+		"carrier_status":  event.CarrierStatus,
+	}
+	if event.Location != "" {
+		payload["location"] = event.Location
+	}
+	actor := models.OrderActor{Type: models.ActorCarrier, ID: carrierCode}
+	return true, syncOrderFulfillment(order, shipments, refunds, actor, payload)
+}
+
+// syncOrderFulfillment fait passer la commande au statut déduit de ses colis (partially_shipped, shipped, delivered)
+// et notifie le client à chaque étape. Les transitions interdites (commande remboursée, litige...) sont ignorées.
+func syncOrderFulfillment(order *models.Order, shipments []models.Shipment, refunds []models.Refund, actor models.OrderActor, payload map[string]interface{}) error {
+	for _, status := range fulfillmentSteps(order, shipments, refunds) {
+		if err := transitionOrder(order, status, actor, payload); err != nil {
+			return err
+		}
+		log.Printf("🚚 Commande %s → %s (%s)", order.ID, status, actor.Type)
+		notifyOrderStatus(order, status)
+	}
+	return nil
+}
+
+// fulfillmentSteps liste les transitions à appliquer depuis le statut actuel de la commande
+func fulfillmentSteps(order *models.Order, shipments []models.Shipment, refunds []models.Refund) []string {
+	current := order.Status
+	var steps []string
+	for _, status := range services.FulfillmentPath(services.FulfillmentStatus(order, shipments, refunds)) {
+		if current == status || !services.CanTransitionOrder(current, status) {
+			continue
+		}
+		steps = append(steps, status)
+		current = status
+	}
+	return steps
+}
+
+// shipmentWeight calcule le poids total des articles d'un colis (kg)
+func shipmentWeight(items []models.ShipmentItem) (float64, error) {
+	cartItems := make([]models.CartItem, 0, len(items))
+	for _, item := range items {
+		cartItems = append(cartItems, models.CartItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	shippingItems, err := services.ShippingItemsFromCart(cartItems)
+	if err != nil {
+		return 0, err
+	}
+
+	var weight float64
+	for _, item := range shippingItems {
+		weight += item.Weight * float64(item.Quantity)
+	}
+	return weight, nil
+}
+
+// getUserContact récupère le nom et l'email d'un utilisateur pour l'étiquette
+func getUserContact(userID string) (string, string) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return "", ""
+	}
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return "", ""
+	}
+
+	var name, email string
+	if err := session.Query("SELECT name, email FROM users WHERE user_id = ?", gocql.UUID(uid)).Scan(&name, &email); err != nil {
+		log.Printf("⚠️ Contact introuvable pour %s: %v", userID, err)
+	}
+	return name, email
+}
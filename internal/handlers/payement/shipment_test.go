@@ -0,0 +1,96 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestFulfillmentSteps(t *testing.T) {
+	order := func(status string) *models.Order {
+		return &models.Order{
+			Status: status,
+			Items: []models.OrderItem{
+				{ProductID: "p1", Quantity: 2},
+				{ProductID: "p2", Quantity: 1},
+			},
+		}
+	}
+	shipment := func(status string, items ...models.ShipmentItem) models.Shipment {
+		return models.Shipment{Status: status, Items: items}
+	}
+	all := []models.ShipmentItem{{ProductID: "p1", Quantity: 2}, {ProductID: "p2", Quantity: 1}}
+
+	tests := []struct {
+		name      string
+		order     *models.Order
+		shipments []models.Shipment
+		want      []string
+	}{
+		{
+			name:  "aucun colis",
+			order: order(models.OrderStatusPaid),
+			want:  nil,
+		},
+		{
+			name:      "colis partiel",
+			order:     order(models.OrderStatusPaid),
+			shipments: []models.Shipment{shipment(models.TrackingStatusLabelCreated, models.ShipmentItem{ProductID: "p1", Quantity: 2})},
+			want:      []string{models.OrderStatusPartiallyShipped},
+		},
+		{
+			name:      "tout expédié",
+			order:     order(models.OrderStatusProcessing),
+			shipments: []models.Shipment{shipment(models.TrackingStatusInTransit, all...)},
+			want:      []string{models.OrderStatusShipped},
+		},
+		{
+			name:  "reste expédié après un colis partiel",
+			order: order(models.OrderStatusPartiallyShipped),
+			shipments: []models.Shipment{
+				shipment(models.TrackingStatusDelivered, models.ShipmentItem{ProductID: "p1", Quantity: 2}),
+				shipment(models.TrackingStatusLabelCreated, models.ShipmentItem{ProductID: "p2", Quantity: 1}),
+			},
+			want: []string{models.OrderStatusShipped},
+		},
+		{
+			name:      "livré sans expédition signalée",
+			order:     order(models.OrderStatusPaid),
+			shipments: []models.Shipment{shipment(models.TrackingStatusDelivered, all...)},
+			want:      []string{models.OrderStatusShipped, models.OrderStatusDelivered},
+		},
+		{
+			name:      "livré après expédition",
+			order:     order(models.OrderStatusShipped),
+			shipments: []models.Shipment{shipment(models.TrackingStatusDelivered, all...)},
+			want:      []string{models.OrderStatusDelivered},
+		},
+		{
+			name:      "ancien colis sans détail des articles",
+			order:     order(models.OrderStatusPaid),
+			shipments: []models.Shipment{shipment(models.TrackingStatusInTransit)},
+			want:      []string{models.OrderStatusShipped},
+		},
+		{
+			name:      "déjà livrée",
+			order:     order(models.OrderStatusDelivered),
+			shipments: []models.Shipment{shipment(models.TrackingStatusDelivered, all...)},
+			want:      nil,
+		},
+		{
+			name:      "commande annulée ignorée",
+			order:     order(models.OrderStatusCancelled),
+			shipments: []models.Shipment{shipment(models.TrackingStatusDelivered, all...)},
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fulfillmentSteps(tt.order, tt.shipments, nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fulfillmentSteps = %v, attendu %v", got, tt.want)
+			}
+		})
+	}
+}
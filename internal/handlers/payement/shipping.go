@@ -1,68 +1,121 @@
 package pa
 
 import (
+	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
 )
 
-// GetShippingOptions retourne les options de livraison disponibles
+// GetShippingOptions retourne les options de livraison calculées pour le panier de l'utilisateur
+// et l'adresse choisie (?address_id=...), ou à défaut un pays et un code postal (?country=BE&postal_code=1000)
 func GetShippingOptions(c *gin.Context) {
-	// Récupérer le total du panier depuis le query param
-	var cartTotal float64
-	if total := c.Query("cart_total"); total != "" {
-		if _, err := c.GetQuery("cart_total"); err {
-			// Parse le total
+	userID := c.GetString("user_id")
+
+	quote := services.ShippingQuote{
+		Country:    c.Query("country"),
+		PostalCode: c.Query("postal_code"),
+	}
+
+	if addressID := c.Query("address_id"); addressID != "" {
+		address, err := loadUserAddress(addressID, userID)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Adresse introuvable ou non autorisée"})
+			return
+		}
+		quote.Country, quote.PostalCode = address.Country, address.PostalCode
+	}
+
+	// Contenu réel du panier : poids et classes de livraison
+	cartItems, err := loadCart(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture panier"})
+		return
+	}
+	quote.GoodsTotal = calcTotal(cartItems)
+
+	// Sans panier, le montant passé en paramètre permet d'estimer les frais de port
+	if len(cartItems) == 0 {
+		if total := c.Query("cart_total"); total != "" {
 			if n, err := parseFloat(total); err == nil {
-				cartTotal = n
+				quote.GoodsTotal = models.MoneyFromFloat(n)
 			}
 		}
 	}
 
-	// Seuil de livraison gratuite
-	freeThreshold := 50.0
-	isFree := cartTotal >= freeThreshold
-
-	options := []models.ShippingOption{
-		{
-			ID:            "standard",
-			Name:          "Livraison Standard",
-			Description:   "Livraison en 5-7 jours ouvrés",
-			Price:         5.99,
-			EstimatedDays: 7,
-		},
-		{
-			ID:            "express",
-			Name:          "Livraison Express",
-			Description:   "Livraison en 2-3 jours ouvrés",
-			Price:         12.99,
-			EstimatedDays: 3,
-		},
-		{
-			ID:            "next_day",
-			Name:          "Livraison 24h",
-			Description:   "Livraison le lendemain avant 18h",
-			Price:         19.99,
-			EstimatedDays: 1,
-		},
+	quote.Items, err = services.ShippingItemsFromCart(cartItems)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calculation, err := services.QuoteShipping(quote)
+	if err != nil {
+		if errors.Is(err, services.ErrNoShippingZone) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("❌ Erreur calcul livraison: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur calcul livraison"})
+		return
+	}
+
+	c.JSON(http.StatusOK, calculation)
+}
+
+// loadCart lit le panier Redis de l'utilisateur (vide s'il n'existe pas)
+func loadCart(userID string) ([]models.CartItem, error) {
+	cartData, err := database.Redis.Get(context.Background(), "cart:"+userID).Result()
+	if err != nil {
+		return []models.CartItem{}, nil
 	}
 
-	// Si livraison gratuite, mettre le prix à 0 pour l'option standard
-	if isFree {
-		options[0].Price = 0
-		options[0].Name = "Livraison Standard Gratuite"
+	var cartItems []models.CartItem
+	if err := json.Unmarshal([]byte(cartData), &cartItems); err != nil {
+		return nil, err
 	}
+	return cartItems, nil
+}
 
-	calculation := models.ShippingCalculation{
-		Options:       options,
-		FreeThreshold: freeThreshold,
-		CartTotal:     cartTotal,
-		IsFree:        isFree,
+// loadUserAddress récupère une adresse de livraison appartenant à l'utilisateur ou partagée par sa société
+func loadUserAddress(addressID, userID string) (*models.Address, error) {
+	addressUUID, err := uuid.Parse(addressID)
+	if err != nil {
+		return nil, fmt.Errorf("ID adresse invalide")
 	}
 
-	c.JSON(http.StatusOK, calculation)
+	usersSession, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	address := models.Address{ID: gocql.UUID(addressUUID)}
+	var companyID string
+	err = usersSession.Query("SELECT user_id, company_id, street, postal_code, city, country, type FROM addresses WHERE address_id = ?", gocql.UUID(addressUUID)).
+		Scan(&address.UserID, &companyID, &address.Street, &address.PostalCode, &address.City, &address.Country, &address.Type)
+	if err != nil {
+		return nil, err
+	}
+	if companyID != "" {
+		address.CompanyID = &companyID
+	}
+	if address.UserID != userID {
+		// Adresse de livraison partagée de la société de l'utilisateur
+		userCompanyID, err := services.UserCompanyID(userID)
+		if companyID == "" || err != nil || userCompanyID == nil || userCompanyID.String() != companyID {
+			return nil, fmt.Errorf("adresse non autorisée")
+		}
+	}
+	return &address, nil
 }
 
 // Helper function
@@ -0,0 +1,196 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/paymentintent"
+)
+
+// loadStock récupère le stock physique d'un produit, ou de sa variante si variantID est fourni
+func loadStock(session *gocql.Session, productID, variantID string) (int, error) {
+	var stock int
+
+	if variantID != "" {
+		variantUUID, err := uuid.Parse(variantID)
+		if err != nil {
+			return 0, fmt.Errorf("ID variante invalide: %s", variantID)
+		}
+		var variantProductID gocql.UUID
+		err = session.Query("SELECT product_id, stock FROM ks_products.product_variants WHERE id = ?", gocql.UUID(variantUUID)).
+			Scan(&variantProductID, &stock)
+		if err != nil {
+			return 0, err
+		}
+		if variantProductID.String() != productID {
+			return 0, fmt.Errorf("la variante %s n'appartient pas au produit %s", variantID, productID)
+		}
+		return stock, nil
+	}
+
+	productUUID, err := uuid.Parse(productID)
+	if err != nil {
+		return 0, fmt.Errorf("ID produit invalide: %s", productID)
+	}
+	err = session.Query("SELECT stock FROM products WHERE product_id = ?", gocql.UUID(productUUID)).Scan(&stock)
+	return stock, err
+}
+
+// maxStockUpdateAttempts borne les relectures quand le stock change entre la lecture et l'écriture
+const maxStockUpdateAttempts = 10
+
+// adjustStock applique un delta au stock d'une ligne de commande et enregistre le mouvement de stock
+func adjustStock(item models.OrderItem, delta int, movementType, reason string, orderID *gocql.UUID, userID string) error {
+	productsSession, err := database.GetProductsSession()
+	if err != nil {
+		return err
+	}
+
+	productUUID, err := uuid.Parse(item.ProductID)
+	if err != nil {
+		return fmt.Errorf("ID produit invalide: %s", item.ProductID)
+	}
+
+	// Écriture conditionnelle (IF stock = valeur lue) : une vente, une annulation ou un retour concurrent
+	// fait échouer l'écriture, qui est recalculée sur le stock à jour
+	var prevStock, newStock int
+	now := time.Now()
+	for attempt := 0; ; attempt++ {
+		prevStock, err = loadStock(productsSession, item.ProductID, item.VariantID)
+		if err != nil {
+			return err
+		}
+
+		// Un stock négatif est enregistré tel quel : la survente reste visible (stock et mouvement) pour être régularisée
+		newStock = prevStock + delta
+		if newStock < 0 {
+			log.Printf("❌ Survente de %s: stock %d %+d = %d, à régulariser", item.ProductID, prevStock, delta, newStock)
+		}
+
+		now = time.Now()
+		var applied bool
+		if item.VariantID != "" {
+			variantUUID, _ := uuid.Parse(item.VariantID)
+			applied, err = productsSession.Query("UPDATE ks_products.product_variants SET stock = ?, updated_at = ? WHERE id = ? IF stock = ?",
+				newStock, now, gocql.UUID(variantUUID), prevStock).MapScanCAS(map[string]interface{}{})
+		} else {
+			applied, err = productsSession.Query("UPDATE products SET stock = ?, updated_at = ? WHERE product_id = ? IF stock = ?",
+				newStock, now, gocql.UUID(productUUID), prevStock).MapScanCAS(map[string]interface{}{})
+		}
+		if err != nil {
+			return err
+		}
+		if applied {
+			break
+		}
+		if attempt >= maxStockUpdateAttempts {
+			return fmt.Errorf("stock de %s modifié en parallèle, mise à jour abandonnée après %d essais", item.ProductID, attempt+1)
+		}
+	}
+
+	quantity := delta
+	if quantity < 0 {
+		quantity = -quantity
+	}
+
+	movement := models.StockMovement{
+		ID:        gocql.TimeUUID(),
+		ProductID: gocql.UUID(productUUID),
+		Type:      movementType,
+		Quantity:  quantity,
+		PrevStock: prevStock,
+		NewStock:  newStock,
+		Reason:    reason,
+		OrderID:   orderID,
+		UserID:    userID,
+		CreatedAt: now,
+	}
+
+	if err := productsSession.Query(`
+		INSERT INTO ks_products.stock_movements (
+			id, product_id, type, quantity, prev_stock, new_stock, reason, order_id, user_id, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, movement.ID, movement.ProductID, movement.Type, movement.Quantity, movement.PrevStock,
+		movement.NewStock, movement.Reason, movement.OrderID, movement.UserID, movement.CreatedAt,
+	).Exec(); err != nil {
+		log.Printf("⚠️ Erreur enregistrement mouvement stock: %v", err)
+	}
+
+	return nil
+}
+
+// restockOrder remet en stock toutes les lignes d'une commande (mouvement "return")
+func restockOrder(order *models.Order, reason, userID string) {
+	for _, item := range order.Items {
+		if err := adjustStock(item, item.Quantity, "return", reason, &order.ID, userID); err != nil {
+			log.Printf("⚠️ Erreur remise en stock %s: %v", item.ProductID, err)
+			continue
+		}
+		log.Printf("📦 Stock réintégré: %s (+%d)", item.Name, item.Quantity)
+	}
+}
+
+// StartReservationSweeper libère périodiquement les réservations expirées
+// et annule les PaymentIntents qui n'ont pas été payés à temps
+func StartReservationSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			sweepExpiredReservations()
+		}
+	}()
+	log.Printf("✅ Nettoyage des réservations de stock actif (toutes les %s)", interval)
+}
+
+func sweepExpiredReservations() {
+	ids, err := services.ExpiredReservations()
+	if err != nil {
+		log.Printf("⚠️ Erreur lecture réservations expirées: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		reservation, err := services.GetReservation(id)
+		if err == nil && reservation.PaymentIntentID != "" {
+			cancelUnpaidIntent(reservation.PaymentIntentID)
+		}
+
+		if err := services.ReleaseReservation(id); err != nil {
+			log.Printf("⚠️ Erreur libération réservation %s: %v", id, err)
+			continue
+		}
+		log.Printf("🔓 Réservation expirée libérée: %s", id)
+	}
+}
+
+// cancelUnpaidIntent annule un PaymentIntent encore en attente de paiement
+func cancelUnpaidIntent(paymentIntentID string) {
+	intent, err := paymentintent.Get(paymentIntentID, nil)
+	if err != nil {
+		log.Printf("⚠️ PaymentIntent %s introuvable: %v", paymentIntentID, err)
+		return
+	}
+
+	switch intent.Status {
+	case stripe.PaymentIntentStatusRequiresPaymentMethod,
+		stripe.PaymentIntentStatusRequiresConfirmation,
+		stripe.PaymentIntentStatusRequiresAction:
+		params := &stripe.PaymentIntentCancelParams{
+			CancellationReason: stripe.String(string(stripe.PaymentIntentCancellationReasonAbandoned)),
+		}
+		if _, err := paymentintent.Cancel(paymentIntentID, params); err != nil {
+			log.Printf("⚠️ Erreur annulation PaymentIntent %s: %v", paymentIntentID, err)
+			return
+		}
+		log.Printf("🚫 PaymentIntent %s annulé (réservation expirée)", paymentIntentID)
+	}
+}
@@ -0,0 +1,39 @@
+package pa
+
+import (
+	"cedra_back_end/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+// Sans base produits, chaque écriture échoue : toutes les lignes doivent être tentées et rapportées
+func TestDecrementStockReportsEveryFailedLine(t *testing.T) {
+	t.Setenv("SCYLLA_KS_PRODUCTS_KEYSPACE", "")
+
+	items := []models.OrderItem{
+		{ProductID: "p1", Name: "A", Quantity: 2},
+		{ProductID: "p2", VariantID: "v1", Name: "B", Quantity: 1},
+		{ProductID: "p3", Name: "C", Quantity: 4},
+	}
+	failed, err := decrementStock(items, gocql.TimeUUID(), "user")
+	if err == nil {
+		t.Fatal("decrementStock devrait échouer")
+	}
+	if len(failed) != len(items) {
+		t.Fatalf("%d ligne(s) en échec, attendu %d", len(failed), len(items))
+	}
+	for i, item := range items {
+		if failed[i].ProductID != item.ProductID || failed[i].Quantity != item.Quantity {
+			t.Errorf("ligne %d = %+v, attendu %+v", i, failed[i], item)
+		}
+		if !strings.Contains(err.Error(), item.ProductID+":") {
+			t.Errorf("erreur %q sans %s", err, item.ProductID)
+		}
+	}
+
+	if failed, err := decrementStock(nil, gocql.TimeUUID(), "user"); err != nil || len(failed) != 0 {
+		t.Errorf("decrementStock(aucune ligne) = %v, %v", failed, err)
+	}
+}
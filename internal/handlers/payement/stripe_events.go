@@ -0,0 +1,156 @@
+package pa
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
+	"github.com/stripe/stripe-go/v83"
+)
+
+// Statuts de traitement des événements Stripe
+const (
+	EventStatusProcessing = "processing"
+	EventStatusProcessed  = "processed"
+	EventStatusFailed     = "failed"
+	EventStatusIgnored    = "ignored"
+)
+
+// staleEventDelay au-delà duquel un événement resté "processing" est retraité (crash pendant le traitement)
+const staleEventDelay = 5 * time.Minute
+
+// beginStripeEvent enregistre l'événement dans stripe_events.
+// Retourne false si l'événement a déjà été traité (retry Stripe) et ne doit pas être rejoué.
+func beginStripeEvent(event stripe.Event) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(event.Data.Raw, &object)
+
+	now := time.Now()
+	existing := map[string]interface{}{}
+	applied, err := session.Query(`INSERT INTO stripe_events (event_id, type, object_id, status, attempts, payload, received_at)
+	                               VALUES (?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		event.ID, string(event.Type), object.ID, EventStatusProcessing, 1, string(event.Data.Raw), now).MapScanCAS(existing)
+	if err != nil {
+		return false, err
+	}
+	if applied {
+		return true, nil
+	}
+
+	status, _ := existing["status"].(string)
+	attempts, _ := existing["attempts"].(int)
+	receivedAt, _ := existing["received_at"].(time.Time)
+
+	switch status {
+	case EventStatusProcessed, EventStatusIgnored:
+		return false, nil
+	case EventStatusProcessing:
+		if time.Since(receivedAt) < staleEventDelay {
+			return false, nil
+		}
+	}
+
+	// Échec précédent ou traitement interrompu : nouvelle tentative
+	err = session.Query("UPDATE stripe_events SET status = ?, attempts = ?, received_at = ? WHERE event_id = ?",
+		EventStatusProcessing, attempts+1, now, event.ID).Exec()
+	return err == nil, err
+}
+
+// finishStripeEvent enregistre le résultat du traitement d'un événement
+func finishStripeEvent(eventID, status string, orderID *gocql.UUID, procErr error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		log.Printf("⚠️ Impossible d'enregistrer le résultat de l'événement %s: %v", eventID, err)
+		return
+	}
+
+	var errorMsg string
+	if procErr != nil {
+		errorMsg = procErr.Error()
+	}
+
+	if err := session.Query("UPDATE stripe_events SET status = ?, order_id = ?, error = ?, processed_at = ? WHERE event_id = ?",
+		status, orderID, errorMsg, time.Now(), eventID).Exec(); err != nil {
+		log.Printf("⚠️ Erreur mise à jour événement %s: %v", eventID, err)
+	}
+}
+
+// GetStripeEvents liste les événements Stripe reçus (admin)
+func GetStripeEvents(c *gin.Context) {
+	eventType := c.Query("type")
+	status := c.Query("status")
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	iter := session.Query(`SELECT event_id, type, object_id, order_id, status, error, attempts, received_at, processed_at
+	                       FROM stripe_events`).Iter()
+
+	events := []models.PaymentEvent{}
+	var event models.PaymentEvent
+	for iter.Scan(&event.EventID, &event.Type, &event.ObjectID, &event.OrderID, &event.Status, &event.Error,
+		&event.Attempts, &event.ReceivedAt, &event.ProcessedAt) {
+		if (eventType == "" || event.Type == eventType) && (status == "" || event.Status == status) {
+			events = append(events, event)
+		}
+		event = models.PaymentEvent{}
+		if len(events) >= limit {
+			break
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Printf("❌ Erreur lecture événements Stripe: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lecture événements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// GetStripeEvent retourne le détail d'un événement Stripe, payload compris (admin)
+func GetStripeEvent(c *gin.Context) {
+	eventID := c.Param("eventId")
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur connexion base de données"})
+		return
+	}
+
+	var event models.PaymentEvent
+	err = session.Query(`SELECT event_id, type, object_id, order_id, status, error, attempts, payload, received_at, processed_at
+	                     FROM stripe_events WHERE event_id = ?`, eventID).Scan(
+		&event.EventID, &event.Type, &event.ObjectID, &event.OrderID, &event.Status, &event.Error,
+		&event.Attempts, &event.Payload, &event.ReceivedAt, &event.ProcessedAt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Événement introuvable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
@@ -69,13 +69,18 @@ func UpdateStock(c *gin.Context) {
 
 	userID, _ := c.Get("user_id")
 
-	// Mettre à jour le stock
-	updateQuery := `UPDATE ks_products.products SET stock = ?, updated_at = ? WHERE product_id = ?`
-	if err := productsSession.Query(updateQuery, newStock, time.Now(), productID).Exec(); err != nil {
+	// Mettre à jour le stock (conditionnel : les ventes et retours écrivent aussi le stock par LWT)
+	updateQuery := `UPDATE ks_products.products SET stock = ?, updated_at = ? WHERE product_id = ? IF stock = ?`
+	applied, err := productsSession.Query(updateQuery, newStock, time.Now(), productID, currentStock).MapScanCAS(map[string]interface{}{})
+	if err != nil {
 		log.Printf("❌ Erreur mise à jour stock: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour du stock"})
 		return
 	}
+	if !applied {
+		c.JSON(http.StatusConflict, gin.H{"error": "Le stock a changé pendant la mise à jour, veuillez réessayer"})
+		return
+	}
 
 	// Enregistrer le mouvement de stock
 	movement := models.StockMovement{
@@ -272,12 +277,12 @@ func GetInventoryStats(c *gin.Context) {
 
 	// Valeur totale de l'inventaire
 	iter := productsSession.Query(`SELECT stock, price FROM ks_products.products WHERE is_active = true`).Iter()
-	var totalValue float64
+	var totalValue models.Money
 	var stock int
-	var price float64
+	var price models.Money
 
 	for iter.Scan(&stock, &price) {
-		totalValue += float64(stock) * price
+		totalValue = totalValue.Add(price.Mul(stock))
 	}
 	iter.Close()
 	stats.TotalValue = totalValue
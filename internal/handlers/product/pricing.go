@@ -0,0 +1,48 @@
+package product
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Le cache Redis garde toujours le prix catalogue : le prix propre au client (palier, tarif négocié)
+// est appliqué juste avant la réponse.
+
+// withCustomerPrices affiche les produits au prix du client connecté
+func withCustomerPrices(c *gin.Context, products []models.Product) []models.Product {
+	pricing := services.LoadPricingContext(c.GetString("user_id"))
+	if len(products) > 1 {
+		pricing.PreloadTiers()
+	}
+	pricing.ApplyProductPricing(products)
+	return products
+}
+
+// withCustomerHitPrices applique le prix du client aux résultats Elasticsearch (documents produit indexés)
+func withCustomerHitPrices(c *gin.Context, hits []map[string]interface{}) {
+	products := make([]models.Product, len(hits))
+	priced := make([]bool, len(hits))
+	for i, hit := range hits {
+		data, err := json.Marshal(hit)
+		if err == nil && json.Unmarshal(data, &products[i]) == nil {
+			priced[i] = true
+		}
+	}
+	withCustomerPrices(c, products)
+
+	for i := range hits {
+		if !priced[i] {
+			continue
+		}
+		hits[i]["price"] = products[i].Price
+		if products[i].ListPrice != nil {
+			hits[i]["list_price"] = products[i].ListPrice
+		}
+		if len(products[i].PriceTiers) > 0 {
+			hits[i]["price_tiers"] = products[i].PriceTiers
+		}
+	}
+}
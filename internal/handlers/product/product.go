@@ -30,7 +30,7 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Le champ 'name' est obligatoire"})
 		return
 	}
-	if p.Price <= 0 {
+	if p.Price.Amount <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Le prix doit être supérieur à 0"})
 		return
 	}
@@ -38,6 +38,14 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Le stock ne peut pas être négatif"})
 		return
 	}
+	if p.Weight < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Le poids ne peut pas être négatif"})
+		return
+	}
+	if !models.IsTaxClass(p.TaxClass) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Classe de TVA invalide (standard, reduced, zero)"})
+		return
+	}
 	if p.CategoryID == (gocql.UUID{}) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Le champ 'category_id' est obligatoire"})
 		return
@@ -73,11 +81,11 @@ func CreateProduct(c *gin.Context) {
 	}
 
 	// ✅ Insérer dans la table principale
-	query := `INSERT INTO products (product_id, name, description, price, stock, category_id, image_urls, tags, created_at, updated_at)
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO products (product_id, name, description, price, stock, weight, shipping_class, tax_class, category_id, image_urls, tags, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	if err := session.Query(query,
-		p.ID, p.Name, p.Description, p.Price, p.Stock,
+		p.ID, p.Name, p.Description, p.Price, p.Stock, p.Weight, p.ShippingClass, p.TaxClass,
 		p.CategoryID, p.ImageURLs, p.Tags,
 		p.CreatedAt, p.UpdatedAt,
 	).Exec(); err != nil {
@@ -137,7 +145,7 @@ func GetAllProducts(c *gin.Context) {
 				}
 				cached[i].ImageURLs = signed
 			}
-			c.JSON(http.StatusOK, cached)
+			c.JSON(http.StatusOK, withCustomerPrices(c, cached))
 			return
 		}
 	}
@@ -182,7 +190,7 @@ func GetAllProducts(c *gin.Context) {
 		database.RedisClient.Set(ctx, cacheKey, data, 30*time.Minute)
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, withCustomerPrices(c, products))
 }
 
 func SearchProducts(c *gin.Context) {
@@ -220,6 +228,8 @@ func SearchProducts(c *gin.Context) {
 			}
 		}
 
+		withCustomerHitPrices(c, results)
+
 		// ✅ Format JSON standardisé
 		c.JSON(http.StatusOK, gin.H{
 			"products": results,
@@ -276,7 +286,7 @@ func SearchProducts(c *gin.Context) {
 
 	// ✅ Format JSON standardisé
 	c.JSON(http.StatusOK, gin.H{
-		"products": products,
+		"products": withCustomerPrices(c, products),
 		"count":    len(products),
 		"source":   "scylladb",
 	})
@@ -326,7 +336,7 @@ func GetProductsByCategory(c *gin.Context) {
 				}
 				cached[i].ImageURLs = signed
 			}
-			c.JSON(http.StatusOK, cached)
+			c.JSON(http.StatusOK, withCustomerPrices(c, cached))
 			return
 		}
 	}
@@ -401,7 +411,7 @@ func GetProductsByCategory(c *gin.Context) {
 		database.RedisClient.Set(ctx, cacheKey, data, 30*time.Minute)
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, withCustomerPrices(c, products))
 }
 
 func GetBestSellers(c *gin.Context) {
@@ -425,7 +435,7 @@ func GetBestSellers(c *gin.Context) {
 				}
 				cached[i].ImageURLs = signed
 			}
-			c.JSON(http.StatusOK, cached)
+			c.JSON(http.StatusOK, withCustomerPrices(c, cached))
 			return
 		}
 	}
@@ -522,5 +532,5 @@ func GetBestSellers(c *gin.Context) {
 		database.RedisClient.Set(ctx, cacheKey, data, 1*time.Hour)
 	}
 
-	c.JSON(http.StatusOK, products)
+	c.JSON(http.StatusOK, withCustomerPrices(c, products))
 }
@@ -44,7 +44,9 @@ func GetProductFull(c *gin.Context) {
 				}
 			}
 			cached.ImageURLs = signed
-			c.JSON(http.StatusOK, cached)
+			available := services.AvailableStock(productID, "", cached.Stock)
+			cached.Available = &available
+			c.JSON(http.StatusOK, withCustomerPrices(c, []models.Product{cached})[0])
 			return
 		}
 	}
@@ -98,7 +100,11 @@ func GetProductFull(c *gin.Context) {
 		database.RedisClient.Set(ctx, cacheKey, data, 15*time.Minute)
 	}
 
-	c.JSON(http.StatusOK, product)
+	// ✅ Stock disponible = stock - réservations actives (jamais mis en cache)
+	available := services.AvailableStock(productID, "", product.Stock)
+	product.Available = &available
+
+	c.JSON(http.StatusOK, withCustomerPrices(c, []models.Product{product})[0])
 }
 
 func extractMinIOKey(url string) string {
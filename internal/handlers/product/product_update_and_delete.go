@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 
 	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
 )
 
 func UpdateProduct(c *gin.Context) {
@@ -22,12 +23,15 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	var input struct {
-		Name        *string   `json:"name"`
-		Description *string   `json:"description"`
-		Price       *float64  `json:"price"`
-		Stock       *int      `json:"stock"`
-		CategoryID  *string   `json:"category_id"`
-		Tags        *[]string `json:"tags"`
+		Name          *string   `json:"name"`
+		Description   *string   `json:"description"`
+		Price         *float64  `json:"price"`
+		Stock         *int      `json:"stock"`
+		Weight        *float64  `json:"weight"`
+		ShippingClass *string   `json:"shipping_class"`
+		TaxClass      *string   `json:"tax_class"`
+		CategoryID    *string   `json:"category_id"`
+		Tags          *[]string `json:"tags"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -54,12 +58,32 @@ func UpdateProduct(c *gin.Context) {
 	}
 	if input.Price != nil {
 		updates = append(updates, "price = ?")
-		values = append(values, *input.Price)
+		values = append(values, models.MoneyFromFloat(*input.Price))
 	}
 	if input.Stock != nil {
 		updates = append(updates, "stock = ?")
 		values = append(values, *input.Stock)
 	}
+	if input.Weight != nil {
+		if *input.Weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Le poids ne peut pas être négatif"})
+			return
+		}
+		updates = append(updates, "weight = ?")
+		values = append(values, *input.Weight)
+	}
+	if input.ShippingClass != nil {
+		updates = append(updates, "shipping_class = ?")
+		values = append(values, *input.ShippingClass)
+	}
+	if input.TaxClass != nil {
+		if !models.IsTaxClass(*input.TaxClass) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Classe de TVA invalide (standard, reduced, zero)"})
+			return
+		}
+		updates = append(updates, "tax_class = ?")
+		values = append(values, *input.TaxClass)
+	}
 	if input.CategoryID != nil {
 		catUUID, err := uuid.Parse(*input.CategoryID)
 		if err != nil {
@@ -74,22 +74,27 @@ func SearchProductsAdvanced(c *gin.Context) {
 		iter.Close()
 	}
 
+	// Filtres et tri portent sur le prix du client connecté
+	products = withCustomerPrices(c, products)
+
 	// Filtrer par prix
 	if minPrice != "" || maxPrice != "" {
-		var minPriceFloat, maxPriceFloat float64
+		var minPriceValue, maxPriceValue models.Money
 		if minPrice != "" {
-			minPriceFloat, _ = strconv.ParseFloat(minPrice, 64)
+			minPriceFloat, _ := strconv.ParseFloat(minPrice, 64)
+			minPriceValue = models.MoneyFromFloat(minPriceFloat)
 		}
 		if maxPrice != "" {
-			maxPriceFloat, _ = strconv.ParseFloat(maxPrice, 64)
+			maxPriceFloat, _ := strconv.ParseFloat(maxPrice, 64)
+			maxPriceValue = models.MoneyFromFloat(maxPriceFloat)
 		}
 
 		var filtered []models.Product
 		for _, p := range products {
-			if minPrice != "" && p.Price < minPriceFloat {
+			if minPrice != "" && p.Price.Amount < minPriceValue.Amount {
 				continue
 			}
-			if maxPrice != "" && p.Price > maxPriceFloat {
+			if maxPrice != "" && p.Price.Amount > maxPriceValue.Amount {
 				continue
 			}
 			filtered = append(filtered, p)
@@ -177,9 +182,9 @@ func GetProductFilters(c *gin.Context) {
 	}
 	categoriesIter.Close()
 
-	var minPrice, maxPrice float64
+	var minPrice, maxPrice models.Money
 	productsIter := session.Query("SELECT price FROM products").Iter()
-	var price float64
+	var price models.Money
 	first := true
 
 	for productsIter.Scan(&price) {
@@ -188,10 +193,10 @@ func GetProductFilters(c *gin.Context) {
 			maxPrice = price
 			first = false
 		} else {
-			if price < minPrice {
+			if price.Amount < minPrice.Amount {
 				minPrice = price
 			}
-			if price > maxPrice {
+			if price.Amount > maxPrice.Amount {
 				maxPrice = price
 			}
 		}
@@ -216,7 +221,7 @@ func GetProductFilters(c *gin.Context) {
 func sortByPriceAsc(products []models.Product) {
 	for i := 0; i < len(products)-1; i++ {
 		for j := i + 1; j < len(products); j++ {
-			if products[i].Price > products[j].Price {
+			if products[i].Price.Amount > products[j].Price.Amount {
 				products[i], products[j] = products[j], products[i]
 			}
 		}
@@ -226,7 +231,7 @@ func sortByPriceAsc(products []models.Product) {
 func sortByPriceDesc(products []models.Product) {
 	for i := 0; i < len(products)-1; i++ {
 		for j := i + 1; j < len(products); j++ {
-			if products[i].Price < products[j].Price {
+			if products[i].Price.Amount < products[j].Price.Amount {
 				products[i], products[j] = products[j], products[i]
 			}
 		}
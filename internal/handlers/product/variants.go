@@ -60,7 +60,7 @@ func CreateProductVariant(c *gin.Context) {
 		ID:         gocql.TimeUUID(),
 		ProductID:  productID,
 		SKU:        req.SKU,
-		Price:      req.Price,
+		Price:      models.MoneyFromFloat(req.Price),
 		Stock:      req.Stock,
 		Attributes: req.Attributes,
 		IsActive:   true,
@@ -168,7 +168,7 @@ func UpdateProductVariant(c *gin.Context) {
 
 	if req.Price != nil {
 		updates = append(updates, "price = ?")
-		values = append(values, *req.Price)
+		values = append(values, models.MoneyFromFloat(*req.Price))
 	}
 
 	if req.Stock != nil {
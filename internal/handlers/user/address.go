@@ -6,6 +6,7 @@ import (
 
 	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gocql/gocql"
@@ -19,7 +20,6 @@ import (
 // 🟢 GET /api/addresses/mine
 func ListMyAddresses(c *gin.Context) {
 	userID := c.GetString("user_id")
-	companyID := c.GetString("company_id")
 
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "non authentifié"})
@@ -65,9 +65,9 @@ func ListMyAddresses(c *gin.Context) {
 		log.Printf("⚠️ Erreur fermeture iter: %v", err)
 	}
 
-	// Si companyID est fourni, chercher aussi les adresses de la société
-	if companyID != "" {
-		iter2 := session.Query("SELECT address_id, user_id, company_id, street, postal_code, city, country, type, is_default FROM addresses WHERE company_id = ? AND type != ? ALLOW FILTERING", companyID, "billing").Iter()
+	// Employé d'une société : ajouter les adresses de livraison partagées de la société
+	if companyID, err := services.UserCompanyID(userID); err == nil && companyID != nil {
+		iter2 := session.Query("SELECT address_id, user_id, company_id, street, postal_code, city, country, type, is_default FROM addresses WHERE company_id = ? AND type != ? ALLOW FILTERING", companyID.String(), "billing").Iter()
 		for iter2.Scan(&addressID, &userIDDB, &companyIDDB, &street, &postalCode, &city, &country, &typeAddr, &isDefault) {
 			var companyIDPtr *string
 			if companyIDDB != "" {
@@ -135,8 +135,14 @@ func CreateAddress(c *gin.Context) {
 	input.UserID = userID
 	input.IsDefault = false
 
+	// Une adresse rattachée à la société est partagée avec tous ses employés : réservé à ses administrateurs
 	var companyIDStr string
-	if input.CompanyID != nil {
+	if input.CompanyID != nil && *input.CompanyID != "" {
+		companyID, err := services.UserCompanyID(userID)
+		if err != nil || companyID == nil || companyID.String() != *input.CompanyID || !c.GetBool("isCompanyAdmin") {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Seul un administrateur de la société peut partager une adresse"})
+			return
+		}
 		companyIDStr = *input.CompanyID
 	}
 
@@ -3,8 +3,10 @@ package user
 import (
 	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
@@ -40,13 +42,13 @@ func GetCartOptimized(c *gin.Context) {
 	}
 
 	// Calculer le total
-	total := 0.0
+	var total models.Money
 	for _, item := range cart {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Mul(item.Quantity))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"items": cart,
+		"items": withAvailability(cart),
 		"total": total,
 		"count": len(cart),
 	})
@@ -62,6 +64,7 @@ func AddToCartOptimized(c *gin.Context) {
 
 	var input struct {
 		ProductID string `json:"productId" binding:"required"`
+		VariantID string `json:"variantId"` // Optionnel
 		Quantity  int    `json:"quantity" binding:"required,min=1"`
 	}
 
@@ -86,22 +89,41 @@ func AddToCartOptimized(c *gin.Context) {
 	var (
 		productIDDB gocql.UUID
 		name        string
-		price       float64
+		price       models.Money
 		stock       int
 		imageURLs   []string
+		categoryID  gocql.UUID
 	)
 
 	// Requête optimisée (seulement les champs nécessaires)
-	err = session.Query(`SELECT product_id, name, price, stock, image_urls FROM products WHERE product_id = ?`, gocql.UUID(productID)).
-		Scan(&productIDDB, &name, &price, &stock, &imageURLs)
+	err = session.Query(`SELECT product_id, name, price, stock, image_urls, category_id FROM products WHERE product_id = ?`, gocql.UUID(productID)).
+		Scan(&productIDDB, &name, &price, &stock, &imageURLs, &categoryID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Produit introuvable"})
 		return
 	}
 
-	// Vérifier le stock
-	if stock < input.Quantity {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock insuffisant"})
+	// Les variantes ont leur propre stock et leur propre prix
+	if input.VariantID != "" {
+		variantID, err := uuid.Parse(input.VariantID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID variante invalide"})
+			return
+		}
+		var variantProductID gocql.UUID
+		var isActive bool
+		err = session.Query(`SELECT product_id, price, stock, is_active FROM ks_products.product_variants WHERE id = ?`, gocql.UUID(variantID)).
+			Scan(&variantProductID, &price, &stock, &isActive)
+		if err != nil || !isActive || variantProductID != productIDDB {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variante introuvable"})
+			return
+		}
+	}
+
+	// Vérifier le stock disponible (stock moins les réservations en cours de paiement)
+	available := services.AvailableStock(input.ProductID, input.VariantID, stock)
+	if available < input.Quantity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock insuffisant", "available": available})
 		return
 	}
 
@@ -112,6 +134,7 @@ func AddToCartOptimized(c *gin.Context) {
 
 	item := models.CartItem{
 		ProductID: input.ProductID,
+		VariantID: input.VariantID,
 		Name:      name,
 		Price:     price,
 		Quantity:  input.Quantity,
@@ -134,23 +157,27 @@ func AddToCartOptimized(c *gin.Context) {
 	}
 
 	// Mettre à jour ou ajouter l'item
-	found := false
+	line := -1
 	for i := range cart {
-		if cart[i].ProductID == item.ProductID {
+		if cart[i].ProductID == item.ProductID && cart[i].VariantID == item.VariantID {
 			newQuantity := cart[i].Quantity + item.Quantity
-			if newQuantity > stock {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Stock insuffisant pour cette quantité"})
+			if newQuantity > available {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Stock insuffisant pour cette quantité", "available": available})
 				return
 			}
 			cart[i].Quantity = newQuantity
-			found = true
+			line = i
 			break
 		}
 	}
-	if !found {
+	if line < 0 {
 		cart = append(cart, item)
+		line = len(cart) - 1
 	}
 
+	// Prix du client pour la quantité totale de la ligne (palier de quantité, tarif négocié)
+	services.LoadPricingContext(userID).PriceCartItem(&cart[line], categoryID.String(), price)
+
 	// Sauvegarder avec pipeline
 	jsonData, _ := json.Marshal(cart)
 	pipe = database.Redis.Pipeline()
@@ -159,14 +186,14 @@ func AddToCartOptimized(c *gin.Context) {
 	pipe.Exec(ctx)
 
 	// Calculer le total
-	total := 0.0
+	var total models.Money
 	for _, item := range cart {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Mul(item.Quantity))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Produit ajouté au panier",
-		"items":   cart,
+		"items":   withAvailability(cart),
 		"total":   total,
 		"count":   len(cart),
 	})
@@ -181,6 +208,7 @@ func UpdateCartQuantityOptimized(c *gin.Context) {
 	}
 
 	productID := c.Param("productId")
+	variantID := c.Query("variant_id")
 
 	var input struct {
 		Quantity int `json:"quantity" binding:"required,min=0"` // 0 = supprimer
@@ -211,10 +239,16 @@ func UpdateCartQuantityOptimized(c *gin.Context) {
 	newCart := []models.CartItem{}
 	found := false
 	for i := range cart {
-		if cart[i].ProductID == productID {
+		if cart[i].ProductID == productID && cart[i].VariantID == variantID {
 			found = true
 			if input.Quantity > 0 {
 				cart[i].Quantity = input.Quantity
+				// La nouvelle quantité peut atteindre ou quitter un palier de prix
+				if price, categoryID, err := services.CatalogPrice(productID, variantID); err == nil {
+					services.LoadPricingContext(userID).PriceCartItem(&cart[i], categoryID, price)
+				} else {
+					log.Printf("⚠️ Prix du produit %s non recalculé: %v", productID, err)
+				}
 				newCart = append(newCart, cart[i])
 			}
 			// Si quantity = 0, on ne l'ajoute pas (suppression)
@@ -240,14 +274,14 @@ func UpdateCartQuantityOptimized(c *gin.Context) {
 	pipe.Exec(ctx)
 
 	// Calculer le total
-	total := 0.0
+	var total models.Money
 	for _, item := range newCart {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Mul(item.Quantity))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Quantité mise à jour",
-		"items":   newCart,
+		"items":   withAvailability(newCart),
 		"total":   total,
 		"count":   len(newCart),
 	})
@@ -262,6 +296,7 @@ func RemoveFromCartOptimized(c *gin.Context) {
 	}
 
 	productID := c.Param("productId")
+	variantID := c.Query("variant_id")
 	ctx := context.Background()
 	key := "cart:" + userID
 
@@ -282,7 +317,7 @@ func RemoveFromCartOptimized(c *gin.Context) {
 	newCart := []models.CartItem{}
 	found := false
 	for _, item := range cart {
-		if item.ProductID != productID {
+		if item.ProductID != productID || item.VariantID != variantID {
 			newCart = append(newCart, item)
 		} else {
 			found = true
@@ -306,14 +341,14 @@ func RemoveFromCartOptimized(c *gin.Context) {
 	pipe.Exec(ctx)
 
 	// Calculer le total
-	total := 0.0
+	var total models.Money
 	for _, item := range newCart {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Mul(item.Quantity))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Produit supprimé du panier",
-		"items":   newCart,
+		"items":   withAvailability(newCart),
 		"total":   total,
 		"count":   len(newCart),
 	})
@@ -374,15 +409,57 @@ func SyncCart(c *gin.Context) {
 	}
 
 	// Calculer le total
-	total := 0.0
+	var total models.Money
 	for _, item := range cart {
-		total += item.Price * float64(item.Quantity)
+		total = total.Add(item.Price.Mul(item.Quantity))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"items":  cart,
+		"items":  withAvailability(cart),
 		"total":  total,
 		"count":  len(cart),
 		"synced": true,
 	})
 }
+
+// withAvailability renseigne le stock disponible (stock moins réservations) de chaque ligne.
+// Le champ n'est jamais persisté dans Redis : il est recalculé à chaque lecture.
+func withAvailability(cart []models.CartItem) []models.CartItem {
+	if len(cart) == 0 {
+		return cart
+	}
+
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return cart
+	}
+
+	result := make([]models.CartItem, len(cart))
+	for i, item := range cart {
+		result[i] = item
+
+		var stock int
+		if item.VariantID != "" {
+			variantID, err := uuid.Parse(item.VariantID)
+			if err != nil {
+				continue
+			}
+			err = session.Query(`SELECT stock FROM ks_products.product_variants WHERE id = ?`, gocql.UUID(variantID)).Scan(&stock)
+			if err != nil {
+				continue
+			}
+		} else {
+			productID, err := uuid.Parse(item.ProductID)
+			if err != nil {
+				continue
+			}
+			if err := session.Query(`SELECT stock FROM products WHERE product_id = ?`, gocql.UUID(productID)).Scan(&stock); err != nil {
+				continue
+			}
+		}
+
+		available := services.AvailableStock(item.ProductID, item.VariantID, stock)
+		result[i].Available = &available
+	}
+	return result
+}
@@ -73,9 +73,9 @@ func CartWebSocket(c *gin.Context) {
 					var cart []models.CartItem
 					json.Unmarshal([]byte(data), &cart)
 
-					total := 0.0
+					var total models.Money
 					for _, item := range cart {
-						total += item.Price * float64(item.Quantity)
+						total = total.Add(item.Price.Mul(item.Quantity))
 					}
 
 					response = map[string]interface{}{
@@ -4,6 +4,7 @@ import (
 	"cedra_back_end/internal/cache"
 	"cedra_back_end/internal/database"
 	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/services"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -36,7 +37,7 @@ func GetMyOrders(c *gin.Context) {
 		orderID         gocql.UUID
 		paymentIntentID string
 		itemsJSON       string
-		totalPrice      float64
+		totalPrice      models.Money
 		status          string
 		createdAt       time.Time
 		updatedAt       *time.Time
@@ -120,7 +121,7 @@ func GetOrderByID(c *gin.Context) {
 
 	// Vérifier que la commande appartient à l'utilisateur
 	var userIDDB, paymentIntentID, itemsJSON string
-	var totalPrice float64
+	var totalPrice models.Money
 	var status string
 	var createdAt time.Time
 	var updatedAt *time.Time
@@ -148,5 +149,46 @@ func GetOrderByID(c *gin.Context) {
 		UpdatedAt:       updatedAt,
 	}
 
+	// Détails complets (montants, coupon, adresse de livraison) depuis la table orders
+	var addressJSON, taxJSON string
+	err = session.Query(`SELECT subtotal, discount_amount, coupon_code, address_id, shipping_address, shipping_option_id, shipping_option_name, shipping_cost,
+		tax_amount, tax_details, tracking_number, refunded_amount, payment_method, quote_id, company_id, po_number, cost_center FROM orders WHERE order_id = ?`, gocql.UUID(orderUUID)).Scan(
+		&order.Subtotal, &order.DiscountAmount, &order.CouponCode, &order.AddressID, &addressJSON, &order.ShippingOptionID, &order.ShippingOptionName,
+		&order.ShippingCost, &order.TaxAmount, &taxJSON, &order.TrackingNumber, &order.RefundedAmount, &order.PaymentMethod, &order.QuoteID, &order.CompanyID, &order.PONumber, &order.CostCenter)
+	if err != nil {
+		log.Printf("⚠️ Détails commande %s indisponibles: %v", orderID, err)
+	} else {
+		if order.PaymentMethod == "" {
+			order.PaymentMethod = models.PaymentMethodCard
+		}
+		if addressJSON != "" {
+			var address models.Address
+			if json.Unmarshal([]byte(addressJSON), &address) == nil {
+				order.ShippingAddress = &address
+			}
+		}
+		// Détail de la TVA (lignes, taux, mention d'autoliquidation)
+		if taxJSON != "" {
+			var tax models.TaxSummary
+			if json.Unmarshal([]byte(taxJSON), &tax) == nil {
+				order.Tax = &tax
+			}
+		}
+	}
+
+	// Historique des statuts
+	if history, err := services.GetOrderEvents(order.ID); err == nil {
+		order.History = history
+	} else {
+		log.Printf("⚠️ Historique commande %s indisponible: %v", orderID, err)
+	}
+
+	// Colis expédiés et leur suivi (une commande peut partir en plusieurs colis)
+	if shipments, err := services.GetOrderShipments(order.ID); err == nil {
+		order.Shipments = shipments
+	} else {
+		log.Printf("⚠️ Colis commande %s indisponibles: %v", orderID, err)
+	}
+
 	c.JSON(http.StatusOK, order)
 }
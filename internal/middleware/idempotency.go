@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bytes"
+	"cedra_back_end/internal/database"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyHeader    = "Idempotency-Key"
+	IdempotencyTTL       = 24 * time.Hour  // Durée de conservation de la première réponse
+	idempotencyLockTTL   = 2 * time.Minute // Durée max d'une requête en cours de traitement
+	idempotencyKeyMaxLen = 255
+)
+
+// idempotencyRecord est la réponse mémorisée pour une clé d'idempotence
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	InProgress  bool   `json:"in_progress"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// idempotencyWriter capture la réponse envoyée au client
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency rejoue la première réponse d'une requête envoyée plusieurs fois avec le même header Idempotency-Key.
+// La clé est propre à chaque utilisateur (à placer après AuthRequired).
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		userID := c.GetString("user_id")
+		if key == "" || userID == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key trop longue (255 caractères max)"})
+			c.Abort()
+			return
+		}
+
+		// Empreinte de la requête : une même clé ne peut pas servir pour un autre body
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Échec lecture body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+		fingerprint := requestFingerprint(c.Request, bodyBytes)
+
+		ctx := context.Background()
+		redisKey := "idempotency:" + userID + ":" + key
+
+		lock, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint, InProgress: true})
+		acquired, err := database.Redis.SetNX(ctx, redisKey, lock, idempotencyLockTTL).Result()
+		if err != nil {
+			log.Printf("⚠️ Erreur Redis idempotence: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service temporairement indisponible"})
+			c.Abort()
+			return
+		}
+
+		if !acquired {
+			replayIdempotentResponse(c, redisKey, fingerprint)
+			return
+		}
+
+		c.Set("idempotency_key", key)
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		status := writer.Status()
+
+		// Erreur serveur ou limite de débit : le client peut retenter avec la même clé
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			database.Redis.Del(ctx, redisKey)
+			return
+		}
+
+		record, _ := json.Marshal(idempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.String(),
+		})
+		if err := database.Redis.Set(ctx, redisKey, record, IdempotencyTTL).Err(); err != nil {
+			log.Printf("⚠️ Erreur sauvegarde réponse idempotente: %v", err)
+		}
+	}
+}
+
+// requestFingerprint identifie une requête par sa méthode, son chemin réel (paramètres compris, pas le modèle de route),
+// sa query string et son body : la même clé réutilisée pour une autre commande est refusée au lieu d'être rejouée
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayIdempotentResponse renvoie la réponse mémorisée pour une clé déjà utilisée
+func replayIdempotentResponse(c *gin.Context, redisKey, fingerprint string) {
+	defer c.Abort()
+
+	data, err := database.Redis.Get(context.Background(), redisKey).Bytes()
+	if err != nil {
+		// La clé vient d'expirer ou d'être libérée entre SETNX et GET
+		c.JSON(http.StatusConflict, gin.H{"error": "Requête en cours de traitement, réessayez"})
+		return
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Réponse idempotente illisible"})
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key déjà utilisée pour une requête différente"})
+		return
+	}
+
+	if record.InProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Requête en cours de traitement, réessayez"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.Status, record.ContentType, []byte(record.Body))
+}
+
+// StripeIdempotencyKey dérive la clé transmise à Stripe à partir de celle du client.
+// Vide si la requête ne porte pas de header Idempotency-Key.
+func StripeIdempotencyKey(c *gin.Context, operation string) string {
+	key := c.GetString("idempotency_key")
+	if key == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(c.GetString("user_id") + ":" + operation + ":" + key))
+	return hex.EncodeToString(hash[:])
+}
+
+// IdempotentResourceID attache un identifiant (commande...) à la clé d'idempotence du client : un retry après une erreur
+// serveur retrouve l'identifiant de la première tentative, et les paramètres envoyés à Stripe restent identiques.
+// Sans header Idempotency-Key, newID est retourné tel quel.
+func IdempotentResourceID(c *gin.Context, operation, newID string) string {
+	key := c.GetString("idempotency_key")
+	if key == "" {
+		return newID
+	}
+
+	ctx := context.Background()
+	redisKey := "idempotency:" + c.GetString("user_id") + ":" + key + ":" + operation
+	acquired, err := database.Redis.SetNX(ctx, redisKey, newID, IdempotencyTTL).Result()
+	if err != nil {
+		log.Printf("⚠️ Erreur Redis identifiant idempotent: %v", err)
+		return newID
+	}
+	if acquired {
+		return newID
+	}
+	existing, err := database.Redis.Get(ctx, redisKey).Result()
+	if err != nil || existing == "" {
+		return newID
+	}
+	return existing
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestFingerprint(t *testing.T) {
+	body := []byte(`{"reason":"changed_mind"}`)
+	base := requestFingerprint(httptest.NewRequest("POST", "/api/orders/11111111-1111-1111-1111-111111111111/cancel", nil), body)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		same   bool
+	}{
+		{name: "même requête", method: "POST", target: "/api/orders/11111111-1111-1111-1111-111111111111/cancel", body: string(body), same: true},
+		{name: "autre commande, même body", method: "POST", target: "/api/orders/22222222-2222-2222-2222-222222222222/cancel", body: string(body)},
+		{name: "autre body", method: "POST", target: "/api/orders/11111111-1111-1111-1111-111111111111/cancel", body: `{"reason":"late"}`},
+		{name: "autre query string", method: "POST", target: "/api/orders/11111111-1111-1111-1111-111111111111/cancel?notify=false", body: string(body)},
+		{name: "autre méthode", method: "PUT", target: "/api/orders/11111111-1111-1111-1111-111111111111/cancel", body: string(body)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requestFingerprint(httptest.NewRequest(tt.method, tt.target, nil), []byte(tt.body))
+			if (got == base) != tt.same {
+				t.Errorf("empreinte identique = %v, attendu %v", got == base, tt.same)
+			}
+		})
+	}
+}
+
+// Sans clé ou sans utilisateur, la requête passe sans toucher à Redis ; une clé trop longue est refusée
+func TestIdempotencyWithoutStoredKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		key    string
+		userID string
+		status int
+	}{
+		{name: "sans clé", userID: "user", status: http.StatusCreated},
+		{name: "sans utilisateur", key: "cle-1", status: http.StatusCreated},
+		{name: "clé trop longue", key: strings.Repeat("k", idempotencyKeyMaxLen+1), userID: "user", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/orders", func(c *gin.Context) {
+				if tt.userID != "" {
+					c.Set("user_id", tt.userID)
+				}
+				c.Next()
+			}, Idempotency(), func(c *gin.Context) {
+				c.JSON(http.StatusCreated, gin.H{"id": "order-1"})
+			})
+
+			req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{}`))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("statut = %d, attendu %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestStripeIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newContext := func(userID, key string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("user_id", userID)
+		if key != "" {
+			c.Set("idempotency_key", key)
+		}
+		return c
+	}
+
+	if got := StripeIdempotencyKey(newContext("user", ""), "refund"); got != "" {
+		t.Errorf("sans clé = %q, attendu vide", got)
+	}
+	if got := IdempotentResourceID(newContext("user", ""), "order", "order-1"); got != "order-1" {
+		t.Errorf("IdempotentResourceID sans clé = %q, attendu order-1", got)
+	}
+
+	base := StripeIdempotencyKey(newContext("user", "cle-1"), "refund")
+	if base == "" || base != StripeIdempotencyKey(newContext("user", "cle-1"), "refund") {
+		t.Fatalf("clé Stripe instable: %q", base)
+	}
+	others := []string{
+		StripeIdempotencyKey(newContext("user", "cle-1"), "cancel"),
+		StripeIdempotencyKey(newContext("user", "cle-2"), "refund"),
+		StripeIdempotencyKey(newContext("autre", "cle-1"), "refund"),
+	}
+	for i, other := range others {
+		if other == base {
+			t.Errorf("clé Stripe %d identique à la clé de base", i)
+		}
+	}
+}
@@ -76,6 +76,31 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuth renseigne l'utilisateur si un token valide est fourni, sans jamais bloquer la requête :
+// les routes publiques (catalogue) peuvent ainsi afficher les prix propres au client connecté
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.Next()
+			return
+		}
+
+		claims, err := utils.ParseAccessToken(parts[1])
+		if err != nil || cache.IsTokenBlacklisted(claims.TokenID) || cache.IsUserBanned(claims.UserID) {
+			c.Next()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("email", claims.Email)
+		c.Set("role", claims.Role)
+		c.Set("isCompanyAdmin", claims.IsCompanyAdmin)
+		c.Set("token_id", claims.TokenID)
+		c.Next()
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
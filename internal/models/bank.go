@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Formats d'extraits bancaires importés
+const (
+	BankFormatCODA    = "coda"    // CODA 2.x (banques belges)
+	BankFormatCAMT053 = "camt053" // ISO 20022 camt.053
+)
+
+// Statuts d'une ligne d'extrait bancaire
+const (
+	BankTxStatusMatched   = "matched"   // Rapprochée d'une facture, marquée payée
+	BankTxStatusUnmatched = "unmatched" // File de rapprochement manuel
+	BankTxStatusIgnored   = "ignored"   // Écartée par un administrateur (virement sans rapport avec une facture)
+)
+
+// BankStatement est un extrait bancaire importé
+type BankStatement struct {
+	ID               gocql.UUID `json:"id" db:"statement_id"`
+	Format           string     `json:"format" db:"format"` // coda, camt053
+	Filename         string     `json:"filename" db:"filename"`
+	Account          string     `json:"account" db:"account"` // IBAN du compte
+	StatementDate    time.Time  `json:"statement_date" db:"statement_date"`
+	TransactionCount int        `json:"transaction_count" db:"transaction_count"` // Crédits importés
+	MatchedCount     int        `json:"matched_count" db:"matched_count"`
+	UnmatchedCount   int        `json:"unmatched_count" db:"unmatched_count"`
+	DuplicateCount   int        `json:"duplicate_count" db:"duplicate_count"` // Déjà importés par un extrait précédent
+	ImportedBy       string     `json:"imported_by" db:"imported_by"`
+	ImportedAt       time.Time  `json:"imported_at" db:"imported_at"`
+}
+
+// BankTransaction est un virement reçu lu dans un extrait bancaire
+type BankTransaction struct {
+	ID                  string      `json:"id" db:"transaction_id"` // Empreinte de la ligne : un même virement n'est importé qu'une fois
+	StatementID         gocql.UUID  `json:"statement_id" db:"statement_id"`
+	Account             string      `json:"account" db:"account"`
+	BookingDate         time.Time   `json:"booking_date" db:"booking_date"`
+	ValueDate           time.Time   `json:"value_date" db:"value_date"`
+	Amount              Money       `json:"amount" db:"amount"`
+	CounterpartyName    string      `json:"counterparty_name,omitempty" db:"counterparty_name"`
+	CounterpartyAccount string      `json:"counterparty_account,omitempty" db:"counterparty_account"`
+	StructuredReference string      `json:"structured_reference,omitempty" db:"structured_reference"` // +++123/4567/89002+++
+	Communication       string      `json:"communication,omitempty" db:"communication"`               // Communication libre
+	BankReference       string      `json:"bank_reference,omitempty" db:"bank_reference"`
+	Status              string      `json:"status" db:"status"` // matched, unmatched, ignored
+	InvoiceNumber       string      `json:"invoice_number,omitempty" db:"invoice_number"`
+	OrderID             *gocql.UUID `json:"order_id,omitempty" db:"order_id"`
+	MatchedBy           string      `json:"matched_by,omitempty" db:"matched_by"` // auto, ou user_id de l'administrateur
+	Note                string      `json:"note,omitempty" db:"note"`             // Raison du non-rapprochement ou commentaire
+	ImportedAt          time.Time   `json:"imported_at" db:"imported_at"`
+	ResolvedAt          *time.Time  `json:"resolved_at,omitempty" db:"resolved_at"`
+}
@@ -6,9 +6,13 @@ type Cart struct {
 }
 
 type CartItem struct {
-	ProductID string  `json:"product_id"`
-	Name      string  `json:"name"`
-	Price     float64 `json:"price"`
-	Quantity  int     `json:"quantity"`
-	ImageURL  string  `json:"image_url"`
+	ProductID   string `json:"product_id"`
+	VariantID   string `json:"variant_id,omitempty"`
+	Name        string `json:"name"`
+	Price       Money  `json:"price"`
+	ListPrice   *Money `json:"list_price,omitempty"`   // Prix catalogue, si un palier ou un tarif négocié s'applique
+	PriceSource string `json:"price_source,omitempty"` // Voir PriceSource*
+	Quantity    int    `json:"quantity"`
+	ImageURL    string `json:"image_url"`
+	Available   *int   `json:"available,omitempty"` // Stock disponible (hors réservations), calculé à la lecture
 }
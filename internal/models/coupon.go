@@ -11,8 +11,8 @@ type Coupon struct {
 	Code            string     `json:"code"`
 	Type            string     `json:"type"` // "percentage", "fixed", "free_shipping"
 	Value           float64    `json:"value"`
-	MinAmount       float64    `json:"min_amount"`
-	MaxAmount       *float64   `json:"max_amount,omitempty"` // Montant max de réduction
+	MinAmount       Money      `json:"min_amount"`
+	MaxAmount       *Money     `json:"max_amount,omitempty"` // Montant max de réduction
 	MaxUses         int        `json:"max_uses"`
 	UsedCount       int        `json:"used_count"`
 	MaxUsesPerUser  int        `json:"max_uses_per_user"`
@@ -36,9 +36,9 @@ type CouponUsage struct {
 }
 
 type CouponValidation struct {
-	IsValid      bool    `json:"is_valid"`
-	ErrorMessage string  `json:"error_message,omitempty"`
-	Discount     float64 `json:"discount"`
-	Type         string  `json:"type"`
-	Code         string  `json:"code"`
+	IsValid      bool   `json:"is_valid"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	Discount     Money  `json:"discount"`
+	Type         string `json:"type"`
+	Code         string `json:"code"`
 }
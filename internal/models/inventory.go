@@ -23,7 +23,7 @@ type ProductVariant struct {
 	ID         gocql.UUID        `json:"id"`
 	ProductID  gocql.UUID        `json:"product_id"`
 	SKU        string            `json:"sku"`
-	Price      float64           `json:"price"`
+	Price      Money             `json:"price"`
 	Stock      int               `json:"stock"`
 	Attributes map[string]string `json:"attributes"` // {"size": "L", "color": "red"}
 	IsActive   bool              `json:"is_active"`
@@ -47,7 +47,7 @@ type InventoryStats struct {
 	TotalProducts      int            `json:"total_products"`
 	LowStockProducts   int            `json:"low_stock_products"`
 	OutOfStockProducts int            `json:"out_of_stock_products"`
-	TotalValue         float64        `json:"total_value"`
+	TotalValue         Money          `json:"total_value"`
 	TopSellingProducts []ProductSales `json:"top_selling_products"`
 }
 
@@ -55,5 +55,5 @@ type ProductSales struct {
 	ProductID   gocql.UUID `json:"product_id"`
 	ProductName string     `json:"product_name"`
 	TotalSold   int        `json:"total_sold"`
-	Revenue     float64    `json:"revenue"`
+	Revenue     Money      `json:"revenue"`
 }
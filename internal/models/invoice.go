@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// InvoiceParty est le vendeur ou l'acheteur tel qu'imprimé sur la facture
+type InvoiceParty struct {
+	Name         string   `json:"name"`
+	AddressLines []string `json:"address_lines"`
+	Country      string   `json:"country,omitempty"`
+	VATNumber    string   `json:"vat_number,omitempty"`
+	Registration string   `json:"registration,omitempty"` // N° d'entreprise (BCE, SIREN...)
+	Email        string   `json:"email,omitempty"`
+}
+
+// InvoiceLine est une ligne de facture (article ou frais de port)
+type InvoiceLine struct {
+	ProductID   string  `json:"productId,omitempty"`
+	VariantID   string  `json:"variant_id,omitempty"`
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   Money   `json:"unit_price"` // Prix unitaire facturé (palier ou tarif négocié compris)
+	TaxRate     float64 `json:"tax_rate"`
+	NetAmount   Money   `json:"net_amount"`
+	TaxAmount   Money   `json:"tax_amount"`
+	GrossAmount Money   `json:"gross_amount"`
+}
+
+// Invoice est une facture émise : son contenu est figé à l'émission et le PDF conservé dans MinIO
+type Invoice struct {
+	Number           string         `json:"number"` // F2026-000001, sans trou par exercice
+	FiscalYear       int            `json:"fiscal_year"`
+	Sequence         int64          `json:"sequence"`
+	OrderID          gocql.UUID     `json:"order_id"`
+	UserID           string         `json:"user_id"`
+	Seller           InvoiceParty   `json:"seller"`
+	Buyer            InvoiceParty   `json:"buyer"`
+	Lines            []InvoiceLine  `json:"lines"`
+	Rates            []TaxRateTotal `json:"rates"`
+	DiscountAmount   Money          `json:"discount_amount"` // Remise TTC, déjà répartie sur les lignes
+	NetTotal         Money          `json:"net_total"`
+	TaxTotal         Money          `json:"tax_total"`
+	GrossTotal       Money          `json:"gross_total"`
+	TaxRegime        string         `json:"tax_regime"`
+	TaxNote          string         `json:"tax_note,omitempty"`
+	PaymentReference string         `json:"payment_reference"`
+	IBAN             string         `json:"iban"`
+	BIC              string         `json:"bic"`
+	IssuedAt         time.Time      `json:"issued_at"`
+	PaidAt           *time.Time     `json:"paid_at,omitempty"`            // Payée en ligne à l'émission
+	DueDate          *time.Time     `json:"due_date,omitempty"`           // Paiement sur facture : échéance
+	PaymentTermsDays int            `json:"payment_terms_days,omitempty"` // Délai de paiement du compte société (30 = net 30)
+	PONumber         string         `json:"po_number,omitempty"`          // Bon de commande de l'acheteur
+	CostCenter       string         `json:"cost_center,omitempty"`        // Centre de coût de l'acheteur
+	PDFKey           string         `json:"-"`
+}
+
+// CreditNote est une note de crédit : elle annule tout ou partie d'une facture lors d'un remboursement.
+// Ses montants sont négatifs ; comme la facture, son contenu est figé à l'émission.
+type CreditNote struct {
+	Number        string         `json:"number"` // NC2026-000001, série distincte des factures
+	FiscalYear    int            `json:"fiscal_year"`
+	Sequence      int64          `json:"sequence"`
+	RefundID      gocql.UUID     `json:"refund_id"`
+	OrderID       gocql.UUID     `json:"order_id"`
+	UserID        string         `json:"user_id"`
+	InvoiceNumber string         `json:"invoice_number"` // Facture d'origine
+	InvoiceDate   time.Time      `json:"invoice_date"`
+	Seller        InvoiceParty   `json:"seller"`
+	Buyer         InvoiceParty   `json:"buyer"`
+	Lines         []InvoiceLine  `json:"lines"`
+	Rates         []TaxRateTotal `json:"rates"`
+	NetTotal      Money          `json:"net_total"`
+	TaxTotal      Money          `json:"tax_total"`
+	GrossTotal    Money          `json:"gross_total"`
+	TaxRegime     string         `json:"tax_regime"`
+	TaxNote       string         `json:"tax_note,omitempty"`
+	Reason        string         `json:"reason,omitempty"`
+	IBAN          string         `json:"iban"`
+	IssuedAt      time.Time      `json:"issued_at"`
+	PDFKey        string         `json:"-"`
+}
+
+// Types de documents transmis sur le réseau Peppol
+const (
+	PeppolDocumentInvoice    = "invoice"
+	PeppolDocumentCreditNote = "credit_note"
+)
+
+// PeppolDelivery trace la transmission d'une facture ou d'une note de crédit à un point d'accès Peppol
+type PeppolDelivery struct {
+	DocumentNumber string    `json:"document_number"`
+	DocumentType   string    `json:"document_type"`
+	ReceiverID     string    `json:"receiver_id"` // Identifiant Peppol de l'acheteur (0208:0123456789)
+	MessageID      string    `json:"message_id"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+// OrphanDocumentNumber est un numéro attribué mais jamais inscrit sur son document : il doit être annulé
+// explicitement pour justifier le trou dans la série
+type OrphanDocumentNumber struct {
+	Number        string     `json:"number"`
+	FiscalYear    int        `json:"fiscal_year"`
+	Sequence      int64      `json:"sequence"`
+	DocumentTable string     `json:"document_table"`
+	DocumentKey   gocql.UUID `json:"document_key"`
+	Reason        string     `json:"reason"`
+	CreatedAt     time.Time  `json:"created_at"`
+	VoidedAt      *time.Time `json:"voided_at,omitempty"`
+	VoidedBy      string     `json:"voided_by,omitempty"`
+	VoidNote      string     `json:"void_note,omitempty"`
+}
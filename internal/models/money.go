@@ -0,0 +1,189 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+)
+
+// DefaultCurrency est la devise utilisée quand aucune n'est précisée
+const DefaultCurrency = "EUR"
+
+// Money représente un montant exact en unités mineures (centimes) dans une devise.
+// En JSON il reste encodé comme un nombre décimal (19.99) pour rester compatible avec les clients existants.
+// En base il se lit et s'écrit aussi bien dans une colonne double (historique) que bigint (centimes) ou decimal.
+type Money struct {
+	Amount   int64  // Montant en centimes
+	Currency string // Code ISO 4217, vide = DefaultCurrency
+}
+
+// Cents crée un montant en euros à partir d'un nombre de centimes
+func Cents(amount int64) Money {
+	return Money{Amount: amount, Currency: DefaultCurrency}
+}
+
+// MoneyFromFloat convertit un montant décimal (19.99) en centimes, arrondi au centime le plus proche
+func MoneyFromFloat(value float64) Money {
+	return Cents(int64(math.Round(value * 100)))
+}
+
+// Float retourne le montant en unités (19.99), pour l'affichage uniquement
+func (m Money) Float() float64 {
+	return float64(m.Amount) / 100
+}
+
+// CurrencyCode retourne la devise du montant
+func (m Money) CurrencyCode() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// Add additionne deux montants
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.CurrencyCode()}
+}
+
+// Sub soustrait un montant
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.CurrencyCode()}
+}
+
+// Mul multiplie le montant par une quantité
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.CurrencyCode()}
+}
+
+// Percent retourne le pourcentage du montant (20 → 20 %), arrondi au centime
+func (m Money) Percent(percent float64) Money {
+	return Money{Amount: int64(math.Round(float64(m.Amount) * percent / 100)), Currency: m.CurrencyCode()}
+}
+
+// IsZero indique si le montant est nul
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// String formate le montant en unités avec deux décimales ("19.99")
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// MinMoney retourne le plus petit des deux montants
+func MinMoney(a, b Money) Money {
+	if b.Amount < a.Amount {
+		return b
+	}
+	return a
+}
+
+// MaxMoney retourne le plus grand des deux montants
+func MaxMoney(a, b Money) Money {
+	if b.Amount > a.Amount {
+		return b
+	}
+	return a
+}
+
+// MarshalJSON encode le montant comme un nombre décimal (compatibilité avec l'ancien float64)
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepte un nombre (19.99), une chaîne ("19.99") ou un objet {"amount": 1999, "currency": "EUR"}
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		*m = Money{}
+		return nil
+	}
+
+	switch data[0] {
+	case '{':
+		var obj struct {
+			Amount   int64  `json:"amount"`
+			Currency string `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		*m = Money{Amount: obj.Amount, Currency: obj.Currency}
+		return nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+
+	value, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("montant invalide: %s", data)
+	}
+	*m = MoneyFromFloat(value)
+	return nil
+}
+
+// MarshalCQL écrit le montant selon le type de la colonne (double, bigint ou decimal)
+func (m Money) MarshalCQL(info gocql.TypeInfo) ([]byte, error) {
+	switch info.Type() {
+	case gocql.TypeDouble:
+		return gocql.Marshal(info, m.Float())
+	case gocql.TypeBigInt, gocql.TypeInt, gocql.TypeVarint:
+		return gocql.Marshal(info, m.Amount)
+	case gocql.TypeDecimal:
+		return gocql.Marshal(info, inf.NewDec(m.Amount, 2))
+	default:
+		return nil, fmt.Errorf("type de colonne non supporté pour un montant: %s", info.Type())
+	}
+}
+
+// UnmarshalCQL lit le montant quel que soit le type de la colonne (double, bigint ou decimal)
+func (m *Money) UnmarshalCQL(info gocql.TypeInfo, data []byte) error {
+	if data == nil {
+		*m = Money{}
+		return nil
+	}
+
+	switch info.Type() {
+	case gocql.TypeDouble:
+		var value float64
+		if err := gocql.Unmarshal(info, data, &value); err != nil {
+			return err
+		}
+		*m = MoneyFromFloat(value)
+	case gocql.TypeBigInt, gocql.TypeInt, gocql.TypeVarint:
+		var amount int64
+		if err := gocql.Unmarshal(info, data, &amount); err != nil {
+			return err
+		}
+		*m = Cents(amount)
+	case gocql.TypeDecimal:
+		value := new(inf.Dec)
+		if err := gocql.Unmarshal(info, data, value); err != nil {
+			return err
+		}
+		rounded := new(inf.Dec).Round(value, 2, inf.RoundHalfUp)
+		amount, ok := rounded.Unscaled()
+		if !ok {
+			return fmt.Errorf("montant hors limites: %s", value)
+		}
+		*m = Cents(amount)
+	default:
+		return fmt.Errorf("type de colonne non supporté pour un montant: %s", info.Type())
+	}
+	return nil
+}
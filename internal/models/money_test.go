@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := Cents(1999)
+
+	if got := price.Add(Cents(1)); got.Amount != 2000 {
+		t.Errorf("Add = %d, attendu 2000", got.Amount)
+	}
+	if got := price.Sub(Cents(2000)); got.Amount != -1 {
+		t.Errorf("Sub = %d, attendu -1", got.Amount)
+	}
+	if got := price.Mul(3); got.Amount != 5997 {
+		t.Errorf("Mul = %d, attendu 5997", got.Amount)
+	}
+	if got := MinMoney(price, Cents(500)); got.Amount != 500 {
+		t.Errorf("MinMoney = %d, attendu 500", got.Amount)
+	}
+	if got := MaxMoney(price, Cents(500)); got.Amount != 1999 {
+		t.Errorf("MaxMoney = %d, attendu 1999", got.Amount)
+	}
+	if got := (Money{Amount: 100}).Add(Cents(1)); got.Currency != DefaultCurrency {
+		t.Errorf("Add sans devise = %q, attendu %q", got.Currency, DefaultCurrency)
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		percent float64
+		want    int64
+	}{
+		{1999, 20, 400}, // 399.8 arrondi au centime
+		{1000, 21, 210},
+		{333, 50, 167}, // 166.5 arrondi au centime supérieur
+		{1000, 0, 0},
+		{1000, 100, 1000},
+		{1, 6, 0},
+	}
+
+	for _, tt := range tests {
+		if got := Cents(tt.amount).Percent(tt.percent); got.Amount != tt.want {
+			t.Errorf("Cents(%d).Percent(%v) = %d, attendu %d", tt.amount, tt.percent, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  int64
+	}{
+		{19.99, 1999},
+		{0.1 + 0.2, 30},
+		{1.005, 100}, // 100.49999... en double
+		{-4.5, -450},
+		{0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.value); got.Amount != tt.want {
+			t.Errorf("MoneyFromFloat(%v) = %d, attendu %d", tt.value, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		amount int64
+		want   string
+	}{
+		{1999, "19.99"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{-1050, "-10.50"},
+		{0, "0.00"},
+	}
+
+	for _, tt := range tests {
+		if got := Cents(tt.amount).String(); got != tt.want {
+			t.Errorf("Cents(%d).String() = %q, attendu %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{Cents(1999)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"price":19.99}` {
+		t.Errorf("MarshalJSON = %s", data)
+	}
+
+	tests := []struct {
+		input    string
+		want     int64
+		currency string
+	}{
+		{`19.99`, 1999, DefaultCurrency},
+		{`"19.99"`, 1999, DefaultCurrency},
+		{`{"amount": 1999, "currency": "USD"}`, 1999, "USD"},
+		{`null`, 0, ""},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.input), &m); err != nil {
+			t.Errorf("UnmarshalJSON(%s): %v", tt.input, err)
+			continue
+		}
+		if m.Amount != tt.want || m.Currency != tt.currency {
+			t.Errorf("UnmarshalJSON(%s) = %+v, attendu %d %s", tt.input, m, tt.want, tt.currency)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"abc"`), &m); err == nil {
+		t.Error("UnmarshalJSON(\"abc\") devrait échouer")
+	}
+}
+
+func TestMoneyCQL(t *testing.T) {
+	types := []gocql.Type{gocql.TypeDouble, gocql.TypeBigInt, gocql.TypeDecimal}
+
+	for _, typ := range types {
+		info := gocql.NewNativeType(4, typ, "")
+		for _, amount := range []int64{1999, -1050, 0, 1} {
+			data, err := Cents(amount).MarshalCQL(info)
+			if err != nil {
+				t.Fatalf("MarshalCQL(%s, %d): %v", typ, amount, err)
+			}
+			var m Money
+			if err := m.UnmarshalCQL(info, data); err != nil {
+				t.Fatalf("UnmarshalCQL(%s, %d): %v", typ, amount, err)
+			}
+			if m.Amount != amount {
+				t.Errorf("aller-retour %s: %d, attendu %d", typ, m.Amount, amount)
+			}
+		}
+	}
+
+	var m Money
+	if err := m.UnmarshalCQL(gocql.NewNativeType(4, gocql.TypeDecimal, ""), nil); err != nil || m.Amount != 0 {
+		t.Errorf("UnmarshalCQL(nil) = %+v, %v", m, err)
+	}
+	if _, err := Cents(1).MarshalCQL(gocql.NewNativeType(4, gocql.TypeVarchar, "")); err == nil {
+		t.Error("MarshalCQL(varchar) devrait échouer")
+	}
+}
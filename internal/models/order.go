@@ -5,21 +5,71 @@ import (
 	"github.com/gocql/gocql"
 )
 
+// Statuts de commande
+const (
+	OrderStatusPendingApproval   = "pending_approval" // Achat d'un employé au-delà de son plafond : attend un administrateur de la société
+	OrderStatusPendingPayment    = "pending_payment"
+	OrderStatusPaymentProcessing = "payment_processing"
+	OrderStatusPaymentFailed     = "payment_failed"
+	OrderStatusPaid              = "paid"
+	OrderStatusInvoiced          = "invoiced" // Compte société payable sur facture : préparée avant le paiement
+	OrderStatusProcessing        = "processing"
+	OrderStatusPartiallyShipped  = "partially_shipped" // Une partie des articles est expédiée
+	OrderStatusShipped           = "shipped"
+	OrderStatusDelivered         = "delivered"
+	OrderStatusCancelled         = "cancelled"
+	OrderStatusRefunded          = "refunded"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+	OrderStatusDisputed          = "disputed"
+)
+
+// Modes de paiement d'une commande
+const (
+	PaymentMethodCard    = "card"    // Paiement en ligne Stripe (carte, Bancontact, SEPA...)
+	PaymentMethodInvoice = "invoice" // Sur facture, à l'échéance du compte société
+)
+
 type Order struct {
 	ID              gocql.UUID `json:"id"`
 	UserID          string     `json:"user_id"`
 	PaymentIntentID string     `json:"payment_intent_id"`
+	PaymentMethod   string     `json:"payment_method"` // card, invoice
+	QuoteID         string     `json:"quote_id,omitempty"` // Devis accepté à l'origine de la commande
+	CompanyID       *gocql.UUID `json:"company_id,omitempty"`  // Société de l'acheteur au moment de la commande (historique société)
+	PONumber        string     `json:"po_number,omitempty"`   // Bon de commande de l'acheteur, repris sur la facture
+	CostCenter      string     `json:"cost_center,omitempty"` // Centre de coût de l'acheteur, repris sur la facture
 	Items           []OrderItem `json:"items"`
-	TotalPrice      float64    `json:"total_price"`
-	Status          string     `json:"status"` // "pending", "paid", "shipped", "delivered"
+	Subtotal        Money      `json:"subtotal"`
+	DiscountAmount  Money      `json:"discount_amount"`
+	CouponCode      string     `json:"coupon_code,omitempty"`
+	AddressID       string     `json:"address_id,omitempty"`
+	ShippingAddress *Address   `json:"shipping_address,omitempty"` // Copie de l'adresse au moment de la commande
+	ShippingOptionID   string `json:"shipping_option_id,omitempty"`   // Option de livraison choisie (standard, express...)
+	ShippingOptionName string `json:"shipping_option_name,omitempty"` // Libellé au moment de la commande
+	ShippingCost       Money  `json:"shipping_cost"`                  // Frais de port facturés (TVA comprise)
+	TaxAmount       Money       `json:"tax_amount"`    // TVA totale de la commande
+	Tax             *TaxSummary `json:"tax,omitempty"` // Détail de la TVA par ligne et par taux
+	TotalPrice      Money      `json:"total_price"`
+	RefundedAmount  Money      `json:"refunded_amount"` // Total déjà remboursé
+	Status          string     `json:"status"` // Voir OrderStatus*
+	TrackingNumber  string     `json:"tracking_number,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	History         []OrderEvent `json:"history,omitempty"` // Transitions de statut (order_events)
+	Shipments       []Shipment   `json:"shipments,omitempty"` // Colis expédiés
 }
 
 type OrderItem struct {
 	ProductID   string  `json:"productId"`
+	VariantID   string  `json:"variant_id,omitempty"`
 	ProductName string  `json:"product_name"`
 	Quantity    int     `json:"quantity"`
-	Price       float64 `json:"price"`
+	Price       Money   `json:"price"`
+	ListPrice   *Money  `json:"list_price,omitempty"`   // Prix catalogue, si un palier ou un tarif négocié s'applique
+	PriceSource string  `json:"price_source,omitempty"` // Voir PriceSource*
 	Name        string  `json:"name"`
-}
\ No newline at end of file
+	TaxClass    string  `json:"tax_class,omitempty"`
+	TaxRate     float64 `json:"tax_rate"`   // Taux appliqué (21 = 21 %)
+	NetAmount   Money   `json:"net_amount"` // Total HT de la ligne, remise déduite
+	TaxAmount   Money   `json:"tax_amount"` // TVA de la ligne
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Statuts d'une demande d'approbation d'achat
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+)
+
+// PurchasePolicy est la règle d'achat d'un utilisateur : les employés d'une société peuvent avoir un plafond par commande,
+// au-delà duquel un administrateur de la société doit approuver. Les administrateurs n'ont pas de plafond.
+type PurchasePolicy struct {
+	UserID         string      `json:"user_id"`
+	CompanyID      *gocql.UUID `json:"company_id,omitempty"`
+	IsCompanyAdmin bool        `json:"is_company_admin"`
+	SpendingLimit  *Money      `json:"spending_limit,omitempty"` // Montant TTC maximal par commande (nil : illimité)
+}
+
+// OrderApproval est la demande d'approbation d'une commande qui dépasse le plafond de l'employé, et sa décision
+type OrderApproval struct {
+	OrderID       gocql.UUID `json:"order_id"`
+	CompanyID     gocql.UUID `json:"company_id"`
+	RequestedBy   string     `json:"requested_by"` // Employé à l'origine de la commande
+	Amount        Money      `json:"amount"`
+	SpendingLimit Money      `json:"spending_limit"` // Plafond de l'employé au moment de la commande
+	Status        string     `json:"status"`         // Voir ApprovalStatus*
+	DecidedBy     string     `json:"decided_by,omitempty"`
+	Comment       string     `json:"comment,omitempty"`
+	RequestedAt   time.Time  `json:"requested_at"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	Order         *Order     `json:"order,omitempty"` // Commande concernée (lecture)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Types d'acteurs à l'origine d'une transition de commande
+const (
+	ActorCustomer     = "customer"
+	ActorAdmin        = "admin"
+	ActorStripe       = "stripe"
+	ActorSystem       = "system"
+	ActorCarrier      = "carrier"
+	ActorBank         = "bank"          // Virement rapproché depuis un extrait bancaire
+	ActorCompanyAdmin = "company_admin" // Administrateur de la société acheteuse (approbation d'achat)
+)
+
+// OrderActor identifie qui a déclenché une transition (utilisateur, admin, webhook Stripe ou transporteur, extrait bancaire, tâche interne)
+type OrderActor struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"` // user_id, ID d'événement Stripe, ligne d'extrait...
+}
+
+// OrderEvent est une transition de statut enregistrée dans order_events
+type OrderEvent struct {
+	ID         gocql.UUID             `json:"id" db:"event_id"`
+	OrderID    gocql.UUID             `json:"order_id" db:"order_id"`
+	FromStatus string                 `json:"from_status" db:"from_status"`
+	ToStatus   string                 `json:"to_status" db:"to_status"`
+	Actor      OrderActor             `json:"actor"`
+	Payload    map[string]interface{} `json:"payload,omitempty" db:"payload"`
+	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+}
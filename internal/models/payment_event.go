@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// PaymentEvent représente un événement Stripe reçu par le webhook
+type PaymentEvent struct {
+	EventID     string      `json:"event_id" db:"event_id"`
+	Type        string      `json:"type" db:"type"`
+	ObjectID    string      `json:"object_id" db:"object_id"` // PaymentIntent, Charge ou Dispute concerné
+	OrderID     *gocql.UUID `json:"order_id,omitempty" db:"order_id"`
+	Status      string      `json:"status" db:"status"` // processing, processed, failed, ignored
+	Error       string      `json:"error,omitempty" db:"error"`
+	Attempts    int         `json:"attempts" db:"attempts"`
+	Payload     string      `json:"payload,omitempty" db:"payload"`
+	ReceivedAt  time.Time   `json:"received_at" db:"received_at"`
+	ProcessedAt *time.Time  `json:"processed_at,omitempty" db:"processed_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Origine du prix appliqué à une ligne
+const (
+	PriceSourceCatalog   = "catalog"    // Prix du produit ou de la variante
+	PriceSourceTier      = "tier"       // Prix dégressif par quantité du catalogue
+	PriceSourcePriceList = "price_list" // Tarif négocié (liste de prix de la société ou du groupe de clients)
+)
+
+// PriceRule est une règle d'une liste de prix : elle cible une variante, un produit ou une catégorie,
+// à partir d'une quantité, avec un prix fixe TTC ou un pourcentage de remise sur le prix catalogue
+type PriceRule struct {
+	ProductID       string  `json:"productId,omitempty"`
+	VariantID       string  `json:"variant_id,omitempty"`
+	CategoryID      string  `json:"category_id,omitempty"`
+	MinQuantity     int     `json:"min_quantity,omitempty"` // Palier : la règle s'applique à partir de cette quantité (1 par défaut)
+	FixedPrice      *Money  `json:"fixed_price,omitempty"`
+	DiscountPercent float64 `json:"discount_percent,omitempty"`
+}
+
+// PriceList est un tarif négocié, attribué à des sociétés ou à des groupes de clients
+type PriceList struct {
+	ID          gocql.UUID  `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	IsActive    bool        `json:"is_active"`
+	Rules       []PriceRule `json:"rules"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   *time.Time  `json:"updated_at,omitempty"`
+}
+
+// CustomerGroup regroupe des clients (revendeurs, enseignement...) qui partagent une liste de prix
+type CustomerGroup struct {
+	ID          gocql.UUID  `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	PriceListID *gocql.UUID `json:"price_list_id,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// PriceTier est un prix dégressif du catalogue, ouvert à tous les clients à partir d'une quantité
+type PriceTier struct {
+	ProductID   string `json:"productId"`
+	VariantID   string `json:"variant_id,omitempty"` // Vide : s'applique au produit et à toutes ses variantes
+	MinQuantity int    `json:"min_quantity"`
+	UnitPrice   Money  `json:"unit_price"`
+}
+
+// ResolvedPrice est le prix unitaire TTC retenu pour une ligne : le plus bas entre le prix catalogue,
+// le palier dégressif atteint et le tarif négocié du client
+type ResolvedPrice struct {
+	UnitPrice   Money  `json:"unit_price"`
+	ListPrice   Money  `json:"list_price"` // Prix catalogue
+	Source      string `json:"source"`     // Voir PriceSource*
+	PriceListID string `json:"price_list_id,omitempty"`
+}
@@ -7,19 +7,24 @@ import (
 )
 
 type Product struct {
-	ID                gocql.UUID `json:"id" db:"product_id"`
-	Name              string     `json:"name" db:"name"`
-	Description       string     `json:"description" db:"description"`
-	Price             float64    `json:"price" db:"price"`
-	Stock             int        `json:"stock" db:"stock"`
-	LowStockThreshold int        `json:"low_stock_threshold" db:"low_stock_threshold"`
-	SKU               string     `json:"sku" db:"sku"`
-	Weight            float64    `json:"weight" db:"weight"`
-	CategoryID        gocql.UUID `json:"category_id" db:"category_id"`
-	ImageURLs         []string   `json:"image_urls" db:"image_urls"`
-	Tags              []string   `json:"tags" db:"tags"`
-	IsActive          bool       `json:"is_active" db:"is_active"`
-	HasVariants       bool       `json:"has_variants" db:"has_variants"`
-	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
+	ID                gocql.UUID  `json:"id" db:"product_id"`
+	Name              string      `json:"name" db:"name"`
+	Description       string      `json:"description" db:"description"`
+	Price             Money       `json:"price" db:"price"`
+	ListPrice         *Money      `json:"list_price,omitempty" db:"-"`  // Prix catalogue, si le client connecté bénéficie d'un tarif négocié
+	PriceTiers        []PriceTier `json:"price_tiers,omitempty" db:"-"` // Prix dégressifs par quantité
+	Stock             int         `json:"stock" db:"stock"`
+	Available         *int        `json:"available,omitempty" db:"-"` // Stock moins les réservations actives
+	LowStockThreshold int         `json:"low_stock_threshold" db:"low_stock_threshold"`
+	SKU               string      `json:"sku" db:"sku"`
+	Weight            float64     `json:"weight" db:"weight"`                           // kg, utilisé pour le calcul des frais de port
+	ShippingClass     string      `json:"shipping_class,omitempty" db:"shipping_class"` // Classe de livraison (encombrant, fragile...)
+	TaxClass          string      `json:"tax_class,omitempty" db:"tax_class"`           // Classe de TVA : standard (défaut), reduced, zero
+	CategoryID        gocql.UUID  `json:"category_id" db:"category_id"`
+	ImageURLs         []string    `json:"image_urls" db:"image_urls"`
+	Tags              []string    `json:"tags" db:"tags"`
+	IsActive          bool        `json:"is_active" db:"is_active"`
+	HasVariants       bool        `json:"has_variants" db:"has_variants"`
+	CreatedAt         time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at" db:"updated_at"`
 }
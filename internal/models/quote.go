@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Statuts d'un devis
+const (
+	QuoteStatusRequested = "requested" // Demandé par l'acheteur, en attente de l'équipe commerciale
+	QuoteStatusSent      = "sent"      // Prix et validité fixés, PDF envoyé : l'acheteur peut l'accepter
+	QuoteStatusAccepted  = "accepted"  // Converti en commande (OrderID)
+	QuoteStatusDeclined  = "declined"  // Refusé par l'acheteur
+	QuoteStatusCancelled = "cancelled" // Retiré par l'équipe commerciale
+	QuoteStatusExpired   = "expired"   // Date de validité dépassée sans acceptation
+)
+
+// QuoteItem est une ligne de devis : prix catalogue à la demande et prix consenti par l'équipe commerciale (TTC)
+type QuoteItem struct {
+	ProductID string `json:"productId"`
+	VariantID string `json:"variant_id,omitempty"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	ListPrice Money  `json:"list_price"` // Prix catalogue au moment de la demande
+	UnitPrice Money  `json:"unit_price"` // Prix du devis, appliqué à la commande
+}
+
+// Total retourne le montant de la ligne au prix du devis
+func (i QuoteItem) Total() Money {
+	return i.UnitPrice.Mul(i.Quantity)
+}
+
+// Quote est un devis demandé par un compte société depuis son panier
+type Quote struct {
+	ID           gocql.UUID  `json:"id"`
+	Number       string      `json:"number"` // D2026-000001
+	CompanyID    gocql.UUID  `json:"company_id"`
+	UserID       string      `json:"user_id"`
+	Items        []QuoteItem `json:"items"`
+	Total        Money       `json:"total"`  // Total des articles TTC (hors livraison)
+	Status       string      `json:"status"` // Voir QuoteStatus*
+	BuyerNote    string      `json:"buyer_note,omitempty"`
+	StaffNote    string      `json:"staff_note,omitempty"` // Conditions imprimées sur le devis
+	ValidUntil   *time.Time  `json:"valid_until,omitempty"`
+	ReserveStock bool        `json:"reserve_stock"` // Stock réservé jusqu'à la fin de validité une fois le devis envoyé
+	OrderID      gocql.UUID  `json:"order_id"`      // Attribué à la demande : porte la réservation puis la commande
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    *time.Time  `json:"updated_at,omitempty"`
+	UpdatedBy    string      `json:"updated_by,omitempty"`
+	SentAt       *time.Time  `json:"sent_at,omitempty"`
+	AcceptedAt   *time.Time  `json:"accepted_at,omitempty"`
+}
+
+// IsOpen indique si le devis attend encore une décision (demande ou devis envoyé)
+func (q Quote) IsOpen() bool {
+	return q.Status == QuoteStatusRequested || q.Status == QuoteStatusSent
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// CompanyCreditTerms sont les conditions de paiement sur facture accordées à une société par l'équipe finance
+type CompanyCreditTerms struct {
+	CompanyID             gocql.UUID `json:"company_id"`
+	InvoicePaymentEnabled bool       `json:"invoice_payment_enabled"` // Société approuvée pour le paiement sur facture
+	CreditLimit           Money      `json:"credit_limit"`            // Encours maximal (factures ouvertes + nouvelle commande)
+	PaymentTermsDays      int        `json:"payment_terms_days"`      // 30 = net 30
+}
+
+// Receivable est une facture payable sur facture qui attend son virement, avec son état de relance.
+// Le document de la facture reste figé : frais de retard et relances sont suivis à côté.
+type Receivable struct {
+	Invoice        Invoice     `json:"invoice"`
+	CompanyID      *gocql.UUID `json:"company_id,omitempty"`
+	LateFee        Money       `json:"late_fee"`      // Indemnité forfaitaire et intérêts de retard réclamés
+	DunningLevel   int         `json:"dunning_level"` // Nombre de relances envoyées
+	LastReminderAt *time.Time  `json:"last_reminder_at,omitempty"`
+}
+
+// AmountDue retourne le montant réclamé : total de la facture et frais de retard
+func (r Receivable) AmountDue() Money {
+	return r.Invoice.GrossTotal.Add(r.LateFee)
+}
+
+// DaysOverdue retourne le nombre de jours écoulés depuis l'échéance (négatif avant l'échéance, 0 sans échéance)
+func (r Receivable) DaysOverdue(now time.Time) int {
+	if r.Invoice.DueDate == nil {
+		return 0
+	}
+	due := r.Invoice.DueDate.Truncate(24 * time.Hour)
+	return int(now.Truncate(24*time.Hour).Sub(due).Hours() / 24)
+}
+
+// CompanyCreditStatus est la situation d'encours d'une société : conditions, factures ouvertes et blocage éventuel
+type CompanyCreditStatus struct {
+	Terms        CompanyCreditTerms `json:"terms"`
+	Outstanding  Money              `json:"outstanding"` // Total réclamé sur les factures ouvertes
+	Available    Money              `json:"available"`   // Crédit restant avant le plafond
+	OverdueCount int                `json:"overdue_count"`
+	OnHold       bool               `json:"on_hold"` // Nouvelles commandes sur facture bloquées
+	HoldReason   string             `json:"hold_reason,omitempty"`
+	Receivables  []Receivable       `json:"receivables"`
+}
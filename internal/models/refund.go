@@ -6,14 +6,69 @@ import (
 	"github.com/gocql/gocql"
 )
 
+// Statuts d'une demande de remboursement
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusApproved  = "approved"
+	RefundStatusRejected  = "rejected"
+	RefundStatusCompleted = "completed"
+	RefundStatusFailed    = "failed"
+
+	// Retours physiques (RMA) : demandé → autorisé (numéro RA) → reçu et inspecté → completed
+	ReturnStatusRequested  = "return_requested"
+	ReturnStatusAuthorized = "return_authorized"
+	ReturnStatusReceived   = "return_received"
+)
+
+// Types de demande : remboursement simple ou retour de marchandise
+const (
+	RefundTypeRefund = "refund"
+	RefundTypeReturn = "return"
+)
+
+// États des articles constatés à la réception d'un retour
+const (
+	ItemConditionResellable = "resellable" // Remis en stock
+	ItemConditionDamaged    = "damaged"    // Remboursé mais pas remis en stock
+)
+
 type Refund struct {
-	ID             gocql.UUID `json:"id" db:"refund_id"`
-	OrderID        gocql.UUID `json:"order_id" db:"order_id"`
-	UserID         string     `json:"user_id" db:"user_id"`
-	Reason         string     `json:"reason" db:"reason"`
-	Status         string     `json:"status" db:"status"` // pending, approved, rejected, completed
-	RefundAmount   float64    `json:"refund_amount" db:"refund_amount"`
-	StripeRefundID string     `json:"stripe_refund_id,omitempty" db:"stripe_refund_id"`
-	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt      *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+	ID              gocql.UUID   `json:"id" db:"refund_id"`
+	OrderID         gocql.UUID   `json:"order_id" db:"order_id"`
+	UserID          string       `json:"user_id" db:"user_id"`
+	Type            string       `json:"type" db:"type"` // refund, return
+	Reason          string       `json:"reason" db:"reason"`
+	Status          string       `json:"status" db:"status"`                   // pending, approved, rejected, completed, failed, return_*
+	Items           []RefundItem `json:"items,omitempty" db:"items"`           // Lignes remboursées (JSON)
+	ShippingAmount  Money        `json:"shipping_amount" db:"shipping_amount"` // Part des frais de port remboursée
+	RefundAmount    Money        `json:"refund_amount" db:"refund_amount"`
+	Restocked       bool         `json:"restocked" db:"restocked"` // Articles remis en stock
+	StripeRefundID  string       `json:"stripe_refund_id,omitempty" db:"stripe_refund_id"`
+	RANumber        string       `json:"ra_number,omitempty" db:"ra_number"` // Numéro d'autorisation de retour
+	InspectionNotes string       `json:"inspection_notes,omitempty" db:"inspection_notes"`
+	ApprovedAt      *time.Time   `json:"approved_at,omitempty" db:"approved_at"`
+	ReceivedAt      *time.Time   `json:"received_at,omitempty" db:"received_at"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt       *time.Time   `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// RefundItem est une ligne de commande (ou une partie de ses quantités) incluse dans un remboursement
+type RefundItem struct {
+	ProductID string `json:"productId"`
+	VariantID string `json:"variant_id,omitempty"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	Amount    Money  `json:"amount"`              // Montant remboursé pour la ligne, remise déduite
+	Condition string `json:"condition,omitempty"` // État constaté à la réception d'un retour
+}
+
+// IsReturn indique si la demande porte sur un retour de marchandise
+func (r Refund) IsReturn() bool {
+	return r.Type == RefundTypeReturn
+}
+
+// Counts indique si la demande bloque les quantités remboursables de la commande.
+// Une demande en échec peut être relancée : elle bloque ses quantités tant qu'elle n'est pas rejetée.
+func (r Refund) Counts() bool {
+	return r.Status != RefundStatusRejected
 }
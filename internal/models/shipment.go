@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Statuts de suivi normalisés, communs à tous les transporteurs
+const (
+	TrackingStatusLabelCreated   = "label_created"
+	TrackingStatusInTransit      = "in_transit"
+	TrackingStatusOutForDelivery = "out_for_delivery"
+	TrackingStatusDelivered      = "delivered"
+	TrackingStatusException      = "exception" // Incident : adresse introuvable, colis endommagé, retour à l'expéditeur...
+)
+
+// Shipment est un colis remis à un transporteur ; une commande peut être expédiée en plusieurs colis
+type Shipment struct {
+	ID             gocql.UUID      `json:"id" db:"shipment_id"`
+	OrderID        gocql.UUID      `json:"order_id" db:"order_id"`
+	Carrier        string          `json:"carrier" db:"carrier"` // Code du transporteur (fake, bpost...)
+	ServiceCode    string          `json:"service_code,omitempty" db:"service_code"`
+	TrackingNumber string          `json:"tracking_number" db:"tracking_number"`
+	TrackingURL    string          `json:"tracking_url,omitempty" db:"-"`
+	LabelKey       string          `json:"-" db:"label_key"` // Objet MinIO de l'étiquette PDF
+	Status         string          `json:"status" db:"status"`
+	Weight         float64         `json:"weight" db:"weight"` // kg
+	Items          []ShipmentItem  `json:"items" db:"items"`   // Lignes de commande contenues dans le colis (JSON)
+	Events         []ShipmentEvent `json:"events,omitempty" db:"-"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      *time.Time      `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// ShipmentItem est une ligne de commande (ou une partie de ses quantités) expédiée dans un colis
+type ShipmentItem struct {
+	ProductID string `json:"productId"`
+	VariantID string `json:"variant_id,omitempty"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+}
+
+// ShipmentEvent est un événement de suivi reçu du transporteur
+type ShipmentEvent struct {
+	ShipmentID    gocql.UUID `json:"shipment_id" db:"shipment_id"`
+	Status        string     `json:"status" db:"status"`                 // Statut normalisé
+	CarrierStatus string     `json:"carrier_status" db:"carrier_status"` // Code brut du transporteur
+	Description   string     `json:"description,omitempty" db:"description"`
+	Location      string     `json:"location,omitempty" db:"location"`
+	OccurredAt    time.Time  `json:"occurred_at" db:"occurred_at"`
+}
@@ -1,16 +1,93 @@
 package models
 
 type ShippingOption struct {
-	ID            string  `json:"id"`
-	Name          string  `json:"name"`
-	Description   string  `json:"description"`
-	Price         float64 `json:"price"`
-	EstimatedDays int     `json:"estimated_days"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Price         Money  `json:"price"`
+	EstimatedDays int    `json:"estimated_days"`
+	Carrier       string `json:"carrier,omitempty"` // Code du transporteur
+	ZoneID        string `json:"zone_id,omitempty"` // Zone de livraison retenue
+	IsFree        bool   `json:"is_free,omitempty"` // Règle de livraison gratuite appliquée
 }
 
 type ShippingCalculation struct {
 	Options       []ShippingOption `json:"options"`
-	FreeThreshold float64          `json:"free_threshold"`
-	CartTotal     float64          `json:"cart_total"`
+	FreeThreshold Money            `json:"free_threshold"`
+	CartTotal     Money            `json:"cart_total"`
 	IsFree        bool             `json:"is_free"`
+	TotalWeight   float64          `json:"total_weight,omitempty"` // kg
+	Zone          string           `json:"zone,omitempty"`
+}
+
+// PostalCodeRange délimite une plage de codes postaux d'un pays (bornes incluses)
+type PostalCodeRange struct {
+	Country string `json:"country"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// ShippingZone regroupe des pays et/ou des plages de codes postaux.
+// Les zones de plus haute priorité sont évaluées en premier.
+type ShippingZone struct {
+	ID           string            `json:"id" db:"id"`
+	Name         string            `json:"name" db:"name"`
+	Countries    []string          `json:"countries" db:"countries"`         // Codes ISO (BE, FR...)
+	PostalRanges []PostalCodeRange `json:"postal_ranges" db:"postal_ranges"` // JSON
+	Priority     int               `json:"priority" db:"priority"`
+	Active       bool              `json:"active" db:"active"`
+}
+
+// ShippingCarrier est un transporteur (bpost, DHL...)
+type ShippingCarrier struct {
+	ID          string `json:"id" db:"id"`
+	Code        string `json:"code" db:"code"`
+	Name        string `json:"name" db:"name"`
+	TrackingURL string `json:"tracking_url,omitempty" db:"tracking_url"` // %s remplacé par le numéro de suivi
+	Active      bool   `json:"active" db:"active"`
+}
+
+// ShippingService est un service d'un transporteur (standard, express...) proposé au checkout
+type ShippingService struct {
+	ID            string `json:"id" db:"id"`
+	CarrierID     string `json:"carrier_id" db:"carrier_id"`
+	Code          string `json:"code" db:"code"` // Identifiant de l'option au checkout
+	Name          string `json:"name" db:"name"`
+	Description   string `json:"description" db:"description"`
+	EstimatedDays int    `json:"estimated_days" db:"estimated_days"`
+	Active        bool   `json:"active" db:"active"`
+}
+
+// ShippingRate est une ligne de grille tarifaire : une zone, un service, une tranche de poids et de montant.
+// Les bornes max à zéro ne sont pas limitées.
+type ShippingRate struct {
+	ID           string  `json:"id" db:"id"`
+	ZoneID       string  `json:"zone_id" db:"zone_id"`
+	ServiceID    string  `json:"service_id" db:"service_id"`
+	MinWeight    float64 `json:"min_weight" db:"min_weight"` // kg, inclus
+	MaxWeight    float64 `json:"max_weight" db:"max_weight"` // kg, exclu
+	MinCartValue Money   `json:"min_cart_value" db:"min_cart_value"`
+	MaxCartValue Money   `json:"max_cart_value" db:"max_cart_value"`
+	Price        Money   `json:"price" db:"price"`
+}
+
+// ShippingClass regroupe des produits aux contraintes de transport particulières (encombrant, fragile...)
+type ShippingClass struct {
+	Code            string   `json:"code" db:"code"`
+	Name            string   `json:"name" db:"name"`
+	Surcharge       Money    `json:"surcharge" db:"surcharge"`
+	PerItem         bool     `json:"per_item" db:"per_item"`                 // Supplément par article plutôt que par commande
+	AllowedServices []string `json:"allowed_services" db:"allowed_services"` // Codes de services autorisés (vide = tous)
+}
+
+// FreeShippingRule offre le tarif de base au-delà d'un montant de marchandises.
+// ZoneID et ServiceID vides s'appliquent à toutes les zones / tous les services.
+type FreeShippingRule struct {
+	ID              string   `json:"id" db:"id"`
+	Name            string   `json:"name" db:"name"`
+	ZoneID          string   `json:"zone_id,omitempty" db:"zone_id"`
+	ServiceID       string   `json:"service_id,omitempty" db:"service_id"`
+	MinCartValue    Money    `json:"min_cart_value" db:"min_cart_value"`
+	ExcludedClasses []string `json:"excluded_classes" db:"excluded_classes"` // Classes qui annulent la gratuité
+	Active          bool     `json:"active" db:"active"`
 }
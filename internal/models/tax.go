@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// Classes de TVA des produits
+const (
+	TaxClassStandard = "standard"
+	TaxClassReduced  = "reduced"
+	TaxClassZero     = "zero"
+)
+
+// Régimes de TVA appliqués à une commande
+const (
+	TaxRegimeDomestic      = "domestic"       // TVA du pays de l'entreprise
+	TaxRegimeOSS           = "oss"            // B2C intra-UE : TVA du pays de destination (guichet unique OSS)
+	TaxRegimeReverseCharge = "reverse_charge" // B2B intra-UE avec numéro de TVA : autoliquidation par le client
+	TaxRegimeExport        = "export"         // Livraison hors UE : exonérée
+)
+
+// TaxLine détaille la TVA d'une ligne (article ou frais de port)
+type TaxLine struct {
+	ProductID   string  `json:"productId,omitempty"`
+	VariantID   string  `json:"variant_id,omitempty"`
+	Description string  `json:"description"`
+	TaxClass    string  `json:"tax_class"`
+	Rate        float64 `json:"rate"` // Pourcentage (21 = 21 %)
+	NetAmount   Money   `json:"net_amount"`
+	TaxAmount   Money   `json:"tax_amount"`
+	GrossAmount Money   `json:"gross_amount"`
+}
+
+// TaxRateTotal regroupe les montants par taux (récapitulatif de facture)
+type TaxRateTotal struct {
+	Rate      float64 `json:"rate"`
+	NetAmount Money   `json:"net_amount"`
+	TaxAmount Money   `json:"tax_amount"`
+}
+
+// TaxSummary est le calcul de TVA d'une commande, enregistré avec elle (colonne tax_details)
+type TaxSummary struct {
+	Regime           string         `json:"regime"`             // Voir TaxRegime*
+	Country          string         `json:"country"`            // Pays dont les taux s'appliquent
+	PricesIncludeTax bool           `json:"prices_include_tax"` // Prix catalogue TTC ou HT
+	VATNumber        string         `json:"vat_number,omitempty"`
+	Lines            []TaxLine      `json:"lines"`
+	Shipping         *TaxLine       `json:"shipping,omitempty"`
+	Rates            []TaxRateTotal `json:"rates"`
+	NetTotal         Money          `json:"net_total"`
+	TaxTotal         Money          `json:"tax_total"`
+	GrossTotal       Money          `json:"gross_total"`
+	Note             string         `json:"note,omitempty"` // Mention légale (autoliquidation, exonération)
+}
+
+// IsTaxClass indique si la classe de TVA est connue (vide = standard)
+func IsTaxClass(class string) bool {
+	switch class {
+	case "", TaxClassStandard, TaxClassReduced, TaxClassZero:
+		return true
+	}
+	return false
+}
+
+// TaxRate est le taux d'une classe de TVA dans un pays (Override : surcharge saisie par l'admin)
+type TaxRate struct {
+	Country  string  `json:"country"`
+	TaxClass string  `json:"tax_class"`
+	Rate     float64 `json:"rate"`
+	Override bool    `json:"override"`
+}
+
+// Statuts du numéro de TVA d'une société
+const (
+	VATStatusValid   = "valid"   // Format, clé de contrôle et VIES vérifiés : autoliquidation possible
+	VATStatusPending = "pending" // VIES indisponible lors de la saisie : revérifié au prochain checkout
+)
+
+// VATVerification est le résultat de la validation d'un numéro de TVA
+type VATVerification struct {
+	VATNumber string    `json:"vat_number"`
+	Status    string    `json:"status"`                    // Voir VATStatus*
+	Name      string    `json:"registered_name,omitempty"` // Raison sociale enregistrée dans VIES
+	CheckedAt time.Time `json:"checked_at"`
+}
@@ -8,6 +8,7 @@ import (
 
 	adminHandlers "cedra_back_end/internal/handlers/admin"
 	"cedra_back_end/internal/handlers/company"
+	"cedra_back_end/internal/handlers/invoice"
 	pa "cedra_back_end/internal/handlers/payement"
 	"cedra_back_end/internal/handlers/product"
 	"cedra_back_end/internal/handlers/user"
@@ -20,7 +21,7 @@ func RegisterRoutes(router *gin.Engine) {
 	router.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true, // ✅ Permet toutes les origines (dev uniquement)
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.IdempotencyHeader},
 		ExposeHeaders:    []string{"Content-Length", "Content-Encoding"},
 		AllowCredentials: false,          // ⚠️ Doit être false avec AllowAllOrigins
 		MaxAge:           24 * time.Hour, // ✅ Augmenté à 24h pour réduire les preflight
@@ -73,6 +74,22 @@ func RegisterRoutes(router *gin.Engine) {
 	{
 		orders.GET("/mine", user.GetMyOrders)
 		orders.GET("/:id", user.GetOrderByID)
+		orders.POST("/:id/cancel", middleware.Idempotency(), pa.CancelOrder)
+		orders.POST("/:id/pay", middleware.Idempotency(), pa.PayApprovedOrder)
+		orders.GET("/:id/tracking", pa.GetOrderTracking)
+		orders.GET("/:id/invoice", invoice.GetOrderInvoice)
+		orders.GET("/:id/invoice/ubl", invoice.GetOrderInvoiceUBL)
+	}
+
+	// ✅ Devis des comptes société (demande depuis le panier, acceptation → commande)
+	quotes := api.Group("/quotes", middleware.AuthRequired())
+	{
+		quotes.POST("", pa.RequestQuote)
+		quotes.GET("", pa.ListMyQuotes)
+		quotes.GET("/:id", pa.GetMyQuote)
+		quotes.GET("/:id/pdf", pa.GetMyQuotePDF)
+		quotes.POST("/:id/accept", middleware.Idempotency(), pa.AcceptQuote)
+		quotes.POST("/:id/decline", pa.DeclineQuote)
 	}
 
 	companyGroup := api.Group("/company", middleware.AuthRequired())
@@ -80,9 +97,18 @@ func RegisterRoutes(router *gin.Engine) {
 		companyGroup.GET("/me", company.GetMyCompany)
 		companyGroup.PUT("/billing", middleware.CompanyAdminRequired(), company.UpdateCompanyBilling)
 		companyGroup.GET("/employees", middleware.CompanyAdminRequired(), company.ListCompanyEmployees)
+		companyGroup.GET("/credit", middleware.CompanyAdminRequired(), company.GetCompanyCredit)
 		companyGroup.POST("/employees", middleware.CompanyAdminRequired(), company.AddCompanyEmployee)
 		companyGroup.DELETE("/employees/:userId", middleware.CompanyAdminRequired(), company.RemoveCompanyEmployee)
 		companyGroup.PUT("/employees/:userId/admin", middleware.CompanyAdminRequired(), company.ToggleEmployeeAdmin)
+		companyGroup.PUT("/employees/:userId/spending-limit", middleware.CompanyAdminRequired(), company.UpdateEmployeeSpendingLimit)
+		companyGroup.GET("/approvals", middleware.CompanyAdminRequired(), pa.ListCompanyApprovals)
+		companyGroup.GET("/orders", middleware.CompanyAdminRequired(), pa.ListCompanyOrders)
+		companyGroup.GET("/addresses", company.ListCompanyAddresses)
+		companyGroup.POST("/addresses", middleware.CompanyAdminRequired(), company.CreateCompanyAddress)
+		companyGroup.DELETE("/addresses/:id", middleware.CompanyAdminRequired(), company.DeleteCompanyAddress)
+		companyGroup.POST("/approvals/:id/approve", middleware.CompanyAdminRequired(), pa.ApproveOrder)
+		companyGroup.POST("/approvals/:id/reject", middleware.CompanyAdminRequired(), pa.RejectOrder)
 	}
 
 	// =========================
@@ -90,11 +116,12 @@ func RegisterRoutes(router *gin.Engine) {
 	// =========================
 	products := api.Group("/products")
 	{
-		products.GET("", product.GetAllProducts)
-		products.GET("/search", middleware.SearchRateLimit(), product.SearchProducts)
-		products.GET("/category/:id", product.GetProductsByCategory)
-		products.GET("/best-sellers", product.GetBestSellers)
-		products.GET("/:id", product.GetProductFull)
+		// Token facultatif : un client connecté voit ses prix (palier, tarif négocié)
+		products.GET("", middleware.OptionalAuth(), product.GetAllProducts)
+		products.GET("/search", middleware.SearchRateLimit(), middleware.OptionalAuth(), product.SearchProducts)
+		products.GET("/category/:id", middleware.OptionalAuth(), product.GetProductsByCategory)
+		products.GET("/best-sellers", middleware.OptionalAuth(), product.GetBestSellers)
+		products.GET("/:id", middleware.OptionalAuth(), product.GetProductFull)
 
 		// 🔹 Routes admin avec permissions granulaires
 		products.POST("", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_PRODUCTS_CREATE),
@@ -132,10 +159,10 @@ func RegisterRoutes(router *gin.Engine) {
 
 	payments := api.Group("/payments")
 	{
-		payments.POST("/create-intent", middleware.AuthRequired(), pa.CreatePaymentIntent)
-		payments.POST("/checkout", middleware.AuthRequired(), pa.Checkout)                     // ✅ Nouveau endpoint checkout
-		payments.GET("/validate-coupon", middleware.AuthRequired(), pa.ValidateCouponDetailed) // ✅ Validation coupon détaillée
-		payments.POST("/webhook", pa.StripeWebhook)                                            // ⚠️ Pas d'auth (Stripe vérifie la signature)
+		payments.POST("/create-intent", middleware.AuthRequired(), middleware.Idempotency(), pa.CreatePaymentIntent)
+		payments.POST("/checkout", middleware.AuthRequired(), middleware.Idempotency(), pa.Checkout) // ✅ Nouveau endpoint checkout
+		payments.GET("/validate-coupon", middleware.AuthRequired(), pa.ValidateCouponDetailed)       // ✅ Validation coupon détaillée
+		payments.POST("/webhook", pa.StripeWebhook)                                                  // ⚠️ Pas d'auth (Stripe vérifie la signature)
 	}
 
 	// ✅ Routes admin pour la gestion des commandes
@@ -143,7 +170,23 @@ func RegisterRoutes(router *gin.Engine) {
 	{
 		adminOrders.GET("", pa.GetAllOrders)
 		adminOrders.GET("/stats", pa.GetOrderStats)
+		adminOrders.GET("/:id", pa.GetOrderDetails)
 		adminOrders.PUT("/:id/status", pa.UpdateOrderStatus)
+		adminOrders.POST("/:id/cancel", middleware.Idempotency(), pa.AdminCancelOrder)
+		adminOrders.POST("/:id/refunds", middleware.Idempotency(), pa.CreateOrderRefund)
+		adminOrders.POST("/:id/shipments", middleware.RequirePermission(models.PERM_ORDERS_EDIT), middleware.Idempotency(), pa.CreateShipment)
+		adminOrders.GET("/:id/shipments", pa.GetOrderShipments)
+	}
+
+	// ✅ Devis : prix consentis, validité et réservation du stock par l'équipe commerciale
+	adminQuotes := api.Group("/admin/quotes", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_ORDERS_VIEW))
+	{
+		adminQuotes.GET("", pa.AdminListQuotes)
+		adminQuotes.GET("/:id", pa.AdminGetQuote)
+		adminQuotes.GET("/:id/pdf", pa.AdminGetQuotePDF)
+		adminQuotes.PUT("/:id", middleware.RequirePermission(models.PERM_ORDERS_EDIT), pa.AdminUpdateQuote)
+		adminQuotes.POST("/:id/send", middleware.RequirePermission(models.PERM_ORDERS_EDIT), pa.SendQuote)
+		adminQuotes.POST("/:id/cancel", middleware.RequirePermission(models.PERM_ORDERS_EDIT), pa.CancelQuote)
 	}
 
 	// ✅ Wishlist
@@ -165,25 +208,125 @@ func RegisterRoutes(router *gin.Engine) {
 	refunds := api.Group("/refunds", middleware.AuthRequired())
 	{
 		refunds.GET("/mine", pa.GetUserRefunds)
-		refunds.POST("/order/:orderId", pa.RequestRefund)
+		refunds.POST("/order/:orderId", middleware.Idempotency(), pa.RequestRefund)
+		refunds.POST("/returns/order/:orderId", middleware.Idempotency(), pa.RequestReturn)
+		refunds.GET("/:refundId/slip", pa.GetReturnSlip)
 	}
 
 	adminRefunds := api.Group("/admin/refunds", middleware.AuthRequired(), middleware.RequireAdmin)
 	{
 		adminRefunds.GET("", pa.GetAllRefunds)
 		adminRefunds.PUT("/:refundId/process", pa.ProcessRefund)
+		adminRefunds.GET("/ra/:raNumber", pa.GetReturnByRA)
+		adminRefunds.GET("/:refundId/slip", pa.GetReturnSlip)
+		adminRefunds.PUT("/:refundId/receive", middleware.RequirePermission(models.PERM_INVENTORY_EDIT), pa.ReceiveReturn)
+		adminRefunds.POST("/:refundId/credit-note", middleware.RequirePermission(models.PERM_FINANCE_INVOICES), pa.IssueRefundCreditNote)
+	}
+
+	// ✅ Événements Stripe reçus par le webhook (journal idempotent)
+	adminPayments := api.Group("/admin/payments", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_FINANCE_VIEW))
+	{
+		adminPayments.GET("/events", pa.GetStripeEvents)
+		adminPayments.GET("/events/:eventId", pa.GetStripeEvent)
+	}
+
+	// ✅ Factures et notes de crédit (consultation, recherche et renvoi)
+	adminInvoices := api.Group("/admin/invoices", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_FINANCE_INVOICES))
+	{
+		adminInvoices.GET("", invoice.ListInvoices)
+		adminInvoices.GET("/receivables", invoice.ListReceivables)
+		adminInvoices.POST("/receivables/dunning", invoice.RunDunning)
+		adminInvoices.GET("/orphan-numbers", invoice.ListOrphanNumbers)
+		adminInvoices.POST("/orphan-numbers/:number/void", invoice.VoidOrphanNumber)
+		adminInvoices.GET("/:number", invoice.GetInvoice)
+		adminInvoices.POST("/:number/send", invoice.ResendInvoice)
+		adminInvoices.GET("/:number/ubl", invoice.GetInvoiceUBL)
+		adminInvoices.POST("/:number/peppol", invoice.SendInvoicePeppol)
+		adminInvoices.POST("/orders/:id/send", invoice.SendInvoice)
+		adminInvoices.GET("/credit-notes", invoice.ListCreditNotes)
+		adminInvoices.GET("/credit-notes/:number", invoice.GetCreditNote)
+		adminInvoices.GET("/credit-notes/:number/ubl", invoice.GetCreditNoteUBL)
+		adminInvoices.POST("/credit-notes/:number/peppol", invoice.SendCreditNotePeppol)
+	}
+
+	// ✅ Paiement sur facture des sociétés (approbation, plafond de crédit, délai de paiement)
+	adminCompanies := api.Group("/admin/companies", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_FINANCE_INVOICES))
+	{
+		adminCompanies.GET("/:id/credit", company.AdminGetCompanyCredit)
+		adminCompanies.PUT("/:id/credit", company.AdminUpdateCompanyCredit)
+	}
+
+	// ✅ Tarifs B2B : listes de prix, groupes de clients, prix dégressifs
+	adminPricing := api.Group("/admin/pricing", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_PRODUCTS_PRICE))
+	{
+		adminPricing.GET("/price-lists", adminHandlers.ListPriceLists)
+		adminPricing.POST("/price-lists", adminHandlers.CreatePriceList)
+		adminPricing.GET("/price-lists/:id", adminHandlers.GetPriceList)
+		adminPricing.PUT("/price-lists/:id", adminHandlers.UpdatePriceList)
+		adminPricing.DELETE("/price-lists/:id", adminHandlers.DeletePriceList)
+		adminPricing.GET("/customer-groups", adminHandlers.ListCustomerGroups)
+		adminPricing.POST("/customer-groups", adminHandlers.SaveCustomerGroup)
+		adminPricing.PUT("/customer-groups/:id", adminHandlers.SaveCustomerGroup)
+		adminPricing.DELETE("/customer-groups/:id", adminHandlers.DeleteCustomerGroup)
+		adminPricing.PUT("/companies/:id", adminHandlers.UpdateCompanyPricing)
+		adminPricing.PUT("/users/:id", adminHandlers.UpdateUserCustomerGroup)
+		adminPricing.GET("/products/:id/tiers", adminHandlers.GetProductPriceTiers)
+		adminPricing.PUT("/products/:id/tiers", adminHandlers.ReplaceProductPriceTiers)
+	}
+
+	// ✅ Rapprochement des virements (extraits CODA / camt.053)
+	adminBank := api.Group("/admin/bank", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_FINANCE_INVOICES))
+	{
+		adminBank.POST("/statements", pa.ImportBankStatement)
+		adminBank.GET("/statements", pa.ListBankStatements)
+		adminBank.GET("/transactions", pa.ListBankTransactions)
+		adminBank.POST("/transactions/:id/match", pa.MatchBankTransaction)
+		adminBank.POST("/transactions/:id/ignore", pa.IgnoreBankTransaction)
 	}
 
 	// ✅ Shipping
 	shipping := api.Group("/shipping")
 	{
-		shipping.GET("/options", pa.GetShippingOptions)
+		shipping.GET("/options", middleware.AuthRequired(), pa.GetShippingOptions)
+		shipping.POST("/webhooks/:carrier", pa.CarrierWebhook) // ⚠️ Pas d'auth (signature vérifiée par le transporteur)
+	}
+
+	adminShipments := api.Group("/admin/shipments", middleware.AuthRequired(), middleware.RequireAdmin)
+	{
+		adminShipments.GET("/:shipmentId/label", pa.GetShipmentLabel)
+	}
+
+	// ✅ Configuration des tarifs de livraison
+	adminShipping := api.Group("/admin/shipping", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_ADMIN_SETTINGS))
+	{
+		adminShipping.GET("", adminHandlers.GetShippingConfig)
+		adminShipping.POST("/zones", adminHandlers.SaveShippingZone)
+		adminShipping.PUT("/zones/:id", adminHandlers.SaveShippingZone)
+		adminShipping.POST("/carriers", adminHandlers.SaveShippingCarrier)
+		adminShipping.PUT("/carriers/:id", adminHandlers.SaveShippingCarrier)
+		adminShipping.POST("/services", adminHandlers.SaveShippingService)
+		adminShipping.PUT("/services/:id", adminHandlers.SaveShippingService)
+		adminShipping.POST("/rates", adminHandlers.SaveShippingRate)
+		adminShipping.PUT("/rates/:id", adminHandlers.SaveShippingRate)
+		adminShipping.POST("/classes", adminHandlers.SaveShippingClass)
+		adminShipping.PUT("/classes/:id", adminHandlers.SaveShippingClass)
+		adminShipping.POST("/free-rules", adminHandlers.SaveFreeShippingRule)
+		adminShipping.PUT("/free-rules/:id", adminHandlers.SaveFreeShippingRule)
+		adminShipping.DELETE("/:kind/:id", adminHandlers.DeleteShippingEntity)
+	}
+
+	// ✅ TVA (taux par pays et par classe)
+	adminTax := api.Group("/admin/tax", middleware.AuthRequired(), middleware.RequirePermission(models.PERM_ADMIN_SETTINGS))
+	{
+		adminTax.GET("/rates", adminHandlers.GetTaxRates)
+		adminTax.PUT("/rates/:country/:class", adminHandlers.SaveTaxRate)
+		adminTax.DELETE("/rates/:country/:class", adminHandlers.DeleteTaxRate)
 	}
 
 	// ✅ Advanced Search
 	search := api.Group("/search")
 	{
-		search.GET("/advanced", product.SearchProductsAdvanced)
+		search.GET("/advanced", middleware.OptionalAuth(), product.SearchProductsAdvanced)
 		search.GET("/filters", product.GetProductFilters)
 	}
 
@@ -0,0 +1,504 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	ErrInvoiceAlreadyPaid = errors.New("facture déjà payée")
+	ErrBankTxResolved     = errors.New("virement déjà rapproché ou écarté")
+	ErrBankAmountMismatch = errors.New("montant du virement différent du total de la facture")
+	ErrForeignBankAccount = errors.New("extrait d'un autre compte que celui imprimé sur les factures")
+	errBankTxDuplicate    = errors.New("virement déjà importé")
+)
+
+// bankTxStatusClaimed : virement en cours de rapprochement manuel (retiré de la file, pas encore résolu)
+const bankTxStatusClaimed = "claimed"
+
+const bankTransactionColumns = `transaction_id, statement_id, account, booking_date, value_date, amount, currency, counterparty_name,
+	counterparty_account, structured_reference, communication, bank_reference, status, invoice_number, order_id, matched_by,
+	note, imported_at, resolved_at`
+
+// =========================
+// Communication structurée
+// =========================
+
+// StructuredReference calcule la communication structurée belge (+++xxx/xxxx/xxxxx+++) d'une facture :
+// exercice sur 2 chiffres et numéro de séquence sur 8, suivis du modulo 97
+func StructuredReference(fiscalYear int, sequence int64) string {
+	base := fmt.Sprintf("%02d%08d", fiscalYear%100, sequence%100000000)
+	return FormatStructuredReference(base + structuredReferenceCheck(base))
+}
+
+// FormatStructuredReference normalise une communication structurée ("+++123/4567/89002+++", "***...***",
+// "123456789002") ; retourne "" si elle n'a pas 12 chiffres ou si le modulo 97 est faux
+func FormatStructuredReference(value string) string {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == '+', r == '*', r == '/', r == ' ', r == '-', r == '.':
+			return -1
+		default:
+			return 'x'
+		}
+	}, value)
+	if len(digits) != 12 || strings.Contains(digits, "x") {
+		return ""
+	}
+	if structuredReferenceCheck(digits[:10]) != digits[10:] {
+		return ""
+	}
+	return "+++" + digits[:3] + "/" + digits[3:7] + "/" + digits[7:] + "+++"
+}
+
+// structuredReferenceCheck : reste de la division par 97 des 10 premiers chiffres (97 quand il est nul)
+func structuredReferenceCheck(base string) string {
+	n, _ := strconv.ParseInt(base, 10, 64)
+	check := n % 97
+	if check == 0 {
+		check = 97
+	}
+	return fmt.Sprintf("%02d", check)
+}
+
+// =========================
+// Rapprochement
+// =========================
+
+// MatchBankTransaction cherche la facture ouverte désignée par le virement : communication structurée, numéro de
+// facture ou ancienne référence FACT-<commande> dans la communication libre. Le montant doit correspondre au
+// centime près (total de la facture, ou total et frais de retard réclamés) ; sinon la facture est retournée avec
+// ErrBankAmountMismatch pour le rapprochement manuel.
+func MatchBankTransaction(tx *models.BankTransaction, open []models.Receivable) (*models.Invoice, error) {
+	references := []string{}
+	if tx.StructuredReference != "" {
+		references = append(references, tx.StructuredReference)
+	}
+	// Communication structurée recopiée dans la communication libre
+	for _, word := range strings.Fields(strings.NewReplacer("+", " ", "*", " ").Replace(tx.Communication)) {
+		if ref := FormatStructuredReference(word); ref != "" {
+			references = append(references, ref)
+		}
+	}
+	if ref := FormatStructuredReference(tx.Communication); ref != "" {
+		references = append(references, ref)
+	}
+	communication := compactReference(tx.Communication)
+
+	for i := range open {
+		inv := &open[i].Invoice
+		found := false
+		for _, ref := range references {
+			if ref == StructuredReference(inv.FiscalYear, inv.Sequence) || ref == inv.PaymentReference {
+				found = true
+				break
+			}
+		}
+		if !found && communication != "" {
+			found = strings.Contains(communication, compactReference(inv.Number)) ||
+				strings.Contains(communication, compactReference("FACT-"+inv.OrderID.String()))
+		}
+		if !found {
+			continue
+		}
+
+		if !bankAmountMatches(tx.Amount, open[i]) {
+			return inv, ErrBankAmountMismatch
+		}
+		return inv, nil
+	}
+	return nil, gocql.ErrNotFound
+}
+
+// bankAmountMatches accepte le total de la facture, ou le montant réclamé par la dernière relance
+func bankAmountMatches(amount models.Money, r models.Receivable) bool {
+	if amount.CurrencyCode() != r.Invoice.GrossTotal.CurrencyCode() {
+		return false
+	}
+	return amount.Amount == r.Invoice.GrossTotal.Amount || amount.Amount == r.AmountDue().Amount
+}
+
+// compactReference met une référence en majuscules sans séparateurs ("F2026-000001" → "F2026000001")
+func compactReference(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'Z':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return -1
+		}
+	}, value)
+}
+
+// GetInvoicePayment retourne la date de paiement d'une facture (nil si ouverte) et le virement rapproché
+func GetInvoicePayment(inv *models.Invoice) (*time.Time, string, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		paidAt        *time.Time
+		transactionID string
+	)
+	if err := session.Query("SELECT paid_at, bank_transaction_id FROM invoices WHERE invoice_number = ?", inv.Number).
+		Scan(&paidAt, &transactionID); err != nil {
+		return nil, "", err
+	}
+	if paidAt == nil {
+		paidAt = inv.PaidAt
+	}
+	return paidAt, transactionID, nil
+}
+
+// MarkInvoicePaid enregistre le paiement d'une facture par virement (compare-and-set : un seul virement par facture)
+func MarkInvoicePaid(inv *models.Invoice, paidAt time.Time, transactionID string) error {
+	if inv.PaidAt != nil {
+		return ErrInvoiceAlreadyPaid
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	applied, err := session.Query("UPDATE invoices SET paid_at = ?, bank_transaction_id = ? WHERE invoice_number = ? IF paid_at = null",
+		paidAt, transactionID, inv.Number).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrInvoiceAlreadyPaid
+	}
+
+	log.Printf("💰 Facture %s payée par virement (%s)", inv.Number, transactionID)
+	return nil
+}
+
+// ImportBankStatement enregistre les crédits d'un extrait et rapproche automatiquement ceux qui désignent une facture
+// ouverte au bon montant. Les autres rejoignent la file de rapprochement manuel ; les débits sont ignorés.
+// Retourne l'extrait et les virements nouvellement importés.
+func ImportBankStatement(file *BankStatementFile, filename, importedBy string) (*models.BankStatement, []models.BankTransaction, error) {
+	if iban, _ := utils.GetBankDetails(); iban != "" && file.Account != "" &&
+		compactReference(iban) != compactReference(file.Account) {
+		return nil, nil, ErrForeignBankAccount
+	}
+
+	open, err := ListReceivables(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	statement := &models.BankStatement{
+		ID:            gocql.TimeUUID(),
+		Format:        file.Format,
+		Filename:      filename,
+		Account:       file.Account,
+		StatementDate: file.Date,
+		ImportedBy:    importedBy,
+		ImportedAt:    now,
+	}
+	if statement.StatementDate.IsZero() {
+		statement.StatementDate = now
+	}
+
+	imported := []models.BankTransaction{}
+	for _, line := range file.Transactions {
+		if line.Amount.Amount <= 0 {
+			continue
+		}
+
+		tx := line
+		tx.ID = bankTransactionID(&tx)
+		tx.StatementID = statement.ID
+		tx.Status = models.BankTxStatusUnmatched
+		tx.ImportedAt = now
+
+		// Réservation de la ligne avant tout rapprochement : un virement réimporté ne paie pas deux fois
+		if err := insertBankTransaction(&tx); err != nil {
+			if err == errBankTxDuplicate {
+				statement.DuplicateCount++
+				continue
+			}
+			return nil, nil, err
+		}
+		statement.TransactionCount++
+
+		inv, err := MatchBankTransaction(&tx, open)
+		switch {
+		case err == nil:
+			if err := MarkInvoicePaid(inv, tx.BookingDate, tx.ID); err != nil {
+				tx.Note = "facture " + inv.Number + " : " + err.Error()
+				break
+			}
+			tx.Status = models.BankTxStatusMatched
+			tx.InvoiceNumber = inv.Number
+			tx.OrderID = &inv.OrderID
+			tx.MatchedBy = "auto"
+			tx.ResolvedAt = &now
+			open = removeReceivable(open, inv.Number)
+		case err == ErrBankAmountMismatch:
+			tx.InvoiceNumber = inv.Number
+			tx.Note = fmt.Sprintf("montant différent de la facture %s (%s attendus)", inv.Number, inv.GrossTotal)
+		default:
+			tx.Note = "aucune facture ouverte ne correspond à la communication"
+		}
+
+		if err := saveBankTransactionResolution(&tx); err != nil {
+			log.Printf("⚠️ Rapprochement du virement %s non enregistré: %v", tx.ID, err)
+		}
+		if tx.Status == models.BankTxStatusMatched {
+			statement.MatchedCount++
+		} else {
+			statement.UnmatchedCount++
+		}
+		imported = append(imported, tx)
+	}
+
+	if err := saveBankStatement(statement); err != nil {
+		log.Printf("⚠️ Extrait %s non enregistré: %v", filename, err)
+	}
+
+	log.Printf("🏦 Extrait %s importé : %d virement(s), %d rapproché(s), %d à traiter, %d doublon(s)",
+		filename, statement.TransactionCount, statement.MatchedCount, statement.UnmatchedCount, statement.DuplicateCount)
+	return statement, imported, nil
+}
+
+// MatchBankTransactionManually rapproche un virement de la file d'attente d'une facture choisie par un administrateur.
+// Un écart de montant doit être accepté explicitement (acceptDifference).
+func MatchBankTransactionManually(id, invoiceNumber, adminID, note string, acceptDifference bool) (*models.BankTransaction, *models.Invoice, error) {
+	tx, err := GetBankTransaction(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tx.Status != models.BankTxStatusUnmatched {
+		return nil, nil, ErrBankTxResolved
+	}
+
+	inv, err := GetInvoice(invoiceNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !acceptDifference && !bankAmountMatches(tx.Amount, models.Receivable{Invoice: *inv, LateFee: invoiceLateFee(inv.Number)}) {
+		return tx, inv, ErrBankAmountMismatch
+	}
+
+	// Le virement est réservé avant le paiement de la facture : deux administrateurs ne le rapprochent pas deux fois
+	if err := claimBankTransaction(tx.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := MarkInvoicePaid(inv, tx.BookingDate, tx.ID); err != nil {
+		tx.Status = models.BankTxStatusUnmatched
+		if err := saveBankTransactionResolution(tx); err != nil {
+			log.Printf("⚠️ Virement %s non remis en file d'attente: %v", tx.ID, err)
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	tx.Status = models.BankTxStatusMatched
+	tx.InvoiceNumber = inv.Number
+	tx.OrderID = &inv.OrderID
+	tx.MatchedBy = adminID
+	tx.Note = note
+	tx.ResolvedAt = &now
+	if err := saveBankTransactionResolution(tx); err != nil {
+		return tx, inv, err
+	}
+	return tx, inv, nil
+}
+
+// IgnoreBankTransaction retire un virement de la file d'attente (remboursement fournisseur, virement interne...)
+func IgnoreBankTransaction(id, adminID, note string) (*models.BankTransaction, error) {
+	tx, err := GetBankTransaction(id)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Status != models.BankTxStatusUnmatched {
+		return nil, ErrBankTxResolved
+	}
+	if err := claimBankTransaction(tx.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tx.Status = models.BankTxStatusIgnored
+	tx.InvoiceNumber = ""
+	tx.OrderID = nil
+	tx.MatchedBy = adminID
+	tx.Note = note
+	tx.ResolvedAt = &now
+	if err := saveBankTransactionResolution(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func removeReceivable(receivables []models.Receivable, number string) []models.Receivable {
+	for i := range receivables {
+		if receivables[i].Invoice.Number == number {
+			return append(receivables[:i], receivables[i+1:]...)
+		}
+	}
+	return receivables
+}
+
+// =========================
+// Persistance
+// =========================
+
+// GetBankTransaction charge un virement importé
+func GetBankTransaction(id string) (*models.BankTransaction, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	txs, err := scanBankTransactions(session.Query("SELECT "+bankTransactionColumns+" FROM bank_transactions WHERE transaction_id = ?", id).Iter())
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		return nil, gocql.ErrNotFound
+	}
+	return &txs[0], nil
+}
+
+// ListBankTransactions retourne les virements d'un statut (tous si vide), du plus récent au plus ancien
+func ListBankTransactions(status string) ([]models.BankTransaction, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	query := session.Query("SELECT " + bankTransactionColumns + " FROM bank_transactions")
+	if status != "" {
+		query = session.Query("SELECT "+bankTransactionColumns+" FROM bank_transactions WHERE status = ? ALLOW FILTERING", status)
+	}
+	txs, err := scanBankTransactions(query.Iter())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(txs, func(i, j int) bool { return txs[i].BookingDate.After(txs[j].BookingDate) })
+	return txs, nil
+}
+
+// ListBankStatements retourne l'historique des extraits importés, du plus récent au plus ancien
+func ListBankStatements() ([]models.BankStatement, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(`SELECT statement_id, format, filename, account, statement_date, transaction_count, matched_count,
+		unmatched_count, duplicate_count, imported_by, imported_at FROM bank_statements`).Iter()
+	statements := []models.BankStatement{}
+	var s models.BankStatement
+	for iter.Scan(&s.ID, &s.Format, &s.Filename, &s.Account, &s.StatementDate, &s.TransactionCount, &s.MatchedCount,
+		&s.UnmatchedCount, &s.DuplicateCount, &s.ImportedBy, &s.ImportedAt) {
+		statements = append(statements, s)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(statements, func(i, j int) bool { return statements[i].ImportedAt.After(statements[j].ImportedAt) })
+	return statements, nil
+}
+
+func scanBankTransactions(iter *gocql.Iter) ([]models.BankTransaction, error) {
+	txs := []models.BankTransaction{}
+	for {
+		var (
+			tx       models.BankTransaction
+			currency string
+		)
+		if !iter.Scan(&tx.ID, &tx.StatementID, &tx.Account, &tx.BookingDate, &tx.ValueDate, &tx.Amount, &currency,
+			&tx.CounterpartyName, &tx.CounterpartyAccount, &tx.StructuredReference, &tx.Communication, &tx.BankReference,
+			&tx.Status, &tx.InvoiceNumber, &tx.OrderID, &tx.MatchedBy, &tx.Note, &tx.ImportedAt, &tx.ResolvedAt) {
+			break
+		}
+		tx.Amount.Currency = currency
+		txs = append(txs, tx)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func insertBankTransaction(tx *models.BankTransaction) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	applied, err := session.Query(`INSERT INTO bank_transactions (transaction_id, statement_id, account, booking_date, value_date,
+		amount, currency, counterparty_name, counterparty_account, structured_reference, communication, bank_reference, status, imported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		tx.ID, tx.StatementID, tx.Account, tx.BookingDate, tx.ValueDate, tx.Amount, tx.Amount.CurrencyCode(), tx.CounterpartyName,
+		tx.CounterpartyAccount, tx.StructuredReference, tx.Communication, tx.BankReference, tx.Status, tx.ImportedAt).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errBankTxDuplicate
+	}
+	return nil
+}
+
+// claimBankTransaction fait sortir le virement de la file d'attente (compare-and-set sur le statut)
+func claimBankTransaction(id string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	applied, err := session.Query("UPDATE bank_transactions SET status = ? WHERE transaction_id = ? IF status = ?",
+		bankTxStatusClaimed, id, models.BankTxStatusUnmatched).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrBankTxResolved
+	}
+	return nil
+}
+
+func saveBankTransactionResolution(tx *models.BankTransaction) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	return session.Query(`UPDATE bank_transactions SET status = ?, invoice_number = ?, order_id = ?, matched_by = ?, note = ?, resolved_at = ?
+		WHERE transaction_id = ?`, tx.Status, tx.InvoiceNumber, tx.OrderID, tx.MatchedBy, tx.Note, tx.ResolvedAt, tx.ID).Exec()
+}
+
+func saveBankStatement(s *models.BankStatement) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	return session.Query(`INSERT INTO bank_statements (statement_id, format, filename, account, statement_date, transaction_count,
+		matched_count, unmatched_count, duplicate_count, imported_by, imported_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.Format, s.Filename, s.Account, s.StatementDate, s.TransactionCount, s.MatchedCount, s.UnmatchedCount,
+		s.DuplicateCount, s.ImportedBy, s.ImportedAt).Exec()
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"cedra_back_end/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownBankFormat : le fichier n'est ni un CODA ni un camt.053
+var ErrUnknownBankFormat = errors.New("format d'extrait bancaire non reconnu (CODA ou camt.053 attendu)")
+
+// BankStatementFile est le contenu lu d'un extrait bancaire, avant rapprochement
+type BankStatementFile struct {
+	Format       string
+	Account      string
+	Date         time.Time
+	Transactions []models.BankTransaction // Crédits et débits, montants signés
+}
+
+// ParseBankStatement détecte le format de l'extrait (XML camt.053 ou CODA) et le lit
+func ParseBankStatement(data []byte) (*BankStatementFile, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return ParseCAMT053(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("0")):
+		return ParseCODA(trimmed)
+	default:
+		return nil, ErrUnknownBankFormat
+	}
+}
+
+// =========================
+// CODA
+// =========================
+
+// ParseCODA lit un extrait CODA 2.x : enregistrements de 128 caractères, mouvements en 2.1 / 2.2 / 2.3.
+// Un mouvement globalisé (plusieurs virements regroupés) est remplacé par ses lignes de détail.
+func ParseCODA(data []byte) (*BankStatementFile, error) {
+	statement := &BankStatementFile{Format: models.BankFormatCODA}
+	currency := models.DefaultCurrency
+
+	type movement struct {
+		tx        models.BankTransaction
+		sequence  string
+		detail    string
+		globalise bool
+	}
+	var (
+		movements []*movement
+		current   *movement
+		details   = map[string]bool{} // Mouvements qui ont des lignes de détail
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line) < 128 {
+			line += strings.Repeat(" ", 128-len(line))
+		}
+
+		switch {
+		case line[0] == '0':
+			// En-tête : date de création
+			if date, err := parseCODADate(field(line, 6, 11)); err == nil {
+				statement.Date = date
+			}
+
+		case line[0] == '1':
+			// Ancien solde : compte (structure 2 / 3 = IBAN) et devise
+			switch line[1] {
+			case '2', '3':
+				statement.Account = strings.TrimSpace(field(line, 6, 39))
+				currency = field(line, 40, 42)
+			default:
+				statement.Account = strings.TrimSpace(field(line, 6, 17))
+				currency = field(line, 19, 21)
+			}
+			if date, err := parseCODADate(field(line, 59, 64)); err == nil && statement.Date.IsZero() {
+				statement.Date = date
+			}
+
+		case line[0] == '2' && line[1] == '1':
+			amount, err := strconv.ParseInt(field(line, 33, 47), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("CODA ligne %d : montant invalide", lineNumber)
+			}
+			// 3 décimales dans le fichier, centimes en interne
+			cents := amount / 10
+			if line[31] == '1' {
+				cents = -cents
+			}
+
+			m := &movement{
+				sequence:  field(line, 3, 6),
+				detail:    field(line, 7, 10),
+				globalise: line[124] != '0' && line[124] != ' ',
+				tx: models.BankTransaction{
+					Amount:        models.Money{Amount: cents, Currency: currency},
+					BankReference: strings.TrimSpace(field(line, 11, 31)),
+				},
+			}
+			m.tx.ValueDate, _ = parseCODADate(field(line, 48, 53))
+			m.tx.BookingDate, _ = parseCODADate(field(line, 116, 121))
+			if m.tx.BookingDate.IsZero() {
+				m.tx.BookingDate = m.tx.ValueDate
+			}
+
+			communication := field(line, 63, 115)
+			if line[61] == '1' {
+				// Communication structurée : type 101 / 102 = référence belge (OGM-VCS) sur 12 chiffres
+				if code := communication[:3]; code == "101" || code == "102" {
+					m.tx.StructuredReference = FormatStructuredReference(communication[3:15])
+				} else {
+					m.tx.Communication = strings.TrimSpace(communication[3:])
+				}
+			} else {
+				m.tx.Communication = strings.TrimSpace(communication)
+			}
+
+			if m.detail != "0000" {
+				details[m.sequence] = true
+			}
+			movements = append(movements, m)
+			current = m
+
+		case line[0] == '2' && line[1] == '2':
+			if current != nil && current.tx.StructuredReference == "" {
+				current.tx.Communication = joinCommunication(current.tx.Communication, field(line, 11, 63))
+			}
+
+		case line[0] == '2' && line[1] == '3':
+			if current != nil {
+				current.tx.CounterpartyAccount = strings.TrimSpace(field(line, 11, 44))
+				current.tx.CounterpartyName = strings.TrimSpace(field(line, 48, 82))
+				if current.tx.StructuredReference == "" {
+					current.tx.Communication = joinCommunication(current.tx.Communication, field(line, 83, 125))
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if statement.Account == "" && len(movements) == 0 {
+		return nil, ErrUnknownBankFormat
+	}
+
+	for _, m := range movements {
+		// Le mouvement globalisé n'est qu'un total : seules ses lignes de détail sont des virements
+		if m.detail == "0000" && m.globalise && details[m.sequence] {
+			continue
+		}
+		m.tx.Account = statement.Account
+		statement.Transactions = append(statement.Transactions, m.tx)
+	}
+	return statement, nil
+}
+
+// field retourne les positions from à to (numérotées à partir de 1, bornes incluses) d'un enregistrement CODA
+func field(line string, from, to int) string {
+	if from > len(line) {
+		return ""
+	}
+	if to > len(line) {
+		to = len(line)
+	}
+	return line[from-1 : to]
+}
+
+func parseCODADate(value string) (time.Time, error) {
+	return time.Parse("020106", value)
+}
+
+func joinCommunication(current, next string) string {
+	next = strings.TrimSpace(next)
+	if next == "" {
+		return current
+	}
+	if current == "" {
+		return next
+	}
+	return current + " " + next
+}
+
+// =========================
+// camt.053
+// =========================
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtStatus : "BOOK" en texte (camt.053.001.02) ou dans <Cd> (camt.053.001.08 et suivants)
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtParty struct {
+	Name     string `xml:"Nm"`
+	PtyName  string `xml:"Pty>Nm"` // camt.053.001.08 et suivants
+	IBAN     string `xml:"Id>IBAN"`
+	OtherAcc string `xml:"Id>Othr>Id"`
+}
+
+type camtTransaction struct {
+	AccountRef  string      `xml:"Refs>AcctSvcrRef"`
+	EndToEndID  string      `xml:"Refs>EndToEndId"`
+	Amount      *camtAmount `xml:"Amt"`
+	TxAmount    *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	CreditDebit string      `xml:"CdtDbtInd"`
+	Debtor      camtParty   `xml:"RltdPties>Dbtr"`
+	DebtorAcct  camtParty   `xml:"RltdPties>DbtrAcct"`
+	Unstructure []string    `xml:"RmtInf>Ustrd"`
+	Structured  []string    `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+}
+
+type camtEntry struct {
+	Amount       camtAmount        `xml:"Amt"`
+	CreditDebit  string            `xml:"CdtDbtInd"`
+	Status       camtStatus        `xml:"Sts"`
+	BookingDate  camtDate          `xml:"BookgDt"`
+	ValueDate    camtDate          `xml:"ValDt"`
+	AccountRef   string            `xml:"AcctSvcrRef"`
+	Transactions []camtTransaction `xml:"NtryDtls>TxDtls"`
+}
+
+type camtStatement struct {
+	ID        string      `xml:"Id"`
+	CreatedAt string      `xml:"CreDtTm"`
+	IBAN      string      `xml:"Acct>Id>IBAN"`
+	Currency  string      `xml:"Acct>Ccy"`
+	Entries   []camtEntry `xml:"Ntry"`
+}
+
+type camtDocument struct {
+	XMLName    xml.Name        `xml:"Document"`
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// ParseCAMT053 lit un extrait ISO 20022 camt.053 ; seules les écritures comptabilisées (BOOK) sont retenues.
+// Une écriture regroupant plusieurs virements (TxDtls) donne une transaction par virement.
+func ParseCAMT053(data []byte) (*BankStatementFile, error) {
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("camt.053 illisible: %v", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, ErrUnknownBankFormat
+	}
+
+	statement := &BankStatementFile{Format: models.BankFormatCAMT053}
+	for _, stmt := range doc.Statements {
+		if statement.Account == "" {
+			statement.Account = stmt.IBAN
+		}
+		if date, err := parseCAMTDate(stmt.CreatedAt); err == nil && statement.Date.IsZero() {
+			statement.Date = date
+		}
+
+		for i, entry := range stmt.Entries {
+			status := strings.TrimSpace(entry.Status.Code)
+			if status == "" {
+				status = strings.TrimSpace(entry.Status.Text)
+			}
+			if status != "" && status != "BOOK" {
+				continue
+			}
+
+			base := models.BankTransaction{
+				Account:       stmt.IBAN,
+				BankReference: entry.AccountRef,
+			}
+			base.BookingDate, _ = parseCAMTDate(entry.BookingDate.value())
+			base.ValueDate, _ = parseCAMTDate(entry.ValueDate.value())
+			if base.BookingDate.IsZero() {
+				base.BookingDate = base.ValueDate
+			}
+
+			if len(entry.Transactions) == 0 {
+				amount, err := camtMoney(entry.Amount, entry.CreditDebit, stmt.Currency)
+				if err != nil {
+					return nil, fmt.Errorf("camt.053 écriture %d : %v", i+1, err)
+				}
+				base.Amount = amount
+				statement.Transactions = append(statement.Transactions, base)
+				continue
+			}
+
+			for _, detail := range entry.Transactions {
+				tx := base
+				amount := entry.Amount
+				switch {
+				case detail.Amount != nil:
+					amount = *detail.Amount
+				case detail.TxAmount != nil:
+					amount = *detail.TxAmount
+				case len(entry.Transactions) > 1:
+					return nil, fmt.Errorf("camt.053 écriture %d : montant de détail manquant", i+1)
+				}
+				indicator := detail.CreditDebit
+				if indicator == "" {
+					indicator = entry.CreditDebit
+				}
+				money, err := camtMoney(amount, indicator, stmt.Currency)
+				if err != nil {
+					return nil, fmt.Errorf("camt.053 écriture %d : %v", i+1, err)
+				}
+				tx.Amount = money
+
+				if detail.AccountRef != "" {
+					tx.BankReference = detail.AccountRef
+				} else if detail.EndToEndID != "" && detail.EndToEndID != "NOTPROVIDED" {
+					tx.BankReference = detail.EndToEndID
+				}
+				tx.CounterpartyName = detail.Debtor.Name
+				if tx.CounterpartyName == "" {
+					tx.CounterpartyName = detail.Debtor.PtyName
+				}
+				tx.CounterpartyAccount = detail.DebtorAcct.IBAN
+				if tx.CounterpartyAccount == "" {
+					tx.CounterpartyAccount = detail.DebtorAcct.OtherAcc
+				}
+
+				for _, ref := range detail.Structured {
+					if formatted := FormatStructuredReference(ref); formatted != "" {
+						tx.StructuredReference = formatted
+						break
+					}
+					tx.Communication = joinCommunication(tx.Communication, ref)
+				}
+				for _, text := range detail.Unstructure {
+					tx.Communication = joinCommunication(tx.Communication, text)
+				}
+				statement.Transactions = append(statement.Transactions, tx)
+			}
+		}
+	}
+	return statement, nil
+}
+
+func (d camtDate) value() string {
+	if d.Date != "" {
+		return d.Date
+	}
+	return d.DateTime
+}
+
+func parseCAMTDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date invalide %q", value)
+}
+
+// camtMoney convertit un montant camt ("1234.5", CRDT/DBIT) en montant signé
+func camtMoney(amount camtAmount, indicator, fallbackCurrency string) (models.Money, error) {
+	cents, err := parseDecimalCents(amount.Value)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if indicator == "DBIT" {
+		cents = -cents
+	}
+	currency := amount.Currency
+	if currency == "" {
+		currency = fallbackCurrency
+	}
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	return models.Money{Amount: cents, Currency: currency}, nil
+}
+
+// parseDecimalCents lit un montant décimal exact ("1234.5" → 123450) sans passer par un float
+func parseDecimalCents(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	units, decimals, _ := strings.Cut(value, ".")
+	if len(decimals) > 2 {
+		if strings.Trim(decimals[2:], "0") != "" {
+			return 0, fmt.Errorf("montant %q plus précis que le centime", value)
+		}
+		decimals = decimals[:2]
+	}
+	decimals += strings.Repeat("0", 2-len(decimals))
+	cents, err := strconv.ParseInt(units+decimals, 10, 64)
+	if err != nil || units == "" {
+		return 0, fmt.Errorf("montant %q invalide", value)
+	}
+	return cents, nil
+}
+
+// bankTransactionID calcule l'empreinte d'un virement : le même virement présent dans deux extraits
+// (chevauchement de périodes, réimport du même fichier) n'est importé qu'une fois
+func bankTransactionID(tx *models.BankTransaction) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		tx.Account,
+		tx.BookingDate.Format("2006-01-02"),
+		tx.Amount.String(),
+		tx.Amount.CurrencyCode(),
+		tx.BankReference,
+		tx.StructuredReference,
+		tx.Communication,
+		tx.CounterpartyAccount,
+	}, "|")))
+	return hex.EncodeToString(sum[:16])
+}
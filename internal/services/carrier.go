@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ShipmentRequest décrit un colis à confier au transporteur
+type ShipmentRequest struct {
+	Reference     string // Référence commande imprimée sur l'étiquette
+	ServiceCode   string
+	RecipientName string
+	Email         string
+	Address       models.Address
+	Weight        float64 // kg
+}
+
+// CarrierShipment est la réponse du transporteur à la création d'un envoi
+type CarrierShipment struct {
+	TrackingNumber string
+	Label          []byte // Étiquette PDF
+}
+
+// TrackingEvent est un événement de suivi normalisé extrait d'un webhook transporteur
+type TrackingEvent struct {
+	TrackingNumber string
+	Status         string // models.TrackingStatus*
+	CarrierStatus  string
+	Description    string
+	Location       string
+	OccurredAt     time.Time
+}
+
+// Carrier est l'interface commune aux intégrations transporteurs
+type Carrier interface {
+	// Code identifie le transporteur (colonne carrier des envois, URL du webhook)
+	Code() string
+	// Name est le nom affiché sur l'étiquette
+	Name() string
+	// CreateShipment enregistre l'envoi chez le transporteur et retourne le numéro de suivi et l'étiquette PDF
+	CreateShipment(req ShipmentRequest) (*CarrierShipment, error)
+	// ParseTrackingWebhook vérifie et décode un webhook de suivi du transporteur
+	ParseTrackingWebhook(header http.Header, body []byte) ([]TrackingEvent, error)
+}
+
+var (
+	carriersMu sync.RWMutex
+	carriers   = map[string]Carrier{}
+)
+
+// RegisterCarrier ajoute (ou remplace) une intégration transporteur
+func RegisterCarrier(carrier Carrier) {
+	carriersMu.Lock()
+	defer carriersMu.Unlock()
+	carriers[carrier.Code()] = carrier
+}
+
+// GetCarrier retourne l'intégration enregistrée pour un code transporteur
+func GetCarrier(code string) (Carrier, error) {
+	carriersMu.RLock()
+	defer carriersMu.RUnlock()
+	carrier, ok := carriers[strings.ToLower(code)]
+	if !ok {
+		return nil, fmt.Errorf("transporteur inconnu: %s", code)
+	}
+	return carrier, nil
+}
+
+// CarrierCodes liste les transporteurs disponibles
+func CarrierCodes() []string {
+	carriersMu.RLock()
+	defer carriersMu.RUnlock()
+	codes := make([]string, 0, len(carriers))
+	for code := range carriers {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// InitCarriers enregistre les intégrations transporteurs (à appeler après le chargement de la configuration).
+// Le transporteur de test n'est disponible qu'avec CARRIER_FAKE_ENABLED=true.
+func InitCarriers() {
+	if os.Getenv("CARRIER_FAKE_ENABLED") == "true" {
+		RegisterCarrier(&FakeCarrier{})
+	}
+	RegisterCarrier(NewBpostCarrier())
+	log.Printf("✅ Transporteurs disponibles: %s (défaut: %s)", strings.Join(CarrierCodes(), ", "), DefaultCarrierCode())
+}
+
+// DefaultCarrierCode est le transporteur utilisé quand l'option de livraison n'en désigne pas
+// (bpost si DEFAULT_CARRIER n'est pas défini)
+func DefaultCarrierCode() string {
+	if code := os.Getenv("DEFAULT_CARRIER"); code != "" {
+		return strings.ToLower(code)
+	}
+	return "bpost"
+}
+
+// CarrierForShippingOption retrouve le transporteur du service choisi au checkout
+func CarrierForShippingOption(optionID string) string {
+	cfg, err := GetShippingConfig()
+	if err != nil {
+		return DefaultCarrierCode()
+	}
+	for _, service := range cfg.Services {
+		if service.Code != optionID {
+			continue
+		}
+		if carrier, ok := cfg.Carriers[service.CarrierID]; ok {
+			if _, err := GetCarrier(carrier.Code); err == nil {
+				return strings.ToLower(carrier.Code)
+			}
+		}
+	}
+	return DefaultCarrierCode()
+}
+
+// TrackingURL construit le lien de suivi public à partir du modèle configuré pour le transporteur
+func TrackingURL(carrierCode, trackingNumber string) string {
+	cfg, err := GetShippingConfig()
+	if err != nil || trackingNumber == "" {
+		return ""
+	}
+	for _, carrier := range cfg.Carriers {
+		if strings.EqualFold(carrier.Code, carrierCode) && carrier.TrackingURL != "" {
+			if strings.Contains(carrier.TrackingURL, "%s") {
+				return fmt.Sprintf(carrier.TrackingURL, trackingNumber)
+			}
+			return carrier.TrackingURL + trackingNumber
+		}
+	}
+	return ""
+}
+
+// verifyWebhookSignature compare la signature HMAC-SHA256 (hex) du corps avec le secret partagé
+func verifyWebhookSignature(body []byte, signature, secret string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(strings.TrimPrefix(signature, "sha256="))))
+}
+
+// documentsBucket est le bucket MinIO des documents générés (étiquettes, factures...)
+func documentsBucket() string {
+	if bucket := os.Getenv("MINIO_DOCUMENTS_BUCKET"); bucket != "" {
+		return bucket
+	}
+	return os.Getenv("MINIO_BUCKET")
+}
+
+// StoreDocument enregistre un document généré dans MinIO
+func StoreDocument(objectName string, data []byte, contentType string) error {
+	if database.MinIO == nil {
+		return fmt.Errorf("MinIO non initialisé")
+	}
+	_, err := database.MinIO.PutObject(context.Background(), documentsBucket(), objectName,
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// GetDocument relit un document généré depuis MinIO
+func GetDocument(objectName string) ([]byte, error) {
+	if database.MinIO == nil {
+		return nil, fmt.Errorf("MinIO non initialisé")
+	}
+	object, err := database.MinIO.GetObject(context.Background(), documentsBucket(), objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// BpostCarrier intègre l'API d'envoi bpost (Shipping Manager) :
+// création d'envoi authentifiée en Basic (compte + passphrase), étiquette PDF en base64,
+// webhooks de suivi signés en HMAC-SHA256.
+type BpostCarrier struct {
+	BaseURL        string
+	AccountID      string
+	Passphrase     string
+	WebhookSecret  string
+	DefaultProduct string
+	Client         *http.Client
+}
+
+// NewBpostCarrier configure l'adaptateur depuis l'environnement (BPOST_*)
+func NewBpostCarrier() *BpostCarrier {
+	product := os.Getenv("BPOST_PRODUCT")
+	if product == "" {
+		product = "bpack 24h Pro"
+	}
+	return &BpostCarrier{
+		BaseURL:        strings.TrimRight(os.Getenv("BPOST_API_URL"), "/"),
+		AccountID:      os.Getenv("BPOST_ACCOUNT_ID"),
+		Passphrase:     os.Getenv("BPOST_PASSPHRASE"),
+		WebhookSecret:  os.Getenv("BPOST_WEBHOOK_SECRET"),
+		DefaultProduct: product,
+		Client:         &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (b *BpostCarrier) Code() string { return "bpost" }
+
+func (b *BpostCarrier) Name() string { return "bpost" }
+
+type bpostShipmentRequest struct {
+	Reference string        `json:"reference"`
+	Product   string        `json:"product"`
+	Weight    int           `json:"weight"` // grammes
+	Receiver  bpostReceiver `json:"receiver"`
+}
+
+type bpostReceiver struct {
+	Name        string `json:"name"`
+	Email       string `json:"email,omitempty"`
+	Street      string `json:"street"`
+	PostalCode  string `json:"postalCode"`
+	City        string `json:"city"`
+	CountryCode string `json:"countryCode"`
+}
+
+type bpostShipmentResponse struct {
+	Barcode string `json:"barcode"`
+	Label   string `json:"label"` // PDF en base64
+	Error   string `json:"error"`
+}
+
+// CreateShipment annonce le colis et récupère le code-barres (numéro de suivi) et l'étiquette
+func (b *BpostCarrier) CreateShipment(req ShipmentRequest) (*CarrierShipment, error) {
+	if b.BaseURL == "" || b.AccountID == "" {
+		return nil, fmt.Errorf("bpost non configuré (BPOST_API_URL, BPOST_ACCOUNT_ID)")
+	}
+
+	product := req.ServiceCode
+	if product == "" || product == DefaultShippingOptionID {
+		product = b.DefaultProduct
+	}
+	country := req.Address.Country
+	if country == "" {
+		country = "BE"
+	}
+
+	payload, err := json.Marshal(bpostShipmentRequest{
+		Reference: req.Reference,
+		Product:   product,
+		Weight:    int(math.Ceil(req.Weight * 1000)),
+		Receiver: bpostReceiver{
+			Name:        req.RecipientName,
+			Email:       req.Email,
+			Street:      req.Address.Street,
+			PostalCode:  req.Address.PostalCode,
+			City:        req.Address.City,
+			CountryCode: strings.ToUpper(country),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s/shipments", b.BaseURL, b.AccountID), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.SetBasicAuth(b.AccountID, b.Passphrase)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := b.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("bpost injoignable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var result bpostShipmentResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("réponse bpost illisible (HTTP %d)", resp.StatusCode)
+	}
+	if resp.StatusCode >= 300 || result.Barcode == "" {
+		return nil, fmt.Errorf("bpost a refusé l'envoi (HTTP %d): %s", resp.StatusCode, result.Error)
+	}
+
+	shipment := &CarrierShipment{TrackingNumber: result.Barcode}
+	if result.Label != "" {
+		if shipment.Label, err = base64.StdEncoding.DecodeString(result.Label); err != nil {
+			return nil, fmt.Errorf("étiquette bpost invalide: %v", err)
+		}
+	} else {
+		// Étiquette non fournie (envoi annoncé sans impression) : on imprime la nôtre avec le code-barres bpost
+		if shipment.Label, err = utils.GenerateShippingLabelPDF(shippingLabel(b.Name(), result.Barcode, req)); err != nil {
+			return nil, err
+		}
+	}
+	return shipment, nil
+}
+
+type bpostTrackingWebhook struct {
+	Events []struct {
+		Barcode     string `json:"barcode"`
+		StatusCode  string `json:"statusCode"`
+		Description string `json:"description"`
+		Location    string `json:"location"`
+		Timestamp   string `json:"timestamp"`
+	} `json:"events"`
+}
+
+// bpostStatuses traduit les codes de suivi bpost en statuts normalisés
+var bpostStatuses = map[string]string{
+	"ANNOUNCED":              models.TrackingStatusLabelCreated,
+	"PREPARED":               models.TrackingStatusLabelCreated,
+	"PICKED_UP":              models.TrackingStatusInTransit,
+	"IN_TRANSIT":             models.TrackingStatusInTransit,
+	"PROCESSING":             models.TrackingStatusInTransit,
+	"ARRIVED_AT_DEPOT":       models.TrackingStatusInTransit,
+	"OUT_FOR_DELIVERY":       models.TrackingStatusOutForDelivery,
+	"DELIVERED":              models.TrackingStatusDelivered,
+	"DELIVERED_PICKUP_POINT": models.TrackingStatusDelivered,
+	"AWAITING_PICKUP":        models.TrackingStatusOutForDelivery,
+	"NOT_DELIVERED":          models.TrackingStatusException,
+	"ADDRESS_UNKNOWN":        models.TrackingStatusException,
+	"DAMAGED":                models.TrackingStatusException,
+	"RETURNED_TO_SENDER":     models.TrackingStatusException,
+}
+
+// ParseTrackingWebhook vérifie le header X-Bpost-Signature puis normalise les événements.
+// Les codes inconnus sont ignorés.
+func (b *BpostCarrier) ParseTrackingWebhook(header http.Header, body []byte) ([]TrackingEvent, error) {
+	if b.WebhookSecret == "" {
+		return nil, fmt.Errorf("BPOST_WEBHOOK_SECRET non configuré")
+	}
+	if !verifyWebhookSignature(body, header.Get("X-Bpost-Signature"), b.WebhookSecret) {
+		return nil, fmt.Errorf("signature invalide")
+	}
+
+	var payload bpostTrackingWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("payload invalide: %v", err)
+	}
+
+	events := make([]TrackingEvent, 0, len(payload.Events))
+	for _, e := range payload.Events {
+		status, ok := bpostStatuses[strings.ToUpper(e.StatusCode)]
+		if !ok || e.Barcode == "" {
+			continue
+		}
+		occurredAt, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil {
+			occurredAt = time.Now()
+		}
+		events = append(events, TrackingEvent{
+			TrackingNumber: e.Barcode,
+			Status:         status,
+			CarrierStatus:  e.StatusCode,
+			Description:    e.Description,
+			Location:       e.Location,
+			OccurredAt:     occurredAt,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+)
+
+// FakeCarrier est un transporteur local : numéro de suivi et étiquette générés sur place,
+// webhooks au format normalisé. Utilisé en développement et pour les tests de bout en bout.
+type FakeCarrier struct{}
+
+func (f *FakeCarrier) Code() string { return "fake" }
+
+func (f *FakeCarrier) Name() string { return "Cedra Test Carrier" }
+
+// CreateShipment génère un numéro de suivi FAKE + 12 chiffres et l'étiquette PDF
+func (f *FakeCarrier) CreateShipment(req ShipmentRequest) (*CarrierShipment, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1e12))
+	if err != nil {
+		return nil, err
+	}
+	trackingNumber := fmt.Sprintf("FAKE%012d", n.Int64())
+
+	label, err := utils.GenerateShippingLabelPDF(shippingLabel(f.Name(), trackingNumber, req))
+	if err != nil {
+		return nil, err
+	}
+	return &CarrierShipment{TrackingNumber: trackingNumber, Label: label}, nil
+}
+
+// fakeTrackingPayload : {"tracking_number": "...", "status": "delivered", ...} ou {"events": [...]}
+type fakeTrackingPayload struct {
+	TrackingNumber string    `json:"tracking_number"`
+	Status         string    `json:"status"`
+	Description    string    `json:"description"`
+	Location       string    `json:"location"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// ParseTrackingWebhook accepte les statuts déjà normalisés. Le header X-Carrier-Signature (HMAC-SHA256 du corps
+// avec FAKE_CARRIER_WEBHOOK_SECRET) est exigé : sans secret configuré, tous les webhooks sont refusés.
+func (f *FakeCarrier) ParseTrackingWebhook(header http.Header, body []byte) ([]TrackingEvent, error) {
+	secret := os.Getenv("FAKE_CARRIER_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("FAKE_CARRIER_WEBHOOK_SECRET non configuré")
+	}
+	if !verifyWebhookSignature(body, header.Get("X-Carrier-Signature"), secret) {
+		return nil, fmt.Errorf("signature invalide")
+	}
+
+	var batch struct {
+		Events []fakeTrackingPayload `json:"events"`
+		fakeTrackingPayload
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("payload invalide: %v", err)
+	}
+	if len(batch.Events) == 0 {
+		batch.Events = []fakeTrackingPayload{batch.fakeTrackingPayload}
+	}
+
+	events := make([]TrackingEvent, 0, len(batch.Events))
+	for _, e := range batch.Events {
+		if e.TrackingNumber == "" || !isTrackingStatus(e.Status) {
+			return nil, fmt.Errorf("événement invalide: %q / %q", e.TrackingNumber, e.Status)
+		}
+		if e.OccurredAt.IsZero() {
+			e.OccurredAt = time.Now()
+		}
+		events = append(events, TrackingEvent{
+			TrackingNumber: e.TrackingNumber,
+			Status:         e.Status,
+			CarrierStatus:  e.Status,
+			Description:    e.Description,
+			Location:       e.Location,
+			OccurredAt:     e.OccurredAt,
+		})
+	}
+	return events, nil
+}
+
+func isTrackingStatus(status string) bool {
+	switch status {
+	case models.TrackingStatusLabelCreated, models.TrackingStatusInTransit, models.TrackingStatusOutForDelivery,
+		models.TrackingStatusDelivered, models.TrackingStatusException:
+		return true
+	}
+	return false
+}
+
+// shippingLabel prépare les données d'étiquette communes aux transporteurs qui n'en fournissent pas
+func shippingLabel(carrierName, trackingNumber string, req ShipmentRequest) utils.ShippingLabel {
+	return utils.ShippingLabel{
+		CarrierName:    carrierName,
+		ServiceName:    req.ServiceCode,
+		TrackingNumber: trackingNumber,
+		Reference:      req.Reference,
+		RecipientName:  req.RecipientName,
+		RecipientLines: []string{
+			req.Address.Street,
+			req.Address.PostalCode + " " + req.Address.City,
+			req.Address.Country,
+		},
+		Weight: req.Weight,
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"cedra_back_end/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func signedHeader(body []byte, secret string) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	header := http.Header{}
+	header.Set("X-Carrier-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestFakeCarrierCreateShipment(t *testing.T) {
+	shipment, err := (&FakeCarrier{}).CreateShipment(ShipmentRequest{
+		Reference:     "CMD-0001",
+		ServiceCode:   "standard",
+		RecipientName: "Jeanne Dupont",
+		Address:       models.Address{Street: "Rue Neuve 1", PostalCode: "1000", City: "Bruxelles", Country: "BE"},
+		Weight:        1.2,
+	})
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if !regexp.MustCompile(`^FAKE\d{12}$`).MatchString(shipment.TrackingNumber) {
+		t.Errorf("numéro de suivi inattendu: %q", shipment.TrackingNumber)
+	}
+	if !bytes.HasPrefix(shipment.Label, []byte("%PDF")) {
+		t.Errorf("l'étiquette n'est pas un PDF")
+	}
+}
+
+func TestFakeCarrierParseTrackingWebhook(t *testing.T) {
+	t.Setenv("FAKE_CARRIER_WEBHOOK_SECRET", testWebhookSecret)
+
+	tests := []struct {
+		name     string
+		body     string
+		statuses []string
+		wantErr  bool
+	}{
+		{
+			name:     "événement unique",
+			body:     `{"tracking_number":"FAKE000000000001","status":"in_transit","location":"Bruxelles X"}`,
+			statuses: []string{models.TrackingStatusInTransit},
+		},
+		{
+			name: "lot d'événements",
+			body: `{"events":[{"tracking_number":"FAKE000000000001","status":"out_for_delivery"},` +
+				`{"tracking_number":"FAKE000000000001","status":"delivered","occurred_at":"2026-03-02T10:00:00Z"}]}`,
+			statuses: []string{models.TrackingStatusOutForDelivery, models.TrackingStatusDelivered},
+		},
+		{name: "statut inconnu", body: `{"tracking_number":"FAKE000000000001","status":"lost"}`, wantErr: true},
+		{name: "numéro manquant", body: `{"status":"delivered"}`, wantErr: true},
+		{name: "JSON invalide", body: `{"tracking_number":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(tt.body)
+			events, err := (&FakeCarrier{}).ParseTrackingWebhook(signedHeader(body, testWebhookSecret), body)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("erreur attendue, obtenu %d événement(s)", len(events))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTrackingWebhook: %v", err)
+			}
+			if len(events) != len(tt.statuses) {
+				t.Fatalf("%d événement(s), attendu %d", len(events), len(tt.statuses))
+			}
+			for i, e := range events {
+				if e.Status != tt.statuses[i] || e.CarrierStatus != tt.statuses[i] {
+					t.Errorf("événement %d: statut %q, attendu %q", i, e.Status, tt.statuses[i])
+				}
+				if e.OccurredAt.IsZero() {
+					t.Errorf("événement %d: date manquante", i)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeCarrierWebhookSignature(t *testing.T) {
+	body := []byte(`{"tracking_number":"FAKE000000000001","status":"delivered"}`)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  http.Header
+		wantErr bool
+	}{
+		{name: "signature valide", secret: testWebhookSecret, header: signedHeader(body, testWebhookSecret)},
+		{name: "mauvais secret", secret: testWebhookSecret, header: signedHeader(body, "autre"), wantErr: true},
+		{name: "signature absente", secret: testWebhookSecret, header: http.Header{}, wantErr: true},
+		{name: "secret non configuré", secret: "", header: signedHeader(body, ""), wantErr: true},
+		{name: "secret non configuré sans signature", secret: "", header: http.Header{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_CARRIER_WEBHOOK_SECRET", tt.secret)
+			_, err := (&FakeCarrier{}).ParseTrackingWebhook(tt.header, body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("erreur = %v, attendu erreur: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Le corps modifié après signature est refusé
+	t.Setenv("FAKE_CARRIER_WEBHOOK_SECRET", testWebhookSecret)
+	tampered := []byte(`{"tracking_number":"FAKE000000000002","status":"delivered"}`)
+	if _, err := (&FakeCarrier{}).ParseTrackingWebhook(signedHeader(body, testWebhookSecret), tampered); err == nil {
+		t.Error("corps modifié accepté")
+	}
+}
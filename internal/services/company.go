@@ -0,0 +1,64 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// UserCompanyID retourne la société d'un utilisateur (nil pour un particulier)
+func UserCompanyID(userID string) (*gocql.UUID, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var companyID *gocql.UUID
+	if err := session.Query("SELECT company_id FROM users WHERE user_id = ?", gocql.UUID(uid)).Scan(&companyID); err != nil {
+		return nil, err
+	}
+	return companyID, nil
+}
+
+// ListCompanyOrderIDs retourne les commandes passées par les employés d'une société (colonne orders.company_id)
+func ListCompanyOrderIDs(companyID gocql.UUID) ([]gocql.UUID, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query("SELECT order_id FROM orders WHERE company_id = ?", companyID).Iter()
+	ids := []gocql.UUID{}
+	var id gocql.UUID
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	return ids, iter.Close()
+}
+
+// CompanyMemberNames retourne le nom (à défaut l'email) de chaque employé d'une société, par user_id
+func CompanyMemberNames(companyID gocql.UUID) (map[string]string, error) {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query("SELECT user_id, name, email FROM users WHERE company_id = ? ALLOW FILTERING", companyID).Iter()
+	names := map[string]string{}
+	var (
+		userID      gocql.UUID
+		name, email string
+	)
+	for iter.Scan(&userID, &name, &email) {
+		if name == "" {
+			name = email
+		}
+		names[userID.String()] = name
+	}
+	return names, iter.Close()
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/minio/minio-go/v7"
+)
+
+// creditNotePrefix est le préfixe des notes de crédit (NC par défaut : NC2026-000001), série distincte des factures
+func creditNotePrefix() string {
+	if prefix := os.Getenv("CREDIT_NOTE_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return "NC"
+}
+
+// GetRefundCreditNote retourne la note de crédit déjà émise pour un remboursement (gocql.ErrNotFound sinon)
+func GetRefundCreditNote(refundID gocql.UUID) (*models.CreditNote, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var number string
+	if err := session.Query("SELECT credit_note_number FROM credit_notes_by_refund WHERE refund_id = ?", refundID).Scan(&number); err != nil {
+		return nil, err
+	}
+	if number == "" {
+		return nil, gocql.ErrNotFound
+	}
+	return GetCreditNote(number)
+}
+
+// GetCreditNote charge une note de crédit par son numéro
+func GetCreditNote(number string) (*models.CreditNote, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var document, pdfKey string
+	if err := session.Query("SELECT document, pdf_key FROM credit_notes WHERE credit_note_number = ?", number).Scan(&document, &pdfKey); err != nil {
+		return nil, err
+	}
+
+	var note models.CreditNote
+	if err := json.Unmarshal([]byte(document), &note); err != nil {
+		return nil, fmt.Errorf("note de crédit %s illisible: %v", number, err)
+	}
+	note.PDFKey = pdfKey
+	return &note, nil
+}
+
+// ListCreditNotes retourne les notes de crédit d'un exercice, de la plus récente à la plus ancienne
+func ListCreditNotes(fiscalYear int) ([]models.CreditNote, error) {
+	return queryCreditNotes("SELECT document, pdf_key FROM credit_notes WHERE fiscal_year = ? ALLOW FILTERING", fiscalYear)
+}
+
+// ListInvoiceCreditNotes retourne les notes de crédit qui corrigent une facture
+func ListInvoiceCreditNotes(invoiceNumber string) ([]models.CreditNote, error) {
+	return queryCreditNotes("SELECT document, pdf_key FROM credit_notes WHERE invoice_number = ? ALLOW FILTERING", invoiceNumber)
+}
+
+func queryCreditNotes(query string, values ...interface{}) ([]models.CreditNote, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(query, values...).Iter()
+	notes := []models.CreditNote{}
+	var document, pdfKey string
+	for iter.Scan(&document, &pdfKey) {
+		var note models.CreditNote
+		if err := json.Unmarshal([]byte(document), &note); err != nil {
+			log.Printf("⚠️ Note de crédit illisible (%s): %v", pdfKey, err)
+			continue
+		}
+		note.PDFKey = pdfKey
+		notes = append(notes, note)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].FiscalYear != notes[j].FiscalYear {
+			return notes[i].FiscalYear > notes[j].FiscalYear
+		}
+		return notes[i].Sequence > notes[j].Sequence
+	})
+	return notes, nil
+}
+
+// IssueCreditNote émet la note de crédit d'un remboursement effectué : elle référence la facture de la commande
+// (émise au besoin), reçoit un numéro de sa propre série et son PDF est stocké à côté des factures.
+// Idempotent : un remboursement déjà crédité retourne sa note existante.
+func IssueCreditNote(order *models.Order, r *models.Refund) (*models.CreditNote, error) {
+	if existing, err := GetRefundCreditNote(r.ID); err == nil {
+		return existing, nil
+	}
+	if r.Status != models.RefundStatusCompleted {
+		return nil, fmt.Errorf("remboursement %s non effectué (%s)", r.ID, r.Status)
+	}
+	if r.RefundAmount.Amount <= 0 {
+		return nil, fmt.Errorf("remboursement %s sans montant", r.ID)
+	}
+
+	inv, err := IssueInvoice(order)
+	if err != nil {
+		return nil, fmt.Errorf("facture de la commande %s indisponible: %v", order.ID, err)
+	}
+
+	claim, err := claimDocument("credit_notes_by_refund", "refund_id", "credit_note_number", r.ID)
+	if err != nil {
+		if err == ErrInvoiceInProgress {
+			if existing, err := GetRefundCreditNote(r.ID); err == nil {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+
+	note := BuildCreditNote(inv, r)
+	if claim.Number == "" {
+		prefix := creditNotePrefix()
+		sequence, err := NextDocumentSequence(prefix, note.FiscalYear)
+		if err != nil {
+			releaseDocument("credit_notes_by_refund", "refund_id", "credit_note_number", r.ID)
+			return nil, err
+		}
+		claim.FiscalYear = note.FiscalYear
+		claim.Sequence = sequence
+		claim.Number = FormatInvoiceNumber(prefix, note.FiscalYear, sequence)
+		if err := reserveDocumentNumber("credit_notes_by_refund", "refund_id", "credit_note_number", r.ID, claim); err != nil {
+			log.Printf("❌ Numéro de note de crédit %s (remboursement %s) non réservé: %v", claim.Number, r.ID, err)
+			return nil, err
+		}
+	} else {
+		log.Printf("⚠️ Reprise de l'émission de la note de crédit %s (remboursement %s)", claim.Number, r.ID)
+	}
+	note.FiscalYear = claim.FiscalYear
+	note.Sequence = claim.Sequence
+	note.Number = claim.Number
+	note.PDFKey = fmt.Sprintf("invoices/%d/%s.pdf", note.FiscalYear, note.Number)
+
+	// Le numéro est réservé pour le remboursement : un échec d'enregistrement sera repris avec ce même numéro
+	if err := saveCreditNote(note); err != nil {
+		if existing, err := GetRefundCreditNote(r.ID); err == nil {
+			return existing, nil
+		}
+		log.Printf("❌ Note de crédit %s (remboursement %s) non enregistrée, reprise au prochain essai: %v", note.Number, r.ID, err)
+		return nil, err
+	}
+	if _, err := storeCreditNotePDF(note); err != nil {
+		log.Printf("⚠️ PDF de la note de crédit %s non stocké (régénéré au prochain téléchargement): %v", note.Number, err)
+	}
+
+	log.Printf("🧾 Note de crédit %s émise sur la facture %s (%s %s)", note.Number, inv.Number, note.GrossTotal, note.GrossTotal.CurrencyCode())
+	return note, nil
+}
+
+// GetCreditNotePDF relit le PDF d'une note de crédit ; s'il manque, il est régénéré depuis le contenu figé
+func GetCreditNotePDF(note *models.CreditNote) ([]byte, error) {
+	if data, err := GetDocument(note.PDFKey); err == nil && len(data) > 0 {
+		return data, nil
+	}
+	data, err := storeCreditNotePDF(note)
+	if err != nil && data != nil {
+		log.Printf("⚠️ PDF de la note de crédit %s régénéré mais non stocké: %v", note.Number, err)
+		return data, nil
+	}
+	return data, err
+}
+
+// CreditNoteDownloadURL retourne une URL signée (valable duration) vers le PDF de la note de crédit
+func CreditNoteDownloadURL(ctx context.Context, note *models.CreditNote, duration time.Duration) (string, error) {
+	if database.MinIO == nil {
+		return "", fmt.Errorf("MinIO non initialisé")
+	}
+	if _, err := database.MinIO.StatObject(ctx, documentsBucket(), note.PDFKey, minio.StatObjectOptions{}); err != nil {
+		if _, err := storeCreditNotePDF(note); err != nil {
+			return "", err
+		}
+	}
+	return GenerateDocumentSignedURL(ctx, note.PDFKey, note.Number+".pdf", duration)
+}
+
+func storeCreditNotePDF(note *models.CreditNote) ([]byte, error) {
+	data, err := utils.RenderCreditNotePDF(note)
+	if err != nil {
+		return nil, err
+	}
+	if err := StoreDocument(note.PDFKey, data, "application/pdf"); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+func saveCreditNote(note *models.CreditNote) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(note)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation note de crédit: %v", err)
+	}
+
+	applied, err := session.Query(`INSERT INTO credit_notes (credit_note_number, fiscal_year, sequence, refund_id, order_id, invoice_number,
+		user_id, buyer_name, buyer_email, net_total, tax_total, gross_total, issued_at, pdf_key, document)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		note.Number, note.FiscalYear, note.Sequence, note.RefundID, note.OrderID, note.InvoiceNumber,
+		note.UserID, note.Buyer.Name, note.Buyer.Email, note.NetTotal, note.TaxTotal, note.GrossTotal, note.IssuedAt, note.PDFKey, string(document)).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return fmt.Errorf("le numéro de note de crédit %s existe déjà", note.Number)
+	}
+	return nil
+}
+
+// BuildCreditNote fige le contenu de la note de crédit : chaque ligne remboursée reprend le taux de TVA
+// de la ligne facturée, montants négatifs ; un montant sans ligne facturée correspondante est réparti
+// sur les taux de la facture. Le total TTC est exactement le montant remboursé.
+func BuildCreditNote(inv *models.Invoice, r *models.Refund) *models.CreditNote {
+	now := time.Now()
+	note := &models.CreditNote{
+		FiscalYear:    FiscalYear(now),
+		RefundID:      r.ID,
+		OrderID:       inv.OrderID,
+		UserID:        inv.UserID,
+		InvoiceNumber: inv.Number,
+		InvoiceDate:   inv.IssuedAt,
+		Seller:        inv.Seller,
+		Buyer:         inv.Buyer,
+		TaxRegime:     inv.TaxRegime,
+		TaxNote:       inv.TaxNote,
+		Reason:        r.Reason,
+		IBAN:          inv.IBAN,
+		IssuedAt:      now,
+	}
+
+	lines := []creditLine{}
+	for _, item := range r.Items {
+		line := models.InvoiceLine{ProductID: item.ProductID, VariantID: item.VariantID, Description: item.Name, Quantity: item.Quantity}
+		invoiced, ok := findInvoiceLine(inv, item.ProductID, item.VariantID)
+		if !ok {
+			// Article absent de la facture : réparti sur ses taux de TVA
+			lines = append(lines, spreadOverRates(inv, line, item.Amount)...)
+			continue
+		}
+		line.Description = invoiced.Description
+		line.UnitPrice = invoiced.UnitPrice
+		line.TaxRate = invoiced.TaxRate
+		lines = append(lines, creditLine{line: line, gross: item.Amount})
+	}
+	if !r.ShippingAmount.IsZero() {
+		line := models.InvoiceLine{Description: "Livraison", Quantity: 1}
+		if invoiced, ok := findInvoiceLine(inv, "", ""); ok {
+			line.Description = invoiced.Description
+			line.UnitPrice = invoiced.UnitPrice
+			line.TaxRate = invoiced.TaxRate
+			lines = append(lines, creditLine{line: line, gross: r.ShippingAmount})
+		} else {
+			lines = append(lines, spreadOverRates(inv, line, r.ShippingAmount)...)
+		}
+	}
+
+	if len(lines) == 0 {
+		// Remboursement sans détail (Stripe, geste commercial) : réparti sur les taux de la facture
+		line := models.InvoiceLine{Description: "Remboursement sur la facture " + inv.Number, Quantity: 1}
+		lines = spreadOverRates(inv, line, r.RefundAmount)
+	} else {
+		// Écart d'arrondi (solde de la commande) reporté sur la dernière ligne
+		total := models.Money{}
+		for _, l := range lines {
+			total = total.Add(l.gross)
+		}
+		lines[len(lines)-1].gross = lines[len(lines)-1].gross.Add(r.RefundAmount.Sub(total))
+	}
+
+	byRate := map[float64]*models.TaxRateTotal{}
+	for _, l := range lines {
+		line := l.line
+		net := l.gross
+		if line.TaxRate > 0 {
+			net = extractNet(l.gross, line.TaxRate)
+		}
+		line.NetAmount = negate(net)
+		line.TaxAmount = negate(l.gross.Sub(net))
+		line.GrossAmount = negate(l.gross)
+		note.Lines = append(note.Lines, line)
+
+		note.NetTotal = note.NetTotal.Add(line.NetAmount)
+		note.TaxTotal = note.TaxTotal.Add(line.TaxAmount)
+		note.GrossTotal = note.GrossTotal.Add(line.GrossAmount)
+		rate, ok := byRate[line.TaxRate]
+		if !ok {
+			rate = &models.TaxRateTotal{Rate: line.TaxRate}
+			byRate[line.TaxRate] = rate
+		}
+		rate.NetAmount = rate.NetAmount.Add(line.NetAmount)
+		rate.TaxAmount = rate.TaxAmount.Add(line.TaxAmount)
+	}
+	for _, rate := range byRate {
+		note.Rates = append(note.Rates, *rate)
+	}
+	sort.Slice(note.Rates, func(i, j int) bool { return note.Rates[i].Rate > note.Rates[j].Rate })
+	return note
+}
+
+// creditLine est une ligne de note de crédit avant l'extraction de la TVA (montant TTC positif)
+type creditLine struct {
+	line  models.InvoiceLine
+	gross models.Money
+}
+
+// spreadOverRates répartit un montant TTC sur les taux de TVA de la facture, au prorata de leur base HT :
+// une ligne par taux, l'écart d'arrondi sur la dernière
+func spreadOverRates(inv *models.Invoice, line models.InvoiceLine, gross models.Money) []creditLine {
+	var base int64
+	for _, rate := range inv.Rates {
+		if rate.NetAmount.Amount > 0 {
+			base += rate.NetAmount.Amount
+		}
+	}
+	if base == 0 {
+		return []creditLine{{line: line, gross: gross}}
+	}
+
+	lines := []creditLine{}
+	var allocated int64
+	for _, rate := range inv.Rates {
+		if rate.NetAmount.Amount <= 0 {
+			continue
+		}
+		share := int64(math.Round(float64(gross.Amount) * float64(rate.NetAmount.Amount) / float64(base)))
+		l := line
+		l.TaxRate = rate.Rate
+		lines = append(lines, creditLine{line: l, gross: models.Money{Amount: share, Currency: gross.CurrencyCode()}})
+		allocated += share
+	}
+	last := &lines[len(lines)-1]
+	last.gross.Amount += gross.Amount - allocated
+	return lines
+}
+
+func findInvoiceLine(inv *models.Invoice, productID, variantID string) (models.InvoiceLine, bool) {
+	for _, line := range inv.Lines {
+		if line.ProductID == productID && line.VariantID == variantID {
+			return line, true
+		}
+	}
+	return models.InvoiceLine{}, false
+}
+
+func negate(m models.Money) models.Money {
+	return models.Money{Amount: -m.Amount, Currency: m.CurrencyCode()}
+}
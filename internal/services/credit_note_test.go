@@ -0,0 +1,79 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"testing"
+)
+
+// Facture à deux taux : 100,00 HT à 21 % (livre électronique) et 300,00 HT à 6 % (livres)
+func twoRateInvoice() *models.Invoice {
+	return &models.Invoice{
+		Number: "F2026-000042",
+		Lines: []models.InvoiceLine{
+			{ProductID: "ebook", Quantity: 1, UnitPrice: models.Cents(12100), TaxRate: 21, NetAmount: models.Cents(10000)},
+			{ProductID: "book", Quantity: 3, UnitPrice: models.Cents(10600), TaxRate: 6, NetAmount: models.Cents(30000)},
+		},
+		Rates: []models.TaxRateTotal{
+			{Rate: 21, NetAmount: models.Cents(10000), TaxAmount: models.Cents(2100)},
+			{Rate: 6, NetAmount: models.Cents(30000), TaxAmount: models.Cents(1800)},
+		},
+	}
+}
+
+func TestBuildCreditNoteSpreadsOverInvoiceRates(t *testing.T) {
+	tests := []struct {
+		name   string
+		refund *models.Refund
+		gross  map[float64]int64 // TTC crédité par taux (centimes, positif)
+	}{
+		{
+			name:   "remboursement sans détail",
+			refund: &models.Refund{RefundAmount: models.Cents(10000)},
+			gross:  map[float64]int64{21: 2500, 6: 7500},
+		},
+		{
+			name: "article absent de la facture",
+			refund: &models.Refund{
+				RefundAmount: models.Cents(2001),
+				Items:        []models.RefundItem{{ProductID: "gift", Name: "Cadeau", Quantity: 1, Amount: models.Cents(2001)}},
+			},
+			gross: map[float64]int64{21: 500, 6: 1501},
+		},
+		{
+			name: "article facturé et article absent",
+			refund: &models.Refund{
+				RefundAmount: models.Cents(14100),
+				Items: []models.RefundItem{
+					{ProductID: "book", Quantity: 1, Amount: models.Cents(10600)},
+					{ProductID: "gift", Quantity: 1, Amount: models.Cents(3500)},
+				},
+			},
+			gross: map[float64]int64{21: 875, 6: 10600 + 2625},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := BuildCreditNote(twoRateInvoice(), tt.refund)
+			if note.GrossTotal.Amount != -tt.refund.RefundAmount.Amount {
+				t.Errorf("total TTC %d, attendu %d", note.GrossTotal.Amount, -tt.refund.RefundAmount.Amount)
+			}
+
+			gross := map[float64]int64{}
+			for _, line := range note.Lines {
+				if line.Quantity <= 0 {
+					t.Errorf("ligne %q sans quantité", line.Description)
+				}
+				gross[line.TaxRate] -= line.GrossAmount.Amount
+			}
+			for rate, want := range tt.gross {
+				if gross[rate] != want {
+					t.Errorf("TTC à %g %% = %d, attendu %d", rate, gross[rate], want)
+				}
+			}
+			if len(gross) != len(tt.gross) {
+				t.Errorf("taux crédités %v, attendu %v", gross, tt.gross)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DunningPolicy décrit la séquence de relance des factures impayées
+type DunningPolicy struct {
+	Offsets       []int        // Jours par rapport à l'échéance de chaque relance (négatif : rappel avant l'échéance)
+	LateFeeLevel  int          // Relance à partir de laquelle les frais de retard sont réclamés (0 : jamais)
+	LateFee       models.Money // Indemnité forfaitaire de recouvrement
+	InterestRate  float64      // Taux annuel des intérêts de retard (%), calculés depuis l'échéance
+	HoldAfterDays int          // Retard toléré avant le blocage des commandes sur facture
+}
+
+// CurrentDunningPolicy lit la politique de relance :
+// DUNNING_OFFSETS (défaut "-3,7,21,35"), DUNNING_LATE_FEE_LEVEL (défaut 3), DUNNING_LATE_FEE (défaut 40.00),
+// DUNNING_INTEREST_RATE (défaut 0) et DUNNING_HOLD_AFTER_DAYS (défaut 0)
+func CurrentDunningPolicy() DunningPolicy {
+	policy := DunningPolicy{
+		Offsets:      []int{-3, 7, 21, 35},
+		LateFeeLevel: 3,
+		LateFee:      models.Cents(4000),
+	}
+
+	if value := os.Getenv("DUNNING_OFFSETS"); value != "" {
+		offsets := []int{}
+		for _, part := range strings.Split(value, ",") {
+			if offset, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+				offsets = append(offsets, offset)
+			}
+		}
+		sort.Ints(offsets)
+		policy.Offsets = offsets
+	}
+	if level, err := strconv.Atoi(os.Getenv("DUNNING_LATE_FEE_LEVEL")); err == nil && level >= 0 {
+		policy.LateFeeLevel = level
+	}
+	if fee, err := parseDecimalCents(os.Getenv("DUNNING_LATE_FEE")); err == nil && fee >= 0 {
+		policy.LateFee = models.Cents(fee)
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("DUNNING_INTEREST_RATE"), 64); err == nil && rate >= 0 {
+		policy.InterestRate = rate
+	}
+	if days, err := strconv.Atoi(os.Getenv("DUNNING_HOLD_AFTER_DAYS")); err == nil && days >= 0 {
+		policy.HoldAfterDays = days
+	}
+	return policy
+}
+
+// LevelFor retourne la relance due après daysOverdue jours (0 : aucune)
+func (p DunningPolicy) LevelFor(daysOverdue int) int {
+	level := 0
+	for _, offset := range p.Offsets {
+		if daysOverdue >= offset {
+			level++
+		}
+	}
+	return level
+}
+
+// LateFeeFor calcule les frais de retard réclamés à une relance : indemnité forfaitaire et intérêts depuis l'échéance
+func (p DunningPolicy) LateFeeFor(r models.Receivable, level int, now time.Time) models.Money {
+	if p.LateFeeLevel == 0 || level < p.LateFeeLevel {
+		return r.LateFee
+	}
+	fee := p.LateFee
+	if days := r.DaysOverdue(now); p.InterestRate > 0 && days > 0 {
+		interest := math.Round(float64(r.Invoice.GrossTotal.Amount) * p.InterestRate / 100 * float64(days) / 365)
+		fee = fee.Add(models.Cents(int64(interest)))
+	}
+	return models.MaxMoney(fee, r.LateFee)
+}
+
+// StartDunningScheduler relance périodiquement les factures impayées
+func StartDunningScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			RunDunning(time.Now())
+		}
+	}()
+	log.Printf("✅ Relances des factures impayées actives (toutes les %s)", interval)
+}
+
+// RunDunning envoie les relances dues à la date donnée et retourne le nombre de relances envoyées.
+// Une relance manquée (service arrêté) n'est pas rattrapée : seule la plus récente est envoyée.
+func RunDunning(now time.Time) int {
+	receivables, err := ListReceivables(nil)
+	if err != nil {
+		log.Printf("⚠️ Erreur lecture des factures ouvertes: %v", err)
+		return 0
+	}
+
+	policy := CurrentDunningPolicy()
+	sent := 0
+	for i := range receivables {
+		r := &receivables[i]
+		if r.Invoice.DueDate == nil {
+			continue
+		}
+		level := policy.LevelFor(r.DaysOverdue(now))
+		if level <= r.DunningLevel {
+			continue
+		}
+
+		if err := sendDunningReminder(r, level, policy, now); err != nil {
+			log.Printf("⚠️ Relance %d de la facture %s non envoyée: %v", level, r.Invoice.Number, err)
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("📨 %d relance(s) de factures impayées envoyée(s)", sent)
+	}
+	return sent
+}
+
+// sendDunningReminder enregistre la relance (compare-and-set sur le niveau : une seule instance l'envoie) puis l'envoie
+func sendDunningReminder(r *models.Receivable, level int, policy DunningPolicy, now time.Time) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	lateFee := policy.LateFeeFor(*r, level, now)
+	previous := r.DunningLevel
+	applied, err := session.Query(`UPDATE invoices SET dunning_level = ?, late_fee = ?, last_reminder_at = ?
+		WHERE invoice_number = ? IF dunning_level = ? AND paid_at = null`,
+		level, lateFee, now, r.Invoice.Number, previous).MapScanCAS(map[string]interface{}{})
+	if err == nil && !applied && previous == 0 {
+		// Factures émises avant le suivi des relances : dunning_level n'est pas renseigné
+		applied, err = session.Query(`UPDATE invoices SET dunning_level = ?, late_fee = ?, last_reminder_at = ?
+			WHERE invoice_number = ? IF dunning_level = null AND paid_at = null`,
+			level, lateFee, now, r.Invoice.Number).MapScanCAS(map[string]interface{}{})
+	}
+	if err != nil {
+		return err
+	}
+	if !applied {
+		// Payée entre-temps, ou relance envoyée par une autre instance
+		return nil
+	}
+
+	r.DunningLevel = level
+	r.LateFee = lateFee
+	r.LastReminderAt = &now
+
+	if r.Invoice.Buyer.Email == "" {
+		log.Printf("⚠️ Facture %s sans email acheteur, relance %d enregistrée sans envoi", r.Invoice.Number, level)
+		return nil
+	}
+	pdf, err := GetInvoicePDF(&r.Invoice)
+	if err != nil {
+		log.Printf("⚠️ PDF de la facture %s indisponible pour la relance: %v", r.Invoice.Number, err)
+		pdf = nil
+	}
+	final := level >= len(policy.Offsets)
+	if err := utils.SendPaymentReminderEmail(r.Invoice.Buyer.Email, r, final, pdf); err != nil {
+		return err
+	}
+
+	log.Printf("📨 Relance %d envoyée pour la facture %s (%s %s dus)", level, r.Invoice.Number, r.AmountDue(), r.AmountDue().CurrencyCode())
+	return nil
+}
@@ -0,0 +1,641 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// invoiceClaimTimeout : au-delà, une émission interrompue (crash) peut être reprise
+const invoiceClaimTimeout = 5 * time.Minute
+
+// ErrInvoiceInProgress est retourné quand la facture de la commande est en cours d'émission
+var ErrInvoiceInProgress = fmt.Errorf("facture en cours d'émission")
+
+// FiscalYear retourne l'exercice comptable d'une date.
+// FISCAL_YEAR_START_MONTH (1 à 12, janvier par défaut) décale le début de l'exercice ; il porte l'année de son début.
+func FiscalYear(t time.Time) int {
+	startMonth, err := strconv.Atoi(os.Getenv("FISCAL_YEAR_START_MONTH"))
+	if err != nil || startMonth < 1 || startMonth > 12 {
+		startMonth = 1
+	}
+	if int(t.Month()) < startMonth {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+// invoicePrefix est le préfixe des numéros de facture (F par défaut : F2026-000001)
+func invoicePrefix() string {
+	if prefix := os.Getenv("INVOICE_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return "F"
+}
+
+// FormatInvoiceNumber construit le numéro affiché à partir de l'exercice et du rang
+func FormatInvoiceNumber(prefix string, fiscalYear int, sequence int64) string {
+	return fmt.Sprintf("%s%d-%06d", prefix, fiscalYear, sequence)
+}
+
+// NextDocumentSequence attribue le prochain numéro d'une série (compare-and-set, sans trou ni doublon).
+// Une série est identifiée par son préfixe et son exercice (factures, notes de crédit...).
+func NextDocumentSequence(series string, fiscalYear int) (int64, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return 0, err
+	}
+
+	current := map[string]interface{}{}
+	if _, err := session.Query(`INSERT INTO invoice_sequences (series, fiscal_year, last_number) VALUES (?, ?, 0) IF NOT EXISTS`,
+		series, fiscalYear).MapScanCAS(current); err != nil {
+		return 0, err
+	}
+
+	var last int64
+	if v, ok := current["last_number"].(int64); ok {
+		last = v
+	}
+	for attempt := 0; attempt < 50; attempt++ {
+		current = map[string]interface{}{}
+		applied, err := session.Query(`UPDATE invoice_sequences SET last_number = ? WHERE series = ? AND fiscal_year = ? IF last_number = ?`,
+			last+1, series, fiscalYear, last).MapScanCAS(current)
+		if err != nil {
+			return 0, err
+		}
+		if applied {
+			return last + 1, nil
+		}
+		// Un autre numéro vient d'être attribué : on repart de la valeur courante
+		if v, ok := current["last_number"].(int64); ok {
+			last = v
+		}
+	}
+	return 0, fmt.Errorf("numérotation %s%d trop disputée, réessayer", series, fiscalYear)
+}
+
+// GetOrderInvoice retourne la facture déjà émise pour une commande (gocql.ErrNotFound sinon)
+func GetOrderInvoice(orderID gocql.UUID) (*models.Invoice, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var number string
+	if err := session.Query("SELECT invoice_number FROM invoices_by_order WHERE order_id = ?", orderID).Scan(&number); err != nil {
+		return nil, err
+	}
+	if number == "" {
+		return nil, gocql.ErrNotFound
+	}
+	return GetInvoice(number)
+}
+
+// GetInvoice charge une facture par son numéro
+func GetInvoice(number string) (*models.Invoice, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var document, pdfKey string
+	if err := session.Query("SELECT document, pdf_key FROM invoices WHERE invoice_number = ?", number).Scan(&document, &pdfKey); err != nil {
+		return nil, err
+	}
+
+	var inv models.Invoice
+	if err := json.Unmarshal([]byte(document), &inv); err != nil {
+		return nil, fmt.Errorf("facture %s illisible: %v", number, err)
+	}
+	inv.PDFKey = pdfKey
+	return &inv, nil
+}
+
+// IssueInvoice émet la facture d'une commande payée : numéro attribué sans trou, contenu figé, PDF stocké dans MinIO.
+// Idempotent : une commande déjà facturée retourne sa facture existante.
+func IssueInvoice(order *models.Order) (*models.Invoice, error) {
+	if existing, err := GetOrderInvoice(order.ID); err == nil {
+		return existing, nil
+	}
+
+	claim, err := claimOrderInvoice(order.ID)
+	if err != nil {
+		if err == ErrInvoiceInProgress {
+			if existing, err := GetOrderInvoice(order.ID); err == nil {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+
+	inv := BuildInvoice(order)
+	if claim.Number == "" {
+		prefix := invoicePrefix()
+		sequence, err := NextDocumentSequence(prefix, inv.FiscalYear)
+		if err != nil {
+			releaseOrderInvoice(order.ID)
+			return nil, err
+		}
+		claim.FiscalYear = inv.FiscalYear
+		claim.Sequence = sequence
+		claim.Number = FormatInvoiceNumber(prefix, inv.FiscalYear, sequence)
+		if err := reserveDocumentNumber("invoices_by_order", "order_id", "invoice_number", order.ID, claim); err != nil {
+			log.Printf("❌ Numéro de facture %s (commande %s) non réservé: %v", claim.Number, order.ID, err)
+			return nil, err
+		}
+	} else {
+		log.Printf("⚠️ Reprise de l'émission de la facture %s (commande %s)", claim.Number, order.ID)
+	}
+	inv.FiscalYear = claim.FiscalYear
+	inv.Sequence = claim.Sequence
+	inv.Number = claim.Number
+	inv.PaymentReference = StructuredReference(inv.FiscalYear, inv.Sequence)
+	inv.PDFKey = fmt.Sprintf("invoices/%d/%s.pdf", inv.FiscalYear, inv.Number)
+
+	// Le numéro est réservé pour la commande : un échec d'enregistrement sera repris avec ce même numéro
+	if err := saveInvoice(inv); err != nil {
+		// Émission concurrente de la même reprise : la facture enregistrée fait foi
+		if existing, err := GetOrderInvoice(order.ID); err == nil {
+			return existing, nil
+		}
+		log.Printf("❌ Facture %s (commande %s) non enregistrée, reprise au prochain essai: %v", inv.Number, order.ID, err)
+		return nil, err
+	}
+	if _, err := storeInvoicePDF(inv); err != nil {
+		log.Printf("⚠️ PDF de la facture %s non stocké (régénéré au prochain téléchargement): %v", inv.Number, err)
+	}
+	// Le montant entre dans l'encours de la société : sa réservation de crédit n'a plus lieu d'être
+	if order.PaymentMethod == models.PaymentMethodInvoice {
+		ReleaseInvoiceCredit(order.UserID, order.ID)
+	}
+
+	log.Printf("🧾 Facture %s émise pour la commande %s (%s %s)", inv.Number, order.ID, inv.GrossTotal, inv.GrossTotal.CurrencyCode())
+	return inv, nil
+}
+
+// QueueInvoiceRetry inscrit une commande sur facture dont la facture n'a pas pu être émise : elle sera reprise
+// périodiquement (même numéro si celui-ci était déjà réservé)
+func QueueInvoiceRetry(orderID gocql.UUID, cause error) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	var attempts int
+	if err := session.Query("SELECT attempts FROM pending_invoices WHERE order_id = ?", orderID).Scan(&attempts); err != nil && err != gocql.ErrNotFound {
+		return err
+	}
+	return session.Query("INSERT INTO pending_invoices (order_id, queued_at, attempts, last_error) VALUES (?, ?, ?, ?)",
+		orderID, time.Now(), attempts+1, cause.Error()).Exec()
+}
+
+// PendingInvoiceOrders retourne les commandes dont la facture reste à émettre
+func PendingInvoiceOrders() ([]gocql.UUID, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+	var ids []gocql.UUID
+	var id gocql.UUID
+	iter := session.Query("SELECT order_id FROM pending_invoices").Iter()
+	for iter.Scan(&id) {
+		ids = append(ids, id)
+	}
+	return ids, iter.Close()
+}
+
+// ClearPendingInvoice retire une commande de la file des factures à émettre
+func ClearPendingInvoice(orderID gocql.UUID) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("DELETE FROM pending_invoices WHERE order_id = ?", orderID).Exec()
+}
+
+// GetInvoicePDF relit le PDF d'une facture ; s'il manque, il est régénéré à l'identique depuis le contenu figé
+func GetInvoicePDF(inv *models.Invoice) ([]byte, error) {
+	if data, err := GetDocument(inv.PDFKey); err == nil && len(data) > 0 {
+		return data, nil
+	}
+	data, err := storeInvoicePDF(inv)
+	if err != nil && data != nil {
+		log.Printf("⚠️ PDF de la facture %s régénéré mais non stocké: %v", inv.Number, err)
+		return data, nil
+	}
+	return data, err
+}
+
+// InvoiceDownloadURL retourne une URL signée (valable duration) vers le PDF de la facture dans MinIO.
+// Un PDF manquant (échec de stockage à l'émission) est d'abord régénéré depuis le contenu figé.
+func InvoiceDownloadURL(ctx context.Context, inv *models.Invoice, duration time.Duration) (string, error) {
+	if database.MinIO == nil {
+		return "", fmt.Errorf("MinIO non initialisé")
+	}
+	if _, err := database.MinIO.StatObject(ctx, documentsBucket(), inv.PDFKey, minio.StatObjectOptions{}); err != nil {
+		if _, err := storeInvoicePDF(inv); err != nil {
+			return "", err
+		}
+	}
+	return GenerateDocumentSignedURL(ctx, inv.PDFKey, inv.Number+".pdf", duration)
+}
+
+// ListInvoices retourne les factures d'un exercice, de la plus récente à la plus ancienne
+func ListInvoices(fiscalYear int) ([]models.Invoice, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query("SELECT document, pdf_key FROM invoices WHERE fiscal_year = ? ALLOW FILTERING", fiscalYear).Iter()
+	invoices := []models.Invoice{}
+	var document, pdfKey string
+	for iter.Scan(&document, &pdfKey) {
+		var inv models.Invoice
+		if err := json.Unmarshal([]byte(document), &inv); err != nil {
+			log.Printf("⚠️ Facture illisible (%s): %v", pdfKey, err)
+			continue
+		}
+		inv.PDFKey = pdfKey
+		invoices = append(invoices, inv)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(invoices, func(i, j int) bool { return invoices[i].Sequence > invoices[j].Sequence })
+	return invoices, nil
+}
+
+func storeInvoicePDF(inv *models.Invoice) ([]byte, error) {
+	data, err := utils.RenderInvoicePDF(inv)
+	if err != nil {
+		return nil, err
+	}
+	if err := StoreDocument(inv.PDFKey, data, "application/pdf"); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// claimOrderInvoice réserve la facturation de la commande (une seule facture par commande, même en concurrence)
+func claimOrderInvoice(orderID gocql.UUID) (*documentClaim, error) {
+	return claimDocument("invoices_by_order", "order_id", "invoice_number", orderID)
+}
+
+func releaseOrderInvoice(orderID gocql.UUID) {
+	releaseDocument("invoices_by_order", "order_id", "invoice_number", orderID)
+}
+
+// documentClaim est la réservation d'émission d'un document ; Number est renseigné quand une émission
+// précédente a déjà obtenu son numéro sans enregistrer le document
+type documentClaim struct {
+	ClaimedAt  time.Time
+	Number     string
+	FiscalYear int
+	Sequence   int64
+}
+
+// claimDocument réserve l'émission du document lié à key dans la table de réservation (numéro vide tant qu'il
+// n'est pas attribué). Une réservation plus ancienne que invoiceClaimTimeout est reprise ; une réservation
+// dont le numéro est déjà attribué est retournée telle quelle pour terminer l'émission avec ce numéro.
+func claimDocument(table, keyColumn, numberColumn string, key gocql.UUID) (*documentClaim, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	current := map[string]interface{}{}
+	applied, err := session.Query(fmt.Sprintf(`INSERT INTO %s (%s, %s, claimed_at) VALUES (?, '', ?) IF NOT EXISTS`, table, keyColumn, numberColumn),
+		key, now).MapScanCAS(current)
+	if err != nil {
+		return nil, err
+	}
+	if applied {
+		return &documentClaim{ClaimedAt: now}, nil
+	}
+
+	claimedAt, _ := current["claimed_at"].(time.Time)
+	if number, _ := current[numberColumn].(string); number != "" {
+		claim := &documentClaim{ClaimedAt: claimedAt, Number: number}
+		claim.FiscalYear, _ = current["fiscal_year"].(int)
+		claim.Sequence, _ = current["sequence"].(int64)
+		if claim.Sequence == 0 {
+			// Réservation antérieure à la migration 022 : le document a été enregistré avec son numéro
+			return nil, ErrInvoiceInProgress
+		}
+		return claim, nil
+	}
+	if time.Since(claimedAt) < invoiceClaimTimeout {
+		return nil, ErrInvoiceInProgress
+	}
+
+	// Émission précédente interrompue avant l'attribution du numéro : on la reprend
+	applied, err = session.Query(fmt.Sprintf(`UPDATE %s SET claimed_at = ? WHERE %s = ? IF %s = '' AND claimed_at = ?`, table, keyColumn, numberColumn),
+		now, key, claimedAt).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if !applied {
+		return nil, ErrInvoiceInProgress
+	}
+	return &documentClaim{ClaimedAt: now}, nil
+}
+
+// reserveNumberAttempts : essais d'inscription d'un numéro attribué avant de le consigner comme numéro orphelin
+const reserveNumberAttempts = 3
+
+// reserveDocumentNumber inscrit le numéro attribué dans la réservation, tant qu'elle n'a pas été reprise
+// par une autre émission. Une erreur passagère est retentée avec le même numéro ; un numéro qui ne peut pas être
+// inscrit est consigné dans orphan_document_numbers pour être annulé explicitement.
+func reserveDocumentNumber(table, keyColumn, numberColumn string, key gocql.UUID, claim *documentClaim) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		recordOrphanNumber(table, key, claim, err.Error())
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		current := map[string]interface{}{}
+		applied, err := session.Query(fmt.Sprintf(`UPDATE %s SET %s = ?, fiscal_year = ?, sequence = ? WHERE %s = ? IF %s = '' AND claimed_at = ?`,
+			table, numberColumn, keyColumn, numberColumn), claim.Number, claim.FiscalYear, claim.Sequence, key, claim.ClaimedAt).
+			MapScanCAS(current)
+		if err == nil {
+			// Un essai précédent sans réponse a pu être appliqué : le numéro est alors déjà inscrit
+			if applied || current[numberColumn] == claim.Number {
+				return nil
+			}
+			recordOrphanNumber(table, key, claim, "réservation reprise par une autre émission")
+			return ErrInvoiceInProgress
+		}
+		if attempt >= reserveNumberAttempts {
+			recordOrphanNumber(table, key, claim, err.Error())
+			return err
+		}
+		log.Printf("⚠️ Numéro %s non inscrit (essai %d/%d): %v", claim.Number, attempt, reserveNumberAttempts, err)
+		time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+	}
+}
+
+// recordOrphanNumber consigne un numéro attribué qui ne figurera sur aucun document
+func recordOrphanNumber(table string, key gocql.UUID, claim *documentClaim, reason string) {
+	log.Printf("❌ Numéro %s (%s %s) perdu, consigné pour annulation: %s", claim.Number, table, key, reason)
+	session, err := database.GetOrdersSession()
+	if err == nil {
+		err = session.Query(`INSERT INTO orphan_document_numbers (document_number, fiscal_year, sequence, document_table, document_key, reason, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			claim.Number, claim.FiscalYear, claim.Sequence, table, key, reason, time.Now()).Exec()
+	}
+	if err != nil {
+		log.Printf("❌ Numéro orphelin %s non consigné, à annuler manuellement: %v", claim.Number, err)
+	}
+}
+
+// ListOrphanDocumentNumbers retourne les numéros orphelins, du plus ancien au plus récent
+func ListOrphanDocumentNumbers() ([]models.OrphanDocumentNumber, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := []models.OrphanDocumentNumber{}
+	var n models.OrphanDocumentNumber
+	iter := session.Query(`SELECT document_number, fiscal_year, sequence, document_table, document_key, reason, created_at, voided_at, voided_by, void_note
+		FROM orphan_document_numbers`).Iter()
+	for iter.Scan(&n.Number, &n.FiscalYear, &n.Sequence, &n.DocumentTable, &n.DocumentKey, &n.Reason, &n.CreatedAt, &n.VoidedAt, &n.VoidedBy, &n.VoidNote) {
+		numbers = append(numbers, n)
+		n = models.OrphanDocumentNumber{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i].CreatedAt.Before(numbers[j].CreatedAt) })
+	return numbers, nil
+}
+
+// ErrNumberAlreadyVoided : le numéro orphelin a déjà été annulé
+var ErrNumberAlreadyVoided = errors.New("numéro déjà annulé")
+
+// VoidOrphanDocumentNumber enregistre l'annulation d'un numéro orphelin (gocql.ErrNotFound s'il n'est pas consigné)
+func VoidOrphanDocumentNumber(number, voidedBy, note string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	var voidedAt *time.Time
+	if err := session.Query("SELECT voided_at FROM orphan_document_numbers WHERE document_number = ?", number).Scan(&voidedAt); err != nil {
+		return err
+	}
+	applied, err := session.Query(`UPDATE orphan_document_numbers SET voided_at = ?, voided_by = ?, void_note = ?
+		WHERE document_number = ? IF voided_at = null`, time.Now(), voidedBy, note, number).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrNumberAlreadyVoided
+	}
+	return nil
+}
+
+func releaseDocument(table, keyColumn, numberColumn string, key gocql.UUID) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return
+	}
+	if err := session.Query(fmt.Sprintf("DELETE FROM %s WHERE %s = ? IF %s = ''", table, keyColumn, numberColumn), key).Exec(); err != nil {
+		log.Printf("⚠️ Réservation %s de %s non libérée: %v", table, key, err)
+	}
+}
+
+func saveInvoice(inv *models.Invoice) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation facture: %v", err)
+	}
+
+	// Société de l'acheteur : encours et relances des factures payables sur facture
+	companyID, _ := UserCompanyID(inv.UserID)
+
+	applied, err := session.Query(`INSERT INTO invoices (invoice_number, fiscal_year, sequence, order_id, user_id, buyer_name, buyer_email,
+		buyer_vat_number, net_total, tax_total, gross_total, issued_at, paid_at, pdf_key, document, company_id, dunning_level)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0) IF NOT EXISTS`,
+		inv.Number, inv.FiscalYear, inv.Sequence, inv.OrderID, inv.UserID, inv.Buyer.Name, inv.Buyer.Email,
+		inv.Buyer.VATNumber, inv.NetTotal, inv.TaxTotal, inv.GrossTotal, inv.IssuedAt, inv.PaidAt, inv.PDFKey, string(document), companyID).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return fmt.Errorf("le numéro de facture %s existe déjà", inv.Number)
+	}
+	return nil
+}
+
+// BuildInvoice fige le contenu de la facture à partir de la commande (lignes et TVA calculées au checkout)
+func BuildInvoice(order *models.Order) *models.Invoice {
+	now := time.Now()
+	seller := utils.GetSellerDetails()
+	seller.Country = ShopCountry()
+	iban, bic := utils.GetBankDetails()
+
+	inv := &models.Invoice{
+		FiscalYear:     FiscalYear(now),
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		Seller:         seller,
+		Buyer:          loadInvoiceBuyer(order),
+		DiscountAmount: order.DiscountAmount,
+		IBAN:           iban,
+		BIC:            bic,
+		IssuedAt:       now,
+		PONumber:       order.PONumber,
+		CostCenter:     order.CostCenter,
+	}
+	switch {
+	case order.PaymentMethod == models.PaymentMethodInvoice:
+		// Paiement sur facture : échéance selon les conditions de la société, acquittée au rapprochement du virement
+		inv.PaymentTermsDays = defaultPaymentTermsDays
+		if terms, err := userCreditTerms(order.UserID); err == nil {
+			inv.PaymentTermsDays = terms.PaymentTermsDays
+		}
+		due := now.AddDate(0, 0, inv.PaymentTermsDays)
+		inv.DueDate = &due
+	case IsPaidOrderStatus(order.Status):
+		inv.PaidAt = &now
+	case order.Status == models.OrderStatusCancelled:
+		// Commande payée puis annulée, facturée pour sa note de crédit : la date du paiement est reprise de l'historique
+		inv.PaidAt = OrderPaidAt(order.ID)
+	}
+
+	tax := order.Tax
+	if tax == nil {
+		// Commandes antérieures au calcul de la TVA : TVA domestique extraite des prix payés
+		legacy := *order
+		legacy.Items = append([]models.OrderItem(nil), order.Items...)
+		if err := ApplyOrderTax(&legacy, TaxCustomer{Country: ShopCountry()}); err == nil {
+			tax = legacy.Tax
+		}
+	}
+	if tax == nil {
+		tax = &models.TaxSummary{Regime: models.TaxRegimeDomestic, GrossTotal: order.TotalPrice, NetTotal: order.TotalPrice}
+	}
+
+	for i, line := range tax.Lines {
+		invoiceLine := models.InvoiceLine{
+			ProductID:   line.ProductID,
+			VariantID:   line.VariantID,
+			Description: line.Description,
+			TaxRate:     line.Rate,
+			NetAmount:   line.NetAmount,
+			TaxAmount:   line.TaxAmount,
+			GrossAmount: line.GrossAmount,
+		}
+		if i < len(order.Items) {
+			invoiceLine.Quantity = order.Items[i].Quantity
+			invoiceLine.UnitPrice = order.Items[i].Price
+		}
+		inv.Lines = append(inv.Lines, invoiceLine)
+	}
+	if tax.Shipping != nil {
+		description := "Livraison"
+		if order.ShippingOptionName != "" {
+			description = "Livraison - " + order.ShippingOptionName
+		}
+		inv.Lines = append(inv.Lines, models.InvoiceLine{
+			Description: description,
+			Quantity:    1,
+			UnitPrice:   order.ShippingCost,
+			TaxRate:     tax.Shipping.Rate,
+			NetAmount:   tax.Shipping.NetAmount,
+			TaxAmount:   tax.Shipping.TaxAmount,
+			GrossAmount: tax.Shipping.GrossAmount,
+		})
+	}
+
+	inv.Rates = tax.Rates
+	inv.NetTotal = tax.NetTotal
+	inv.TaxTotal = tax.TaxTotal
+	inv.GrossTotal = tax.GrossTotal
+	inv.TaxRegime = tax.Regime
+	inv.TaxNote = tax.Note
+	if inv.Buyer.VATNumber == "" {
+		inv.Buyer.VATNumber = tax.VATNumber
+	}
+	return inv
+}
+
+// loadInvoiceBuyer retrouve l'acheteur : la société (raison sociale, adresse de facturation, TVA) pour un compte
+// entreprise, sinon le client et son adresse de livraison
+func loadInvoiceBuyer(order *models.Order) models.InvoiceParty {
+	buyer := models.InvoiceParty{}
+	if order.ShippingAddress != nil {
+		buyer.AddressLines = addressLines(order.ShippingAddress.Street, order.ShippingAddress.PostalCode,
+			order.ShippingAddress.City, order.ShippingAddress.Country)
+		buyer.Country = order.ShippingAddress.Country
+	}
+
+	uid, err := uuid.Parse(order.UserID)
+	if err != nil {
+		return buyer
+	}
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return buyer
+	}
+
+	var companyID *gocql.UUID
+	if err := session.Query("SELECT name, email, company_id FROM users WHERE user_id = ?", gocql.UUID(uid)).
+		Scan(&buyer.Name, &buyer.Email, &companyID); err != nil || companyID == nil {
+		return buyer
+	}
+
+	var name, street, postalCode, city, country, vatNumber, vatStatus string
+	if err := session.Query(`SELECT name, billing_street, billing_postal_code, billing_city, billing_country, vat_number, vat_status
+		FROM companies WHERE company_id = ?`, *companyID).Scan(&name, &street, &postalCode, &city, &country, &vatNumber, &vatStatus); err != nil {
+		log.Printf("⚠️ Société %s introuvable pour la facture: %v", companyID, err)
+		return buyer
+	}
+
+	buyer.Name = name
+	if street != "" {
+		buyer.AddressLines = addressLines(street, postalCode, city, country)
+		buyer.Country = country
+	}
+	if vatStatus == models.VATStatusValid {
+		buyer.VATNumber = vatNumber
+	}
+	return buyer
+}
+
+func addressLines(street, postalCode, city, country string) []string {
+	lines := []string{}
+	if street != "" {
+		lines = append(lines, street)
+	}
+	if cityLine := strings.TrimSpace(postalCode + " " + city); cityLine != "" {
+		lines = append(lines, cityLine)
+	}
+	if country != "" {
+		lines = append(lines, strings.ToUpper(country))
+	}
+	return lines
+}
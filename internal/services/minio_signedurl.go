@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"strings"
 	"time"
@@ -30,3 +31,22 @@ func GenerateSignedURL(ctx context.Context, objectPath string, duration time.Dur
 
 	return presignedURL.String(), nil
 }
+
+// GenerateDocumentSignedURL signe l'URL d'un document généré (factures...) du bucket des documents ;
+// le navigateur le télécharge sous le nom filename
+func GenerateDocumentSignedURL(ctx context.Context, objectName, filename string, duration time.Duration) (string, error) {
+	if database.MinIO == nil {
+		return "", fmt.Errorf("MinIO non initialisé")
+	}
+
+	reqParams := make(url.Values)
+	if filename != "" {
+		reqParams.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+
+	presignedURL, err := database.MinIO.PresignedGetObject(ctx, documentsBucket(), objectName, duration, reqParams)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"log"
+
+	"github.com/gocql/gocql"
+)
+
+// orderColumns liste les colonnes lues par LoadOrder (table orders)
+const orderColumns = `order_id, user_id, payment_intent_id, payment_method, quote_id, company_id, po_number, cost_center, items, subtotal, discount_amount, coupon_code,
+	address_id, shipping_address, shipping_option_id, shipping_option_name, shipping_cost, tax_amount, tax_details, total_price, refunded_amount, status,
+	tracking_number, created_at, updated_at`
+
+// LoadOrder récupère une commande complète depuis la table orders (lignes, adresse, TVA, références de l'acheteur)
+func LoadOrder(orderID gocql.UUID) (*models.Order, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		order       models.Order
+		itemsJSON   string
+		addressJSON string
+		taxJSON     string
+	)
+
+	err = session.Query("SELECT "+orderColumns+" FROM orders WHERE order_id = ?", orderID).Scan(
+		&order.ID, &order.UserID, &order.PaymentIntentID, &order.PaymentMethod, &order.QuoteID, &order.CompanyID, &order.PONumber, &order.CostCenter, &itemsJSON, &order.Subtotal, &order.DiscountAmount, &order.CouponCode,
+		&order.AddressID, &addressJSON, &order.ShippingOptionID, &order.ShippingOptionName, &order.ShippingCost, &order.TaxAmount, &taxJSON, &order.TotalPrice, &order.RefundedAmount, &order.Status, &order.TrackingNumber, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if itemsJSON != "" {
+		if err := json.Unmarshal([]byte(itemsJSON), &order.Items); err != nil {
+			log.Printf("⚠️ Erreur désérialisation items commande %s: %v", orderID, err)
+		}
+	}
+	if addressJSON != "" {
+		var address models.Address
+		if err := json.Unmarshal([]byte(addressJSON), &address); err == nil {
+			order.ShippingAddress = &address
+		}
+	}
+	if taxJSON != "" {
+		var tax models.TaxSummary
+		if err := json.Unmarshal([]byte(taxJSON), &tax); err == nil {
+			order.Tax = &tax
+		}
+	}
+	// Commandes antérieures au paiement sur facture
+	if order.PaymentMethod == "" {
+		order.PaymentMethod = models.PaymentMethodCard
+	}
+
+	return &order, nil
+}
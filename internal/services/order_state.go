@@ -0,0 +1,207 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// orderTransitions liste, pour chaque statut, les statuts atteignables
+var orderTransitions = map[string][]string{
+	// Approbation d'achat : le paiement n'est possible qu'une fois la commande approuvée ; un refus l'annule
+	models.OrderStatusPendingApproval: {
+		models.OrderStatusPendingPayment, models.OrderStatusCancelled,
+	},
+	models.OrderStatusPendingPayment: {
+		models.OrderStatusPaymentProcessing, models.OrderStatusPaymentFailed, models.OrderStatusPaid, models.OrderStatusInvoiced,
+		models.OrderStatusCancelled,
+	},
+	// Commande sur facture (société approuvée) : préparée sans attendre le virement, payée à l'échéance
+	models.OrderStatusInvoiced: {
+		models.OrderStatusPaid, models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, models.OrderStatusShipped,
+		models.OrderStatusCancelled,
+	},
+	models.OrderStatusPaymentProcessing: {
+		models.OrderStatusPaymentFailed, models.OrderStatusPaid, models.OrderStatusCancelled,
+	},
+	models.OrderStatusPaymentFailed: {
+		models.OrderStatusPaymentProcessing, models.OrderStatusPaid, models.OrderStatusCancelled,
+	},
+	models.OrderStatusPaid: {
+		models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusCancelled,
+		models.OrderStatusRefunded, models.OrderStatusPartiallyRefunded, models.OrderStatusDisputed,
+	},
+	models.OrderStatusProcessing: {
+		models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusCancelled,
+		models.OrderStatusRefunded, models.OrderStatusPartiallyRefunded, models.OrderStatusDisputed,
+	},
+	// Expédition en plusieurs colis : la commande est "shipped" quand le dernier article est parti
+	models.OrderStatusPartiallyShipped: {
+		models.OrderStatusShipped, models.OrderStatusRefunded, models.OrderStatusPartiallyRefunded, models.OrderStatusDisputed,
+	},
+	models.OrderStatusShipped: {
+		models.OrderStatusDelivered, models.OrderStatusRefunded, models.OrderStatusPartiallyRefunded, models.OrderStatusDisputed,
+	},
+	models.OrderStatusDelivered: {
+		models.OrderStatusRefunded, models.OrderStatusPartiallyRefunded, models.OrderStatusDisputed,
+	},
+	// Un remboursement partiel n'interrompt pas la préparation de la commande
+	models.OrderStatusPartiallyRefunded: {
+		models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded, models.OrderStatusProcessing,
+		models.OrderStatusPartiallyShipped, models.OrderStatusShipped, models.OrderStatusDelivered, models.OrderStatusDisputed,
+	},
+	// Litige gagné : retour au statut précédent ; perdu : remboursé
+	models.OrderStatusDisputed: {
+		models.OrderStatusPaid, models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, models.OrderStatusShipped,
+		models.OrderStatusDelivered, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded,
+	},
+	models.OrderStatusCancelled: {},
+	models.OrderStatusRefunded:  {},
+	// Ancien statut des commandes créées avant pending_payment
+	"pending": {
+		models.OrderStatusPaid, models.OrderStatusCancelled,
+	},
+}
+
+// InvalidTransitionError est retournée quand une transition n'est pas autorisée par la machine à états
+type InvalidTransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("transition %s → %s non autorisée", e.From, e.To)
+}
+
+// IsOrderStatus indique si le statut fait partie de la machine à états
+func IsOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// AllowedOrderTransitions retourne les statuts atteignables depuis un statut
+func AllowedOrderTransitions(from string) []string {
+	allowed := orderTransitions[from]
+	if allowed == nil {
+		return []string{}
+	}
+	return allowed
+}
+
+// IsPaidOrderStatus indique si le statut est celui d'une commande payée (y compris expédiée, livrée ou remboursée)
+func IsPaidOrderStatus(status string) bool {
+	switch status {
+	case models.OrderStatusPaid, models.OrderStatusProcessing, models.OrderStatusPartiallyShipped, models.OrderStatusShipped,
+		models.OrderStatusDelivered, models.OrderStatusPartiallyRefunded, models.OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransitionOrder indique si une commande peut passer de from à to
+func CanTransitionOrder(from, to string) bool {
+	for _, status := range orderTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrderTransition retourne une InvalidTransitionError si la transition est interdite
+func CheckOrderTransition(from, to string) error {
+	if !CanTransitionOrder(from, to) {
+		return &InvalidTransitionError{From: from, To: to, Allowed: AllowedOrderTransitions(from)}
+	}
+	return nil
+}
+
+// RecordOrderEvent enregistre une transition dans order_events
+func RecordOrderEvent(orderID gocql.UUID, from, to string, actor models.OrderActor, payload map[string]interface{}) (*models.OrderEvent, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	event := &models.OrderEvent{
+		ID:         gocql.TimeUUID(),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		Payload:    payload,
+		CreatedAt:  time.Now(),
+	}
+
+	var payloadJSON string
+	if len(payload) > 0 {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("erreur sérialisation payload: %v", err)
+		}
+		payloadJSON = string(data)
+	}
+
+	err = session.Query(`INSERT INTO order_events (order_id, event_id, from_status, to_status, actor_type, actor_id, payload, created_at)
+	                     VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.OrderID, event.ID, event.FromStatus, event.ToStatus, actor.Type, actor.ID, payloadJSON, event.CreatedAt).Exec()
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// GetOrderEvents retourne l'historique des transitions d'une commande, du plus ancien au plus récent
+func GetOrderEvents(orderID gocql.UUID) ([]models.OrderEvent, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(`SELECT event_id, from_status, to_status, actor_type, actor_id, payload, created_at
+	                       FROM order_events WHERE order_id = ?`, orderID).Iter()
+
+	events := []models.OrderEvent{}
+	var (
+		event       models.OrderEvent
+		payloadJSON string
+	)
+	for iter.Scan(&event.ID, &event.FromStatus, &event.ToStatus, &event.Actor.Type, &event.Actor.ID, &payloadJSON, &event.CreatedAt) {
+		event.OrderID = orderID
+		if payloadJSON != "" {
+			if err := json.Unmarshal([]byte(payloadJSON), &event.Payload); err != nil {
+				log.Printf("⚠️ Payload illisible pour l'événement %s: %v", event.ID, err)
+			}
+		}
+		events = append(events, event)
+		event = models.OrderEvent{}
+		payloadJSON = ""
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// OrderPaidAt retourne la date du dernier passage de la commande en "paid" (nil si elle n'a jamais été payée)
+func OrderPaidAt(orderID gocql.UUID) *time.Time {
+	events, err := GetOrderEvents(orderID)
+	if err != nil {
+		log.Printf("⚠️ Historique de la commande %s illisible: %v", orderID, err)
+		return nil
+	}
+	var paidAt *time.Time
+	for i := range events {
+		if events[i].ToStatus == models.OrderStatusPaid && (paidAt == nil || events[i].CreatedAt.After(*paidAt)) {
+			paidAt = &events[i].CreatedAt
+		}
+	}
+	return paidAt
+}
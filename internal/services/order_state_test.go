@@ -0,0 +1,96 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestCanTransitionOrder(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{models.OrderStatusPendingApproval, models.OrderStatusPendingPayment, true},
+		{models.OrderStatusPendingApproval, models.OrderStatusPaid, false},
+		{models.OrderStatusPendingPayment, models.OrderStatusPaid, true},
+		{models.OrderStatusPendingPayment, models.OrderStatusShipped, false},
+		{models.OrderStatusPaymentFailed, models.OrderStatusPaymentProcessing, true},
+		{models.OrderStatusInvoiced, models.OrderStatusShipped, true},
+		{models.OrderStatusPaid, models.OrderStatusProcessing, true},
+		{models.OrderStatusPaid, models.OrderStatusDelivered, false},
+		{models.OrderStatusPaid, models.OrderStatusPendingPayment, false},
+		{models.OrderStatusPartiallyShipped, models.OrderStatusCancelled, false},
+		{models.OrderStatusShipped, models.OrderStatusDelivered, true},
+		{models.OrderStatusShipped, models.OrderStatusCancelled, false},
+		{models.OrderStatusDelivered, models.OrderStatusProcessing, false},
+		{models.OrderStatusPartiallyRefunded, models.OrderStatusPartiallyRefunded, true},
+		{models.OrderStatusDisputed, models.OrderStatusShipped, true},
+		{models.OrderStatusCancelled, models.OrderStatusPaid, false},
+		{models.OrderStatusRefunded, models.OrderStatusPaid, false},
+		{"pending", models.OrderStatusPaid, true},
+		{"inconnu", models.OrderStatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"→"+tt.to, func(t *testing.T) {
+			if got := CanTransitionOrder(tt.from, tt.to); got != tt.allowed {
+				t.Errorf("CanTransitionOrder(%s, %s) = %v, attendu %v", tt.from, tt.to, got, tt.allowed)
+			}
+
+			err := CheckOrderTransition(tt.from, tt.to)
+			if (err == nil) != tt.allowed {
+				t.Errorf("CheckOrderTransition(%s, %s) = %v", tt.from, tt.to, err)
+			}
+			var transitionErr *InvalidTransitionError
+			if err != nil && (!errors.As(err, &transitionErr) || transitionErr.From != tt.from || transitionErr.To != tt.to) {
+				t.Errorf("CheckOrderTransition(%s, %s) = %#v, InvalidTransitionError attendue", tt.from, tt.to, err)
+			}
+		})
+	}
+}
+
+// Chaque statut atteignable fait partie de la machine à états et les statuts finaux n'ont pas de sortie
+func TestOrderTransitionsAreClosed(t *testing.T) {
+	for from, targets := range orderTransitions {
+		for _, to := range targets {
+			if !IsOrderStatus(to) {
+				t.Errorf("%s → %s : statut cible inconnu", from, to)
+			}
+		}
+	}
+
+	for _, status := range []string{models.OrderStatusCancelled, models.OrderStatusRefunded} {
+		if allowed := AllowedOrderTransitions(status); len(allowed) != 0 {
+			t.Errorf("AllowedOrderTransitions(%s) = %v, attendu aucun", status, allowed)
+		}
+	}
+	if allowed := AllowedOrderTransitions("inconnu"); allowed == nil || len(allowed) != 0 {
+		t.Errorf("AllowedOrderTransitions(inconnu) = %#v, attendu une liste vide", allowed)
+	}
+}
+
+func TestIsPaidOrderStatus(t *testing.T) {
+	paid := map[string]bool{
+		models.OrderStatusPendingApproval:   false,
+		models.OrderStatusPendingPayment:    false,
+		models.OrderStatusPaymentProcessing: false,
+		models.OrderStatusPaymentFailed:     false,
+		models.OrderStatusInvoiced:          false,
+		models.OrderStatusCancelled:         false,
+		models.OrderStatusDisputed:          false,
+		models.OrderStatusPaid:              true,
+		models.OrderStatusProcessing:        true,
+		models.OrderStatusPartiallyShipped:  true,
+		models.OrderStatusShipped:           true,
+		models.OrderStatusDelivered:         true,
+		models.OrderStatusPartiallyRefunded: true,
+		models.OrderStatusRefunded:          true,
+	}
+
+	for status, want := range paid {
+		if got := IsPaidOrderStatus(status); got != want {
+			t.Errorf("IsPaidOrderStatus(%s) = %v, attendu %v", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Identifiants du réseau Peppol pour BIS Billing 3.0
+const (
+	peppolInvoiceDocType    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2::Invoice##" + peppolCustomizationID + "::2.1"
+	peppolCreditNoteDocType = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2::CreditNote##" + peppolCustomizationID + "::2.1"
+	peppolProcessID         = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+)
+
+// peppolVATSchemes : schémas d'identification Peppol (ICD) basés sur le numéro de TVA, par préfixe pays
+var peppolVATSchemes = map[string]string{
+	"AT": "9914",
+	"BE": "9925",
+	"DE": "9930",
+	"ES": "9920",
+	"FR": "9957",
+	"IE": "9935",
+	"IT": "9906",
+	"LU": "9938",
+	"NL": "9944",
+}
+
+var peppolParticipantPattern = regexp.MustCompile(`^[0-9]{4}:[A-Za-z0-9.\-]{1,50}$`)
+
+// PeppolDocument est un document UBL à transmettre sur le réseau Peppol
+type PeppolDocument struct {
+	Number     string
+	Type       string // invoice, credit_note
+	SenderID   string // 0208:0123456789
+	ReceiverID string
+	DocumentID string // Identifiant du type de document Peppol
+	ProcessID  string
+	XML        []byte
+}
+
+// PeppolAccessPoint transmet un document au point d'accès Peppol et retourne l'identifiant du message
+type PeppolAccessPoint interface {
+	Send(doc *PeppolDocument) (string, error)
+}
+
+var (
+	peppolMu       sync.RWMutex
+	peppolOverride PeppolAccessPoint
+)
+
+// SetPeppolAccessPoint remplace le point d'accès (nil : retour à la configuration PEPPOL_MODE)
+func SetPeppolAccessPoint(ap PeppolAccessPoint) {
+	peppolMu.Lock()
+	defer peppolMu.Unlock()
+	peppolOverride = ap
+}
+
+// currentPeppolAccessPoint retourne le point d'accès configuré :
+// PEPPOL_MODE=file (défaut, dépôt dans PEPPOL_OUTBOX_DIR) ou off (envoi désactivé)
+func currentPeppolAccessPoint() PeppolAccessPoint {
+	peppolMu.RLock()
+	override := peppolOverride
+	peppolMu.RUnlock()
+	if override != nil {
+		return override
+	}
+
+	switch strings.ToLower(os.Getenv("PEPPOL_MODE")) {
+	case "off":
+		return nil
+	default:
+		dir := os.Getenv("PEPPOL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "peppol-outbox"
+		}
+		return &FileDropAccessPoint{Dir: dir}
+	}
+}
+
+// FileDropAccessPoint dépose le XML et son enveloppe (émetteur, destinataire, type de document) dans un dossier :
+// usage local, ou relève par un point d'accès externe
+type FileDropAccessPoint struct {
+	Dir string
+}
+
+func (f *FileDropAccessPoint) Send(doc *PeppolDocument) (string, error) {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(f.Dir, doc.Number)
+	if err := os.WriteFile(base+".xml", doc.XML, 0o644); err != nil {
+		return "", err
+	}
+
+	envelope, err := json.MarshalIndent(map[string]string{
+		"sender":      doc.SenderID,
+		"receiver":    doc.ReceiverID,
+		"document_id": doc.DocumentID,
+		"process_id":  doc.ProcessID,
+		"type":        doc.Type,
+		"number":      doc.Number,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".json", envelope, 0o644); err != nil {
+		return "", err
+	}
+	return "file:" + base + ".xml", nil
+}
+
+// PeppolParticipantID déduit l'identifiant Peppol (schéma:valeur) d'un numéro de TVA.
+// Belgique : numéro d'entreprise BCE (0208), identifiant le plus répandu sur le réseau belge.
+func PeppolParticipantID(vatNumber string) (string, bool) {
+	vat := NormalizeVATNumber(vatNumber)
+	if len(vat) < 4 {
+		return "", false
+	}
+	country := vat[:2]
+	if country == "BE" {
+		return "0208:" + vat[2:], true
+	}
+	scheme, ok := peppolVATSchemes[country]
+	if !ok {
+		return "", false
+	}
+	return scheme + ":" + vat, true
+}
+
+// ValidatePeppolParticipantID vérifie le format schéma:valeur d'un identifiant Peppol saisi
+func ValidatePeppolParticipantID(id string) bool {
+	return peppolParticipantPattern.MatchString(id)
+}
+
+// PeppolSenderID retourne l'identifiant Peppol du vendeur (PEPPOL_SENDER_ID, sinon déduit de COMPANY_VAT_NUMBER)
+func PeppolSenderID() string {
+	if id := os.Getenv("PEPPOL_SENDER_ID"); id != "" {
+		return id
+	}
+	id, _ := PeppolParticipantID(os.Getenv("COMPANY_VAT_NUMBER"))
+	return id
+}
+
+func splitParticipantID(id string) (string, string) {
+	scheme, value, ok := strings.Cut(id, ":")
+	if !ok {
+		return "", ""
+	}
+	return scheme, value
+}
+
+// invoiceBuyerEndpoint retrouve l'identifiant Peppol de la société acheteuse : celui saisi par la société,
+// sinon celui déduit de son numéro de TVA. Les factures des particuliers ne sont pas exportées.
+func invoiceBuyerEndpoint(userID string, buyer models.InvoiceParty) (string, error) {
+	companyID, err := UserCompanyID(userID)
+	if err != nil || companyID == nil {
+		return "", ErrNotB2BInvoice
+	}
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return "", err
+	}
+	var peppolID string
+	if err := session.Query("SELECT peppol_id FROM companies WHERE company_id = ?", *companyID).Scan(&peppolID); err != nil && err != gocql.ErrNotFound {
+		return "", err
+	}
+	if peppolID != "" {
+		return peppolID, nil
+	}
+	if id, ok := PeppolParticipantID(buyer.VATNumber); ok {
+		return id, nil
+	}
+	return "", nil
+}
+
+// SendInvoiceToPeppol exporte la facture en UBL et la transmet au point d'accès Peppol
+func SendInvoiceToPeppol(inv *models.Invoice) (*models.PeppolDelivery, error) {
+	data, err := InvoiceUBL(inv)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := invoiceBuyerEndpoint(inv.UserID, inv.Buyer)
+	if err != nil {
+		return nil, err
+	}
+	return deliverPeppol(&PeppolDocument{
+		Number:     inv.Number,
+		Type:       models.PeppolDocumentInvoice,
+		SenderID:   PeppolSenderID(),
+		ReceiverID: receiver,
+		DocumentID: peppolInvoiceDocType,
+		ProcessID:  peppolProcessID,
+		XML:        data,
+	})
+}
+
+// SendCreditNoteToPeppol exporte la note de crédit en UBL et la transmet au point d'accès Peppol
+func SendCreditNoteToPeppol(note *models.CreditNote) (*models.PeppolDelivery, error) {
+	data, err := CreditNoteUBL(note)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := invoiceBuyerEndpoint(note.UserID, note.Buyer)
+	if err != nil {
+		return nil, err
+	}
+	return deliverPeppol(&PeppolDocument{
+		Number:     note.Number,
+		Type:       models.PeppolDocumentCreditNote,
+		SenderID:   PeppolSenderID(),
+		ReceiverID: receiver,
+		DocumentID: peppolCreditNoteDocType,
+		ProcessID:  peppolProcessID,
+		XML:        data,
+	})
+}
+
+// GetPeppolDelivery retourne la dernière transmission Peppol d'un document (gocql.ErrNotFound sinon)
+func GetPeppolDelivery(number string) (*models.PeppolDelivery, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery models.PeppolDelivery
+	if err := session.Query(`SELECT document_number, document_type, receiver_id, message_id, sent_at
+		FROM peppol_deliveries WHERE document_number = ?`, number).Scan(
+		&delivery.DocumentNumber, &delivery.DocumentType, &delivery.ReceiverID, &delivery.MessageID, &delivery.SentAt); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func deliverPeppol(doc *PeppolDocument) (*models.PeppolDelivery, error) {
+	ap := currentPeppolAccessPoint()
+	if ap == nil {
+		return nil, fmt.Errorf("envoi Peppol désactivé (PEPPOL_MODE=off)")
+	}
+
+	messageID, err := ap.Send(doc)
+	if err != nil {
+		log.Printf("❌ Envoi Peppol de %s vers %s échoué: %v", doc.Number, doc.ReceiverID, err)
+		return nil, err
+	}
+
+	delivery := &models.PeppolDelivery{
+		DocumentNumber: doc.Number,
+		DocumentType:   doc.Type,
+		ReceiverID:     doc.ReceiverID,
+		MessageID:      messageID,
+		SentAt:         time.Now(),
+	}
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return delivery, err
+	}
+	if err := session.Query(`INSERT INTO peppol_deliveries (document_number, document_type, receiver_id, message_id, sent_at)
+		VALUES (?, ?, ?, ?, ?)`, delivery.DocumentNumber, delivery.DocumentType, delivery.ReceiverID, delivery.MessageID, delivery.SentAt).Exec(); err != nil {
+		log.Printf("⚠️ Transmission Peppol de %s non enregistrée: %v", doc.Number, err)
+	}
+
+	log.Printf("📨 %s transmis sur Peppol à %s (%s)", doc.Number, doc.ReceiverID, messageID)
+	return delivery, nil
+}
@@ -0,0 +1,564 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// =========================
+// Listes de prix
+// =========================
+
+// GetPriceList charge une liste de prix et ses règles
+func GetPriceList(id gocql.UUID) (*models.PriceList, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var document string
+	if err := session.Query("SELECT document FROM price_lists WHERE price_list_id = ?", id).Scan(&document); err != nil {
+		return nil, err
+	}
+	var list models.PriceList
+	if err := json.Unmarshal([]byte(document), &list); err != nil {
+		return nil, fmt.Errorf("liste de prix illisible: %v", err)
+	}
+	return &list, nil
+}
+
+// ListPriceLists retourne toutes les listes de prix, par nom
+func ListPriceLists() ([]models.PriceList, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query("SELECT document FROM price_lists").Iter()
+	lists := []models.PriceList{}
+	var document string
+	for iter.Scan(&document) {
+		var list models.PriceList
+		if err := json.Unmarshal([]byte(document), &list); err != nil {
+			log.Printf("⚠️ Liste de prix illisible: %v", err)
+			continue
+		}
+		lists = append(lists, list)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(lists, func(i, j int) bool { return strings.ToLower(lists[i].Name) < strings.ToLower(lists[j].Name) })
+	return lists, nil
+}
+
+// ValidatePriceRules vérifie les règles d'une liste de prix (une cible, un prix fixe ou une remise valide)
+func ValidatePriceRules(rules []models.PriceRule) error {
+	for i, rule := range rules {
+		targets := 0
+		if rule.VariantID != "" {
+			if rule.ProductID == "" {
+				return fmt.Errorf("règle %d : une variante doit être accompagnée de son produit", i+1)
+			}
+			targets++
+		} else if rule.ProductID != "" {
+			targets++
+		}
+		if rule.CategoryID != "" {
+			targets++
+		}
+		if targets != 1 {
+			return fmt.Errorf("règle %d : cibler un produit, une variante ou une catégorie", i+1)
+		}
+		for _, id := range []string{rule.ProductID, rule.VariantID, rule.CategoryID} {
+			if id != "" {
+				if _, err := uuid.Parse(id); err != nil {
+					return fmt.Errorf("règle %d : identifiant invalide %q", i+1, id)
+				}
+			}
+		}
+		if (rule.FixedPrice == nil) == (rule.DiscountPercent == 0) {
+			return fmt.Errorf("règle %d : indiquer un prix fixe ou un pourcentage de remise", i+1)
+		}
+		if rule.FixedPrice != nil && rule.FixedPrice.Amount < 0 {
+			return fmt.Errorf("règle %d : prix fixe invalide", i+1)
+		}
+		if rule.DiscountPercent < 0 || rule.DiscountPercent > 100 {
+			return fmt.Errorf("règle %d : remise invalide (0 à 100 %%)", i+1)
+		}
+		if rule.MinQuantity < 0 {
+			return fmt.Errorf("règle %d : quantité minimale invalide", i+1)
+		}
+	}
+	return nil
+}
+
+// SavePriceList crée ou remplace une liste de prix
+func SavePriceList(list *models.PriceList) error {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return err
+	}
+
+	if list.Rules == nil {
+		list.Rules = []models.PriceRule{}
+	}
+	document, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation liste de prix: %v", err)
+	}
+	return session.Query("INSERT INTO price_lists (price_list_id, name, is_active, document) VALUES (?, ?, ?, ?)",
+		list.ID, list.Name, list.IsActive, string(document)).Exec()
+}
+
+// PriceListInUse indique si une liste de prix est attribuée à une société ou à un groupe de clients
+func PriceListInUse(id gocql.UUID) (bool, error) {
+	groups, err := ListCustomerGroups()
+	if err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		if group.PriceListID != nil && *group.PriceListID == id {
+			return true, nil
+		}
+	}
+
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return false, err
+	}
+	var companyID gocql.UUID
+	err = session.Query("SELECT company_id FROM companies WHERE price_list_id = ? LIMIT 1 ALLOW FILTERING", id).Scan(&companyID)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeletePriceList supprime une liste de prix (à vérifier avec PriceListInUse)
+func DeletePriceList(id gocql.UUID) error {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("DELETE FROM price_lists WHERE price_list_id = ?", id).Exec()
+}
+
+// =========================
+// Groupes de clients
+// =========================
+
+// ListCustomerGroups retourne les groupes de clients, par nom
+func ListCustomerGroups() ([]models.CustomerGroup, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query("SELECT group_id, name, description, price_list_id, created_at FROM customer_groups").Iter()
+	groups := []models.CustomerGroup{}
+	var group models.CustomerGroup
+	for iter.Scan(&group.ID, &group.Name, &group.Description, &group.PriceListID, &group.CreatedAt) {
+		groups = append(groups, group)
+		group = models.CustomerGroup{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name) })
+	return groups, nil
+}
+
+// GetCustomerGroup charge un groupe de clients
+func GetCustomerGroup(id gocql.UUID) (*models.CustomerGroup, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	group := &models.CustomerGroup{ID: id}
+	if err := session.Query("SELECT name, description, price_list_id, created_at FROM customer_groups WHERE group_id = ?", id).
+		Scan(&group.Name, &group.Description, &group.PriceListID, &group.CreatedAt); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// SaveCustomerGroup crée ou remplace un groupe de clients
+func SaveCustomerGroup(group *models.CustomerGroup) error {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("INSERT INTO customer_groups (group_id, name, description, price_list_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		group.ID, group.Name, group.Description, group.PriceListID, group.CreatedAt).Exec()
+}
+
+// DeleteCustomerGroup supprime un groupe ; ses membres reviennent au prix catalogue
+func DeleteCustomerGroup(id gocql.UUID) error {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("DELETE FROM customer_groups WHERE group_id = ?", id).Exec()
+}
+
+// SetCompanyPricing attribue à une société une liste de prix et/ou un groupe de clients (nil : aucun)
+func SetCompanyPricing(companyID gocql.UUID, priceListID, groupID *gocql.UUID) error {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("UPDATE companies SET price_list_id = ?, customer_group_id = ? WHERE company_id = ?",
+		priceListID, groupID, companyID).Exec()
+}
+
+// SetUserCustomerGroup place un client dans un groupe (nil : aucun)
+func SetUserCustomerGroup(userID gocql.UUID, groupID *gocql.UUID) error {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("UPDATE users SET customer_group_id = ?, updated_at = ? WHERE user_id = ?", groupID, time.Now(), userID).Exec()
+}
+
+// =========================
+// Prix dégressifs du catalogue
+// =========================
+
+// GetPriceTiers retourne les paliers d'un produit (et de ses variantes), par quantité croissante
+func GetPriceTiers(productID string) ([]models.PriceTier, error) {
+	productUUID, err := uuid.Parse(productID)
+	if err != nil {
+		return nil, err
+	}
+	return queryPriceTiers("SELECT product_id, variant_id, min_quantity, unit_price FROM price_tiers WHERE product_id = ?", gocql.UUID(productUUID))
+}
+
+// ReplacePriceTiers remplace tous les paliers d'un produit
+func ReplacePriceTiers(productID gocql.UUID, tiers []models.PriceTier) error {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return err
+	}
+
+	if err := session.Query("DELETE FROM price_tiers WHERE product_id = ?", productID).Exec(); err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		if err := session.Query("INSERT INTO price_tiers (product_id, variant_id, min_quantity, unit_price) VALUES (?, ?, ?, ?)",
+			productID, tier.VariantID, tier.MinQuantity, tier.UnitPrice).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryPriceTiers(query string, values ...interface{}) ([]models.PriceTier, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(query, values...).Iter()
+	tiers := []models.PriceTier{}
+	var (
+		productID gocql.UUID
+		tier      models.PriceTier
+	)
+	for iter.Scan(&productID, &tier.VariantID, &tier.MinQuantity, &tier.UnitPrice) {
+		tier.ProductID = productID.String()
+		tiers = append(tiers, tier)
+		tier = models.PriceTier{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].MinQuantity < tiers[j].MinQuantity })
+	return tiers, nil
+}
+
+// =========================
+// Résolution du prix
+// =========================
+
+// PricedItem est une ligne à tarifer : produit (et sa catégorie), variante éventuelle, quantité et prix catalogue
+type PricedItem struct {
+	ProductID  string
+	VariantID  string
+	CategoryID string
+	Quantity   int
+	ListPrice  models.Money
+}
+
+// PricingContext porte le tarif négocié d'un client et les paliers déjà lus, le temps d'une requête
+type PricingContext struct {
+	PriceList  *models.PriceList
+	tiers      map[string][]models.PriceTier
+	tiersReady bool
+}
+
+// LoadPricingContext retrouve le tarif négocié d'un client : liste de prix de sa société, sinon celle du groupe
+// de la société, sinon celle de son propre groupe. Un visiteur ou une erreur de lecture donne le prix catalogue.
+func LoadPricingContext(userID string) *PricingContext {
+	ctx := &PricingContext{tiers: map[string][]models.PriceTier{}}
+	if userID == "" {
+		return ctx
+	}
+
+	listID, err := customerPriceListID(userID)
+	if err != nil {
+		if err != gocql.ErrNotFound {
+			log.Printf("⚠️ Tarif de %s illisible, prix catalogue appliqué: %v", userID, err)
+		}
+		return ctx
+	}
+	if listID == nil {
+		return ctx
+	}
+
+	list, err := GetPriceList(*listID)
+	if err != nil {
+		log.Printf("⚠️ Liste de prix %s de %s illisible, prix catalogue appliqué: %v", listID, userID, err)
+		return ctx
+	}
+	if list.IsActive {
+		ctx.PriceList = list
+	}
+	return ctx
+}
+
+func customerPriceListID(userID string) (*gocql.UUID, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var companyID, userGroupID *gocql.UUID
+	if err := session.Query("SELECT company_id, customer_group_id FROM users WHERE user_id = ?", gocql.UUID(uid)).
+		Scan(&companyID, &userGroupID); err != nil {
+		return nil, err
+	}
+
+	groupID := userGroupID
+	if companyID != nil {
+		var priceListID, companyGroupID *gocql.UUID
+		if err := session.Query("SELECT price_list_id, customer_group_id FROM companies WHERE company_id = ?", *companyID).
+			Scan(&priceListID, &companyGroupID); err != nil && err != gocql.ErrNotFound {
+			return nil, err
+		}
+		if priceListID != nil {
+			return priceListID, nil
+		}
+		if companyGroupID != nil {
+			groupID = companyGroupID
+		}
+	}
+	if groupID == nil {
+		return nil, nil
+	}
+
+	group, err := GetCustomerGroup(*groupID)
+	if err != nil {
+		return nil, err
+	}
+	return group.PriceListID, nil
+}
+
+// PreloadTiers lit en une requête tous les paliers du catalogue (listes de produits)
+func (p *PricingContext) PreloadTiers() {
+	tiers, err := queryPriceTiers("SELECT product_id, variant_id, min_quantity, unit_price FROM price_tiers")
+	if err != nil {
+		log.Printf("⚠️ Paliers de prix illisibles: %v", err)
+		return
+	}
+	for _, tier := range tiers {
+		p.tiers[tier.ProductID] = append(p.tiers[tier.ProductID], tier)
+	}
+	p.tiersReady = true
+}
+
+// Tiers retourne les paliers d'un produit (lus une seule fois par contexte)
+func (p *PricingContext) Tiers(productID string) []models.PriceTier {
+	if tiers, ok := p.tiers[productID]; ok || p.tiersReady {
+		return tiers
+	}
+	tiers, err := GetPriceTiers(productID)
+	if err != nil {
+		log.Printf("⚠️ Paliers de prix du produit %s illisibles: %v", productID, err)
+	}
+	p.tiers[productID] = tiers
+	return tiers
+}
+
+// Resolve retourne le prix unitaire d'une ligne : le plus bas entre le prix catalogue, le palier atteint
+// (ceux de la variante priment sur ceux du produit) et la règle la plus précise de la liste de prix
+// (variante, puis produit, puis catégorie ; à précision égale, le palier le plus élevé atteint)
+func (p *PricingContext) Resolve(item PricedItem) models.ResolvedPrice {
+	resolved := models.ResolvedPrice{UnitPrice: item.ListPrice, ListPrice: item.ListPrice, Source: models.PriceSourceCatalog}
+	quantity := item.Quantity
+	if quantity < 1 {
+		quantity = 1
+	}
+
+	if tier := matchPriceTier(p.Tiers(item.ProductID), item.VariantID, quantity); tier != nil && tier.UnitPrice.Amount < resolved.UnitPrice.Amount {
+		resolved.UnitPrice = tier.UnitPrice
+		resolved.Source = models.PriceSourceTier
+	}
+
+	if p.PriceList != nil {
+		if rule := matchPriceRule(p.PriceList.Rules, item, quantity); rule != nil {
+			price := item.ListPrice.Sub(item.ListPrice.Percent(rule.DiscountPercent))
+			if rule.FixedPrice != nil {
+				price = *rule.FixedPrice
+			}
+			if price.Amount < resolved.UnitPrice.Amount {
+				resolved.UnitPrice = price
+				resolved.Source = models.PriceSourcePriceList
+				resolved.PriceListID = p.PriceList.ID.String()
+			}
+		}
+	}
+	return resolved
+}
+
+// matchPriceTier retourne le palier le plus élevé atteint par la quantité
+func matchPriceTier(tiers []models.PriceTier, variantID string, quantity int) *models.PriceTier {
+	var best *models.PriceTier
+	hasVariantTiers := false
+	for i := range tiers {
+		if variantID != "" && tiers[i].VariantID == variantID {
+			hasVariantTiers = true
+		}
+	}
+	for i := range tiers {
+		tier := &tiers[i]
+		if hasVariantTiers && tier.VariantID != variantID || !hasVariantTiers && tier.VariantID != "" {
+			continue
+		}
+		if tier.MinQuantity <= quantity && (best == nil || tier.MinQuantity > best.MinQuantity) {
+			best = tier
+		}
+	}
+	return best
+}
+
+// matchPriceRule retourne la règle la plus précise applicable à la ligne
+func matchPriceRule(rules []models.PriceRule, item PricedItem, quantity int) *models.PriceRule {
+	var best *models.PriceRule
+	bestRank := 0
+	for i := range rules {
+		rule := &rules[i]
+		rank := 0
+		switch {
+		case rule.VariantID != "":
+			if rule.VariantID == item.VariantID {
+				rank = 3
+			}
+		case rule.ProductID != "":
+			if rule.ProductID == item.ProductID {
+				rank = 2
+			}
+		case rule.CategoryID != "":
+			if rule.CategoryID == item.CategoryID {
+				rank = 1
+			}
+		}
+		if rank == 0 || rule.MinQuantity > quantity {
+			continue
+		}
+		if rank > bestRank || rank == bestRank && rule.MinQuantity > best.MinQuantity {
+			best = rule
+			bestRank = rank
+		}
+	}
+	return best
+}
+
+// ApplyProductPricing affiche les produits au prix du client (quantité 1) ; le prix catalogue reste dans list_price
+// et les paliers dégressifs sont joints
+func (p *PricingContext) ApplyProductPricing(products []models.Product) {
+	for i := range products {
+		product := &products[i]
+		listPrice := product.Price
+		resolved := p.Resolve(PricedItem{
+			ProductID:  product.ID.String(),
+			CategoryID: product.CategoryID.String(),
+			Quantity:   1,
+			ListPrice:  listPrice,
+		})
+		product.Price = resolved.UnitPrice
+		if resolved.Source != models.PriceSourceCatalog {
+			product.ListPrice = &listPrice
+		}
+		for _, tier := range p.Tiers(product.ID.String()) {
+			if tier.VariantID == "" {
+				product.PriceTiers = append(product.PriceTiers, tier)
+			}
+		}
+	}
+}
+
+// PriceCartItem applique à une ligne de panier le prix résolu pour sa quantité, à partir du prix catalogue
+// du produit ou de la variante
+func (p *PricingContext) PriceCartItem(item *models.CartItem, categoryID string, listPrice models.Money) {
+	resolved := p.Resolve(PricedItem{
+		ProductID:  item.ProductID,
+		VariantID:  item.VariantID,
+		CategoryID: categoryID,
+		Quantity:   item.Quantity,
+		ListPrice:  listPrice,
+	})
+	item.Price = resolved.UnitPrice
+	item.ListPrice = nil
+	item.PriceSource = resolved.Source
+	if resolved.Source != models.PriceSourceCatalog {
+		item.ListPrice = &listPrice
+	}
+}
+
+// CatalogPrice relit le prix catalogue d'un produit (ou de sa variante) et sa catégorie
+func CatalogPrice(productID, variantID string) (models.Money, string, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return models.Money{}, "", err
+	}
+	productUUID, err := uuid.Parse(productID)
+	if err != nil {
+		return models.Money{}, "", err
+	}
+
+	var price models.Money
+	var categoryID gocql.UUID
+	if err := session.Query("SELECT price, category_id FROM products WHERE product_id = ?", gocql.UUID(productUUID)).
+		Scan(&price, &categoryID); err != nil {
+		return models.Money{}, "", err
+	}
+	if variantID != "" {
+		variantUUID, err := uuid.Parse(variantID)
+		if err != nil {
+			return models.Money{}, "", err
+		}
+		if err := session.Query("SELECT price FROM ks_products.product_variants WHERE id = ?", gocql.UUID(variantUUID)).
+			Scan(&price); err != nil {
+			return models.Money{}, "", err
+		}
+	}
+	return price, categoryID.String(), nil
+}
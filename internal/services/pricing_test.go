@@ -0,0 +1,178 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"testing"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	pricingProduct  = "9a3c1f52-6f1e-4c61-9d55-0c6f7a1b2e01"
+	pricingVariant  = "9a3c1f52-6f1e-4c61-9d55-0c6f7a1b2e02"
+	pricingCategory = "9a3c1f52-6f1e-4c61-9d55-0c6f7a1b2e03"
+)
+
+func priceOf(amount int64) *models.Money {
+	price := models.Cents(amount)
+	return &price
+}
+
+func TestMatchPriceTier(t *testing.T) {
+	tiers := []models.PriceTier{
+		{MinQuantity: 10, UnitPrice: models.Cents(900)},
+		{MinQuantity: 50, UnitPrice: models.Cents(800)},
+		{VariantID: "v1", MinQuantity: 5, UnitPrice: models.Cents(950)},
+	}
+
+	tests := []struct {
+		name      string
+		variantID string
+		quantity  int
+		want      int64 // 0 : aucun palier
+	}{
+		{"sous le premier palier", "", 9, 0},
+		{"premier palier", "", 10, 900},
+		{"palier le plus élevé atteint", "", 120, 800},
+		{"variante sans palier propre", "v2", 60, 800},
+		{"les paliers de la variante priment", "v1", 60, 950},
+		{"variante sous son palier", "v1", 4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier := matchPriceTier(tiers, tt.variantID, tt.quantity)
+			switch {
+			case tt.want == 0 && tier != nil:
+				t.Errorf("palier = %+v, attendu aucun", tier)
+			case tt.want != 0 && (tier == nil || tier.UnitPrice.Amount != tt.want):
+				t.Errorf("palier = %+v, attendu %d", tier, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	listID := gocql.TimeUUID()
+	tiers := []models.PriceTier{{ProductID: pricingProduct, MinQuantity: 10, UnitPrice: models.Cents(850)}}
+
+	tests := []struct {
+		name     string
+		rules    []models.PriceRule
+		variant  string
+		quantity int
+		price    int64
+		source   string
+	}{
+		{
+			name:     "prix catalogue",
+			quantity: 1, price: 1000, source: models.PriceSourceCatalog,
+		},
+		{
+			name:     "quantité nulle traitée comme 1",
+			quantity: 0, price: 1000, source: models.PriceSourceCatalog,
+		},
+		{
+			name:     "palier dégressif",
+			quantity: 10, price: 850, source: models.PriceSourceTier,
+		},
+		{
+			name:     "remise de catégorie",
+			rules:    []models.PriceRule{{CategoryID: pricingCategory, DiscountPercent: 10}},
+			quantity: 1, price: 900, source: models.PriceSourcePriceList,
+		},
+		{
+			name: "le produit prime sur la catégorie",
+			rules: []models.PriceRule{
+				{CategoryID: pricingCategory, DiscountPercent: 30},
+				{ProductID: pricingProduct, FixedPrice: priceOf(950)},
+			},
+			quantity: 1, price: 950, source: models.PriceSourcePriceList,
+		},
+		{
+			name: "la variante prime sur le produit",
+			rules: []models.PriceRule{
+				{ProductID: pricingProduct, FixedPrice: priceOf(700)},
+				{ProductID: pricingProduct, VariantID: pricingVariant, FixedPrice: priceOf(960)},
+			},
+			variant:  pricingVariant,
+			quantity: 1, price: 960, source: models.PriceSourcePriceList,
+		},
+		{
+			name: "palier de la liste de prix le plus élevé atteint",
+			rules: []models.PriceRule{
+				{ProductID: pricingProduct, DiscountPercent: 5},
+				{ProductID: pricingProduct, MinQuantity: 20, DiscountPercent: 25},
+			},
+			quantity: 20, price: 750, source: models.PriceSourcePriceList,
+		},
+		{
+			name:     "le palier dégressif reste plus avantageux",
+			rules:    []models.PriceRule{{ProductID: pricingProduct, DiscountPercent: 10}},
+			quantity: 10, price: 850, source: models.PriceSourceTier,
+		},
+		{
+			name:     "un prix fixe plus élevé ne s'applique pas",
+			rules:    []models.PriceRule{{ProductID: pricingProduct, FixedPrice: priceOf(1200)}},
+			quantity: 1, price: 1000, source: models.PriceSourceCatalog,
+		},
+		{
+			name:     "règle d'un autre produit",
+			rules:    []models.PriceRule{{ProductID: pricingCategory, DiscountPercent: 50}},
+			quantity: 1, price: 1000, source: models.PriceSourceCatalog,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &PricingContext{tiers: map[string][]models.PriceTier{pricingProduct: tiers}}
+			if tt.rules != nil {
+				ctx.PriceList = &models.PriceList{ID: listID, IsActive: true, Rules: tt.rules}
+			}
+
+			resolved := ctx.Resolve(PricedItem{
+				ProductID:  pricingProduct,
+				VariantID:  tt.variant,
+				CategoryID: pricingCategory,
+				Quantity:   tt.quantity,
+				ListPrice:  models.Cents(1000),
+			})
+			if resolved.UnitPrice.Amount != tt.price || resolved.Source != tt.source || resolved.ListPrice.Amount != 1000 {
+				t.Errorf("Resolve = %s (%s), attendu %d (%s)", resolved.UnitPrice, resolved.Source, tt.price, tt.source)
+			}
+			if (resolved.Source == models.PriceSourcePriceList) != (resolved.PriceListID == listID.String()) {
+				t.Errorf("PriceListID = %q pour la source %s", resolved.PriceListID, resolved.Source)
+			}
+		})
+	}
+}
+
+func TestValidatePriceRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  models.PriceRule
+		valid bool
+	}{
+		{"produit à prix fixe", models.PriceRule{ProductID: pricingProduct, FixedPrice: priceOf(900)}, true},
+		{"catégorie en remise", models.PriceRule{CategoryID: pricingCategory, DiscountPercent: 15}, true},
+		{"variante", models.PriceRule{ProductID: pricingProduct, VariantID: pricingVariant, DiscountPercent: 5}, true},
+		{"variante sans produit", models.PriceRule{VariantID: pricingVariant, DiscountPercent: 5}, false},
+		{"aucune cible", models.PriceRule{DiscountPercent: 5}, false},
+		{"produit et catégorie", models.PriceRule{ProductID: pricingProduct, CategoryID: pricingCategory, DiscountPercent: 5}, false},
+		{"identifiant invalide", models.PriceRule{ProductID: "abc", DiscountPercent: 5}, false},
+		{"prix fixe et remise", models.PriceRule{ProductID: pricingProduct, FixedPrice: priceOf(900), DiscountPercent: 5}, false},
+		{"ni prix ni remise", models.PriceRule{ProductID: pricingProduct}, false},
+		{"prix négatif", models.PriceRule{ProductID: pricingProduct, FixedPrice: priceOf(-1)}, false},
+		{"remise au-delà de 100 %", models.PriceRule{ProductID: pricingProduct, DiscountPercent: 120}, false},
+		{"quantité minimale négative", models.PriceRule{ProductID: pricingProduct, DiscountPercent: 5, MinQuantity: -1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePriceRules([]models.PriceRule{tt.rule})
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidatePriceRules = %v, valide attendu: %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// ErrApprovalDecided : la demande d'approbation a déjà été tranchée (par un autre administrateur)
+var ErrApprovalDecided = errors.New("cette demande d'approbation a déjà été traitée")
+
+// GetPurchasePolicy lit la société, le rôle et le plafond d'achat d'un utilisateur
+func GetPurchasePolicy(userID string) (*models.PurchasePolicy, error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &models.PurchasePolicy{UserID: userID}
+	var isAdmin *bool
+	if err := session.Query("SELECT company_id, is_company_admin, spending_limit FROM users WHERE user_id = ?", gocql.UUID(uid)).
+		Scan(&policy.CompanyID, &isAdmin, &policy.SpendingLimit); err != nil {
+		return nil, err
+	}
+	policy.IsCompanyAdmin = isAdmin != nil && *isAdmin
+	return policy, nil
+}
+
+// SetSpendingLimit enregistre le plafond par commande d'un employé (nil : illimité)
+func SetSpendingLimit(userID gocql.UUID, limit *models.Money) error {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return err
+	}
+	return session.Query("UPDATE users SET spending_limit = ?, updated_at = ? WHERE user_id = ?", limit, time.Now(), userID).Exec()
+}
+
+// PurchaseApprovalRequired indique si une commande de ce montant doit être approuvée : employé d'une société
+// (hors administrateurs) avec un plafond, dépassé par le total TTC. Un plafond illisible est une erreur :
+// la commande ne doit pas passer sans l'approbation éventuellement requise.
+func PurchaseApprovalRequired(userID string, total models.Money) (*models.PurchasePolicy, bool, error) {
+	policy, err := GetPurchasePolicy(userID)
+	if err == gocql.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if policy.CompanyID == nil || policy.IsCompanyAdmin || policy.SpendingLimit == nil {
+		return policy, false, nil
+	}
+	return policy, total.Amount > policy.SpendingLimit.Amount, nil
+}
+
+// CreateOrderApproval enregistre la demande d'approbation d'une commande
+func CreateOrderApproval(approval *models.OrderApproval) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+	approval.Status = models.ApprovalStatusPending
+	return session.Query(`INSERT INTO order_approvals (order_id, company_id, requested_by, amount, spending_limit, status, requested_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		approval.OrderID, approval.CompanyID, approval.RequestedBy, approval.Amount, approval.SpendingLimit,
+		approval.Status, approval.RequestedAt).Exec()
+}
+
+const orderApprovalColumns = `order_id, company_id, requested_by, amount, spending_limit, status, decided_by, comment, requested_at, decided_at`
+
+// GetOrderApproval charge la demande d'approbation d'une commande
+func GetOrderApproval(orderID gocql.UUID) (*models.OrderApproval, error) {
+	approvals, err := queryOrderApprovals("SELECT "+orderApprovalColumns+" FROM order_approvals WHERE order_id = ?", orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(approvals) == 0 {
+		return nil, gocql.ErrNotFound
+	}
+	return &approvals[0], nil
+}
+
+// ListCompanyOrderApprovals retourne les demandes d'une société (toutes, ou d'un statut), les plus récentes d'abord
+func ListCompanyOrderApprovals(companyID gocql.UUID, status string) ([]models.OrderApproval, error) {
+	approvals, err := queryOrderApprovals("SELECT "+orderApprovalColumns+" FROM order_approvals WHERE company_id = ? ALLOW FILTERING", companyID)
+	if err != nil || status == "" {
+		return approvals, err
+	}
+	filtered := []models.OrderApproval{}
+	for _, approval := range approvals {
+		if approval.Status == status {
+			filtered = append(filtered, approval)
+		}
+	}
+	return filtered, nil
+}
+
+func queryOrderApprovals(query string, values ...interface{}) ([]models.OrderApproval, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(query, values...).Iter()
+	approvals := []models.OrderApproval{}
+	for {
+		var a models.OrderApproval
+		if !iter.Scan(&a.OrderID, &a.CompanyID, &a.RequestedBy, &a.Amount, &a.SpendingLimit, &a.Status,
+			&a.DecidedBy, &a.Comment, &a.RequestedAt, &a.DecidedAt) {
+			break
+		}
+		approvals = append(approvals, a)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].RequestedAt.After(approvals[j].RequestedAt) })
+	return approvals, nil
+}
+
+// DecideOrderApproval enregistre la décision (compare-and-set : une seule décision par demande)
+func DecideOrderApproval(approval *models.OrderApproval, status, decidedBy, comment string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	applied, err := session.Query(`UPDATE order_approvals SET status = ?, decided_by = ?, comment = ?, decided_at = ?
+		WHERE order_id = ? IF status = ?`,
+		status, decidedBy, comment, now, approval.OrderID, models.ApprovalStatusPending).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrApprovalDecided
+	}
+
+	approval.Status = status
+	approval.DecidedBy = decidedBy
+	approval.Comment = comment
+	approval.DecidedAt = &now
+	return nil
+}
+
+// ListCompanyAdminEmails retourne les emails des administrateurs d'une société (destinataires des demandes d'approbation)
+func ListCompanyAdminEmails(companyID gocql.UUID) ([]string, error) {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query("SELECT email, is_company_admin FROM users WHERE company_id = ? ALLOW FILTERING", companyID).Iter()
+	emails := []string{}
+	var (
+		email   string
+		isAdmin bool
+	)
+	for iter.Scan(&email, &isAdmin) {
+		if isAdmin && email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails, iter.Close()
+}
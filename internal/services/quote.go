@@ -0,0 +1,193 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"cedra_back_end/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// ErrQuoteConflict : le devis a changé de statut entre la lecture et l'écriture (accepté, refusé ou modifié ailleurs)
+var ErrQuoteConflict = errors.New("le devis a été modifié entre-temps")
+
+// quotePrefix est le préfixe des numéros de devis (D par défaut : D2026-000001)
+func quotePrefix() string {
+	if prefix := os.Getenv("QUOTE_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return "D"
+}
+
+// QuoteTotal retourne le total des lignes au prix du devis
+func QuoteTotal(items []models.QuoteItem) models.Money {
+	total := models.Cents(0)
+	for _, item := range items {
+		total = total.Add(item.Total())
+	}
+	return total
+}
+
+// CreateQuote enregistre une demande de devis : numéro de la série des devis et ID de la future commande
+func CreateQuote(q *models.Quote) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	fiscalYear := FiscalYear(now)
+	prefix := quotePrefix()
+	sequence, err := NextDocumentSequence(prefix, fiscalYear)
+	if err != nil {
+		return err
+	}
+
+	q.ID = gocql.TimeUUID()
+	q.OrderID = gocql.TimeUUID()
+	q.Number = FormatInvoiceNumber(prefix, fiscalYear, sequence)
+	q.Status = models.QuoteStatusRequested
+	q.Total = QuoteTotal(q.Items)
+	q.CreatedAt = now
+
+	document, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation devis: %v", err)
+	}
+	return session.Query(`INSERT INTO quotes (quote_id, quote_number, company_id, user_id, status, total, valid_until, created_at, document)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		q.ID, q.Number, q.CompanyID, q.UserID, q.Status, q.Total, q.ValidUntil, q.CreatedAt, string(document)).Exec()
+}
+
+// GetQuote charge un devis ; un devis ouvert dont la validité est dépassée est retourné comme expiré
+func GetQuote(id gocql.UUID) (*models.Quote, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	var document, status string
+	if err := session.Query("SELECT document, status FROM quotes WHERE quote_id = ?", id).Scan(&document, &status); err != nil {
+		return nil, err
+	}
+	return decodeQuote(document, status)
+}
+
+// ListQuotes retourne les devis (tous, ou d'un statut), du plus récent au plus ancien
+func ListQuotes(status string) ([]models.Quote, error) {
+	quotes, err := queryQuotes("SELECT document, status FROM quotes")
+	if err != nil || status == "" {
+		return quotes, err
+	}
+	// Le statut expiré est calculé à la lecture : le filtre s'applique après
+	filtered := []models.Quote{}
+	for _, q := range quotes {
+		if q.Status == status {
+			filtered = append(filtered, q)
+		}
+	}
+	return filtered, nil
+}
+
+// ListUserQuotes retourne les devis demandés par un utilisateur
+func ListUserQuotes(userID string) ([]models.Quote, error) {
+	return queryQuotes("SELECT document, status FROM quotes WHERE user_id = ? ALLOW FILTERING", userID)
+}
+
+func queryQuotes(query string, values ...interface{}) ([]models.Quote, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(query, values...).Iter()
+	quotes := []models.Quote{}
+	var document, status string
+	for iter.Scan(&document, &status) {
+		q, err := decodeQuote(document, status)
+		if err != nil {
+			log.Printf("⚠️ %v", err)
+			continue
+		}
+		quotes = append(quotes, *q)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].CreatedAt.After(quotes[j].CreatedAt) })
+	return quotes, nil
+}
+
+func decodeQuote(document, status string) (*models.Quote, error) {
+	var q models.Quote
+	if err := json.Unmarshal([]byte(document), &q); err != nil {
+		return nil, fmt.Errorf("devis illisible: %v", err)
+	}
+	// La colonne status fait foi : c'est elle que protègent les compare-and-set
+	q.Status = status
+	if q.IsOpen() && q.ValidUntil != nil && time.Now().After(*q.ValidUntil) {
+		q.Status = models.QuoteStatusExpired
+	}
+	return &q, nil
+}
+
+// SaveQuote enregistre le devis si son statut est toujours celui lu (ErrQuoteConflict sinon)
+func SaveQuote(q *models.Quote, expectedStatus string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	q.Total = QuoteTotal(q.Items)
+	document, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation devis: %v", err)
+	}
+
+	applied, err := session.Query(`UPDATE quotes SET status = ?, total = ?, valid_until = ?, document = ?
+		WHERE quote_id = ? IF status = ?`,
+		q.Status, q.Total, q.ValidUntil, string(document), q.ID, expectedStatus).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return ErrQuoteConflict
+	}
+	return nil
+}
+
+// ReserveQuoteStock réserve les articles du devis jusqu'à la fin de sa validité, sous l'ID de la future commande :
+// le checkout de l'acceptation reprend la réservation au lieu d'en poser une seconde
+func ReserveQuoteStock(q *models.Quote, items []ReservationItem) (*Reservation, error) {
+	if q.ValidUntil == nil {
+		return nil, fmt.Errorf("devis %s sans date de validité", q.Number)
+	}
+	ttl := time.Until(*q.ValidUntil)
+	if ttl <= 0 {
+		return nil, fmt.Errorf("devis %s expiré", q.Number)
+	}
+	return ReserveStock(q.OrderID.String(), q.UserID, items, ttl)
+}
+
+// ReleaseQuoteStock libère la réservation d'un devis refusé, retiré ou modifié
+func ReleaseQuoteStock(q *models.Quote) {
+	if err := ReleaseReservation(q.OrderID.String()); err != nil {
+		log.Printf("⚠️ Réservation du devis %s non libérée: %v", q.Number, err)
+	}
+}
+
+// GetQuotePDF génère le PDF du devis (non archivé : il suit les révisions de l'équipe commerciale)
+func GetQuotePDF(q *models.Quote) ([]byte, error) {
+	seller := utils.GetSellerDetails()
+	seller.Country = ShopCountry()
+	buyer := loadInvoiceBuyer(&models.Order{UserID: q.UserID})
+	return utils.RenderQuotePDF(q, seller, buyer)
+}
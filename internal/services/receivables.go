@@ -0,0 +1,289 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// defaultPaymentTermsDays : délai de paiement appliqué quand la société n'en a pas de spécifique
+const defaultPaymentTermsDays = 30
+
+// ErrInvoicePaymentNotAllowed : le client n'appartient pas à une société approuvée pour le paiement sur facture
+var ErrInvoicePaymentNotAllowed = errors.New("paiement sur facture non autorisé pour ce compte")
+
+// CreditHoldError : la société est bloquée (plafond atteint ou factures échues) pour les commandes sur facture
+type CreditHoldError struct {
+	Reason string
+	Status *models.CompanyCreditStatus
+}
+
+func (e *CreditHoldError) Error() string {
+	return "commandes sur facture bloquées : " + e.Reason
+}
+
+// GetCompanyCreditTerms retourne les conditions de paiement sur facture d'une société (désactivé par défaut)
+func GetCompanyCreditTerms(companyID gocql.UUID) (*models.CompanyCreditTerms, error) {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	terms := &models.CompanyCreditTerms{CompanyID: companyID}
+	var (
+		enabled *bool
+		limit   models.Money
+		days    *int
+	)
+	if err := session.Query("SELECT invoice_payment_enabled, credit_limit, payment_terms_days FROM companies WHERE company_id = ?", companyID).
+		Scan(&enabled, &limit, &days); err != nil {
+		return nil, err
+	}
+	terms.InvoicePaymentEnabled = enabled != nil && *enabled
+	terms.CreditLimit = limit
+	terms.PaymentTermsDays = defaultPaymentTermsDays
+	if days != nil && *days > 0 {
+		terms.PaymentTermsDays = *days
+	}
+	return terms, nil
+}
+
+// SaveCompanyCreditTerms enregistre les conditions de paiement sur facture d'une société
+func SaveCompanyCreditTerms(terms *models.CompanyCreditTerms) error {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return err
+	}
+
+	return session.Query("UPDATE companies SET invoice_payment_enabled = ?, credit_limit = ?, payment_terms_days = ? WHERE company_id = ?",
+		terms.InvoicePaymentEnabled, terms.CreditLimit, terms.PaymentTermsDays, terms.CompanyID).Exec()
+}
+
+// userCreditTerms retourne les conditions de la société d'un utilisateur (ErrInvoicePaymentNotAllowed sans société)
+func userCreditTerms(userID string) (*models.CompanyCreditTerms, error) {
+	companyID, err := UserCompanyID(userID)
+	if err != nil || companyID == nil {
+		return nil, ErrInvoicePaymentNotAllowed
+	}
+	return GetCompanyCreditTerms(*companyID)
+}
+
+// ListReceivables retourne les factures ouvertes (toutes, ou celles d'une société), de la plus ancienne échéance à la plus récente
+func ListReceivables(companyID *gocql.UUID) ([]models.Receivable, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	query := session.Query("SELECT document, pdf_key, paid_at, company_id, late_fee, dunning_level, last_reminder_at FROM invoices")
+	if companyID != nil {
+		query = session.Query(`SELECT document, pdf_key, paid_at, company_id, late_fee, dunning_level, last_reminder_at
+			FROM invoices WHERE company_id = ? ALLOW FILTERING`, *companyID)
+	}
+
+	iter := query.Iter()
+	receivables := []models.Receivable{}
+	for {
+		var (
+			r                models.Receivable
+			document, pdfKey string
+			paidAt           *time.Time
+			level            *int
+		)
+		if !iter.Scan(&document, &pdfKey, &paidAt, &r.CompanyID, &r.LateFee, &level, &r.LastReminderAt) {
+			break
+		}
+		if paidAt != nil {
+			continue
+		}
+		if err := json.Unmarshal([]byte(document), &r.Invoice); err != nil {
+			log.Printf("⚠️ Facture illisible (%s): %v", pdfKey, err)
+			continue
+		}
+		// Factures antérieures à la colonne paid_at : l'acquittement est dans le document figé
+		if r.Invoice.PaidAt != nil {
+			continue
+		}
+		r.Invoice.PDFKey = pdfKey
+		if level != nil {
+			r.DunningLevel = *level
+		}
+		receivables = append(receivables, r)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(receivables, func(i, j int) bool {
+		return receivableDueDate(receivables[i]).Before(receivableDueDate(receivables[j]))
+	})
+	return receivables, nil
+}
+
+// invoiceLateFee retourne les frais de retard réclamés sur une facture (zéro si aucun ou illisible)
+func invoiceLateFee(number string) models.Money {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return models.Cents(0)
+	}
+	var fee models.Money
+	if err := session.Query("SELECT late_fee FROM invoices WHERE invoice_number = ?", number).Scan(&fee); err != nil {
+		return models.Cents(0)
+	}
+	return fee
+}
+
+func receivableDueDate(r models.Receivable) time.Time {
+	if r.Invoice.DueDate != nil {
+		return *r.Invoice.DueDate
+	}
+	return r.Invoice.IssuedAt
+}
+
+// GetCompanyCreditStatus calcule l'encours d'une société et le blocage éventuel des commandes sur facture :
+// factures échues depuis plus de DUNNING_HOLD_AFTER_DAYS jours, ou plafond de crédit atteint
+func GetCompanyCreditStatus(companyID gocql.UUID) (*models.CompanyCreditStatus, error) {
+	terms, err := GetCompanyCreditTerms(companyID)
+	if err != nil {
+		return nil, err
+	}
+	receivables, err := ListReceivables(&companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	policy := CurrentDunningPolicy()
+	status := &models.CompanyCreditStatus{
+		Terms:       *terms,
+		Outstanding: models.Cents(0),
+		Receivables: receivables,
+	}
+	for _, r := range receivables {
+		status.Outstanding = status.Outstanding.Add(r.AmountDue())
+		if r.Invoice.DueDate != nil && r.DaysOverdue(now) > policy.HoldAfterDays {
+			status.OverdueCount++
+		}
+	}
+	status.Available = models.MaxMoney(terms.CreditLimit.Sub(status.Outstanding), models.Cents(0))
+
+	switch {
+	case status.OverdueCount > 0:
+		status.OnHold = true
+		status.HoldReason = fmt.Sprintf("%d facture(s) échue(s) impayée(s)", status.OverdueCount)
+	case terms.InvoicePaymentEnabled && status.Outstanding.Amount >= terms.CreditLimit.Amount:
+		status.OnHold = true
+		status.HoldReason = "plafond de crédit atteint"
+	}
+	return status, nil
+}
+
+// creditHoldTTL : une réservation de crédit dont la facture n'est jamais émise cesse de compter après ce délai
+const creditHoldTTL = 24 * time.Hour
+
+// creditHoldAttempts : nombre de compare-and-set tentés avant d'abandonner une réservation très disputée
+const creditHoldAttempts = 10
+
+// ReserveInvoiceCredit vérifie qu'un client peut commander sur facture pour ce montant (société approuvée, pas de blocage,
+// encours + réservations en cours + commande sous le plafond) et réserve le montant sur le crédit de sa société jusqu'à
+// l'émission de la facture. La réservation est un compare-and-set sur la version de la ligne de la société :
+// deux commandes simultanées ne peuvent pas dépasser ensemble le plafond. Les paiements en ligne ne sont pas concernés.
+func ReserveInvoiceCredit(userID string, orderID gocql.UUID, amount models.Money) (*models.CompanyCreditStatus, error) {
+	terms, err := userCreditTerms(userID)
+	if err != nil {
+		if err == gocql.ErrNotFound {
+			return nil, ErrInvoicePaymentNotAllowed
+		}
+		return nil, err
+	}
+	if !terms.InvoicePaymentEnabled {
+		return nil, ErrInvoicePaymentNotAllowed
+	}
+
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := session.Query(`INSERT INTO company_credit_holds (company_id, version) VALUES (?, 0) IF NOT EXISTS`,
+		terms.CompanyID).MapScanCAS(map[string]interface{}{}); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < creditHoldAttempts; attempt++ {
+		var version int64
+		var holds map[gocql.UUID]models.Money
+		var heldAt map[gocql.UUID]time.Time
+		if err := session.Query(`SELECT version, holds, held_at FROM company_credit_holds WHERE company_id = ?`,
+			terms.CompanyID).Scan(&version, &holds, &heldAt); err != nil {
+			return nil, err
+		}
+
+		// L'encours est lu après les réservations : une facture émise entre-temps est comptée au moins une fois
+		status, err := GetCompanyCreditStatus(terms.CompanyID)
+		if err != nil {
+			return nil, err
+		}
+		if status.OnHold {
+			return status, &CreditHoldError{Reason: status.HoldReason, Status: status}
+		}
+		status.Outstanding = status.Outstanding.Add(activeCreditHolds(holds, heldAt, orderID))
+		status.Available = models.MaxMoney(terms.CreditLimit.Sub(status.Outstanding), models.Cents(0))
+		if status.Outstanding.Add(amount).Amount > terms.CreditLimit.Amount {
+			return status, &CreditHoldError{
+				Reason: fmt.Sprintf("la commande dépasse le crédit disponible (%s %s)", status.Available, status.Available.CurrencyCode()),
+				Status: status,
+			}
+		}
+
+		applied, err := session.Query(`UPDATE company_credit_holds SET holds[?] = ?, held_at[?] = ?, version = ?
+			WHERE company_id = ? IF version = ?`,
+			orderID, amount, orderID, time.Now(), version+1, terms.CompanyID, version).MapScanCAS(map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			return status, nil
+		}
+	}
+	return nil, fmt.Errorf("réservation du crédit de la société %s impossible après %d essais", terms.CompanyID, creditHoldAttempts)
+}
+
+// activeCreditHolds additionne les réservations qui comptent encore : ni celle de la commande elle-même (nouvel essai),
+// ni celles dont la facture est émise (déjà dans l'encours), ni celles expirées
+func activeCreditHolds(holds map[gocql.UUID]models.Money, heldAt map[gocql.UUID]time.Time, orderID gocql.UUID) models.Money {
+	total := models.Cents(0)
+	for id, amount := range holds {
+		if id == orderID || time.Since(heldAt[id]) > creditHoldTTL {
+			continue
+		}
+		if _, err := GetOrderInvoice(id); err == nil {
+			continue
+		}
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// ReleaseInvoiceCredit libère la réservation de crédit d'une commande : facture émise ou commande abandonnée
+func ReleaseInvoiceCredit(userID string, orderID gocql.UUID) {
+	companyID, err := UserCompanyID(userID)
+	if err != nil || companyID == nil {
+		return
+	}
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		log.Printf("⚠️ Réservation de crédit de la commande %s non libérée: %v", orderID, err)
+		return
+	}
+	if _, err := session.Query(`DELETE holds[?], held_at[?] FROM company_credit_holds WHERE company_id = ? IF EXISTS`,
+		orderID, orderID, *companyID).MapScanCAS(map[string]interface{}{}); err != nil {
+		log.Printf("⚠️ Réservation de crédit de la commande %s non libérée (expire sous %s): %v", orderID, creditHoldTTL, err)
+	}
+}
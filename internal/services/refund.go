@@ -0,0 +1,175 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"fmt"
+)
+
+// RefundLine est une ligne demandée dans un remboursement : un article de la commande et une quantité
+type RefundLine struct {
+	ProductID string `json:"productId" binding:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// RefundError signale une demande de remboursement incompatible avec la commande
+type RefundError struct {
+	Message string
+}
+
+func (e *RefundError) Error() string {
+	return e.Message
+}
+
+func refundKey(productID, variantID string) string {
+	return productID + "|" + variantID
+}
+
+// OrderShippingAmount retourne les frais de port payés sur la commande
+func OrderShippingAmount(order *models.Order) models.Money {
+	if !order.ShippingCost.IsZero() {
+		return order.ShippingCost
+	}
+	// Commandes antérieures à l'enregistrement des frais de port
+	return models.MaxMoney(order.TotalPrice.Sub(order.Subtotal.Sub(order.DiscountAmount)), models.Money{})
+}
+
+// RefundedSoFar additionne les montants des remboursements qui comptent pour la commande
+func RefundedSoFar(refunds []models.Refund) models.Money {
+	total := models.Money{}
+	for _, r := range refunds {
+		if r.Counts() {
+			total = total.Add(r.RefundAmount)
+		}
+	}
+	return total
+}
+
+// RefundableQuantities retourne, par ligne de commande, les quantités qui n'ont pas encore été remboursées
+func RefundableQuantities(order *models.Order, refunds []models.Refund) map[string]int {
+	remaining := make(map[string]int)
+	for _, item := range order.Items {
+		remaining[refundKey(item.ProductID, item.VariantID)] += item.Quantity
+	}
+	for _, r := range refunds {
+		if !r.Counts() {
+			continue
+		}
+		for _, item := range r.Items {
+			remaining[refundKey(item.ProductID, item.VariantID)] -= item.Quantity
+		}
+	}
+	return remaining
+}
+
+// ComputeRefund calcule les lignes et le montant d'un remboursement à partir des prix enregistrés sur la commande.
+// La remise de la commande est répartie au prorata de chaque ligne. Sans lignes, tout ce qui reste est remboursé.
+func ComputeRefund(order *models.Order, previous []models.Refund, lines []RefundLine, includeShipping bool) ([]models.RefundItem, models.Money, models.Money, error) {
+	remaining := RefundableQuantities(order, previous)
+
+	shippingRefunded := false
+	for _, r := range previous {
+		if r.Counts() && !r.ShippingAmount.IsZero() {
+			shippingRefunded = true
+		}
+	}
+
+	if len(lines) == 0 {
+		for _, item := range order.Items {
+			key := refundKey(item.ProductID, item.VariantID)
+			if qty := remaining[key]; qty > 0 {
+				lines = append(lines, RefundLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: qty})
+			}
+		}
+		includeShipping = !shippingRefunded
+	}
+
+	items := make([]models.RefundItem, 0, len(lines))
+	total := models.Money{}
+	for _, line := range lines {
+		item, ok := findOrderItem(order, line.ProductID, line.VariantID)
+		if !ok {
+			return nil, models.Money{}, models.Money{}, &RefundError{Message: fmt.Sprintf("article %s absent de la commande", line.ProductID)}
+		}
+
+		key := refundKey(line.ProductID, line.VariantID)
+		if line.Quantity <= 0 || line.Quantity > remaining[key] {
+			return nil, models.Money{}, models.Money{}, &RefundError{
+				Message: fmt.Sprintf("quantité invalide pour %s : %d demandé(s), %d remboursable(s)", item.Name, line.Quantity, remaining[key]),
+			}
+		}
+		remaining[key] -= line.Quantity
+
+		amount := lineNetAmount(order, item, line.Quantity)
+		items = append(items, models.RefundItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Name:      item.Name,
+			Quantity:  line.Quantity,
+			Amount:    amount,
+		})
+		total = total.Add(amount)
+	}
+
+	shipping := models.Money{}
+	if includeShipping {
+		if shippingRefunded {
+			return nil, models.Money{}, models.Money{}, &RefundError{Message: "les frais de port ont déjà été remboursés"}
+		}
+		shipping = OrderShippingAmount(order)
+		total = total.Add(shipping)
+	}
+
+	// Les arrondis du prorata ne doivent jamais dépasser ce qui a été payé ;
+	// le dernier remboursement solde exactement la commande
+	balance := order.TotalPrice.Sub(RefundedSoFar(previous))
+	total = models.MinMoney(total, balance)
+	if (includeShipping || shippingRefunded || OrderShippingAmount(order).IsZero()) && allRefunded(remaining) {
+		total = balance
+	}
+	if total.Amount <= 0 {
+		return nil, models.Money{}, models.Money{}, &RefundError{Message: "rien à rembourser sur cette commande"}
+	}
+
+	return items, shipping, total, nil
+}
+
+// IsFullyRefunded indique si le montant remboursé couvre la totalité de la commande
+func IsFullyRefunded(order *models.Order) bool {
+	return order.RefundedAmount.Amount >= order.TotalPrice.Amount
+}
+
+func allRefunded(remaining map[string]int) bool {
+	for _, qty := range remaining {
+		if qty > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func findOrderItem(order *models.Order, productID, variantID string) (models.OrderItem, bool) {
+	for _, item := range order.Items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			return item, true
+		}
+	}
+	return models.OrderItem{}, false
+}
+
+// lineNetAmount retourne le prix payé pour quantity unités d'une ligne, remise de la commande déduite au prorata
+func lineNetAmount(order *models.Order, item models.OrderItem, quantity int) models.Money {
+	// Commandes avec détail de TVA : le montant payé (HT + TVA) de la ligne est connu
+	if order.Tax != nil && item.Quantity > 0 {
+		paid := item.NetAmount.Add(item.TaxAmount)
+		amount := (paid.Amount*int64(quantity) + int64(item.Quantity)/2) / int64(item.Quantity)
+		return models.Money{Amount: amount, Currency: paid.CurrencyCode()}
+	}
+
+	gross := item.Price.Mul(quantity)
+	if order.DiscountAmount.Amount <= 0 || order.Subtotal.Amount <= 0 {
+		return gross
+	}
+	share := (order.DiscountAmount.Amount*gross.Amount + order.Subtotal.Amount/2) / order.Subtotal.Amount
+	return models.MaxMoney(gross.Sub(models.Money{Amount: share, Currency: gross.Currency}), models.Money{})
+}
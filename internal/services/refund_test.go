@@ -0,0 +1,162 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"errors"
+	"testing"
+)
+
+// Commande : 2 × A à 10,00 et 1 × B à 30,00, remise de 3,33, port de 4,95 (total 51,62)
+func refundTestOrder() *models.Order {
+	return &models.Order{
+		Items: []models.OrderItem{
+			{ProductID: "a", Name: "A", Price: models.Cents(1000), Quantity: 2},
+			{ProductID: "b", Name: "B", Price: models.Cents(3000), Quantity: 1},
+		},
+		Subtotal:       models.Cents(5000),
+		DiscountAmount: models.Cents(333),
+		ShippingCost:   models.Cents(495),
+		TotalPrice:     models.Cents(5162),
+	}
+}
+
+func refundOf(status string, shipping, amount int64, items ...models.RefundItem) models.Refund {
+	return models.Refund{Status: status, Items: items, ShippingAmount: models.Cents(shipping), RefundAmount: models.Cents(amount)}
+}
+
+func TestRefundableQuantities(t *testing.T) {
+	tests := []struct {
+		name    string
+		refunds []models.Refund
+		a, b    int
+	}{
+		{"aucun remboursement", nil, 2, 1},
+		{"remboursement effectué", []models.Refund{refundOf(models.RefundStatusCompleted, 0, 933, models.RefundItem{ProductID: "a", Quantity: 1})}, 1, 1},
+		{"remboursement en attente", []models.Refund{refundOf(models.RefundStatusPending, 0, 2800, models.RefundItem{ProductID: "b", Quantity: 1})}, 2, 0},
+		{"remboursement en échec", []models.Refund{refundOf(models.RefundStatusFailed, 0, 1867, models.RefundItem{ProductID: "a", Quantity: 2})}, 0, 1},
+		{"remboursement rejeté", []models.Refund{refundOf(models.RefundStatusRejected, 0, 1867, models.RefundItem{ProductID: "a", Quantity: 2})}, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remaining := RefundableQuantities(refundTestOrder(), tt.refunds)
+			if remaining[refundKey("a", "")] != tt.a || remaining[refundKey("b", "")] != tt.b {
+				t.Errorf("quantités = %v, attendu a=%d b=%d", remaining, tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestComputeRefund(t *testing.T) {
+	tests := []struct {
+		name            string
+		previous        []models.Refund
+		lines           []RefundLine
+		includeShipping bool
+		shipping, total int64
+		items           int
+	}{
+		{
+			name:  "une unité, remise au prorata",
+			lines: []RefundLine{{ProductID: "a", Quantity: 1}},
+			total: 933, items: 1,
+		},
+		{
+			name:            "une ligne et les frais de port",
+			lines:           []RefundLine{{ProductID: "b", Quantity: 1}},
+			includeShipping: true,
+			shipping:        495, total: 3295, items: 1,
+		},
+		{
+			name:     "sans lignes : tout le reste, port compris",
+			previous: []models.Refund{refundOf(models.RefundStatusCompleted, 0, 933, models.RefundItem{ProductID: "a", Quantity: 1})},
+			shipping: 495, total: 5162 - 933, items: 2,
+		},
+		{
+			name: "le dernier remboursement solde la commande",
+			previous: []models.Refund{
+				refundOf(models.RefundStatusCompleted, 0, 933, models.RefundItem{ProductID: "a", Quantity: 1}),
+				refundOf(models.RefundStatusCompleted, 0, 933, models.RefundItem{ProductID: "a", Quantity: 1}),
+			},
+			lines:           []RefundLine{{ProductID: "b", Quantity: 1}},
+			includeShipping: true,
+			shipping:        495, total: 3296, items: 1, // 2800 + 495 + 1 centime d'arrondi
+		},
+		{
+			name:     "un remboursement rejeté ne bloque rien",
+			previous: []models.Refund{refundOf(models.RefundStatusRejected, 495, 5162, models.RefundItem{ProductID: "a", Quantity: 2}, models.RefundItem{ProductID: "b", Quantity: 1})},
+			lines:    []RefundLine{{ProductID: "a", Quantity: 2}},
+			total:    1867, items: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, shipping, total, err := ComputeRefund(refundTestOrder(), tt.previous, tt.lines, tt.includeShipping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != tt.items || shipping.Amount != tt.shipping || total.Amount != tt.total {
+				t.Errorf("ComputeRefund = %d ligne(s), port %s, total %s ; attendu %d, %d, %d", len(items), shipping, total, tt.items, tt.shipping, tt.total)
+			}
+		})
+	}
+}
+
+func TestComputeRefundRejects(t *testing.T) {
+	tests := []struct {
+		name            string
+		previous        []models.Refund
+		lines           []RefundLine
+		includeShipping bool
+	}{
+		{"article absent", nil, []RefundLine{{ProductID: "c", Quantity: 1}}, false},
+		{"quantité trop grande", nil, []RefundLine{{ProductID: "a", Quantity: 3}}, false},
+		{"quantité nulle", nil, []RefundLine{{ProductID: "a", Quantity: 0}}, false},
+		{"même article deux fois", nil, []RefundLine{{ProductID: "b", Quantity: 1}, {ProductID: "b", Quantity: 1}}, false},
+		{
+			name:     "quantités bloquées par un remboursement en échec",
+			previous: []models.Refund{refundOf(models.RefundStatusFailed, 0, 1867, models.RefundItem{ProductID: "a", Quantity: 2})},
+			lines:    []RefundLine{{ProductID: "a", Quantity: 1}},
+		},
+		{
+			name:            "frais de port déjà remboursés",
+			previous:        []models.Refund{refundOf(models.RefundStatusCompleted, 495, 495)},
+			lines:           []RefundLine{{ProductID: "a", Quantity: 1}},
+			includeShipping: true,
+		},
+		{
+			name:     "commande entièrement remboursée",
+			previous: []models.Refund{refundOf(models.RefundStatusCompleted, 495, 5162, models.RefundItem{ProductID: "a", Quantity: 2}, models.RefundItem{ProductID: "b", Quantity: 1})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := ComputeRefund(refundTestOrder(), tt.previous, tt.lines, tt.includeShipping)
+			var refundErr *RefundError
+			if !errors.As(err, &refundErr) {
+				t.Errorf("ComputeRefund = %v, RefundError attendue", err)
+			}
+		})
+	}
+}
+
+func TestComputeRefundUsesTaxDetails(t *testing.T) {
+	order := &models.Order{
+		Items: []models.OrderItem{
+			{ProductID: "a", Price: models.Cents(1000), Quantity: 3, NetAmount: models.Cents(2479), TaxAmount: models.Cents(521)},
+		},
+		Subtotal:   models.Cents(3000),
+		TotalPrice: models.Cents(3000),
+		Tax:        &models.TaxSummary{},
+	}
+
+	_, _, total, err := ComputeRefund(order, nil, []RefundLine{{ProductID: "a", Quantity: 2}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Amount != 2000 {
+		t.Errorf("total = %s, attendu 20.00", total)
+	}
+}
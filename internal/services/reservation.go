@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"cedra_back_end/internal/database"
+)
+
+// DefaultReservationTTL durée de vie d'une réservation de stock si STOCK_RESERVATION_TTL n'est pas défini
+const DefaultReservationTTL = 15 * time.Minute
+
+const reservationExpiryKey = "reservations:expiry"
+
+// ReservationItem représente une ligne réservée (produit ou variante)
+type ReservationItem struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Quantity  int    `json:"quantity"`
+	Stock     int    `json:"-"` // Stock physique au moment de la réservation
+}
+
+// Reservation regroupe les réservations posées pour un paiement
+type Reservation struct {
+	ID              string            `json:"id"`
+	UserID          string            `json:"user_id"`
+	PaymentIntentID string            `json:"payment_intent_id,omitempty"`
+	Items           []ReservationItem `json:"items"`
+	ExpiresAt       time.Time         `json:"expires_at"`
+}
+
+// InsufficientStockError est retournée quand le stock disponible ne couvre pas la quantité demandée
+type InsufficientStockError struct {
+	ProductID string
+	VariantID string
+	Available int
+	Requested int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("stock insuffisant pour %s (disponible: %d, demandé: %d)", e.ProductID, e.Available, e.Requested)
+}
+
+// reserveScript vérifie puis pose toutes les réservations de façon atomique.
+// Chaque champ du hash stock_holds:<produit> vaut "<quantité>:<expiration unix>".
+var reserveScript = redis.NewScript(`
+local now = tonumber(ARGV[2])
+for i, key in ipairs(KEYS) do
+	local qty = tonumber(ARGV[2 + 2 * i])
+	local stock = tonumber(ARGV[3 + 2 * i])
+	local reserved = 0
+	local holds = redis.call('HGETALL', key)
+	for j = 1, #holds, 2 do
+		local q, exp = string.match(holds[j + 1], '(%d+):(%d+)')
+		if tonumber(exp) <= now then
+			redis.call('HDEL', key, holds[j])
+		elseif holds[j] ~= ARGV[1] then
+			reserved = reserved + tonumber(q)
+		end
+	end
+	if reserved + qty > stock then
+		return {i, stock - reserved}
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call('HSET', key, ARGV[1], ARGV[2 + 2 * i] .. ':' .. ARGV[3])
+end
+return {0, 0}
+`)
+
+// ReservationTTL retourne la durée de vie configurée des réservations
+func ReservationTTL() time.Duration {
+	if v := os.Getenv("STOCK_RESERVATION_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultReservationTTL
+}
+
+func holdKey(productID, variantID string) string {
+	if variantID != "" {
+		return "stock_holds:" + productID + ":" + variantID
+	}
+	return "stock_holds:" + productID
+}
+
+func reservationKey(reservationID string) string {
+	return "reservation:" + reservationID
+}
+
+// ReserveStock pose une réservation temporaire sur chaque ligne.
+// Rien n'est réservé si une seule ligne dépasse le stock disponible.
+func ReserveStock(reservationID, userID string, items []ReservationItem, ttl time.Duration) (*Reservation, error) {
+	ctx := context.Background()
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	keys := make([]string, 0, len(items))
+	args := []interface{}{reservationID, now.Unix(), expiresAt.Unix()}
+	for _, item := range items {
+		keys = append(keys, holdKey(item.ProductID, item.VariantID))
+		args = append(args, item.Quantity, item.Stock)
+	}
+
+	res, err := reserveScript.Run(ctx, database.Redis, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("erreur réservation stock: %v", err)
+	}
+	if res[0] != 0 {
+		item := items[res[0]-1]
+		available := int(res[1])
+		if available < 0 {
+			available = 0
+		}
+		return nil, &InsufficientStockError{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Available: available,
+			Requested: item.Quantity,
+		}
+	}
+
+	reservation := &Reservation{
+		ID:        reservationID,
+		UserID:    userID,
+		Items:     items,
+		ExpiresAt: expiresAt,
+	}
+	if err := saveReservation(ctx, reservation); err != nil {
+		releaseHolds(ctx, reservationID, items)
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func saveReservation(ctx context.Context, reservation *Reservation) error {
+	data, err := json.Marshal(reservation)
+	if err != nil {
+		return err
+	}
+
+	// On garde la fiche un peu plus longtemps que les réservations pour que le nettoyage la retrouve
+	ttl := time.Until(reservation.ExpiresAt) + time.Hour
+
+	pipe := database.Redis.TxPipeline()
+	pipe.Set(ctx, reservationKey(reservation.ID), data, ttl)
+	pipe.ZAdd(ctx, reservationExpiryKey, redis.Z{Score: float64(reservation.ExpiresAt.Unix()), Member: reservation.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetReservation récupère une réservation par son ID
+func GetReservation(reservationID string) (*Reservation, error) {
+	data, err := database.Redis.Get(context.Background(), reservationKey(reservationID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var reservation Reservation
+	if err := json.Unmarshal([]byte(data), &reservation); err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// AttachPaymentIntent associe le PaymentIntent Stripe à la réservation
+func AttachPaymentIntent(reservationID, paymentIntentID string) error {
+	reservation, err := GetReservation(reservationID)
+	if err != nil {
+		return err
+	}
+	reservation.PaymentIntentID = paymentIntentID
+	return saveReservation(context.Background(), reservation)
+}
+
+// ReleaseReservation libère les réservations (paiement annulé ou expiré)
+func ReleaseReservation(reservationID string) error {
+	ctx := context.Background()
+
+	reservation, err := GetReservation(reservationID)
+	if err == redis.Nil {
+		database.Redis.ZRem(ctx, reservationExpiryKey, reservationID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return releaseHolds(ctx, reservationID, reservation.Items)
+}
+
+// CommitReservation convertit les réservations en ventes : le stock a été décrémenté,
+// les réservations n'ont donc plus lieu d'être comptées
+func CommitReservation(reservationID string) error {
+	return ReleaseReservation(reservationID)
+}
+
+func releaseHolds(ctx context.Context, reservationID string, items []ReservationItem) error {
+	pipe := database.Redis.TxPipeline()
+	for _, item := range items {
+		pipe.HDel(ctx, holdKey(item.ProductID, item.VariantID), reservationID)
+	}
+	pipe.Del(ctx, reservationKey(reservationID))
+	pipe.ZRem(ctx, reservationExpiryKey, reservationID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ExpiredReservations retourne les IDs des réservations arrivées à expiration
+func ExpiredReservations() ([]string, error) {
+	return database.Redis.ZRangeByScore(context.Background(), reservationExpiryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+}
+
+// ReservedQuantity retourne la quantité actuellement réservée pour un produit (ou une variante)
+func ReservedQuantity(productID, variantID string) int {
+	holds, err := database.Redis.HGetAll(context.Background(), holdKey(productID, variantID)).Result()
+	if err != nil {
+		return 0
+	}
+	return activeHeldQuantity(holds, time.Now().Unix())
+}
+
+// activeHeldQuantity additionne les réservations non expirées d'un hash stock_holds ("<quantité>:<expiration unix>")
+func activeHeldQuantity(holds map[string]string, now int64) int {
+	reserved := 0
+	for _, value := range holds {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		qty, err1 := strconv.Atoi(parts[0])
+		exp, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 != nil || err2 != nil || exp <= now {
+			continue
+		}
+		reserved += qty
+	}
+	return reserved
+}
+
+// AvailableStock retourne le stock disponible : stock physique moins les réservations actives
+func AvailableStock(productID, variantID string, stock int) int {
+	available := stock - ReservedQuantity(productID, variantID)
+	if available < 0 {
+		return 0
+	}
+	return available
+}
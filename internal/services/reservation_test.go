@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveHeldQuantity(t *testing.T) {
+	now := int64(1_800_000_000)
+
+	tests := []struct {
+		name  string
+		holds map[string]string
+		want  int
+	}{
+		{"aucune réservation", nil, 0},
+		{"réservations actives", map[string]string{"r1": "2:1800000060", "r2": "3:1800000900"}, 5},
+		{"réservation expirée", map[string]string{"r1": "2:1800000060", "r2": "4:1800000000"}, 2},
+		{"valeur illisible", map[string]string{"r1": "2:1800000060", "r2": "abc", "r3": "x:1800000060"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activeHeldQuantity(tt.holds, now); got != tt.want {
+				t.Errorf("activeHeldQuantity = %d, attendu %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHoldKey(t *testing.T) {
+	if got := holdKey("p1", ""); got != "stock_holds:p1" {
+		t.Errorf("holdKey(p1) = %s", got)
+	}
+	if got := holdKey("p1", "v1"); got != "stock_holds:p1:v1" {
+		t.Errorf("holdKey(p1, v1) = %s", got)
+	}
+}
+
+func TestReservationTTL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", DefaultReservationTTL},
+		{"30m", 30 * time.Minute},
+		{"-5m", DefaultReservationTTL},
+		{"quinze", DefaultReservationTTL},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("STOCK_RESERVATION_TTL", tt.value)
+		if got := ReservationTTL(); got != tt.want {
+			t.Errorf("ReservationTTL(%q) = %s, attendu %s", tt.value, got, tt.want)
+		}
+	}
+}
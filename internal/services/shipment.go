@@ -0,0 +1,288 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const shipmentColumns = `shipment_id, order_id, carrier, service_code, tracking_number, label_key, status, weight, items, created_at, updated_at`
+
+// ShipmentLine est une ligne de commande (ou une partie de ses quantités) à mettre dans un colis
+type ShipmentLine struct {
+	ProductID string `json:"productId" binding:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// ShipmentError est une erreur de validation d'un colis (quantités, articles)
+type ShipmentError struct {
+	Message string
+}
+
+func (e *ShipmentError) Error() string {
+	return e.Message
+}
+
+// scanShipments lit les envois retournés par une requête sur shipmentColumns
+func scanShipments(iter *gocql.Iter) ([]models.Shipment, error) {
+	shipments := []models.Shipment{}
+	var (
+		s         models.Shipment
+		itemsJSON string
+		updatedAt time.Time
+	)
+	for iter.Scan(&s.ID, &s.OrderID, &s.Carrier, &s.ServiceCode, &s.TrackingNumber, &s.LabelKey,
+		&s.Status, &s.Weight, &itemsJSON, &s.CreatedAt, &updatedAt) {
+		if itemsJSON != "" {
+			if err := json.Unmarshal([]byte(itemsJSON), &s.Items); err != nil {
+				log.Printf("⚠️ Lignes illisibles pour l'envoi %s: %v", s.ID, err)
+			}
+		}
+		if !updatedAt.IsZero() {
+			u := updatedAt
+			s.UpdatedAt = &u
+		}
+		s.TrackingURL = TrackingURL(s.Carrier, s.TrackingNumber)
+		shipments = append(shipments, s)
+		s, itemsJSON, updatedAt = models.Shipment{}, "", time.Time{}
+	}
+	return shipments, iter.Close()
+}
+
+// GetOrderShipments retourne les colis d'une commande avec leurs événements de suivi, du plus ancien au plus récent
+func GetOrderShipments(orderID gocql.UUID) ([]models.Shipment, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	shipments, err := scanShipments(session.Query("SELECT "+shipmentColumns+" FROM shipments WHERE order_id = ?", orderID).Iter())
+	if err != nil {
+		return nil, err
+	}
+	for i := range shipments {
+		if shipments[i].Events, err = GetShipmentEvents(shipments[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(shipments, func(i, j int) bool { return shipments[i].CreatedAt.Before(shipments[j].CreatedAt) })
+	return shipments, nil
+}
+
+// GetShipment charge un envoi par son ID
+func GetShipment(shipmentID gocql.UUID) (*models.Shipment, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	shipments, err := scanShipments(session.Query("SELECT "+shipmentColumns+" FROM shipments WHERE shipment_id = ?", shipmentID).Iter())
+	if err != nil {
+		return nil, err
+	}
+	if len(shipments) == 0 {
+		return nil, gocql.ErrNotFound
+	}
+	return &shipments[0], nil
+}
+
+// GetShipmentByTracking retrouve l'envoi d'un transporteur par numéro de suivi
+func GetShipmentByTracking(carrier, trackingNumber string) (*models.Shipment, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	shipments, err := scanShipments(session.Query("SELECT "+shipmentColumns+" FROM shipments WHERE tracking_number = ?", trackingNumber).Iter())
+	if err != nil {
+		return nil, err
+	}
+	for i := range shipments {
+		if shipments[i].Carrier == carrier {
+			return &shipments[i], nil
+		}
+	}
+	return nil, gocql.ErrNotFound
+}
+
+// InsertShipment enregistre un nouvel envoi
+func InsertShipment(s *models.Shipment) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	itemsJSON, err := json.Marshal(s.Items)
+	if err != nil {
+		return fmt.Errorf("erreur sérialisation lignes: %v", err)
+	}
+
+	return session.Query(`INSERT INTO shipments (`+shipmentColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.OrderID, s.Carrier, s.ServiceCode, s.TrackingNumber, s.LabelKey, s.Status, s.Weight, string(itemsJSON),
+		s.CreatedAt, s.UpdatedAt).Exec()
+}
+
+// SetShipmentStatus met à jour le statut de suivi d'un envoi
+func SetShipmentStatus(s *models.Shipment, status string) error {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := session.Query("UPDATE shipments SET status = ?, updated_at = ? WHERE shipment_id = ?", status, now, s.ID).Exec(); err != nil {
+		return err
+	}
+	s.Status = status
+	s.UpdatedAt = &now
+	return nil
+}
+
+// GetShipmentEvents retourne les événements de suivi d'un envoi
+func GetShipmentEvents(shipmentID gocql.UUID) ([]models.ShipmentEvent, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := session.Query(`SELECT shipment_id, occurred_at, status, carrier_status, description, location
+		FROM shipment_events WHERE shipment_id = ?`, shipmentID).Iter()
+
+	events := []models.ShipmentEvent{}
+	var e models.ShipmentEvent
+	for iter.Scan(&e.ShipmentID, &e.OccurredAt, &e.Status, &e.CarrierStatus, &e.Description, &e.Location) {
+		events = append(events, e)
+		e = models.ShipmentEvent{}
+	}
+	return events, iter.Close()
+}
+
+// RecordShipmentEvent enregistre un événement de suivi.
+// Retourne false si l'événement (même date, même code) a déjà été reçu : les webhooks rejoués sont ignorés.
+func RecordShipmentEvent(shipmentID gocql.UUID, e TrackingEvent) (bool, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return false, err
+	}
+
+	return session.Query(`INSERT INTO shipment_events (shipment_id, occurred_at, carrier_status, status, description, location)
+		VALUES (?, ?, ?, ?, ?, ?) IF NOT EXISTS`,
+		shipmentID, e.OccurredAt, e.CarrierStatus, e.Status, e.Description, e.Location).MapScanCAS(map[string]interface{}{})
+}
+
+// QuantitiesToShip retourne, par ligne de commande, les quantités qui restent à expédier.
+// Les articles remboursés sans retour (jamais expédiés) ne sont plus à expédier.
+func QuantitiesToShip(order *models.Order, shipments []models.Shipment, refunds []models.Refund) map[string]int {
+	remaining := make(map[string]int)
+	for _, item := range order.Items {
+		remaining[refundKey(item.ProductID, item.VariantID)] += item.Quantity
+	}
+	for _, r := range refunds {
+		if !r.Counts() || r.IsReturn() {
+			continue
+		}
+		for _, item := range r.Items {
+			remaining[refundKey(item.ProductID, item.VariantID)] -= item.Quantity
+		}
+	}
+	for _, s := range shipments {
+		// Colis créés avant l'expédition partielle : ils contiennent toute la commande
+		if len(s.Items) == 0 {
+			for key := range remaining {
+				remaining[key] = 0
+			}
+		}
+		for _, item := range s.Items {
+			remaining[refundKey(item.ProductID, item.VariantID)] -= item.Quantity
+		}
+	}
+	for key, qty := range remaining {
+		if qty < 0 {
+			remaining[key] = 0
+		}
+	}
+	return remaining
+}
+
+// ComputeShipmentItems valide les lignes d'un colis contre les quantités restant à expédier.
+// Sans lignes, tout ce qui reste est mis dans le colis.
+func ComputeShipmentItems(order *models.Order, remaining map[string]int, lines []ShipmentLine) ([]models.ShipmentItem, error) {
+	if len(lines) == 0 {
+		for _, item := range order.Items {
+			if qty := remaining[refundKey(item.ProductID, item.VariantID)]; qty > 0 {
+				lines = append(lines, ShipmentLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: qty})
+			}
+		}
+		if len(lines) == 0 {
+			return nil, &ShipmentError{Message: "Tous les articles de la commande sont déjà expédiés"}
+		}
+	}
+
+	items := make([]models.ShipmentItem, 0, len(lines))
+	requested := make(map[string]int)
+	for _, line := range lines {
+		item, ok := findOrderItem(order, line.ProductID, line.VariantID)
+		if !ok {
+			return nil, &ShipmentError{Message: fmt.Sprintf("Article %s absent de la commande", line.ProductID)}
+		}
+		key := refundKey(line.ProductID, line.VariantID)
+		requested[key] += line.Quantity
+		if requested[key] > remaining[key] {
+			return nil, &ShipmentError{Message: fmt.Sprintf("Quantité à expédier trop élevée pour %s (reste %d)", item.Name, remaining[key])}
+		}
+
+		name := item.Name
+		if name == "" {
+			name = item.ProductName
+		}
+		items = append(items, models.ShipmentItem{
+			ProductID: line.ProductID,
+			VariantID: line.VariantID,
+			Name:      name,
+			Quantity:  line.Quantity,
+		})
+	}
+	return items, nil
+}
+
+// FulfillmentStatus déduit le statut d'expédition d'une commande de ses colis :
+// "" (rien d'expédié), partially_shipped, shipped (tout est parti) ou delivered (tous les colis sont livrés)
+func FulfillmentStatus(order *models.Order, shipments []models.Shipment, refunds []models.Refund) string {
+	if len(shipments) == 0 {
+		return ""
+	}
+
+	for _, qty := range QuantitiesToShip(order, shipments, refunds) {
+		if qty > 0 {
+			return models.OrderStatusPartiallyShipped
+		}
+	}
+
+	for _, s := range shipments {
+		if s.Status != models.TrackingStatusDelivered {
+			return models.OrderStatusShipped
+		}
+	}
+	return models.OrderStatusDelivered
+}
+
+// FulfillmentPath liste, dans l'ordre, les statuts par lesquels la commande doit passer pour atteindre
+// le statut d'expédition (une commande livrée dont l'expédition n'a pas été signalée passe d'abord par "shipped")
+func FulfillmentPath(status string) []string {
+	switch status {
+	case models.OrderStatusPartiallyShipped:
+		return []string{models.OrderStatusPartiallyShipped}
+	case models.OrderStatusShipped:
+		return []string{models.OrderStatusShipped}
+	case models.OrderStatusDelivered:
+		return []string{models.OrderStatusShipped, models.OrderStatusDelivered}
+	}
+	return nil
+}
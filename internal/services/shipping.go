@@ -0,0 +1,472 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// DefaultShippingOptionID est l'option appliquée quand le client n'en choisit pas
+const DefaultShippingOptionID = "standard"
+
+// freeShippingThreshold : montant de marchandises (remise déduite) à partir duquel la livraison standard est offerte
+// (grille par défaut, tant qu'aucune zone n'est configurée)
+var freeShippingThreshold = models.Cents(5000)
+
+// ErrNoShippingZone est retournée quand aucune zone ne couvre l'adresse de livraison
+var ErrNoShippingZone = errors.New("aucune livraison possible vers cette adresse")
+
+// ShippingItem est une ligne du panier vue par le moteur de tarifs
+type ShippingItem struct {
+	ProductID     string
+	Quantity      int
+	Weight        float64 // kg par unité
+	ShippingClass string
+}
+
+// ShippingQuote décrit un envoi à tarifer : destination, contenu et montant des marchandises (remise déduite)
+type ShippingQuote struct {
+	Country    string
+	PostalCode string
+	Items      []ShippingItem
+	GoodsTotal models.Money
+}
+
+// ShippingConfig est la configuration des tarifs gérée par les admins
+type ShippingConfig struct {
+	Zones     []models.ShippingZone
+	Carriers  map[string]models.ShippingCarrier
+	Services  []models.ShippingService
+	Rates     []models.ShippingRate
+	Classes   map[string]models.ShippingClass
+	FreeRules []models.FreeShippingRule
+}
+
+// La configuration est relue au plus toutes les minutes, ou dès qu'un admin la modifie
+var (
+	shippingConfigMu       sync.Mutex
+	shippingConfigCache    *ShippingConfig
+	shippingConfigLoadedAt time.Time
+)
+
+const shippingConfigTTL = time.Minute
+
+// InvalidateShippingConfig force le rechargement des zones, services et grilles au prochain calcul
+func InvalidateShippingConfig() {
+	shippingConfigMu.Lock()
+	shippingConfigCache = nil
+	shippingConfigMu.Unlock()
+}
+
+// GetShippingConfig retourne la configuration des tarifs (mise en cache)
+func GetShippingConfig() (*ShippingConfig, error) {
+	shippingConfigMu.Lock()
+	defer shippingConfigMu.Unlock()
+
+	if shippingConfigCache != nil && time.Since(shippingConfigLoadedAt) < shippingConfigTTL {
+		return shippingConfigCache, nil
+	}
+
+	cfg, err := loadShippingConfig()
+	if err != nil {
+		return nil, err
+	}
+	shippingConfigCache = cfg
+	shippingConfigLoadedAt = time.Now()
+	return cfg, nil
+}
+
+func loadShippingConfig() (*ShippingConfig, error) {
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ShippingConfig{
+		Carriers: make(map[string]models.ShippingCarrier),
+		Classes:  make(map[string]models.ShippingClass),
+	}
+
+	var (
+		zone       models.ShippingZone
+		rangesJSON string
+		carrier    models.ShippingCarrier
+		service    models.ShippingService
+		rate       models.ShippingRate
+		class      models.ShippingClass
+		rule       models.FreeShippingRule
+		scanErr    error
+	)
+
+	iter := session.Query("SELECT id, name, countries, postal_ranges, priority, active FROM shipping_zones").Iter()
+	for iter.Scan(&zone.ID, &zone.Name, &zone.Countries, &rangesJSON, &zone.Priority, &zone.Active) {
+		if rangesJSON != "" {
+			if err := json.Unmarshal([]byte(rangesJSON), &zone.PostalRanges); err != nil {
+				log.Printf("⚠️ Plages postales illisibles pour la zone %s: %v", zone.ID, err)
+			}
+		}
+		cfg.Zones = append(cfg.Zones, zone)
+		zone, rangesJSON = models.ShippingZone{}, ""
+	}
+	if scanErr = iter.Close(); scanErr != nil {
+		return nil, fmt.Errorf("lecture zones: %v", scanErr)
+	}
+	sort.SliceStable(cfg.Zones, func(i, j int) bool { return cfg.Zones[i].Priority > cfg.Zones[j].Priority })
+
+	iter = session.Query("SELECT id, code, name, tracking_url, active FROM shipping_carriers").Iter()
+	for iter.Scan(&carrier.ID, &carrier.Code, &carrier.Name, &carrier.TrackingURL, &carrier.Active) {
+		cfg.Carriers[carrier.ID] = carrier
+		carrier = models.ShippingCarrier{}
+	}
+	if scanErr = iter.Close(); scanErr != nil {
+		return nil, fmt.Errorf("lecture transporteurs: %v", scanErr)
+	}
+
+	iter = session.Query("SELECT id, carrier_id, code, name, description, estimated_days, active FROM shipping_services").Iter()
+	for iter.Scan(&service.ID, &service.CarrierID, &service.Code, &service.Name, &service.Description, &service.EstimatedDays, &service.Active) {
+		cfg.Services = append(cfg.Services, service)
+		service = models.ShippingService{}
+	}
+	if scanErr = iter.Close(); scanErr != nil {
+		return nil, fmt.Errorf("lecture services: %v", scanErr)
+	}
+
+	iter = session.Query("SELECT id, zone_id, service_id, min_weight, max_weight, min_cart_value, max_cart_value, price FROM shipping_rates").Iter()
+	for iter.Scan(&rate.ID, &rate.ZoneID, &rate.ServiceID, &rate.MinWeight, &rate.MaxWeight, &rate.MinCartValue, &rate.MaxCartValue, &rate.Price) {
+		cfg.Rates = append(cfg.Rates, rate)
+		rate = models.ShippingRate{}
+	}
+	if scanErr = iter.Close(); scanErr != nil {
+		return nil, fmt.Errorf("lecture grilles: %v", scanErr)
+	}
+
+	iter = session.Query("SELECT code, name, surcharge, per_item, allowed_services FROM shipping_classes").Iter()
+	for iter.Scan(&class.Code, &class.Name, &class.Surcharge, &class.PerItem, &class.AllowedServices) {
+		cfg.Classes[class.Code] = class
+		class = models.ShippingClass{}
+	}
+	if scanErr = iter.Close(); scanErr != nil {
+		return nil, fmt.Errorf("lecture classes: %v", scanErr)
+	}
+
+	iter = session.Query("SELECT id, name, zone_id, service_id, min_cart_value, excluded_classes, active FROM shipping_free_rules").Iter()
+	for iter.Scan(&rule.ID, &rule.Name, &rule.ZoneID, &rule.ServiceID, &rule.MinCartValue, &rule.ExcludedClasses, &rule.Active) {
+		cfg.FreeRules = append(cfg.FreeRules, rule)
+		rule = models.FreeShippingRule{}
+	}
+	if scanErr = iter.Close(); scanErr != nil {
+		return nil, fmt.Errorf("lecture règles de gratuité: %v", scanErr)
+	}
+
+	return cfg, nil
+}
+
+// ShippingOptions calcule les options de livraison de la grille par défaut pour un montant de marchandises
+func ShippingOptions(cartTotal models.Money) models.ShippingCalculation {
+	isFree := cartTotal.Amount >= freeShippingThreshold.Amount
+
+	options := []models.ShippingOption{
+		{
+			ID:            "standard",
+			Name:          "Livraison Standard",
+			Description:   "Livraison en 5-7 jours ouvrés",
+			Price:         models.Cents(599),
+			EstimatedDays: 7,
+		},
+		{
+			ID:            "express",
+			Name:          "Livraison Express",
+			Description:   "Livraison en 2-3 jours ouvrés",
+			Price:         models.Cents(1299),
+			EstimatedDays: 3,
+		},
+		{
+			ID:            "next_day",
+			Name:          "Livraison 24h",
+			Description:   "Livraison le lendemain avant 18h",
+			Price:         models.Cents(1999),
+			EstimatedDays: 1,
+		},
+	}
+
+	// Si livraison gratuite, mettre le prix à 0 pour l'option standard
+	if isFree {
+		options[0].Price = models.Cents(0)
+		options[0].Name = "Livraison Standard Gratuite"
+		options[0].IsFree = true
+	}
+
+	return models.ShippingCalculation{
+		Options:       options,
+		FreeThreshold: freeShippingThreshold,
+		CartTotal:     cartTotal,
+		IsFree:        isFree,
+	}
+}
+
+// QuoteShipping calcule les options de livraison d'un envoi à partir des zones, grilles, classes
+// et règles de gratuité. Sans zone configurée, la grille par défaut est utilisée.
+func QuoteShipping(q ShippingQuote) (models.ShippingCalculation, error) {
+	cfg, err := GetShippingConfig()
+	if err != nil {
+		return models.ShippingCalculation{}, err
+	}
+
+	weight := 0.0
+	for _, item := range q.Items {
+		weight += item.Weight * float64(item.Quantity)
+	}
+
+	if len(cfg.Zones) == 0 {
+		calc := ShippingOptions(q.GoodsTotal)
+		calc.TotalWeight = weight
+		return calc, nil
+	}
+
+	zone := cfg.MatchZone(q.Country, q.PostalCode)
+	if zone == nil {
+		return models.ShippingCalculation{}, ErrNoShippingZone
+	}
+
+	calc := models.ShippingCalculation{
+		Options:     []models.ShippingOption{},
+		CartTotal:   q.GoodsTotal,
+		TotalWeight: weight,
+		Zone:        zone.Name,
+	}
+
+	for _, service := range cfg.Services {
+		if !service.Active {
+			continue
+		}
+		carrier, ok := cfg.Carriers[service.CarrierID]
+		if !ok || !carrier.Active {
+			continue
+		}
+
+		rate := cfg.findRate(zone.ID, service.ID, weight, q.GoodsTotal)
+		if rate == nil {
+			continue
+		}
+
+		surcharge, allowed := cfg.classSurcharge(service.Code, q.Items)
+		if !allowed {
+			continue
+		}
+
+		price := rate.Price
+		free := cfg.freeRule(zone.ID, service.ID, q)
+		if free != nil {
+			price = models.Money{}
+			if calc.FreeThreshold.IsZero() || free.MinCartValue.Amount < calc.FreeThreshold.Amount {
+				calc.FreeThreshold = free.MinCartValue
+			}
+		}
+
+		calc.Options = append(calc.Options, models.ShippingOption{
+			ID:            service.Code,
+			Name:          service.Name,
+			Description:   service.Description,
+			Price:         price.Add(surcharge),
+			EstimatedDays: service.EstimatedDays,
+			Carrier:       carrier.Code,
+			ZoneID:        zone.ID,
+			IsFree:        free != nil && surcharge.IsZero(),
+		})
+		calc.IsFree = calc.IsFree || (free != nil && surcharge.IsZero())
+	}
+
+	sort.SliceStable(calc.Options, func(i, j int) bool { return calc.Options[i].Price.Amount < calc.Options[j].Price.Amount })
+	return calc, nil
+}
+
+// SelectShippingOption recalcule côté serveur le prix de l'option choisie par le client
+func SelectShippingOption(optionID string, q ShippingQuote) (*models.ShippingOption, error) {
+	calc, err := QuoteShipping(q)
+	if err != nil {
+		return nil, err
+	}
+	if optionID == "" {
+		if len(calc.Options) == 0 {
+			return nil, ErrNoShippingZone
+		}
+		// Option par défaut, sinon la moins chère
+		for _, option := range calc.Options {
+			if option.ID == DefaultShippingOptionID {
+				return &option, nil
+			}
+		}
+		return &calc.Options[0], nil
+	}
+	for _, option := range calc.Options {
+		if option.ID == optionID {
+			return &option, nil
+		}
+	}
+	return nil, fmt.Errorf("option de livraison indisponible: %s", optionID)
+}
+
+// MatchZone retourne la zone active la plus prioritaire qui couvre le pays et le code postal.
+// À priorité égale, une plage de codes postaux l'emporte sur un pays entier.
+func (cfg *ShippingConfig) MatchZone(country, postalCode string) *models.ShippingZone {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	postalCode = strings.ToUpper(strings.ReplaceAll(postalCode, " ", ""))
+
+	var countryMatch *models.ShippingZone
+	for i := range cfg.Zones {
+		zone := &cfg.Zones[i]
+		if !zone.Active {
+			continue
+		}
+		if countryMatch != nil && zone.Priority < countryMatch.Priority {
+			break
+		}
+		for _, r := range zone.PostalRanges {
+			if strings.EqualFold(r.Country, country) && postalInRange(postalCode, r.From, r.To) {
+				return zone
+			}
+		}
+		if countryMatch == nil {
+			for _, c := range zone.Countries {
+				if strings.EqualFold(c, country) {
+					countryMatch = zone
+					break
+				}
+			}
+		}
+	}
+	return countryMatch
+}
+
+// postalInRange compare des codes postaux de même longueur (numériques ou alphanumériques)
+func postalInRange(code, from, to string) bool {
+	from = strings.ToUpper(strings.ReplaceAll(from, " ", ""))
+	to = strings.ToUpper(strings.ReplaceAll(to, " ", ""))
+	if code == "" || len(code) != len(from) || len(code) != len(to) {
+		return false
+	}
+	return code >= from && code <= to
+}
+
+// findRate retourne la ligne de grille correspondant au poids et au montant de l'envoi
+func (cfg *ShippingConfig) findRate(zoneID, serviceID string, weight float64, goods models.Money) *models.ShippingRate {
+	for i := range cfg.Rates {
+		rate := &cfg.Rates[i]
+		if rate.ZoneID != zoneID || rate.ServiceID != serviceID {
+			continue
+		}
+		if weight < rate.MinWeight || (rate.MaxWeight > 0 && weight >= rate.MaxWeight) {
+			continue
+		}
+		if goods.Amount < rate.MinCartValue.Amount || (!rate.MaxCartValue.IsZero() && goods.Amount >= rate.MaxCartValue.Amount) {
+			continue
+		}
+		return rate
+	}
+	return nil
+}
+
+// classSurcharge additionne les suppléments des classes de livraison du panier
+// et indique si toutes ces classes acceptent le service
+func (cfg *ShippingConfig) classSurcharge(serviceCode string, items []ShippingItem) (models.Money, bool) {
+	total := models.Money{}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if item.ShippingClass == "" {
+			continue
+		}
+		class, ok := cfg.Classes[item.ShippingClass]
+		if !ok {
+			continue
+		}
+		if len(class.AllowedServices) > 0 && !containsFold(class.AllowedServices, serviceCode) {
+			return models.Money{}, false
+		}
+		if class.PerItem {
+			total = total.Add(class.Surcharge.Mul(item.Quantity))
+		} else if !seen[class.Code] {
+			total = total.Add(class.Surcharge)
+		}
+		seen[class.Code] = true
+	}
+	return total, true
+}
+
+// freeRule retourne la première règle de gratuité applicable à l'envoi
+func (cfg *ShippingConfig) freeRule(zoneID, serviceID string, q ShippingQuote) *models.FreeShippingRule {
+	for i := range cfg.FreeRules {
+		rule := &cfg.FreeRules[i]
+		if !rule.Active {
+			continue
+		}
+		if (rule.ZoneID != "" && rule.ZoneID != zoneID) || (rule.ServiceID != "" && rule.ServiceID != serviceID) {
+			continue
+		}
+		if q.GoodsTotal.Amount < rule.MinCartValue.Amount {
+			continue
+		}
+		excluded := false
+		for _, item := range q.Items {
+			if item.ShippingClass != "" && containsFold(rule.ExcludedClasses, item.ShippingClass) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			return rule
+		}
+	}
+	return nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShippingItemsFromCart lit le poids et la classe de livraison des produits du panier
+func ShippingItemsFromCart(items []models.CartItem) ([]ShippingItem, error) {
+	session, err := database.GetProductsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ShippingItem, 0, len(items))
+	for _, item := range items {
+		productUUID, err := uuid.Parse(item.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("ID produit invalide: %s", item.ProductID)
+		}
+
+		var (
+			weight        float64
+			shippingClass string
+		)
+		if err := session.Query("SELECT weight, shipping_class FROM ks_products.products WHERE product_id = ?", gocql.UUID(productUUID)).
+			Scan(&weight, &shippingClass); err != nil {
+			return nil, fmt.Errorf("produit introuvable: %s", item.ProductID)
+		}
+
+		result = append(result, ShippingItem{
+			ProductID:     item.ProductID,
+			Quantity:      item.Quantity,
+			Weight:        weight,
+			ShippingClass: shippingClass,
+		})
+	}
+	return result, nil
+}
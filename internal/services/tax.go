@@ -0,0 +1,463 @@
+package services
+
+import (
+	"cedra_back_end/internal/database"
+	"cedra_back_end/internal/models"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// euVATRates : taux de TVA par pays de l'UE (standard, réduit). Le taux réduit retenu est celui
+// qui s'applique le plus souvent au catalogue ; la table tax_rates permet de corriger un taux sans redéploiement.
+var euVATRates = map[string]struct{ Standard, Reduced float64 }{
+	"AT": {20, 10}, "BE": {21, 6}, "BG": {20, 9}, "CY": {19, 5}, "CZ": {21, 12},
+	"DE": {19, 7}, "DK": {25, 25}, "EE": {24, 9}, "ES": {21, 10}, "FI": {25.5, 14},
+	"FR": {20, 5.5}, "GR": {24, 13}, "HR": {25, 13}, "HU": {27, 5}, "IE": {23, 13.5},
+	"IT": {22, 10}, "LT": {21, 9}, "LU": {17, 8}, "LV": {21, 12}, "MT": {18, 7},
+	"NL": {21, 9}, "PL": {23, 8}, "PT": {23, 6}, "RO": {21, 11}, "SE": {25, 12},
+	"SI": {22, 9.5}, "SK": {23, 19},
+}
+
+// IsEUCountry indique si le pays (code ISO) fait partie de l'UE
+func IsEUCountry(country string) bool {
+	_, ok := euVATRates[normalizeCountry(country)]
+	return ok
+}
+
+func normalizeCountry(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "EL" { // Code TVA de la Grèce
+		return "GR"
+	}
+	return country
+}
+
+// ShopCountry est le pays d'établissement de l'entreprise (TVA domestique)
+func ShopCountry() string {
+	if country := os.Getenv("COMPANY_COUNTRY"); country != "" {
+		return normalizeCountry(country)
+	}
+	return "BE"
+}
+
+// PricesIncludeTax indique si les prix du catalogue sont saisis TTC (défaut) ou HT (PRICES_INCLUDE_TAX=false)
+func PricesIncludeTax() bool {
+	return os.Getenv("PRICES_INCLUDE_TAX") != "false"
+}
+
+// ossEnabled : au-delà du seuil UE de 10 000 € de ventes à distance, la TVA du pays de destination s'applique
+// aux particuliers (TAX_OSS_ENABLED=false tant que le seuil n'est pas atteint)
+func ossEnabled() bool {
+	return os.Getenv("TAX_OSS_ENABLED") != "false"
+}
+
+// Surcharges des taux (table tax_rates), relues au plus toutes les minutes
+var (
+	taxRatesMu       sync.Mutex
+	taxRatesCache    map[string]float64
+	taxRatesLoadedAt time.Time
+)
+
+// InvalidateTaxRates force la relecture de la table tax_rates
+func InvalidateTaxRates() {
+	taxRatesMu.Lock()
+	taxRatesCache = nil
+	taxRatesMu.Unlock()
+}
+
+func taxRateOverrides() map[string]float64 {
+	taxRatesMu.Lock()
+	defer taxRatesMu.Unlock()
+
+	if taxRatesCache != nil && time.Since(taxRatesLoadedAt) < time.Minute {
+		return taxRatesCache
+	}
+
+	overrides := make(map[string]float64)
+	session, err := database.GetOrdersSession()
+	if err != nil {
+		return overrides
+	}
+
+	var (
+		country, class string
+		rate           float64
+	)
+	iter := session.Query("SELECT country, tax_class, rate FROM tax_rates").Iter()
+	for iter.Scan(&country, &class, &rate) {
+		overrides[country+"|"+class] = rate
+	}
+	if err := iter.Close(); err != nil {
+		log.Printf("⚠️ Lecture tax_rates impossible, taux par défaut utilisés: %v", err)
+		return overrides
+	}
+
+	taxRatesCache = overrides
+	taxRatesLoadedAt = time.Now()
+	return overrides
+}
+
+// VATRate retourne le taux (en %) d'une classe de TVA dans un pays
+func VATRate(country, taxClass string) (float64, error) {
+	country = normalizeCountry(country)
+	if taxClass == "" {
+		taxClass = models.TaxClassStandard
+	}
+
+	if rate, ok := taxRateOverrides()[country+"|"+taxClass]; ok {
+		return rate, nil
+	}
+	if taxClass == models.TaxClassZero {
+		return 0, nil
+	}
+
+	rates, ok := euVATRates[country]
+	if !ok {
+		return 0, fmt.Errorf("aucun taux de TVA pour le pays %s", country)
+	}
+	if taxClass == models.TaxClassReduced {
+		return rates.Reduced, nil
+	}
+	return rates.Standard, nil
+}
+
+// VATRates liste les taux en vigueur par pays et par classe, surcharges comprises
+func VATRates() []models.TaxRate {
+	overrides := taxRateOverrides()
+	rates := make([]models.TaxRate, 0, len(euVATRates)*3)
+	for country := range euVATRates {
+		for _, class := range []string{models.TaxClassStandard, models.TaxClassReduced, models.TaxClassZero} {
+			rate, _ := VATRate(country, class)
+			_, override := overrides[country+"|"+class]
+			rates = append(rates, models.TaxRate{Country: country, TaxClass: class, Rate: rate, Override: override})
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Country != rates[j].Country {
+			return rates[i].Country < rates[j].Country
+		}
+		return rates[i].TaxClass < rates[j].TaxClass
+	})
+	return rates
+}
+
+// TaxCustomer décrit l'acheteur du point de vue de la TVA
+type TaxCustomer struct {
+	Country   string // Pays de livraison
+	VATNumber string // Numéro de TVA de la société (B2B), vide pour un particulier
+}
+
+// TaxableLine est une ligne à taxer, au prix du catalogue, remise déduite
+type TaxableLine struct {
+	ProductID   string
+	VariantID   string
+	Description string
+	TaxClass    string
+	Amount      models.Money
+}
+
+// TaxRegime détermine le régime applicable et le pays dont les taux s'appliquent
+func TaxRegime(customer TaxCustomer) (regime, rateCountry string) {
+	shop := ShopCountry()
+	country := normalizeCountry(customer.Country)
+	if country == "" {
+		country = shop
+	}
+
+	switch {
+	case country == shop:
+		return models.TaxRegimeDomestic, shop
+	case !IsEUCountry(country):
+		return models.TaxRegimeExport, shop
+	case customer.VATNumber != "":
+		// B2B : autoliquidation si la société est identifiée à la TVA dans un autre État membre
+		if VATNumberCountry(customer.VATNumber) == shop {
+			return models.TaxRegimeDomestic, shop
+		}
+		return models.TaxRegimeReverseCharge, shop
+	case ossEnabled():
+		return models.TaxRegimeOSS, country
+	default:
+		return models.TaxRegimeDomestic, shop
+	}
+}
+
+// ComputeTax calcule la TVA de chaque ligne et des frais de port.
+// Prix TTC : le prix payé par un particulier reste celui du catalogue, la TVA en est extraite au taux applicable ;
+// en autoliquidation ou à l'export, la TVA du pays de l'entreprise est retirée du prix.
+// Prix HT : la TVA est ajoutée au prix du catalogue.
+func ComputeTax(customer TaxCustomer, lines []TaxableLine, shipping models.Money) (*models.TaxSummary, error) {
+	regime, rateCountry := TaxRegime(customer)
+	summary := &models.TaxSummary{
+		Regime:           regime,
+		Country:          rateCountry,
+		PricesIncludeTax: PricesIncludeTax(),
+		Lines:            make([]models.TaxLine, 0, len(lines)),
+	}
+	// Le numéro de TVA du client (validé) figure sur la facture, même en régime domestique
+	summary.VATNumber = customer.VATNumber
+	if regime == models.TaxRegimeReverseCharge {
+		summary.Note = "Autoliquidation - article 196 de la directive 2006/112/CE"
+	} else if regime == models.TaxRegimeExport {
+		summary.Note = "Exonération de TVA - livraison hors UE (article 146 de la directive 2006/112/CE)"
+	}
+
+	for _, line := range lines {
+		taxLine, err := taxLine(regime, rateCountry, summary.PricesIncludeTax, line)
+		if err != nil {
+			return nil, err
+		}
+		summary.Lines = append(summary.Lines, taxLine)
+	}
+
+	if !shipping.IsZero() {
+		// Les frais de port suivent le taux normal du pays applicable
+		shippingLine, err := taxLine(regime, rateCountry, summary.PricesIncludeTax, TaxableLine{
+			Description: "Livraison",
+			TaxClass:    models.TaxClassStandard,
+			Amount:      shipping,
+		})
+		if err != nil {
+			return nil, err
+		}
+		summary.Shipping = &shippingLine
+	}
+
+	byRate := map[float64]*models.TaxRateTotal{}
+	add := func(l models.TaxLine) {
+		summary.NetTotal = summary.NetTotal.Add(l.NetAmount)
+		summary.TaxTotal = summary.TaxTotal.Add(l.TaxAmount)
+		summary.GrossTotal = summary.GrossTotal.Add(l.GrossAmount)
+		total, ok := byRate[l.Rate]
+		if !ok {
+			total = &models.TaxRateTotal{Rate: l.Rate}
+			byRate[l.Rate] = total
+		}
+		total.NetAmount = total.NetAmount.Add(l.NetAmount)
+		total.TaxAmount = total.TaxAmount.Add(l.TaxAmount)
+	}
+	for _, l := range summary.Lines {
+		add(l)
+	}
+	if summary.Shipping != nil {
+		add(*summary.Shipping)
+	}
+
+	for _, total := range byRate {
+		summary.Rates = append(summary.Rates, *total)
+	}
+	sort.Slice(summary.Rates, func(i, j int) bool { return summary.Rates[i].Rate > summary.Rates[j].Rate })
+
+	return summary, nil
+}
+
+func taxLine(regime, rateCountry string, pricesIncludeTax bool, line TaxableLine) (models.TaxLine, error) {
+	class := line.TaxClass
+	if class == "" {
+		class = models.TaxClassStandard
+	}
+
+	result := models.TaxLine{
+		ProductID:   line.ProductID,
+		VariantID:   line.VariantID,
+		Description: line.Description,
+		TaxClass:    class,
+	}
+
+	// Taux du pays de l'entreprise : inclus dans les prix TTC du catalogue
+	shopRate, err := VATRate(ShopCountry(), class)
+	if err != nil {
+		return result, err
+	}
+
+	exempt := regime == models.TaxRegimeReverseCharge || regime == models.TaxRegimeExport
+	switch {
+	case exempt && pricesIncludeTax:
+		result.NetAmount = extractNet(line.Amount, shopRate)
+	case exempt:
+		result.NetAmount = line.Amount
+	default:
+		if result.Rate, err = VATRate(rateCountry, class); err != nil {
+			return result, err
+		}
+		if pricesIncludeTax {
+			result.NetAmount = extractNet(line.Amount, result.Rate)
+			result.TaxAmount = line.Amount.Sub(result.NetAmount)
+		} else {
+			result.NetAmount = line.Amount
+			result.TaxAmount = line.Amount.Percent(result.Rate)
+		}
+	}
+
+	result.GrossAmount = result.NetAmount.Add(result.TaxAmount)
+	return result, nil
+}
+
+// extractNet retire la TVA d'un montant TTC, arrondi au centime
+func extractNet(gross models.Money, rate float64) models.Money {
+	net := int64(math.Round(float64(gross.Amount) * 100 / (100 + rate)))
+	return models.Money{Amount: net, Currency: gross.CurrencyCode()}
+}
+
+// ApplyOrderTax calcule la TVA de la commande et met à jour ses lignes, ses frais de port (TTC) et son total.
+// order.Subtotal, order.DiscountAmount et order.ShippingCost sont les montants au prix du catalogue ;
+// la remise est répartie sur les lignes au prorata.
+func ApplyOrderTax(order *models.Order, customer TaxCustomer) error {
+	lines := make([]TaxableLine, len(order.Items))
+	discounts := allocateDiscount(order)
+	for i, item := range order.Items {
+		name := item.Name
+		if name == "" {
+			name = item.ProductName
+		}
+		lines[i] = TaxableLine{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Description: name,
+			TaxClass:    item.TaxClass,
+			Amount:      models.MaxMoney(item.Price.Mul(item.Quantity).Sub(discounts[i]), models.Money{}),
+		}
+	}
+
+	summary, err := ComputeTax(customer, lines, order.ShippingCost)
+	if err != nil {
+		return err
+	}
+
+	for i, l := range summary.Lines {
+		order.Items[i].TaxClass = l.TaxClass
+		order.Items[i].TaxRate = l.Rate
+		order.Items[i].NetAmount = l.NetAmount
+		order.Items[i].TaxAmount = l.TaxAmount
+	}
+	if summary.Shipping != nil {
+		order.ShippingCost = summary.Shipping.GrossAmount
+	}
+	order.Tax = summary
+	order.TaxAmount = summary.TaxTotal
+	order.TotalPrice = summary.GrossTotal
+	return nil
+}
+
+// allocateDiscount répartit la remise de la commande sur ses lignes au prorata ; la dernière ligne absorbe l'arrondi
+func allocateDiscount(order *models.Order) []models.Money {
+	shares := make([]models.Money, len(order.Items))
+	if order.DiscountAmount.Amount <= 0 || order.Subtotal.Amount <= 0 || len(order.Items) == 0 {
+		return shares
+	}
+
+	discount := models.MinMoney(order.DiscountAmount, order.Subtotal)
+	var allocated int64
+	for i, item := range order.Items {
+		if i == len(order.Items)-1 {
+			shares[i] = models.Money{Amount: discount.Amount - allocated, Currency: discount.CurrencyCode()}
+			break
+		}
+		share := (discount.Amount*item.Price.Mul(item.Quantity).Amount + order.Subtotal.Amount/2) / order.Subtotal.Amount
+		shares[i] = models.Money{Amount: share, Currency: discount.CurrencyCode()}
+		allocated += share
+	}
+	return shares
+}
+
+// LoadTaxCustomer retrouve le numéro de TVA de la société de l'utilisateur.
+// Seul un numéro validé ouvre droit à l'autoliquidation ; un numéro en attente (VIES indisponible) ou jamais vérifié est revérifié.
+func LoadTaxCustomer(userID, country string) TaxCustomer {
+	customer := TaxCustomer{Country: country}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return customer
+	}
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return customer
+	}
+
+	var companyID *gocql.UUID
+	if err := session.Query("SELECT company_id FROM users WHERE user_id = ?", gocql.UUID(uid)).Scan(&companyID); err != nil || companyID == nil {
+		return customer
+	}
+
+	var vatNumber, vatStatus string
+	if err := session.Query("SELECT vat_number, vat_status FROM companies WHERE company_id = ?", *companyID).Scan(&vatNumber, &vatStatus); err != nil {
+		log.Printf("⚠️ Numéro de TVA de la société %s illisible: %v", companyID, err)
+		return customer
+	}
+	if vatNumber == "" {
+		return customer
+	}
+
+	if vatStatus == models.VATStatusPending || vatStatus == "" {
+		verification, err := VerifyVATNumber(vatNumber)
+		if err != nil {
+			return customer
+		}
+		if err := SaveCompanyVAT(*companyID, verification); err != nil {
+			log.Printf("⚠️ Statut TVA de la société %s non enregistré: %v", companyID, err)
+		}
+		vatStatus = verification.Status
+	}
+
+	if vatStatus == models.VATStatusValid {
+		customer.VATNumber = vatNumber
+	}
+	return customer
+}
+
+// VerifyVATNumber valide un numéro de TVA hors ligne (format, clé de contrôle) puis auprès de VIES.
+// Retourne une *VATNumberError si le numéro est invalide ; VIES injoignable laisse le numéro en attente.
+func VerifyVATNumber(vatNumber string) (*models.VATVerification, error) {
+	normalized, err := ValidateVATNumber(vatNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &models.VATVerification{
+		VATNumber: normalized,
+		Status:    models.VATStatusValid,
+		CheckedAt: time.Now(),
+	}
+
+	result, err := CheckVATWithVIES(normalized)
+	switch {
+	case err != nil:
+		verification.Status = models.VATStatusPending
+	case result == nil:
+		// Vérification en ligne désactivée (VIES_MODE=off) : la validation hors ligne fait foi
+	case !result.Valid:
+		return nil, &VATNumberError{Message: "Numéro de TVA inconnu ou inactif dans VIES"}
+	default:
+		verification.Name = result.Name
+	}
+	return verification, nil
+}
+
+// SaveCompanyVAT enregistre le numéro de TVA d'une société et le résultat de sa vérification (nil : supprime le numéro)
+func SaveCompanyVAT(companyID gocql.UUID, verification *models.VATVerification) error {
+	session, err := database.GetUsersSession()
+	if err != nil {
+		return err
+	}
+	if verification == nil {
+		return session.Query(`UPDATE companies SET vat_number = ?, vat_status = ?, vat_checked_at = ?, vat_registered_name = ?
+			WHERE company_id = ?`, "", "", nil, "", companyID).Exec()
+	}
+	return session.Query(`UPDATE companies SET vat_number = ?, vat_status = ?, vat_checked_at = ?, vat_registered_name = ?
+		WHERE company_id = ?`, verification.VATNumber, verification.Status, verification.CheckedAt, verification.Name, companyID).Exec()
+}
+
+// NormalizeVATNumber met un numéro de TVA au format compact (BE0123456789)
+func NormalizeVATNumber(vatNumber string) string {
+	replacer := strings.NewReplacer(" ", "", ".", "", "-", "")
+	return strings.ToUpper(replacer.Replace(strings.TrimSpace(vatNumber)))
+}
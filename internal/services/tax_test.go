@@ -0,0 +1,250 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"testing"
+)
+
+// Entreprise belge, prix du catalogue TTC, guichet OSS actif
+func setTaxEnv(t *testing.T, pricesIncludeTax, oss string) {
+	t.Helper()
+	t.Setenv("COMPANY_COUNTRY", "BE")
+	t.Setenv("PRICES_INCLUDE_TAX", pricesIncludeTax)
+	t.Setenv("TAX_OSS_ENABLED", oss)
+	t.Setenv("SCYLLA_KS_ORDERS_KEYSPACE", "") // Pas de surcharge tax_rates : taux par défaut
+	InvalidateTaxRates()
+}
+
+func TestTaxRegime(t *testing.T) {
+	tests := []struct {
+		name        string
+		oss         string
+		customer    TaxCustomer
+		regime      string
+		rateCountry string
+	}{
+		{"particulier belge", "true", TaxCustomer{Country: "BE"}, models.TaxRegimeDomestic, "BE"},
+		{"pays non renseigné", "true", TaxCustomer{}, models.TaxRegimeDomestic, "BE"},
+		{"particulier français (OSS)", "true", TaxCustomer{Country: "fr"}, models.TaxRegimeOSS, "FR"},
+		{"particulier français sous le seuil OSS", "false", TaxCustomer{Country: "FR"}, models.TaxRegimeDomestic, "BE"},
+		{"société allemande", "true", TaxCustomer{Country: "DE", VATNumber: "DE136695976"}, models.TaxRegimeReverseCharge, "BE"},
+		{"société belge livrée en Allemagne", "true", TaxCustomer{Country: "DE", VATNumber: "BE0477472701"}, models.TaxRegimeDomestic, "BE"},
+		{"société grecque (EL)", "true", TaxCustomer{Country: "GR", VATNumber: "EL094259216"}, models.TaxRegimeReverseCharge, "BE"},
+		{"export hors UE", "true", TaxCustomer{Country: "US"}, models.TaxRegimeExport, "BE"},
+		{"export hors UE avec numéro", "true", TaxCustomer{Country: "CH", VATNumber: "CHE123456789"}, models.TaxRegimeExport, "BE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTaxEnv(t, "true", tt.oss)
+			regime, rateCountry := TaxRegime(tt.customer)
+			if regime != tt.regime || rateCountry != tt.rateCountry {
+				t.Errorf("TaxRegime(%+v) = %s, %s ; attendu %s, %s", tt.customer, regime, rateCountry, tt.regime, tt.rateCountry)
+			}
+		})
+	}
+}
+
+func TestVATRate(t *testing.T) {
+	setTaxEnv(t, "true", "true")
+
+	tests := []struct {
+		country, class string
+		rate           float64
+	}{
+		{"BE", models.TaxClassStandard, 21},
+		{"BE", "", 21},
+		{"BE", models.TaxClassReduced, 6},
+		{"BE", models.TaxClassZero, 0},
+		{"EL", models.TaxClassStandard, 24},
+		{"fi", models.TaxClassStandard, 25.5},
+	}
+	for _, tt := range tests {
+		rate, err := VATRate(tt.country, tt.class)
+		if err != nil || rate != tt.rate {
+			t.Errorf("VATRate(%s, %s) = %v, %v ; attendu %v", tt.country, tt.class, rate, err, tt.rate)
+		}
+	}
+
+	if _, err := VATRate("US", models.TaxClassStandard); err == nil {
+		t.Error("VATRate(US) devrait échouer")
+	}
+}
+
+func TestComputeTax(t *testing.T) {
+	tests := []struct {
+		name             string
+		pricesIncludeTax string
+		customer         TaxCustomer
+		line             TaxableLine
+		rate             float64
+		net, tax, gross  int64
+	}{
+		{
+			name:             "domestique TTC",
+			pricesIncludeTax: "true",
+			customer:         TaxCustomer{Country: "BE"},
+			line:             TaxableLine{Amount: models.Cents(12100)},
+			rate:             21, net: 10000, tax: 2100, gross: 12100,
+		},
+		{
+			name:             "domestique TTC taux réduit",
+			pricesIncludeTax: "true",
+			customer:         TaxCustomer{Country: "BE"},
+			line:             TaxableLine{TaxClass: models.TaxClassReduced, Amount: models.Cents(1999)},
+			rate:             6, net: 1886, tax: 113, gross: 1999,
+		},
+		{
+			name:             "OSS TTC : le prix payé reste celui du catalogue",
+			pricesIncludeTax: "true",
+			customer:         TaxCustomer{Country: "FR"},
+			line:             TaxableLine{Amount: models.Cents(12100)},
+			rate:             20, net: 10083, tax: 2017, gross: 12100,
+		},
+		{
+			name:             "autoliquidation TTC : la TVA belge est retirée",
+			pricesIncludeTax: "true",
+			customer:         TaxCustomer{Country: "DE", VATNumber: "DE136695976"},
+			line:             TaxableLine{Amount: models.Cents(12100)},
+			rate:             0, net: 10000, tax: 0, gross: 10000,
+		},
+		{
+			name:             "export TTC",
+			pricesIncludeTax: "true",
+			customer:         TaxCustomer{Country: "US"},
+			line:             TaxableLine{TaxClass: models.TaxClassReduced, Amount: models.Cents(10600)},
+			rate:             0, net: 10000, tax: 0, gross: 10000,
+		},
+		{
+			name:             "domestique HT",
+			pricesIncludeTax: "false",
+			customer:         TaxCustomer{Country: "BE"},
+			line:             TaxableLine{Amount: models.Cents(10000)},
+			rate:             21, net: 10000, tax: 2100, gross: 12100,
+		},
+		{
+			name:             "autoliquidation HT",
+			pricesIncludeTax: "false",
+			customer:         TaxCustomer{Country: "NL", VATNumber: "NL123456789B01"},
+			line:             TaxableLine{Amount: models.Cents(10000)},
+			rate:             0, net: 10000, tax: 0, gross: 10000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTaxEnv(t, tt.pricesIncludeTax, "true")
+			summary, err := ComputeTax(tt.customer, []TaxableLine{tt.line}, models.Money{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := summary.Lines[0]
+			if l.Rate != tt.rate || l.NetAmount.Amount != tt.net || l.TaxAmount.Amount != tt.tax || l.GrossAmount.Amount != tt.gross {
+				t.Errorf("ligne = taux %v, HT %s, TVA %s, TTC %s ; attendu taux %v, HT %d, TVA %d, TTC %d",
+					l.Rate, l.NetAmount, l.TaxAmount, l.GrossAmount, tt.rate, tt.net, tt.tax, tt.gross)
+			}
+			if summary.GrossTotal.Amount != tt.gross || summary.NetTotal.Add(summary.TaxTotal) != summary.GrossTotal {
+				t.Errorf("totaux = HT %s, TVA %s, TTC %s", summary.NetTotal, summary.TaxTotal, summary.GrossTotal)
+			}
+		})
+	}
+}
+
+func TestComputeTaxRatesAndNotes(t *testing.T) {
+	setTaxEnv(t, "true", "true")
+
+	lines := []TaxableLine{
+		{ProductID: "ebook", Amount: models.Cents(12100)},
+		{ProductID: "book", TaxClass: models.TaxClassReduced, Amount: models.Cents(10600)},
+		{ProductID: "book2", TaxClass: models.TaxClassReduced, Amount: models.Cents(5300)},
+	}
+	summary, err := ComputeTax(TaxCustomer{Country: "BE"}, lines, models.Cents(605))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Shipping == nil || summary.Shipping.Rate != 21 || summary.Shipping.NetAmount.Amount != 500 {
+		t.Fatalf("frais de port = %+v, attendu 5.00 HT à 21 %%", summary.Shipping)
+	}
+	if len(summary.Rates) != 2 || summary.Rates[0].Rate != 21 || summary.Rates[1].Rate != 6 {
+		t.Fatalf("récapitulatif = %+v, attendu 21 %% puis 6 %%", summary.Rates)
+	}
+	if summary.Rates[0].NetAmount.Amount != 10500 || summary.Rates[0].TaxAmount.Amount != 2205 {
+		t.Errorf("21 %% = HT %s, TVA %s ; attendu 105.00, 22.05", summary.Rates[0].NetAmount, summary.Rates[0].TaxAmount)
+	}
+	if summary.Rates[1].NetAmount.Amount != 15000 || summary.Rates[1].TaxAmount.Amount != 900 {
+		t.Errorf("6 %% = HT %s, TVA %s ; attendu 150.00, 9.00", summary.Rates[1].NetAmount, summary.Rates[1].TaxAmount)
+	}
+	if summary.GrossTotal.Amount != 28605 || summary.Note != "" {
+		t.Errorf("total = %s, mention %q", summary.GrossTotal, summary.Note)
+	}
+
+	reverse, err := ComputeTax(TaxCustomer{Country: "DE", VATNumber: "DE136695976"}, lines[:1], models.Money{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reverse.Note == "" || reverse.VATNumber != "DE136695976" || reverse.Shipping != nil {
+		t.Errorf("autoliquidation = mention %q, numéro %q, port %+v", reverse.Note, reverse.VATNumber, reverse.Shipping)
+	}
+}
+
+func TestApplyOrderTaxAllocatesDiscount(t *testing.T) {
+	setTaxEnv(t, "true", "true")
+
+	order := &models.Order{
+		Items: []models.OrderItem{
+			{ProductID: "a", Name: "A", Price: models.Cents(5000), Quantity: 2},
+			{ProductID: "b", Name: "B", Price: models.Cents(10000), Quantity: 1, TaxClass: models.TaxClassReduced},
+		},
+		Subtotal:       models.Cents(20000),
+		DiscountAmount: models.Cents(1001),
+		ShippingCost:   models.Cents(605),
+	}
+	if err := ApplyOrderTax(order, TaxCustomer{Country: "BE"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remise répartie au prorata : 5.01 sur A, le reste (5.00) sur B
+	lines := order.Tax.Lines
+	if lines[0].GrossAmount.Amount != 9499 || lines[1].GrossAmount.Amount != 9500 {
+		t.Errorf("lignes TTC = %s, %s ; attendu 94.99, 95.00", lines[0].GrossAmount, lines[1].GrossAmount)
+	}
+	if order.Items[0].TaxRate != 21 || order.Items[1].TaxRate != 6 || order.Items[0].TaxClass != models.TaxClassStandard {
+		t.Errorf("taux des lignes = %+v", order.Items)
+	}
+	if order.TotalPrice.Amount != 20000-1001+605 {
+		t.Errorf("total = %s, attendu 196.04", order.TotalPrice)
+	}
+	if order.TaxAmount != order.Tax.TaxTotal || order.ShippingCost.Amount != 605 {
+		t.Errorf("TVA = %s, port = %s", order.TaxAmount, order.ShippingCost)
+	}
+}
+
+func TestAllocateDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		prices   []int64
+		discount int64
+		want     []int64
+	}{
+		{"sans remise", []int64{1000, 2000}, 0, []int64{0, 0}},
+		{"trois tiers", []int64{1000, 1000, 1000}, 1000, []int64{333, 333, 334}},
+		{"remise supérieure au sous-total", []int64{1000, 500}, 5000, []int64{1000, 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{DiscountAmount: models.Cents(tt.discount)}
+			for _, price := range tt.prices {
+				order.Items = append(order.Items, models.OrderItem{Price: models.Cents(price), Quantity: 1})
+				order.Subtotal = order.Subtotal.Add(models.Cents(price))
+			}
+			shares := allocateDiscount(order)
+			for i, share := range shares {
+				if share.Amount != tt.want[i] {
+					t.Errorf("part %d = %d, attendu %d", i, share.Amount, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,711 @@
+package services
+
+import (
+	"cedra_back_end/internal/models"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identifiants Peppol BIS Billing 3.0 (UBL 2.1)
+const (
+	peppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	peppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+
+	ublInvoiceNS    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCreditNoteNS = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	ublCacNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCbcNS        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// Catégories de TVA UNCL5305 utilisées par Cedra
+const (
+	ublCategoryStandard      = "S"
+	ublCategoryZero          = "Z"
+	ublCategoryReverseCharge = "AE"
+	ublCategoryExport        = "G"
+)
+
+// ErrNotB2BInvoice : la facture d'un particulier n'est pas exportée en facture électronique
+var ErrNotB2BInvoice = errors.New("facture électronique réservée aux commandes des comptes société")
+
+// UBLValidationError liste les règles Peppol BIS / EN 16931 non respectées par un document
+type UBLValidationError struct {
+	Violations []string
+}
+
+func (e *UBLValidationError) Error() string {
+	return "document UBL non conforme : " + strings.Join(e.Violations, " ; ")
+}
+
+// ublParty est le vendeur ou l'acheteur d'un document UBL (champs structurés, avant sérialisation)
+type ublParty struct {
+	EndpointScheme string
+	EndpointID     string
+	Name           string
+	Street         string
+	City           string
+	PostalCode     string
+	Country        string
+	VATNumber      string
+	LegalScheme    string
+	LegalID        string
+	Email          string
+}
+
+type ublLine struct {
+	ID           string
+	Name         string
+	SellerItemID string
+	Quantity     int
+	Net          models.Money
+	Tax          models.Money
+	Category     string
+	Rate         float64
+}
+
+type ublTaxSubtotal struct {
+	Category        string
+	Rate            float64
+	Taxable         models.Money
+	Tax             models.Money
+	ExemptionCode   string
+	ExemptionReason string
+}
+
+// ublDocument est une facture ou une note de crédit prête à être validée puis sérialisée.
+// Les montants d'une note de crédit UBL sont positifs (c'est le type de document qui porte le signe).
+type ublDocument struct {
+	CreditNote       bool
+	Number           string
+	IssueDate        time.Time
+	DueDate          *time.Time // Factures payables sur facture (compte société)
+	PaymentTerms     string
+	Currency         string
+	Note             string
+	AccountingCost   string // Centre de coût de l'acheteur (BT-19)
+	BuyerReference   string
+	OrderReference   string // Bon de commande de l'acheteur (BT-13), à défaut la commande
+	BillingReference string
+	BillingDate      time.Time
+	Seller           ublParty
+	Buyer            ublParty
+	PaymentID        string
+	IBAN             string
+	BIC              string
+	Lines            []ublLine
+	Subtotals        []ublTaxSubtotal
+	LineTotal        models.Money
+	TaxExclusive     models.Money
+	TaxTotal         models.Money
+	TaxInclusive     models.Money
+	Prepaid          models.Money
+	Payable          models.Money
+}
+
+// InvoiceUBL exporte une facture au format UBL 2.1 / Peppol BIS Billing 3.0 (comptes société uniquement)
+func InvoiceUBL(inv *models.Invoice) ([]byte, error) {
+	buyerEndpoint, err := invoiceBuyerEndpoint(inv.UserID, inv.Buyer)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := invoiceUBLDocument(inv, buyerEndpoint)
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+	return doc.marshal()
+}
+
+// invoiceUBLDocument prépare la facture UBL ; buyerEndpoint est l'identifiant Peppol de l'acheteur (schéma:valeur)
+func invoiceUBLDocument(inv *models.Invoice, buyerEndpoint string) *ublDocument {
+	doc := &ublDocument{
+		Number:         inv.Number,
+		IssueDate:      inv.IssuedAt,
+		Currency:       inv.GrossTotal.CurrencyCode(),
+		Note:           inv.TaxNote,
+		AccountingCost: inv.CostCenter,
+		BuyerReference: inv.OrderID.String(),
+		OrderReference: inv.OrderID.String(),
+		Seller:         sellerUBLParty(inv.Seller),
+		Buyer:          buyerUBLParty(inv.Buyer, buyerEndpoint),
+		PaymentID:      inv.PaymentReference,
+		IBAN:           inv.IBAN,
+		BIC:            inv.BIC,
+		DueDate:        inv.DueDate,
+	}
+	if inv.PONumber != "" {
+		doc.OrderReference = inv.PONumber
+	}
+	if inv.PaymentTermsDays > 0 {
+		doc.PaymentTerms = fmt.Sprintf("Paiement à %d jours", inv.PaymentTermsDays)
+	}
+	doc.Lines = ublLines(inv.Lines, inv.TaxRegime, false)
+	doc.finalizeTotals()
+	if inv.PaidAt != nil {
+		doc.Prepaid = doc.TaxInclusive
+	}
+	doc.Payable = doc.TaxInclusive.Sub(doc.Prepaid)
+	return doc
+}
+
+// CreditNoteUBL exporte une note de crédit au format UBL 2.1 / Peppol BIS Billing 3.0, avec la facture d'origine en référence
+func CreditNoteUBL(note *models.CreditNote) ([]byte, error) {
+	buyerEndpoint, err := invoiceBuyerEndpoint(note.UserID, note.Buyer)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := creditNoteUBLDocument(note, buyerEndpoint)
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+	return doc.marshal()
+}
+
+// creditNoteUBLDocument prépare la note de crédit UBL ; buyerEndpoint est l'identifiant Peppol de l'acheteur
+func creditNoteUBLDocument(note *models.CreditNote, buyerEndpoint string) *ublDocument {
+	doc := &ublDocument{
+		CreditNote:       true,
+		Number:           note.Number,
+		IssueDate:        note.IssuedAt,
+		Currency:         note.GrossTotal.CurrencyCode(),
+		Note:             strings.TrimSpace(note.TaxNote + " " + note.Reason),
+		BuyerReference:   note.OrderID.String(),
+		OrderReference:   note.OrderID.String(),
+		BillingReference: note.InvoiceNumber,
+		BillingDate:      note.InvoiceDate,
+		Seller:           sellerUBLParty(note.Seller),
+		Buyer:            buyerUBLParty(note.Buyer, buyerEndpoint),
+	}
+	doc.Lines = ublLines(note.Lines, note.TaxRegime, true)
+	doc.finalizeTotals()
+	doc.Payable = doc.TaxInclusive
+	return doc
+}
+
+// ublLines convertit les lignes figées (négatives sur une note de crédit : negate les remet en positif)
+func ublLines(lines []models.InvoiceLine, regime string, negate bool) []ublLine {
+	result := make([]ublLine, 0, len(lines))
+	for i, line := range lines {
+		net, tax := line.NetAmount, line.TaxAmount
+		if negate {
+			net = models.Money{Amount: -net.Amount, Currency: net.CurrencyCode()}
+			tax = models.Money{Amount: -tax.Amount, Currency: tax.CurrencyCode()}
+		}
+		quantity := line.Quantity
+		if quantity <= 0 {
+			quantity = 1
+		}
+		result = append(result, ublLine{
+			ID:           strconv.Itoa(i + 1),
+			Name:         line.Description,
+			SellerItemID: line.ProductID,
+			Quantity:     quantity,
+			Net:          net,
+			Tax:          tax,
+			Category:     ublTaxCategory(regime, line.TaxRate),
+			Rate:         line.TaxRate,
+		})
+	}
+	return result
+}
+
+// ublTaxCategory déduit la catégorie UNCL5305 du régime de TVA et du taux de la ligne
+func ublTaxCategory(regime string, rate float64) string {
+	switch {
+	case regime == models.TaxRegimeReverseCharge:
+		return ublCategoryReverseCharge
+	case regime == models.TaxRegimeExport:
+		return ublCategoryExport
+	case rate > 0:
+		return ublCategoryStandard
+	default:
+		return ublCategoryZero
+	}
+}
+
+// finalizeTotals calcule le récapitulatif par catégorie et taux, et les totaux du document
+func (d *ublDocument) finalizeTotals() {
+	type key struct {
+		category string
+		rate     float64
+	}
+	byKey := map[key]*ublTaxSubtotal{}
+	keys := []key{}
+	for _, line := range d.Lines {
+		k := key{line.Category, line.Rate}
+		subtotal, ok := byKey[k]
+		if !ok {
+			subtotal = &ublTaxSubtotal{Category: line.Category, Rate: line.Rate}
+			switch line.Category {
+			case ublCategoryReverseCharge:
+				subtotal.ExemptionCode, subtotal.ExemptionReason = "VATEX-EU-AE", "Autoliquidation"
+			case ublCategoryExport:
+				subtotal.ExemptionCode, subtotal.ExemptionReason = "VATEX-EU-G", "Exportation hors Union européenne"
+			}
+			byKey[k] = subtotal
+			keys = append(keys, k)
+		}
+		subtotal.Taxable = subtotal.Taxable.Add(line.Net)
+		subtotal.Tax = subtotal.Tax.Add(line.Tax)
+		d.LineTotal = d.LineTotal.Add(line.Net)
+		d.TaxTotal = d.TaxTotal.Add(line.Tax)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].rate > keys[j].rate })
+	for _, k := range keys {
+		d.Subtotals = append(d.Subtotals, *byKey[k])
+	}
+	d.TaxExclusive = d.LineTotal
+	d.TaxInclusive = d.TaxExclusive.Add(d.TaxTotal)
+}
+
+var (
+	ublVATNumberPattern = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*.]{2,13}$`)
+	ublCountryPattern   = regexp.MustCompile(`^[A-Z]{2}$`)
+	ublCurrencyPattern  = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// validate contrôle les règles métier EN 16931 et Peppol BIS Billing 3.0 applicables aux documents de Cedra
+// (le document ne comporte ni remises ni frais au niveau du document : elles sont réparties sur les lignes)
+func (d *ublDocument) validate() error {
+	var violations []string
+	check := func(ok bool, rule, message string) {
+		if !ok {
+			violations = append(violations, rule+" "+message)
+		}
+	}
+
+	check(d.Number != "", "BR-02", "numéro de document manquant")
+	check(!d.IssueDate.IsZero(), "BR-03", "date d'émission manquante")
+	check(ublCurrencyPattern.MatchString(d.Currency), "BR-05", "devise invalide")
+	check(d.Seller.Name != "", "BR-06", "raison sociale du vendeur manquante")
+	check(d.Buyer.Name != "", "BR-07", "nom de l'acheteur manquant")
+	check(ublCountryPattern.MatchString(d.Seller.Country), "BR-09", "pays du vendeur manquant")
+	check(ublCountryPattern.MatchString(d.Buyer.Country), "BR-11", "pays de l'acheteur manquant")
+	check(len(d.Lines) > 0, "BR-16", "aucune ligne")
+	check(d.BuyerReference != "" || d.OrderReference != "", "PEPPOL-EN16931-R003", "référence acheteur ou commande manquante")
+	check(d.Seller.EndpointID != "" && d.Seller.EndpointScheme != "", "PEPPOL-EN16931-R020", "identifiant électronique du vendeur manquant")
+	check(d.Buyer.EndpointID != "" && d.Buyer.EndpointScheme != "", "PEPPOL-EN16931-R010", "identifiant électronique de l'acheteur manquant")
+	check(d.Seller.VATNumber == "" || ublVATNumberPattern.MatchString(d.Seller.VATNumber), "BR-CO-09", "numéro de TVA du vendeur sans préfixe pays")
+	check(d.Buyer.VATNumber == "" || ublVATNumberPattern.MatchString(d.Buyer.VATNumber), "BR-CO-09", "numéro de TVA de l'acheteur sans préfixe pays")
+	if d.CreditNote {
+		check(d.BillingReference != "", "BR-55", "facture d'origine non référencée")
+	}
+
+	lineTotal := models.Money{}
+	for _, line := range d.Lines {
+		check(line.ID != "", "BR-21", "identifiant de ligne manquant")
+		check(line.Quantity > 0, "BR-22", "quantité manquante (ligne "+line.ID+")")
+		check(line.Name != "", "BR-25", "désignation manquante (ligne "+line.ID+")")
+		check(line.Net.Amount >= 0, "BR-27", "prix net négatif (ligne "+line.ID+")")
+		switch line.Category {
+		case ublCategoryStandard:
+			check(line.Rate > 0, "BR-S-05", "taux de TVA nul en catégorie S (ligne "+line.ID+")")
+		case ublCategoryZero, ublCategoryReverseCharge, ublCategoryExport:
+			check(line.Rate == 0, "BR-"+line.Category+"-05", "taux de TVA non nul (ligne "+line.ID+")")
+		}
+		lineTotal = lineTotal.Add(line.Net)
+	}
+	check(lineTotal.Amount == d.LineTotal.Amount, "BR-CO-10", "total des lignes incohérent")
+	check(d.TaxExclusive.Amount == d.LineTotal.Amount, "BR-CO-13", "total HT incohérent")
+	check(d.TaxInclusive.Amount == d.TaxExclusive.Add(d.TaxTotal).Amount, "BR-CO-15", "total TTC incohérent")
+	check(d.Payable.Amount == d.TaxInclusive.Sub(d.Prepaid).Amount, "BR-CO-16", "montant à payer incohérent")
+
+	check(len(d.Subtotals) > 0, "BR-CO-18", "récapitulatif de TVA manquant")
+	taxTotal := models.Money{}
+	for _, subtotal := range d.Subtotals {
+		label := fmt.Sprintf("%s %g %%", subtotal.Category, subtotal.Rate)
+		taxable := models.Money{}
+		for _, line := range d.Lines {
+			if line.Category == subtotal.Category && line.Rate == subtotal.Rate {
+				taxable = taxable.Add(line.Net)
+			}
+		}
+		check(taxable.Amount == subtotal.Taxable.Amount, "BR-"+subtotal.Category+"-08", "base imposable incohérente ("+label+")")
+		expected := int64(math.Round(float64(subtotal.Taxable.Amount) * subtotal.Rate / 100))
+		check(abs64(subtotal.Tax.Amount-expected) <= 100, "BR-CO-17", "montant de TVA incohérent ("+label+")")
+
+		switch subtotal.Category {
+		case ublCategoryStandard:
+			check(d.Seller.VATNumber != "", "BR-S-02", "numéro de TVA du vendeur manquant")
+		case ublCategoryReverseCharge:
+			check(d.Seller.VATNumber != "" && d.Buyer.VATNumber != "", "BR-AE-02", "numéros de TVA du vendeur et de l'acheteur requis")
+			check(subtotal.Tax.IsZero(), "BR-AE-09", "TVA non nulle en autoliquidation")
+			check(subtotal.ExemptionReason != "" || subtotal.ExemptionCode != "", "BR-AE-10", "motif d'exonération manquant")
+		case ublCategoryExport:
+			check(d.Seller.VATNumber != "", "BR-G-02", "numéro de TVA du vendeur manquant")
+			check(subtotal.Tax.IsZero(), "BR-G-09", "TVA non nulle à l'exportation")
+			check(subtotal.ExemptionReason != "" || subtotal.ExemptionCode != "", "BR-G-10", "motif d'exonération manquant")
+		}
+		taxTotal = taxTotal.Add(subtotal.Tax)
+	}
+	check(taxTotal.Amount == d.TaxTotal.Amount, "BR-CO-14", "total de TVA incohérent")
+
+	if len(violations) > 0 {
+		return &UBLValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// =========================
+// Sérialisation XML (UBL 2.1)
+// =========================
+
+type ublXMLDocument struct {
+	XMLName            xml.Name
+	Xmlns              string              `xml:"xmlns,attr"`
+	Cac                string              `xml:"xmlns:cac,attr"`
+	Cbc                string              `xml:"xmlns:cbc,attr"`
+	CustomizationID    string              `xml:"cbc:CustomizationID"`
+	ProfileID          string              `xml:"cbc:ProfileID"`
+	ID                 string              `xml:"cbc:ID"`
+	IssueDate          string              `xml:"cbc:IssueDate"`
+	DueDate            string              `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode    string              `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string              `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note               string              `xml:"cbc:Note,omitempty"`
+	Currency           string              `xml:"cbc:DocumentCurrencyCode"`
+	AccountingCost     string              `xml:"cbc:AccountingCost,omitempty"`
+	BuyerReference     string              `xml:"cbc:BuyerReference,omitempty"`
+	OrderReference     *ublXMLIdentifier   `xml:"cac:OrderReference"`
+	BillingReference   *ublXMLBillingRef   `xml:"cac:BillingReference"`
+	Supplier           ublXMLPartyWrapper  `xml:"cac:AccountingSupplierParty"`
+	Customer           ublXMLPartyWrapper  `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans       *ublXMLPaymentMeans `xml:"cac:PaymentMeans"`
+	PaymentTerms       *ublXMLNote         `xml:"cac:PaymentTerms"`
+	TaxTotal           ublXMLTaxTotal      `xml:"cac:TaxTotal"`
+	MonetaryTotal      ublXMLMonetaryTotal `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines       []ublXMLLine        `xml:"cac:InvoiceLine"`
+	CreditNoteLines    []ublXMLLine        `xml:"cac:CreditNoteLine"`
+}
+
+type ublXMLNote struct {
+	Note string `xml:"cbc:Note"`
+}
+
+type ublXMLIdentifier struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublXMLSchemeID struct {
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type ublXMLBillingRef struct {
+	InvoiceDocumentReference struct {
+		ID        string `xml:"cbc:ID"`
+		IssueDate string `xml:"cbc:IssueDate,omitempty"`
+	} `xml:"cac:InvoiceDocumentReference"`
+}
+
+type ublXMLAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublXMLQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    int    `xml:",chardata"`
+}
+
+type ublXMLPartyWrapper struct {
+	Party ublXMLParty `xml:"cac:Party"`
+}
+
+type ublXMLParty struct {
+	EndpointID ublXMLSchemeID `xml:"cbc:EndpointID"`
+	PartyName  struct {
+		Name string `xml:"cbc:Name"`
+	} `xml:"cac:PartyName"`
+	PostalAddress struct {
+		StreetName string `xml:"cbc:StreetName,omitempty"`
+		CityName   string `xml:"cbc:CityName,omitempty"`
+		PostalZone string `xml:"cbc:PostalZone,omitempty"`
+		Country    struct {
+			IdentificationCode string `xml:"cbc:IdentificationCode"`
+		} `xml:"cac:Country"`
+	} `xml:"cac:PostalAddress"`
+	PartyTaxScheme *ublXMLPartyTaxScheme `xml:"cac:PartyTaxScheme"`
+	LegalEntity    struct {
+		RegistrationName string          `xml:"cbc:RegistrationName"`
+		CompanyID        *ublXMLSchemeID `xml:"cbc:CompanyID"`
+	} `xml:"cac:PartyLegalEntity"`
+	Contact *struct {
+		ElectronicMail string `xml:"cbc:ElectronicMail"`
+	} `xml:"cac:Contact"`
+}
+
+type ublXMLPartyTaxScheme struct {
+	CompanyID string           `xml:"cbc:CompanyID"`
+	TaxScheme ublXMLIdentifier `xml:"cac:TaxScheme"`
+}
+
+type ublXMLPaymentMeans struct {
+	Code      string `xml:"cbc:PaymentMeansCode"`
+	PaymentID string `xml:"cbc:PaymentID,omitempty"`
+	Account   *struct {
+		ID     string            `xml:"cbc:ID"`
+		Branch *ublXMLIdentifier `xml:"cac:FinancialInstitutionBranch"`
+	} `xml:"cac:PayeeFinancialAccount"`
+}
+
+type ublXMLTaxCategory struct {
+	ID                  string           `xml:"cbc:ID"`
+	Percent             string           `xml:"cbc:Percent"`
+	ExemptionReasonCode string           `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	ExemptionReason     string           `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme           ublXMLIdentifier `xml:"cac:TaxScheme"`
+}
+
+type ublXMLTaxTotal struct {
+	TaxAmount ublXMLAmount `xml:"cbc:TaxAmount"`
+	Subtotals []struct {
+		TaxableAmount ublXMLAmount      `xml:"cbc:TaxableAmount"`
+		TaxAmount     ublXMLAmount      `xml:"cbc:TaxAmount"`
+		Category      ublXMLTaxCategory `xml:"cac:TaxCategory"`
+	} `xml:"cac:TaxSubtotal"`
+}
+
+type ublXMLMonetaryTotal struct {
+	LineExtension ublXMLAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusive  ublXMLAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusive  ublXMLAmount  `xml:"cbc:TaxInclusiveAmount"`
+	Prepaid       *ublXMLAmount `xml:"cbc:PrepaidAmount"`
+	Payable       ublXMLAmount  `xml:"cbc:PayableAmount"`
+}
+
+type ublXMLLine struct {
+	ID               string          `xml:"cbc:ID"`
+	InvoicedQuantity *ublXMLQuantity `xml:"cbc:InvoicedQuantity"`
+	CreditedQuantity *ublXMLQuantity `xml:"cbc:CreditedQuantity"`
+	LineExtension    ublXMLAmount    `xml:"cbc:LineExtensionAmount"`
+	Item             struct {
+		Name               string            `xml:"cbc:Name"`
+		SellersItem        *ublXMLIdentifier `xml:"cac:SellersItemIdentification"`
+		ClassifiedCategory ublXMLTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+	} `xml:"cac:Item"`
+	Price struct {
+		Amount       ublXMLAmount    `xml:"cbc:PriceAmount"`
+		BaseQuantity *ublXMLQuantity `xml:"cbc:BaseQuantity"`
+	} `xml:"cac:Price"`
+}
+
+func (d *ublDocument) amount(m models.Money) ublXMLAmount {
+	return ublXMLAmount{Currency: d.Currency, Value: m.String()}
+}
+
+func ublPercent(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+func (d *ublDocument) marshal() ([]byte, error) {
+	out := ublXMLDocument{
+		XMLName:         xml.Name{Local: "Invoice"},
+		Xmlns:           ublInvoiceNS,
+		Cac:             ublCacNS,
+		Cbc:             ublCbcNS,
+		CustomizationID: peppolCustomizationID,
+		ProfileID:       peppolProfileID,
+		ID:              d.Number,
+		IssueDate:       d.IssueDate.Format("2006-01-02"),
+		Note:            d.Note,
+		Currency:        d.Currency,
+		AccountingCost:  d.AccountingCost,
+		BuyerReference:  d.BuyerReference,
+		Supplier:        ublXMLPartyWrapper{Party: d.Seller.xml()},
+		Customer:        ublXMLPartyWrapper{Party: d.Buyer.xml()},
+	}
+	if d.CreditNote {
+		out.XMLName.Local = "CreditNote"
+		out.Xmlns = ublCreditNoteNS
+		out.CreditNoteTypeCode = "381"
+		out.BillingReference = &ublXMLBillingRef{}
+		out.BillingReference.InvoiceDocumentReference.ID = d.BillingReference
+		if !d.BillingDate.IsZero() {
+			out.BillingReference.InvoiceDocumentReference.IssueDate = d.BillingDate.Format("2006-01-02")
+		}
+	} else {
+		out.InvoiceTypeCode = "380"
+		if d.DueDate != nil {
+			out.DueDate = d.DueDate.Format("2006-01-02")
+		}
+	}
+	if d.PaymentTerms != "" {
+		out.PaymentTerms = &ublXMLNote{Note: d.PaymentTerms}
+	}
+	if d.OrderReference != "" {
+		out.OrderReference = &ublXMLIdentifier{ID: d.OrderReference}
+	}
+
+	// Virement SEPA (code 58) avec la communication de la facture
+	if d.IBAN != "" {
+		out.PaymentMeans = &ublXMLPaymentMeans{Code: "58", PaymentID: d.PaymentID}
+		out.PaymentMeans.Account = &struct {
+			ID     string            `xml:"cbc:ID"`
+			Branch *ublXMLIdentifier `xml:"cac:FinancialInstitutionBranch"`
+		}{ID: strings.ReplaceAll(d.IBAN, " ", "")}
+		if d.BIC != "" {
+			out.PaymentMeans.Account.Branch = &ublXMLIdentifier{ID: d.BIC}
+		}
+	}
+
+	out.TaxTotal.TaxAmount = d.amount(d.TaxTotal)
+	for _, subtotal := range d.Subtotals {
+		out.TaxTotal.Subtotals = append(out.TaxTotal.Subtotals, struct {
+			TaxableAmount ublXMLAmount      `xml:"cbc:TaxableAmount"`
+			TaxAmount     ublXMLAmount      `xml:"cbc:TaxAmount"`
+			Category      ublXMLTaxCategory `xml:"cac:TaxCategory"`
+		}{
+			TaxableAmount: d.amount(subtotal.Taxable),
+			TaxAmount:     d.amount(subtotal.Tax),
+			Category: ublXMLTaxCategory{
+				ID:                  subtotal.Category,
+				Percent:             ublPercent(subtotal.Rate),
+				ExemptionReasonCode: subtotal.ExemptionCode,
+				ExemptionReason:     subtotal.ExemptionReason,
+				TaxScheme:           ublXMLIdentifier{ID: "VAT"},
+			},
+		})
+	}
+
+	out.MonetaryTotal = ublXMLMonetaryTotal{
+		LineExtension: d.amount(d.LineTotal),
+		TaxExclusive:  d.amount(d.TaxExclusive),
+		TaxInclusive:  d.amount(d.TaxInclusive),
+		Payable:       d.amount(d.Payable),
+	}
+	if !d.Prepaid.IsZero() {
+		prepaid := d.amount(d.Prepaid)
+		out.MonetaryTotal.Prepaid = &prepaid
+	}
+
+	for _, line := range d.Lines {
+		l := ublXMLLine{ID: line.ID, LineExtension: d.amount(line.Net)}
+		quantity := &ublXMLQuantity{UnitCode: "C62", Value: line.Quantity}
+		if d.CreditNote {
+			l.CreditedQuantity = quantity
+		} else {
+			l.InvoicedQuantity = quantity
+		}
+		l.Item.Name = line.Name
+		if line.SellerItemID != "" {
+			l.Item.SellersItem = &ublXMLIdentifier{ID: line.SellerItemID}
+		}
+		l.Item.ClassifiedCategory = ublXMLTaxCategory{ID: line.Category, Percent: ublPercent(line.Rate), TaxScheme: ublXMLIdentifier{ID: "VAT"}}
+
+		// Prix unitaire exact quand la quantité divise le montant, sinon prix pour la quantité de base (sans arrondi)
+		if line.Net.Amount%int64(line.Quantity) == 0 {
+			l.Price.Amount = d.amount(models.Money{Amount: line.Net.Amount / int64(line.Quantity), Currency: line.Net.Currency})
+		} else {
+			l.Price.Amount = d.amount(line.Net)
+			l.Price.BaseQuantity = &ublXMLQuantity{UnitCode: "C62", Value: line.Quantity}
+		}
+
+		if d.CreditNote {
+			out.CreditNoteLines = append(out.CreditNoteLines, l)
+		} else {
+			out.InvoiceLines = append(out.InvoiceLines, l)
+		}
+	}
+
+	data, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("erreur sérialisation UBL: %v", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+func (p ublParty) xml() ublXMLParty {
+	var party ublXMLParty
+	party.EndpointID = ublXMLSchemeID{SchemeID: p.EndpointScheme, Value: p.EndpointID}
+	party.PartyName.Name = p.Name
+	party.PostalAddress.StreetName = p.Street
+	party.PostalAddress.CityName = p.City
+	party.PostalAddress.PostalZone = p.PostalCode
+	party.PostalAddress.Country.IdentificationCode = p.Country
+	if p.VATNumber != "" {
+		party.PartyTaxScheme = &ublXMLPartyTaxScheme{CompanyID: p.VATNumber, TaxScheme: ublXMLIdentifier{ID: "VAT"}}
+	}
+	party.LegalEntity.RegistrationName = p.Name
+	if p.LegalID != "" {
+		party.LegalEntity.CompanyID = &ublXMLSchemeID{SchemeID: p.LegalScheme, Value: p.LegalID}
+	}
+	if p.Email != "" {
+		party.Contact = &struct {
+			ElectronicMail string `xml:"cbc:ElectronicMail"`
+		}{ElectronicMail: p.Email}
+	}
+	return party
+}
+
+// sellerUBLParty : identifiant Peppol du vendeur (PEPPOL_SENDER_ID, sinon déduit de son numéro de TVA)
+func sellerUBLParty(seller models.InvoiceParty) ublParty {
+	party := partyFromInvoice(seller)
+	if party.Country == "" {
+		party.Country = ShopCountry()
+	}
+	endpoint := PeppolSenderID()
+	party.EndpointScheme, party.EndpointID = splitParticipantID(endpoint)
+	return party
+}
+
+func buyerUBLParty(buyer models.InvoiceParty, endpoint string) ublParty {
+	party := partyFromInvoice(buyer)
+	party.EndpointScheme, party.EndpointID = splitParticipantID(endpoint)
+	return party
+}
+
+// partyFromInvoice reconstitue l'adresse structurée (rue, code postal et ville, pays) des lignes imprimées
+func partyFromInvoice(p models.InvoiceParty) ublParty {
+	party := ublParty{
+		Name:      p.Name,
+		Country:   strings.ToUpper(p.Country),
+		VATNumber: NormalizeVATNumber(p.VATNumber),
+		Email:     p.Email,
+	}
+	lines := p.AddressLines
+	if n := len(lines); n > 0 && ublCountryPattern.MatchString(lines[n-1]) {
+		if party.Country == "" {
+			party.Country = lines[n-1]
+		}
+		lines = lines[:n-1]
+	}
+	// Adresse saisie sur une seule ligne (COMPANY_ADDRESS) : "rue, code postal ville"
+	if len(lines) == 1 {
+		if i := strings.LastIndex(lines[0], ","); i > 0 {
+			lines = []string{strings.TrimSpace(lines[0][:i]), strings.TrimSpace(lines[0][i+1:])}
+		}
+	}
+	if len(lines) > 0 {
+		party.Street = lines[0]
+	}
+	if len(lines) > 1 {
+		cityLine := lines[len(lines)-1]
+		if i := strings.Index(cityLine, " "); i > 0 && strings.ContainsAny(cityLine[:i], "0123456789") {
+			party.PostalCode, party.City = cityLine[:i], strings.TrimSpace(cityLine[i+1:])
+		} else {
+			party.City = cityLine
+		}
+	}
+
+	// Numéro d'entreprise belge (BCE) : les chiffres du numéro de TVA
+	if strings.HasPrefix(party.VATNumber, "BE") {
+		party.LegalScheme, party.LegalID = "0208", party.VATNumber[2:]
+	}
+	return party
+}
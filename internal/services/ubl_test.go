@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bytes"
+	"cedra_back_end/internal/models"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// go test ./internal/services -run UBL -update régénère les fichiers de référence
+var updateGolden = flag.Bool("update", false, "réécrit les fichiers testdata/ubl/*.xml")
+
+var (
+	ublIssueDate   = time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)
+	ublRefundDate  = time.Date(2026, 3, 20, 15, 0, 0, 0, time.UTC)
+	ublTestOrderID = gocql.UUID{0x5a, 0x1e, 0x7c, 0x42, 0x0b, 0x3d, 0x11, 0xf0, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+)
+
+func ublTestSeller() models.InvoiceParty {
+	return models.InvoiceParty{
+		Name:         "Cedra SRL",
+		AddressLines: []string{"Rue de la Loi 16", "1000 Bruxelles", "BE"},
+		Country:      "BE",
+		VATNumber:    "BE0477472701",
+		Email:        "facturation@cedra.test",
+	}
+}
+
+// ublTestInvoice : facture payée en ligne, TVA belge à 21 % et 6 % (catégorie S)
+func ublTestInvoice() *models.Invoice {
+	paidAt := ublIssueDate
+	return &models.Invoice{
+		Number:     "F2026-000042",
+		FiscalYear: 2026,
+		Sequence:   42,
+		OrderID:    ublTestOrderID,
+		Seller:     ublTestSeller(),
+		Buyer:      models.InvoiceParty{Name: "Atelier Dupont SRL", AddressLines: []string{"Place du Marché 3", "4000 Liège", "BE"}, Country: "BE", VATNumber: "BE0417497106"},
+		Lines: []models.InvoiceLine{
+			{ProductID: "chair-01", Description: "Chaise de bureau", Quantity: 2, UnitPrice: models.Cents(12100), TaxRate: 21, NetAmount: models.Cents(20000), TaxAmount: models.Cents(4200), GrossAmount: models.Cents(24200)},
+			{ProductID: "book-07", Description: "Guide de l'ergonomie", Quantity: 3, UnitPrice: models.Cents(1060), TaxRate: 6, NetAmount: models.Cents(3000), TaxAmount: models.Cents(180), GrossAmount: models.Cents(3180)},
+			{Description: "Livraison", Quantity: 1, UnitPrice: models.Cents(1210), TaxRate: 21, NetAmount: models.Cents(1000), TaxAmount: models.Cents(210), GrossAmount: models.Cents(1210)},
+		},
+		Rates: []models.TaxRateTotal{
+			{Rate: 21, NetAmount: models.Cents(21000), TaxAmount: models.Cents(4410)},
+			{Rate: 6, NetAmount: models.Cents(3000), TaxAmount: models.Cents(180)},
+		},
+		NetTotal:         models.Cents(24000),
+		TaxTotal:         models.Cents(4590),
+		GrossTotal:       models.Cents(28590),
+		TaxRegime:        models.TaxRegimeDomestic,
+		PaymentReference: "+++026/0000/04224+++",
+		IBAN:             "BE71 0961 2345 6769",
+		BIC:              "GKCCBEBB",
+		IssuedAt:         ublIssueDate,
+		PaidAt:           &paidAt,
+	}
+}
+
+// ublTestReverseChargeInvoice : société allemande avec numéro de TVA, payable à 30 jours (catégorie AE)
+func ublTestReverseChargeInvoice() *models.Invoice {
+	due := ublIssueDate.AddDate(0, 0, 30)
+	return &models.Invoice{
+		Number:     "F2026-000043",
+		FiscalYear: 2026,
+		Sequence:   43,
+		OrderID:    ublTestOrderID,
+		Seller:     ublTestSeller(),
+		Buyer:      models.InvoiceParty{Name: "Büro Schmidt GmbH", AddressLines: []string{"Hauptstraße 5", "10115 Berlin", "DE"}, Country: "DE", VATNumber: "DE136695976"},
+		Lines: []models.InvoiceLine{
+			{ProductID: "desk-03", Description: "Bureau assis-debout", Quantity: 1, UnitPrice: models.Cents(45000), NetAmount: models.Cents(45000), GrossAmount: models.Cents(45000)},
+			{ProductID: "lamp-02", Description: "Lampe LED", Quantity: 3, UnitPrice: models.Cents(3333), NetAmount: models.Cents(10000), GrossAmount: models.Cents(10000)},
+		},
+		Rates:            []models.TaxRateTotal{{Rate: 0, NetAmount: models.Cents(55000)}},
+		NetTotal:         models.Cents(55000),
+		GrossTotal:       models.Cents(55000),
+		TaxRegime:        models.TaxRegimeReverseCharge,
+		TaxNote:          "Autoliquidation - article 196 de la directive 2006/112/CE",
+		PaymentReference: "+++026/0000/04325+++",
+		IBAN:             "BE71 0961 2345 6769",
+		BIC:              "GKCCBEBB",
+		IssuedAt:         ublIssueDate,
+		DueDate:          &due,
+		PaymentTermsDays: 30,
+		PONumber:         "PO-2026-118",
+		CostCenter:       "CC-4410",
+	}
+}
+
+// ublTestExportInvoice : livraison en Suisse, acheteur sans numéro de TVA UE (catégorie G)
+func ublTestExportInvoice() *models.Invoice {
+	paidAt := ublIssueDate
+	return &models.Invoice{
+		Number:     "F2026-000044",
+		FiscalYear: 2026,
+		Sequence:   44,
+		OrderID:    ublTestOrderID,
+		Seller:     ublTestSeller(),
+		Buyer:      models.InvoiceParty{Name: "Mobilier Favre SA", AddressLines: []string{"Rue du Rhône 12", "1204 Genève", "CH"}, Country: "CH"},
+		Lines: []models.InvoiceLine{
+			{ProductID: "chair-01", Description: "Chaise de bureau", Quantity: 4, UnitPrice: models.Cents(10000), NetAmount: models.Cents(40000), GrossAmount: models.Cents(40000)},
+		},
+		Rates:            []models.TaxRateTotal{{Rate: 0, NetAmount: models.Cents(40000)}},
+		NetTotal:         models.Cents(40000),
+		GrossTotal:       models.Cents(40000),
+		TaxRegime:        models.TaxRegimeExport,
+		TaxNote:          "Exportation hors Union européenne - article 146 de la directive 2006/112/CE",
+		PaymentReference: "+++026/0000/04426+++",
+		IBAN:             "BE71 0961 2345 6769",
+		IssuedAt:         ublIssueDate,
+		PaidAt:           &paidAt,
+	}
+}
+
+func ublTestCreditNote(inv *models.Invoice, r *models.Refund) *models.CreditNote {
+	r.Status = models.RefundStatusCompleted
+	note := BuildCreditNote(inv, r)
+	note.Number = "NC2026-000007"
+	note.FiscalYear = 2026
+	note.Sequence = 7
+	note.IssuedAt = ublRefundDate
+	return note
+}
+
+func TestUBLDocuments(t *testing.T) {
+	t.Setenv("PEPPOL_SENDER_ID", "0208:0477472701")
+
+	tests := []struct {
+		name      string
+		document  func() *ublDocument
+		category  string
+		wantTotal string // Montant à payer (PayableAmount)
+	}{
+		{
+			name: "invoice_standard",
+			document: func() *ublDocument {
+				return invoiceUBLDocument(ublTestInvoice(), "0208:0417497106")
+			},
+			category:  ublCategoryStandard,
+			wantTotal: "0.00",
+		},
+		{
+			name: "invoice_reverse_charge",
+			document: func() *ublDocument {
+				return invoiceUBLDocument(ublTestReverseChargeInvoice(), "9930:DE136695976")
+			},
+			category:  ublCategoryReverseCharge,
+			wantTotal: "550.00",
+		},
+		{
+			name: "invoice_export",
+			document: func() *ublDocument {
+				return invoiceUBLDocument(ublTestExportInvoice(), "0088:7640000000001")
+			},
+			category:  ublCategoryExport,
+			wantTotal: "0.00", // Payée en ligne : montant prépayé
+		},
+		{
+			name: "credit_note_standard",
+			document: func() *ublDocument {
+				note := ublTestCreditNote(ublTestInvoice(), &models.Refund{
+					RefundAmount: models.Cents(12100),
+					Reason:       "Chaise endommagée",
+					Items:        []models.RefundItem{{ProductID: "chair-01", Name: "Chaise de bureau", Quantity: 1, Amount: models.Cents(12100)}},
+				})
+				return creditNoteUBLDocument(note, "0208:0417497106")
+			},
+			category:  ublCategoryStandard,
+			wantTotal: "121.00",
+		},
+		{
+			name: "credit_note_reverse_charge",
+			document: func() *ublDocument {
+				note := ublTestCreditNote(ublTestReverseChargeInvoice(), &models.Refund{
+					RefundAmount: models.Cents(5000),
+					Reason:       "Geste commercial",
+				})
+				return creditNoteUBLDocument(note, "9930:DE136695976")
+			},
+			category:  ublCategoryReverseCharge,
+			wantTotal: "50.00",
+		},
+		{
+			name: "credit_note_export",
+			document: func() *ublDocument {
+				note := ublTestCreditNote(ublTestExportInvoice(), &models.Refund{
+					RefundAmount: models.Cents(20000),
+					Reason:       "Retour de deux chaises",
+					Items:        []models.RefundItem{{ProductID: "chair-01", Name: "Chaise de bureau", Quantity: 2, Amount: models.Cents(20000)}},
+				})
+				return creditNoteUBLDocument(note, "0088:7640000000001")
+			},
+			category:  ublCategoryExport,
+			wantTotal: "200.00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := tt.document()
+			if err := doc.validate(); err != nil {
+				t.Fatalf("règles BR / PEPPOL non respectées: %v", err)
+			}
+			for _, subtotal := range doc.Subtotals {
+				if subtotal.Category != tt.category {
+					t.Errorf("catégorie %s, attendu %s", subtotal.Category, tt.category)
+				}
+			}
+			if got := doc.Payable.String(); got != tt.wantTotal {
+				t.Errorf("montant à payer %s, attendu %s", got, tt.wantTotal)
+			}
+
+			data, err := doc.marshal()
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			checkUBLElementOrder(t, data)
+			compareGolden(t, filepath.Join("testdata", "ubl", tt.name+".xml"), data)
+		})
+	}
+}
+
+func TestUBLValidationRules(t *testing.T) {
+	t.Setenv("PEPPOL_SENDER_ID", "0208:0477472701")
+
+	tests := []struct {
+		name   string
+		mutate func(doc *ublDocument)
+		rule   string
+	}{
+		{"acheteur sans identifiant Peppol", func(doc *ublDocument) { doc.Buyer.EndpointID = "" }, "PEPPOL-EN16931-R010"},
+		{"TVA en autoliquidation", func(doc *ublDocument) {
+			doc.Lines[0].Tax = models.Cents(100)
+			doc.Subtotals, doc.LineTotal, doc.TaxTotal = nil, models.Money{}, models.Money{}
+			doc.finalizeTotals()
+			doc.Payable = doc.TaxInclusive
+		}, "BR-AE-09"},
+		{"acheteur sans TVA en autoliquidation", func(doc *ublDocument) { doc.Buyer.VATNumber = "" }, "BR-AE-02"},
+		{"ligne sans quantité", func(doc *ublDocument) { doc.Lines[0].Quantity = 0 }, "BR-22"},
+		{"montant à payer incohérent", func(doc *ublDocument) { doc.Payable = models.Cents(1) }, "BR-CO-16"},
+		{"note de crédit sans facture d'origine", func(doc *ublDocument) { doc.CreditNote = true }, "BR-55"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := invoiceUBLDocument(ublTestReverseChargeInvoice(), "9930:DE136695976")
+			tt.mutate(doc)
+			err := doc.validate()
+			var validationErr *UBLValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("erreur de validation attendue, obtenu %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.rule) {
+				t.Errorf("règle %s attendue dans %q", tt.rule, err.Error())
+			}
+		})
+	}
+}
+
+// ublElementOrder : séquences des schémas UBL 2.1 (Invoice-2, CreditNote-2 et agrégats communs),
+// limitées aux éléments produits par Cedra
+var ublElementOrder = map[string][]string{
+	"Invoice": {"CustomizationID", "ProfileID", "ID", "IssueDate", "DueDate", "InvoiceTypeCode", "Note", "DocumentCurrencyCode",
+		"AccountingCost", "BuyerReference", "OrderReference", "BillingReference", "AccountingSupplierParty", "AccountingCustomerParty",
+		"PaymentMeans", "PaymentTerms", "TaxTotal", "LegalMonetaryTotal", "InvoiceLine"},
+	"CreditNote": {"CustomizationID", "ProfileID", "ID", "IssueDate", "CreditNoteTypeCode", "Note", "DocumentCurrencyCode",
+		"AccountingCost", "BuyerReference", "OrderReference", "BillingReference", "AccountingSupplierParty", "AccountingCustomerParty",
+		"PaymentMeans", "PaymentTerms", "TaxTotal", "LegalMonetaryTotal", "CreditNoteLine"},
+	"Party":                    {"EndpointID", "PartyName", "PostalAddress", "PartyTaxScheme", "PartyLegalEntity", "Contact"},
+	"PostalAddress":            {"StreetName", "CityName", "PostalZone", "Country"},
+	"PartyTaxScheme":           {"CompanyID", "TaxScheme"},
+	"PartyLegalEntity":         {"RegistrationName", "CompanyID"},
+	"PaymentMeans":             {"PaymentMeansCode", "PaymentID", "PayeeFinancialAccount"},
+	"PayeeFinancialAccount":    {"ID", "FinancialInstitutionBranch"},
+	"InvoiceDocumentReference": {"ID", "IssueDate"},
+	"TaxTotal":                 {"TaxAmount", "TaxSubtotal"},
+	"TaxSubtotal":              {"TaxableAmount", "TaxAmount", "TaxCategory"},
+	"TaxCategory":              {"ID", "Percent", "TaxExemptionReasonCode", "TaxExemptionReason", "TaxScheme"},
+	"ClassifiedTaxCategory":    {"ID", "Percent", "TaxScheme"},
+	"LegalMonetaryTotal":       {"LineExtensionAmount", "TaxExclusiveAmount", "TaxInclusiveAmount", "PrepaidAmount", "PayableAmount"},
+	"InvoiceLine":              {"ID", "InvoicedQuantity", "LineExtensionAmount", "Item", "Price"},
+	"CreditNoteLine":           {"ID", "CreditedQuantity", "LineExtensionAmount", "Item", "Price"},
+	"Item":                     {"Name", "SellersItemIdentification", "ClassifiedTaxCategory"},
+	"Price":                    {"PriceAmount", "BaseQuantity"},
+}
+
+// checkUBLElementOrder vérifie que les enfants de chaque élément connu suivent l'ordre du schéma
+func checkUBLElementOrder(t *testing.T, data []byte) {
+	t.Helper()
+	type frame struct {
+		name string
+		last int
+	}
+	stack := []*frame{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("XML illisible: %v", err)
+		}
+		switch el := token.(type) {
+		case xml.StartElement:
+			if n := len(stack); n > 0 {
+				parent := stack[n-1]
+				if order, ok := ublElementOrder[parent.name]; ok {
+					index := indexOf(order, el.Name.Local)
+					if index < 0 {
+						t.Errorf("élément %s inattendu dans %s", el.Name.Local, parent.name)
+					} else if index < parent.last {
+						t.Errorf("élément %s hors séquence dans %s", el.Name.Local, parent.name)
+					} else {
+						parent.last = index
+					}
+				}
+			}
+			stack = append(stack, &frame{name: el.Name.Local})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func compareGolden(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if *updateGolden {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("écriture %s: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("lecture %s: %v (go test -run UBL -update pour le créer)", path, err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s ne correspond pas au document produit :\n%s", path, data)
+	}
+}
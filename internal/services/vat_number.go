@@ -0,0 +1,432 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VATNumberError est une erreur de validation d'un numéro de TVA (format ou clé de contrôle)
+type VATNumberError struct {
+	Message string
+}
+
+func (e *VATNumberError) Error() string {
+	return e.Message
+}
+
+// vatFormats : format du numéro (sans le préfixe pays) par État membre
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^[1-9]\d{8}$`),
+	"DK": regexp.MustCompile(`^[1-9]\d{7}$`),
+	"EE": regexp.MustCompile(`^10\d{7}$`),
+	"EL": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-IW]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^[1-9]\d{7}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^[1-9]\d{1,9}$`),
+	"SE": regexp.MustCompile(`^\d{10}01$`),
+	"SI": regexp.MustCompile(`^[1-9]\d{7}$`),
+	"SK": regexp.MustCompile(`^[1-9]\d{9}$`),
+}
+
+// vatChecksums : clé de contrôle par État membre (les pays absents ne sont vérifiés que sur le format)
+var vatChecksums = map[string]func(string) bool{
+	"AT": checkVATAT,
+	"BE": checkVATBE,
+	"BG": checkVATBG,
+	"CY": checkVATCY,
+	"CZ": checkVATCZ,
+	"DE": checkMod11_10,
+	"DK": checkVATDK,
+	"EE": checkVATEE,
+	"EL": checkVATEL,
+	"ES": checkVATES,
+	"FI": checkVATFI,
+	"FR": checkVATFR,
+	"HR": checkMod11_10,
+	"HU": checkVATHU,
+	"IE": checkVATIE,
+	"IT": checkLuhn,
+	"LT": checkVATLT,
+	"LU": checkVATLU,
+	"LV": checkVATLV,
+	"MT": checkVATMT,
+	"NL": checkVATNL,
+	"PL": checkVATPL,
+	"PT": checkVATPT,
+	"RO": checkVATRO,
+	"SE": func(n string) bool { return checkLuhn(n[:10]) },
+	"SI": checkVATSI,
+	"SK": checkVATSK,
+}
+
+// ValidateVATNumber vérifie le format et la clé de contrôle d'un numéro de TVA intracommunautaire.
+// Retourne le numéro normalisé (BE0123456789) ; la Grèce utilise le préfixe EL.
+func ValidateVATNumber(vatNumber string) (string, error) {
+	vatNumber = NormalizeVATNumber(vatNumber)
+	if len(vatNumber) < 4 {
+		return "", &VATNumberError{Message: "Numéro de TVA trop court"}
+	}
+
+	prefix, number := vatNumber[:2], vatNumber[2:]
+	if prefix == "GR" {
+		prefix = "EL"
+	}
+	// Anciens numéros belges à 9 chiffres : un 0 est ajouté devant
+	if prefix == "BE" && len(number) == 9 {
+		number = "0" + number
+	}
+	vatNumber = prefix + number
+
+	format, ok := vatFormats[prefix]
+	if !ok {
+		return "", &VATNumberError{Message: fmt.Sprintf("Préfixe pays %s inconnu (numéro de TVA UE attendu)", prefix)}
+	}
+	if !format.MatchString(number) {
+		return "", &VATNumberError{Message: fmt.Sprintf("Format de numéro de TVA invalide pour %s", prefix)}
+	}
+	if check, ok := vatChecksums[prefix]; ok && !check(number) {
+		return "", &VATNumberError{Message: "Clé de contrôle du numéro de TVA invalide"}
+	}
+	return vatNumber, nil
+}
+
+// VATNumberCountry retourne le pays ISO d'un numéro de TVA normalisé (EL → GR)
+func VATNumberCountry(vatNumber string) string {
+	if len(vatNumber) < 2 {
+		return ""
+	}
+	return normalizeCountry(vatNumber[:2])
+}
+
+func digitsOf(s string) []int {
+	digits := make([]int, len(s))
+	for i, r := range s {
+		digits[i] = int(r - '0')
+	}
+	return digits
+}
+
+// weightedSum additionne les chiffres pondérés (poids appliqués depuis le premier chiffre)
+func weightedSum(digits []int, weights ...int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += digits[i] * w
+	}
+	return sum
+}
+
+func checkLuhn(n string) bool {
+	sum := 0
+	for i, d := range digitsOf(n) {
+		if (len(n)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// checkMod11_10 : ISO 7064 MOD 11,10 (Allemagne, Croatie)
+func checkMod11_10(n string) bool {
+	d := digitsOf(n)
+	product := 10
+	for _, digit := range d[:len(d)-1] {
+		sum := (digit + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = (2 * sum) % 11
+	}
+	check := 11 - product
+	if check == 10 {
+		check = 0
+	}
+	return check == d[len(d)-1]
+}
+
+func checkVATAT(n string) bool {
+	d := digitsOf(n[1:])
+	sum := 0
+	for i, digit := range d[:7] {
+		if i%2 == 1 {
+			digit *= 2
+			digit = digit/10 + digit%10
+		}
+		sum += digit
+	}
+	return (10-(sum+4)%10)%10 == d[7]
+}
+
+func checkVATBE(n string) bool {
+	base, _ := strconv.Atoi(n[:8])
+	check, _ := strconv.Atoi(n[8:])
+	return 97-base%97 == check
+}
+
+func checkVATBG(n string) bool {
+	if len(n) != 9 {
+		return true // Numéros personnels à 10 chiffres : format uniquement
+	}
+	d := digitsOf(n)
+	check := weightedSum(d, 1, 2, 3, 4, 5, 6, 7, 8) % 11
+	if check == 10 {
+		check = weightedSum(d, 3, 4, 5, 6, 7, 8, 9, 10) % 11 % 10
+	}
+	return check == d[8]
+}
+
+// checkVATCY : lettre de contrôle sur les 8 chiffres (les chiffres de rang pair sont transcodés)
+func checkVATCY(n string) bool {
+	if strings.HasPrefix(n, "12") {
+		return false
+	}
+	translation := []int{1, 0, 5, 7, 9, 13, 15, 17, 19, 21}
+	sum := 0
+	for i, digit := range digitsOf(n[:8]) {
+		if i%2 == 0 {
+			digit = translation[digit]
+		}
+		sum += digit
+	}
+	return n[8] == byte('A'+sum%26)
+}
+
+// checkVATCZ : personnes morales (8 chiffres), personnes physiques sans numéro de naissance (9 chiffres
+// commençant par 6) et numéros de naissance à 10 chiffres. Les numéros de naissance antérieurs à 1954
+// (9 chiffres) n'ont pas de clé.
+func checkVATCZ(n string) bool {
+	d := digitsOf(n)
+	switch {
+	case len(d) == 8:
+		if d[0] == 9 {
+			return false
+		}
+		check := (11 - weightedSum(d, 8, 7, 6, 5, 4, 3, 2)%11) % 11
+		if check == 0 {
+			check = 1
+		}
+		return check%10 == d[7]
+	case len(d) == 9 && d[0] == 6:
+		check := weightedSum(d[1:], 8, 7, 6, 5, 4, 3, 2) % 11
+		return (check+8)%10 == d[8]
+	case len(d) == 10:
+		value, _ := strconv.ParseInt(n, 10, 64)
+		if value%11 == 0 {
+			return true
+		}
+		// Exception des numéros de naissance d'avant 1985 : reste 10 et clé 0
+		base, _ := strconv.ParseInt(n[:9], 10, 64)
+		return base%11 == 10 && d[9] == 0
+	}
+	return true
+}
+
+func checkVATDK(n string) bool {
+	return weightedSum(digitsOf(n), 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0
+}
+
+func checkVATEE(n string) bool {
+	d := digitsOf(n)
+	return (10-weightedSum(d, 3, 7, 1, 3, 7, 1, 3, 7)%10)%10 == d[8]
+}
+
+func checkVATEL(n string) bool {
+	d := digitsOf(n)
+	return weightedSum(d, 256, 128, 64, 32, 16, 8, 4, 2)%11%10 == d[8]
+}
+
+// checkVATES : DNI et NIE (lettre modulo 23), sociétés (CIF : clé Luhn, en chiffre ou en lettre)
+func checkVATES(n string) bool {
+	const dniLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
+	switch first := n[0]; {
+	case first >= '0' && first <= '9', first == 'X' || first == 'Y' || first == 'Z':
+		digits := n[:8]
+		if first >= 'X' {
+			digits = string(rune('0'+first-'X')) + n[1:8]
+		}
+		value, err := strconv.Atoi(digits)
+		return err == nil && n[8] == dniLetters[value%23]
+	case first == 'K' || first == 'L' || first == 'M':
+		value, err := strconv.Atoi(n[1:8])
+		return err == nil && n[8] == dniLetters[value%23]
+	case strings.IndexByte("ABCDEFGHJNPQRSUVW", first) >= 0:
+		for check := 0; check <= 9; check++ {
+			if checkLuhn(n[1:8] + strconv.Itoa(check)) {
+				return n[8] == byte('0'+check) || n[8] == "JABCDEFGHI"[check]
+			}
+		}
+	}
+	return false
+}
+
+func checkVATFI(n string) bool {
+	d := digitsOf(n)
+	r := weightedSum(d, 7, 9, 10, 5, 8, 4, 2) % 11
+	if r == 1 {
+		return false
+	}
+	if r == 0 {
+		return d[7] == 0
+	}
+	return 11-r == d[7]
+}
+
+func checkVATFR(n string) bool {
+	siren := n[2:]
+	if !checkLuhn(siren) {
+		return false
+	}
+	key, err := strconv.Atoi(n[:2])
+	if err != nil {
+		return true // Clés alphanumériques (nouvelles entreprises) : pas de calcul public
+	}
+	s, _ := strconv.Atoi(siren)
+	return (12+3*(s%97))%97 == key
+}
+
+func checkVATHU(n string) bool {
+	d := digitsOf(n)
+	return (10-weightedSum(d, 9, 7, 3, 1, 9, 7, 3)%10)%10 == d[7]
+}
+
+func checkVATIE(n string) bool {
+	if n[1] < '0' || n[1] > '9' {
+		return true // Ancien format : format uniquement
+	}
+	sum := weightedSum(digitsOf(n[:7]), 8, 7, 6, 5, 4, 3, 2)
+	if len(n) == 9 && n[8] != 'W' {
+		sum += 9 * int(n[8]-'A'+1)
+	}
+	r := sum % 23
+	expected := byte('W')
+	if r > 0 {
+		expected = byte('A' + r - 1)
+	}
+	return n[7] == expected
+}
+
+// checkVATLT : personnes morales (9 chiffres) et assujettis temporaires (12 chiffres), avant-dernier chiffre à 1
+func checkVATLT(n string) bool {
+	d := digitsOf(n)
+	if d[len(d)-2] != 1 {
+		return false
+	}
+	sum := 0
+	for i, digit := range d[:len(d)-1] {
+		sum += (1 + i%9) * digit
+	}
+	check := sum % 11
+	if check == 10 {
+		sum = 0
+		for i, digit := range d[:len(d)-1] {
+			sum += (1 + (i+2)%9) * digit
+		}
+		check = sum % 11
+	}
+	return check%10 == d[len(d)-1]
+}
+
+func checkVATLU(n string) bool {
+	base, _ := strconv.Atoi(n[:6])
+	check, _ := strconv.Atoi(n[6:])
+	return base%89 == check
+}
+
+// checkVATLV : personnes morales (premier chiffre > 3) et codes personnels ; les nouveaux codes
+// personnels (préfixe 32) n'ont pas de clé
+func checkVATLV(n string) bool {
+	d := digitsOf(n)
+	if d[0] > 3 {
+		return weightedSum(d, 9, 1, 4, 8, 3, 10, 2, 5, 7, 6, 1)%11 == 3
+	}
+	if strings.HasPrefix(n, "32") {
+		return true
+	}
+	return (1+weightedSum(d, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9))%11%10 == d[10]
+}
+
+func checkVATMT(n string) bool {
+	check, _ := strconv.Atoi(n[6:])
+	return 37-weightedSum(digitsOf(n), 3, 4, 6, 7, 8, 9)%37 == check
+}
+
+// checkVATNL accepte l'ancien numéro (modulo 11 sur le numéro fiscal) et le numéro de TVA
+// des entrepreneurs individuels depuis 2020 (modulo 97 sur "NL" + numéro)
+func checkVATNL(n string) bool {
+	d := digitsOf(n[:9])
+	if weightedSum(d, 9, 8, 7, 6, 5, 4, 3, 2)%11 == d[8] {
+		return true
+	}
+	// N = 23, L = 21, B = 11
+	value, ok := new(big.Int).SetString("2321"+n[:9]+"11"+n[10:], 10)
+	return ok && new(big.Int).Mod(value, big.NewInt(97)).Int64() == 1
+}
+
+func checkVATPL(n string) bool {
+	d := digitsOf(n)
+	return weightedSum(d, 6, 5, 7, 2, 3, 4, 5, 6, 7)%11 == d[9]
+}
+
+func checkVATPT(n string) bool {
+	d := digitsOf(n)
+	check := 11 - weightedSum(d, 9, 8, 7, 6, 5, 4, 3, 2)%11
+	if check >= 10 {
+		check = 0
+	}
+	return check == d[8]
+}
+
+func checkVATRO(n string) bool {
+	d := digitsOf(n)
+	weights := []int{7, 5, 3, 2, 1, 7, 5, 3, 2}
+	weights = weights[len(weights)-(len(d)-1):]
+	return weightedSum(d, weights...)*10%11%10 == d[len(d)-1]
+}
+
+func checkVATSI(n string) bool {
+	d := digitsOf(n)
+	check := 11 - weightedSum(d, 8, 7, 6, 5, 4, 3, 2)%11
+	if check == 11 {
+		return false
+	}
+	if check == 10 {
+		check = 0
+	}
+	return check == d[7]
+}
+
+func checkVATSK(n string) bool {
+	value, _ := strconv.ParseInt(n, 10, 64)
+	return value%11 == 0
+}
+
+// maskVATNumber masque le milieu d'un numéro de TVA pour les logs
+func maskVATNumber(vatNumber string) string {
+	if len(vatNumber) <= 6 {
+		return vatNumber
+	}
+	return vatNumber[:4] + strings.Repeat("*", len(vatNumber)-6) + vatNumber[len(vatNumber)-2:]
+}
@@ -0,0 +1,44 @@
+package services
+
+import "testing"
+
+func TestValidateVATNumber(t *testing.T) {
+	tests := []struct {
+		vatNumber string
+		valid     bool
+	}{
+		{"BE0477472701", true},
+		{"BE0477472702", false},
+		{"CY10259033P", true},
+		{"CY10259033Z", false},
+		{"CY12000000C", false},
+		{"CZ25123891", true},
+		{"CZ25123890", false},
+		{"CZ7103192745", true},
+		{"CZ7103192746", false},
+		{"CZ640903926", true},
+		{"CZ640903927", false},
+		{"ESA13585625", true},
+		{"ESA13585626", false},
+		{"ES54362315K", true},
+		{"ES54362315Z", false},
+		{"ESX5253868R", true},
+		{"LT119511515", true},
+		{"LT119511516", false},
+		{"LT100001919017", true},
+		{"LT100001919018", false},
+		{"LV40003521600", true},
+		{"LV40003521601", false},
+		{"LV16117519997", true},
+		{"LV16117519996", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vatNumber, func(t *testing.T) {
+			_, err := ValidateVATNumber(tt.vatNumber)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateVATNumber(%s) = %v, valide attendu: %v", tt.vatNumber, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VIESResult est la réponse du registre européen VIES pour un numéro de TVA
+type VIESResult struct {
+	Valid   bool
+	Name    string
+	Address string
+}
+
+// VIESChecker vérifie en ligne qu'un numéro de TVA est actif (country : préfixe TVA, EL pour la Grèce)
+type VIESChecker interface {
+	CheckVAT(country, number string) (*VIESResult, error)
+}
+
+var (
+	viesMu       sync.RWMutex
+	viesOverride VIESChecker
+)
+
+// SetVIESChecker remplace la vérification VIES (nil : retour à la configuration VIES_MODE)
+func SetVIESChecker(checker VIESChecker) {
+	viesMu.Lock()
+	defer viesMu.Unlock()
+	viesOverride = checker
+}
+
+// currentVIESChecker retourne le vérificateur configuré :
+// VIES_MODE=online (défaut, service de la Commission), off (aucune vérification) ou stub (hors ligne, développement)
+func currentVIESChecker() VIESChecker {
+	viesMu.RLock()
+	override := viesOverride
+	viesMu.RUnlock()
+	if override != nil {
+		return override
+	}
+
+	switch strings.ToLower(os.Getenv("VIES_MODE")) {
+	case "stub":
+		return StubVIESChecker{}
+	case "off":
+		return nil
+	default:
+		return &OnlineVIESChecker{BaseURL: os.Getenv("VIES_API_URL"), Client: &http.Client{Timeout: 10 * time.Second}}
+	}
+}
+
+// CheckVATWithVIES interroge VIES pour un numéro déjà validé hors ligne.
+// Retourne nil sans erreur quand la vérification en ligne est désactivée.
+func CheckVATWithVIES(vatNumber string) (*VIESResult, error) {
+	checker := currentVIESChecker()
+	if checker == nil {
+		return nil, nil
+	}
+	result, err := checker.CheckVAT(vatNumber[:2], vatNumber[2:])
+	if err != nil {
+		log.Printf("⚠️ VIES indisponible pour %s: %v", maskVATNumber(vatNumber), err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// StubVIESChecker simule VIES en local : tout numéro est valide sauf ceux listés dans VIES_STUB_INVALID
+type StubVIESChecker struct{}
+
+func (StubVIESChecker) CheckVAT(country, number string) (*VIESResult, error) {
+	for _, invalid := range strings.Split(os.Getenv("VIES_STUB_INVALID"), ",") {
+		if NormalizeVATNumber(invalid) == country+number {
+			return &VIESResult{Valid: false}, nil
+		}
+	}
+	return &VIESResult{Valid: true}, nil
+}
+
+// OnlineVIESChecker utilise l'API REST VIES de la Commission européenne
+type OnlineVIESChecker struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (v *OnlineVIESChecker) CheckVAT(country, number string) (*VIESResult, error) {
+	baseURL := strings.TrimRight(v.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://ec.europa.eu/taxation_customs/vies/rest-api"
+	}
+
+	resp, err := v.Client.Get(fmt.Sprintf("%s/ms/%s/vat/%s", baseURL, country, number))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("VIES HTTP %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		IsValid   bool   `json:"isValid"`
+		Name      string `json:"name"`
+		Address   string `json:"address"`
+		UserError string `json:"userError"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("réponse VIES illisible: %v", err)
+	}
+	// Registre national momentanément indisponible : le numéro n'est ni valide ni invalide
+	if payload.UserError != "" && payload.UserError != "VALID" && payload.UserError != "INVALID" {
+		return nil, fmt.Errorf("VIES: %s", payload.UserError)
+	}
+	return &VIESResult{Valid: payload.IsValid, Name: strings.TrimSpace(payload.Name), Address: strings.TrimSpace(payload.Address)}, nil
+}
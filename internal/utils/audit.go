@@ -106,17 +106,20 @@ const (
 	ACTION_PRODUCT_PRICE_CHANGE = "product.price_change"
 
 	// Actions commandes
-	ACTION_ORDER_CREATE = "order.create"
-	ACTION_ORDER_UPDATE = "order.update"
-	ACTION_ORDER_CANCEL = "order.cancel"
-	ACTION_ORDER_REFUND = "order.refund"
+	ACTION_ORDER_CREATE  = "order.create"
+	ACTION_ORDER_UPDATE  = "order.update"
+	ACTION_ORDER_CANCEL  = "order.cancel"
+	ACTION_ORDER_REFUND  = "order.refund"
+	ACTION_ORDER_APPROVE = "order.approve"
+	ACTION_ORDER_REJECT  = "order.reject"
 
 	// Actions utilisateurs
-	ACTION_USER_CREATE = "user.create"
-	ACTION_USER_UPDATE = "user.update"
-	ACTION_USER_DELETE = "user.delete"
-	ACTION_USER_BAN    = "user.ban"
-	ACTION_USER_UNBAN  = "user.unban"
+	ACTION_USER_CREATE         = "user.create"
+	ACTION_USER_UPDATE         = "user.update"
+	ACTION_USER_DELETE         = "user.delete"
+	ACTION_USER_BAN            = "user.ban"
+	ACTION_USER_UNBAN          = "user.unban"
+	ACTION_USER_SPENDING_LIMIT = "user.spending_limit"
 
 	// Actions coupons
 	ACTION_COUPON_CREATE = "coupon.create"
@@ -127,6 +130,15 @@ const (
 	ACTION_STOCK_UPDATE = "stock.update"
 	ACTION_STOCK_ALERT  = "stock.alert"
 
+	// Actions tarifs
+	ACTION_PRICE_LIST_CREATE     = "price_list.create"
+	ACTION_PRICE_LIST_UPDATE     = "price_list.update"
+	ACTION_PRICE_LIST_DELETE     = "price_list.delete"
+	ACTION_PRICE_LIST_ASSIGN     = "price_list.assign"
+	ACTION_CUSTOMER_GROUP_SAVE   = "customer_group.save"
+	ACTION_CUSTOMER_GROUP_DELETE = "customer_group.delete"
+	ACTION_PRICE_TIERS_UPDATE    = "price_tiers.update"
+
 	// Actions rôles et permissions
 	ACTION_ROLE_ASSIGN = "role.assign"
 	ACTION_ROLE_REVOKE = "role.revoke"
@@ -151,4 +163,6 @@ const (
 	RESOURCE_ROLE      = "role"
 	RESOURCE_SETTINGS  = "settings"
 	RESOURCE_AUTH      = "auth"
+	RESOURCE_PRICING   = "pricing"
+	RESOURCE_COMPANY   = "company"
 )
@@ -12,6 +12,11 @@ import (
 )
 
 func SendConfirmationEmail(to, subject, htmlBody string, pdfAttachment []byte) error {
+	return SendEmailWithAttachment(to, subject, htmlBody, "facture_cedra.pdf", pdfAttachment)
+}
+
+// SendEmailWithAttachment envoie un email HTML avec une pièce jointe facultative (filename)
+func SendEmailWithAttachment(to, subject, htmlBody, filename string, attachment []byte) error {
 	msg := mail.NewMsg()
 
 	if err := msg.From("noreply@eldocam.com"); err != nil {
@@ -24,8 +29,8 @@ func SendConfirmationEmail(to, subject, htmlBody string, pdfAttachment []byte) e
 	msg.SetBodyString(mail.TypeTextHTML, htmlBody)
 
 	// ✅ FIX : Utilise AttachReader au lieu de AddAttachment
-	if pdfAttachment != nil {
-		msg.AttachReader("facture_cedra.pdf", bytes.NewReader(pdfAttachment))
+	if attachment != nil {
+		msg.AttachReader(filename, bytes.NewReader(attachment))
 	}
 
 	client, err := mail.NewClient("ssl0.ovh.net",
@@ -51,9 +56,63 @@ func GenerateOrderConfirmationHTML(order models.Order, userEmail string) string
 			<tr>
 				<td>%s</td>
 				<td>%d</td>
-				<td>%.2f€</td>
-				<td>%.2f€</td>
-			</tr>`, item.Name, item.Quantity, item.Price, item.Price*float64(item.Quantity))
+				<td>%s€</td>
+				<td>%s€</td>
+			</tr>`, item.Name, item.Quantity, item.Price, item.Price.Mul(item.Quantity))
+	}
+
+	// Récapitulatif : sous-total, remise et frais de port
+	summaryHTML := ""
+	if !order.Subtotal.IsZero() {
+		summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="3" style="padding: 10px; text-align: right;">Sous-total:</td>
+					<td style="padding: 10px;">%s€</td>
+				</tr>`, order.Subtotal)
+	}
+	if !order.DiscountAmount.IsZero() {
+		summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="3" style="padding: 10px; text-align: right;">Remise (%s):</td>
+					<td style="padding: 10px;">-%s€</td>
+				</tr>`, order.CouponCode, order.DiscountAmount)
+	}
+	if order.ShippingOptionID != "" {
+		summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="3" style="padding: 10px; text-align: right;">Livraison (%s):</td>
+					<td style="padding: 10px;">%s€</td>
+				</tr>`, order.ShippingOptionName, order.ShippingCost)
+	}
+	// TVA : montant HT et TVA par taux, ou mention d'autoliquidation / d'exonération
+	if order.Tax != nil {
+		summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="3" style="padding: 10px; text-align: right;">Total HT:</td>
+					<td style="padding: 10px;">%s€</td>
+				</tr>`, order.Tax.NetTotal)
+		for _, rate := range order.Tax.Rates {
+			if rate.TaxAmount.IsZero() {
+				continue
+			}
+			summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="3" style="padding: 10px; text-align: right;">TVA %g%%:</td>
+					<td style="padding: 10px;">%s€</td>
+				</tr>`, rate.Rate, rate.TaxAmount)
+		}
+		if order.Tax.VATNumber != "" {
+			summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="4" style="padding: 10px; text-align: right;">N° TVA client: %s</td>
+				</tr>`, order.Tax.VATNumber)
+		}
+		if order.Tax.Note != "" {
+			summaryHTML += fmt.Sprintf(`
+				<tr>
+					<td colspan="4" style="padding: 10px; text-align: right; font-style: italic;">%s</td>
+				</tr>`, order.Tax.Note)
+		}
 	}
 
 	return fmt.Sprintf(`
@@ -83,10 +142,10 @@ func GenerateOrderConfirmationHTML(order models.Order, userEmail string) string
 			<tbody>
 				%s
 			</tbody>
-			<tfoot>
+			<tfoot>%s
 				<tr>
 					<td colspan="3" style="padding: 10px; text-align: right; font-weight: bold;">Total:</td>
-					<td style="padding: 10px; font-weight: bold;">%.2f€</td>
+					<td style="padding: 10px; font-weight: bold;">%s€</td>
 				</tr>
 			</tfoot>
 		</table>
@@ -97,34 +156,5 @@ func GenerateOrderConfirmationHTML(order models.Order, userEmail string) string
 		</p>
 	</div>
 </body>
-</html>`, itemsHTML, order.TotalPrice)
-}
-
-// GenerateInvoicePDF génère un PDF de facture (utilise RenderReactInvoicePDF)
-func GenerateInvoicePDF(order models.Order, userEmail string) ([]byte, error) {
-	// Pour l'instant, on utilise RenderReactInvoicePDF avec l'ID de commande
-	orderID := order.ID.String()
-	frontURL := GetFrontendInvoiceBaseURL()
-	
-	// Générer le QR SEPA
-	iban := os.Getenv("COMPANY_IBAN")
-	if iban == "" {
-		iban = "BE12345678901234"
-	}
-	bic := os.Getenv("COMPANY_BIC")
-	if bic == "" {
-		bic = "KREDBEBB"
-	}
-	companyName := os.Getenv("COMPANY_NAME")
-	if companyName == "" {
-		companyName = "Cedra SRL"
-	}
-	ref := fmt.Sprintf("FACT-%s", orderID)
-	
-	qrBase64, err := GenerateSepaQR(iban, bic, companyName, ref, order.TotalPrice)
-	if err != nil {
-		return nil, fmt.Errorf("erreur génération QR: %v", err)
-	}
-	
-	return RenderReactInvoicePDF(frontURL, orderID, qrBase64)
+</html>`, itemsHTML, summaryHTML, order.TotalPrice)
 }
@@ -1,6 +1,9 @@
 package utils
 
-import "fmt"
+import (
+	"cedra_back_end/internal/models"
+	"fmt"
+)
 
 // SendWelcomeEmail envoie un email de bienvenue moderne
 func SendWelcomeEmail(userEmail, userName string) error {
@@ -203,7 +206,7 @@ func SendWelcomeEmail(userEmail, userName string) error {
 }
 
 // SendOrderConfirmationEmail envoie un email de confirmation de commande
-func SendOrderConfirmationEmail(userEmail string, orderID string, totalAmount float64, items string) error {
+func SendOrderConfirmationEmail(userEmail string, orderID string, totalAmount models.Money, items string) error {
 	subject := "✅ Commande confirmée - Cedra"
 
 	html := fmt.Sprintf(`
@@ -259,7 +262,7 @@ func SendOrderConfirmationEmail(userEmail string, orderID string, totalAmount fl
                                                     <strong>Montant total:</strong>
                                                 </td>
                                                 <td style="padding: 8px 0; color: #10b981; font-size: 18px; text-align: right; font-weight: 700;">
-                                                    %.2f€
+                                                    %s€
                                                 </td>
                                             </tr>
                                         </table>
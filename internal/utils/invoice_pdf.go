@@ -1,80 +1,318 @@
 package utils
 
 import (
-	"context"
+	"cedra_back_end/internal/models"
 	"encoding/base64"
 	"fmt"
-	"net/url"
 	"os"
-	"time"
+	"strings"
 
-	"github.com/chromedp/chromedp"
 	"github.com/skip2/go-qrcode"
 )
 
-// GenerateSepaQR génère un QR SEPA (EPC) en base64 prêt à mettre dans <img src="...">
-func GenerateSepaQR(iban, bic, name, ref string, amount float64) (string, error) {
-	// format EPC basique
-	sepa := fmt.Sprintf(`BCD
+// SepaQRPayload construit le contenu EPC (QR de virement SEPA) lu par les applications bancaires.
+// La communication structurée belge n'est pas une référence RF : elle va dans la communication libre
+// (après les lignes "objet" et "référence RF" laissées vides), où les banques belges la reconnaissent.
+func SepaQRPayload(iban, bic, name, ref string, amount models.Money) string {
+	return fmt.Sprintf(`BCD
 001
 1
 SCT
 %s
 %s
 %s
-EUR%.2f
+EUR%s
+
+
 %s`, bic, name, iban, amount, ref)
+}
 
-	png, err := qrcode.Encode(sepa, qrcode.Medium, 256)
+// GenerateSepaQR génère un QR SEPA (EPC) en base64 prêt à mettre dans <img src="...">
+func GenerateSepaQR(iban, bic, name, ref string, amount models.Money) (string, error) {
+	png, err := qrcode.Encode(SepaQRPayload(iban, bic, name, ref, amount), qrcode.Medium, 256)
 	if err != nil {
 		return "", err
 	}
 	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
 }
 
-// RenderReactInvoicePDF va charger ta page React/Next côté serveur et l’imprimer en PDF
-// frontendURL doit ressembler à: http://localhost:3000/invoice
-func RenderReactInvoicePDF(frontendURL, invoiceID, qrBase64 string) ([]byte, error) {
-	// on passe les params en query
-	q := url.Values{}
-	q.Set("id", invoiceID)
-	q.Set("qr", qrBase64)
-
-	fullURL := fmt.Sprintf("%s?%s", frontendURL, q.Encode())
-
-	ctx, cancel := chromedp.NewContext(context.Background())
-	defer cancel()
-
-	// timeout pour éviter de bloquer
-	ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	var pdfBuf []byte
-
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(fullURL),
-		// on attend que le body soit là (ton composant CedraInvoice)
-		chromedp.WaitVisible("body", chromedp.ByQuery),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			// Note: chromedp.PrintToPDF n'existe pas dans toutes les versions
-			// Pour une solution simple, utilisez une bibliothèque PDF alternative
-			// ou mettez à jour chromedp
-			return fmt.Errorf("PrintToPDF non implémenté - utilisez une alternative comme wkhtmltopdf")
-		}),
-	)
-	if err != nil {
-		return nil, err
+// GetSellerDetails retourne les mentions légales du vendeur imprimées sur les factures
+func GetSellerDetails() models.InvoiceParty {
+	name := os.Getenv("COMPANY_NAME")
+	if name == "" {
+		name = "Cedra SRL"
+	}
+	address := os.Getenv("COMPANY_ADDRESS")
+	if address == "" {
+		address = GetShipperAddress()
+	}
+	return models.InvoiceParty{
+		Name:         name,
+		AddressLines: []string{address},
+		VATNumber:    os.Getenv("COMPANY_VAT_NUMBER"),
+		Registration: os.Getenv("COMPANY_REGISTRATION"),
+		Email:        os.Getenv("COMPANY_EMAIL"),
+	}
+}
+
+// GetBankDetails retourne l'IBAN et le BIC du compte qui reçoit les virements
+func GetBankDetails() (string, string) {
+	iban := os.Getenv("COMPANY_IBAN")
+	if iban == "" {
+		iban = "BE12345678901234"
+	}
+	bic := os.Getenv("COMPANY_BIC")
+	if bic == "" {
+		bic = "KREDBEBB"
+	}
+	return iban, bic
+}
+
+// Colonnes du tableau des lignes (bord droit des colonnes numériques)
+const (
+	invoiceMargin   = 40.0
+	invoiceColQty   = 330.0
+	invoiceColPrice = 400.0
+	invoiceColRate  = 435.0
+	invoiceColNet   = 495.0
+	invoiceColTax   = 555.0
+)
+
+// RenderInvoicePDF génère la facture en PDF (A4, Go pur) : mentions vendeur / acheteur,
+// lignes, récapitulatif de TVA par taux, mention légale et QR de virement SEPA
+func RenderInvoicePDF(inv *models.Invoice) ([]byte, error) {
+	pdf := NewPDF(PageA4Width, PageA4Height)
+	pdf.AddPage()
+	right := PageA4Width - invoiceMargin
+
+	// En-tête : vendeur à gauche, numéro de facture à droite
+	pdf.Text(invoiceMargin, 60, 18, true, inv.Seller.Name)
+	pdf.TextRight(right, 60, 20, true, "FACTURE")
+	pdf.TextRight(right, 80, 10, false, "N° "+inv.Number)
+	pdf.TextRight(right, 94, 10, false, "Date : "+inv.IssuedAt.Format("02/01/2006"))
+	pdf.TextRight(right, 108, 10, false, "Commande : "+inv.OrderID.String()[:8])
+
+	y := invoicePartyBlock(pdf, invoiceMargin, 80, inv.Seller, "")
+	yBuyer := invoicePartyBlock(pdf, 320, 140, inv.Buyer, "FACTURÉ À")
+	if yBuyer > y {
+		y = yBuyer
+	}
+
+	// Références de l'acheteur (rapprochement de la facture dans sa comptabilité)
+	if inv.PONumber != "" {
+		y += 14
+		pdf.Text(invoiceMargin, y, 9, true, "Votre bon de commande : "+inv.PONumber)
+	}
+	if inv.CostCenter != "" {
+		y += 14
+		pdf.Text(invoiceMargin, y, 9, false, "Centre de coût : "+inv.CostCenter)
+	}
+
+	// Lignes
+	footer := func() { invoiceFooter(pdf, inv.Seller, inv.IBAN, inv.Number) }
+	y = invoiceLinesTable(pdf, y+24, inv.Lines, footer)
+
+	// Récapitulatif (et paiement) : doit tenir sur la page avec le QR
+	if y+260 > PageA4Height-60 {
+		footer()
+		pdf.AddPage()
+		y = 60
+	}
+	y += 20
+	if !inv.DiscountAmount.IsZero() {
+		pdf.Text(invoiceMargin, y, 8, false, fmt.Sprintf("Remise de %s %s TTC répartie sur les lignes.", inv.DiscountAmount, inv.GrossTotal.CurrencyCode()))
+	}
+	y = invoiceTotalRow(pdf, y, false, "Total HT", inv.NetTotal)
+	for _, rate := range inv.Rates {
+		y = invoiceTotalRow(pdf, y, false, fmt.Sprintf("TVA %g %% sur %s", rate.Rate, rate.NetAmount), rate.TaxAmount)
+	}
+	pdf.Line(360, y-8, right, y-8, 0.5)
+	y = invoiceTotalRow(pdf, y+4, true, "Total TTC ("+inv.GrossTotal.CurrencyCode()+")", inv.GrossTotal)
+
+	if inv.TaxNote != "" {
+		y += 8
+		for _, line := range WrapText(inv.TaxNote, 9, right-invoiceMargin) {
+			pdf.Text(invoiceMargin, y, 9, true, line)
+			y += 12
+		}
+	}
+
+	// Paiement : QR SEPA avec la référence structurée de la facture
+	y += 16
+	qrContent := SepaQRPayload(inv.IBAN, inv.BIC, inv.Seller.Name, inv.PaymentReference, inv.GrossTotal)
+	if err := pdf.QRCode(invoiceMargin, y, 96, qrContent); err != nil {
+		return nil, fmt.Errorf("erreur génération QR: %v", err)
 	}
+	x := invoiceMargin + 112
+	if inv.PaidAt != nil {
+		pdf.Text(x, y+14, 11, true, "Acquittée le "+inv.PaidAt.Format("02/01/2006"))
+	} else if inv.DueDate != nil {
+		pdf.Text(x, y+14, 11, true, fmt.Sprintf("À payer par virement avant le %s (%d jours)",
+			inv.DueDate.Format("02/01/2006"), inv.PaymentTermsDays))
+	} else {
+		pdf.Text(x, y+14, 11, true, "À payer par virement")
+	}
+	pdf.Text(x, y+32, 9, false, "IBAN : "+inv.IBAN)
+	pdf.Text(x, y+46, 9, false, "BIC : "+inv.BIC)
+	pdf.Text(x, y+60, 9, false, "Communication : "+inv.PaymentReference)
+	pdf.Text(x, y+74, 9, false, "Montant : "+inv.GrossTotal.String()+" "+inv.GrossTotal.CurrencyCode())
+
+	footer()
+	return pdf.Bytes(), nil
+}
+
+// invoiceFooter imprime les mentions légales du vendeur en bas de la page courante
+func invoiceFooter(pdf *PDFDocument, seller models.InvoiceParty, iban, number string) {
+	footer := []string{seller.Name}
+	if seller.VATNumber != "" {
+		footer = append(footer, "TVA "+seller.VATNumber)
+	}
+	if seller.Registration != "" {
+		footer = append(footer, seller.Registration)
+	}
+	footer = append(footer, "IBAN "+iban)
+	pdf.Line(invoiceMargin, PageA4Height-48, PageA4Width-invoiceMargin, PageA4Height-48, 0.5)
+	pdf.TextCenter(PageA4Width/2, PageA4Height-34, 8, false, strings.Join(footer, " - "))
+	pdf.TextRight(PageA4Width-invoiceMargin, PageA4Height-20, 7, false, fmt.Sprintf("%s - page %d", number, pdf.PageCount()))
+}
+
+// invoiceLinesTable imprime le tableau des lignes (avec saut de page) et retourne la position sous le tableau
+func invoiceLinesTable(pdf *PDFDocument, y float64, lines []models.InvoiceLine, footer func()) float64 {
+	y = invoiceTableHeader(pdf, y)
+	for _, line := range lines {
+		description := WrapText(line.Description, 9, invoiceColQty-invoiceMargin-40)
+		if len(description) == 0 {
+			description = []string{"-"}
+		}
+		if y+float64(len(description))*12 > PageA4Height-80 {
+			footer()
+			pdf.AddPage()
+			y = invoiceTableHeader(pdf, 60)
+		}
+		for i, text := range description {
+			pdf.Text(invoiceMargin, y+float64(i)*12, 9, false, text)
+		}
+		if line.Quantity > 0 {
+			pdf.TextRight(invoiceColQty, y, 9, false, fmt.Sprintf("%d", line.Quantity))
+		}
+		if !line.UnitPrice.IsZero() {
+			pdf.TextRight(invoiceColPrice, y, 9, false, line.UnitPrice.String())
+		}
+		pdf.TextRight(invoiceColRate, y, 9, false, fmt.Sprintf("%g %%", line.TaxRate))
+		pdf.TextRight(invoiceColNet, y, 9, false, line.NetAmount.String())
+		pdf.TextRight(invoiceColTax, y, 9, false, line.TaxAmount.String())
+		y += float64(len(description))*12 + 4
+	}
+	pdf.Line(invoiceMargin, y, PageA4Width-invoiceMargin, y, 0.5)
+	return y
+}
+
+// RenderCreditNotePDF génère la note de crédit en PDF : même présentation que la facture,
+// montants négatifs et référence à la facture d'origine
+func RenderCreditNotePDF(note *models.CreditNote) ([]byte, error) {
+	pdf := NewPDF(PageA4Width, PageA4Height)
+	pdf.AddPage()
+	right := PageA4Width - invoiceMargin
+
+	pdf.Text(invoiceMargin, 60, 18, true, note.Seller.Name)
+	pdf.TextRight(right, 60, 20, true, "NOTE DE CRÉDIT")
+	pdf.TextRight(right, 80, 10, false, "N° "+note.Number)
+	pdf.TextRight(right, 94, 10, false, "Date : "+note.IssuedAt.Format("02/01/2006"))
+	pdf.TextRight(right, 108, 10, false, "Facture d'origine : "+note.InvoiceNumber+" du "+note.InvoiceDate.Format("02/01/2006"))
+
+	y := invoicePartyBlock(pdf, invoiceMargin, 80, note.Seller, "")
+	yBuyer := invoicePartyBlock(pdf, 320, 140, note.Buyer, "CLIENT")
+	if yBuyer > y {
+		y = yBuyer
+	}
+
+	footer := func() { invoiceFooter(pdf, note.Seller, note.IBAN, note.Number) }
+	y = invoiceLinesTable(pdf, y+24, note.Lines, footer)
+
+	if y+160 > PageA4Height-60 {
+		footer()
+		pdf.AddPage()
+		y = 60
+	}
+	y += 20
+	y = invoiceTotalRow(pdf, y, false, "Total HT", note.NetTotal)
+	for _, rate := range note.Rates {
+		y = invoiceTotalRow(pdf, y, false, fmt.Sprintf("TVA %g %% sur %s", rate.Rate, rate.NetAmount), rate.TaxAmount)
+	}
+	pdf.Line(360, y-8, right, y-8, 0.5)
+	y = invoiceTotalRow(pdf, y+4, true, "Total TTC ("+note.GrossTotal.CurrencyCode()+")", note.GrossTotal)
+
+	y += 8
+	notes := []string{}
+	if note.TaxNote != "" {
+		notes = append(notes, note.TaxNote)
+	}
+	if note.Reason != "" {
+		notes = append(notes, "Motif : "+note.Reason)
+	}
+	notes = append(notes, "Montant remboursé sur le moyen de paiement utilisé lors de la commande.")
+	for _, text := range notes {
+		for _, line := range WrapText(text, 9, right-invoiceMargin) {
+			pdf.Text(invoiceMargin, y, 9, false, line)
+			y += 12
+		}
+	}
+
+	footer()
+	return pdf.Bytes(), nil
+}
+
+// invoicePartyBlock imprime un bloc adresse (vendeur ou acheteur) et retourne la position sous le bloc
+func invoicePartyBlock(pdf *PDFDocument, x, y float64, party models.InvoiceParty, title string) float64 {
+	const width = 230
+	if title != "" {
+		pdf.Text(x, y, 8, true, title)
+		y += 14
+		pdf.Text(x, y, 11, true, party.Name)
+		y += 14
+	}
+	for _, address := range party.AddressLines {
+		for _, line := range WrapText(address, 9, width) {
+			pdf.Text(x, y, 9, false, line)
+			y += 12
+		}
+	}
+	if party.VATNumber != "" {
+		pdf.Text(x, y, 9, false, "TVA : "+party.VATNumber)
+		y += 12
+	}
+	if party.Registration != "" {
+		pdf.Text(x, y, 9, false, party.Registration)
+		y += 12
+	}
+	if party.Email != "" {
+		pdf.Text(x, y, 9, false, party.Email)
+		y += 12
+	}
+	return y
+}
 
-	return pdfBuf, nil
+// invoiceTableHeader imprime l'en-tête du tableau des lignes et retourne la position de la première ligne
+func invoiceTableHeader(pdf *PDFDocument, y float64) float64 {
+	pdf.Gray(0.92)
+	pdf.Rect(invoiceMargin, y-12, PageA4Width-2*invoiceMargin, 18, true)
+	pdf.Gray(0)
+	pdf.Text(invoiceMargin+4, y, 8, true, "DÉSIGNATION")
+	pdf.TextRight(invoiceColQty, y, 8, true, "QTÉ")
+	pdf.TextRight(invoiceColPrice, y, 8, true, "PRIX UNIT.")
+	pdf.TextRight(invoiceColRate, y, 8, true, "TAUX")
+	pdf.TextRight(invoiceColNet, y, 8, true, "TOTAL HT")
+	pdf.TextRight(invoiceColTax, y, 8, true, "TVA")
+	return y + 22
 }
 
-// Helper: récupère l’URL du front (Next) depuis l'env
-func GetFrontendInvoiceBaseURL() string {
-	u := os.Getenv("FRONTEND_INVOICE_URL")
-	if u == "" {
-		// fallback local dev
-		return "http://localhost:3000/invoice"
+// invoiceTotalRow imprime une ligne du récapitulatif et retourne la position de la suivante
+func invoiceTotalRow(pdf *PDFDocument, y float64, bold bool, label string, amount models.Money) float64 {
+	size := 9.0
+	if bold {
+		size = 11
 	}
-	return u
+	pdf.TextRight(invoiceColNet, y, size, bold, label)
+	pdf.TextRight(invoiceColTax, y, size, bold, amount.String())
+	return y + size + 6
 }
@@ -4,6 +4,7 @@ import (
 	"cedra_back_end/internal/models"
 	"fmt"
 	"log"
+	"time"
 )
 
 // SendOrderStatusEmail envoie un email de notification de changement de statut
@@ -25,6 +26,10 @@ func getStatusEmailSubject(status string) string {
 	switch status {
 	case "paid":
 		return "✅ Paiement confirmé - Cedra"
+	case "invoiced":
+		return "🧾 Commande confirmée, payable sur facture - Cedra"
+	case "partially_shipped":
+		return "📦 Une partie de votre commande a été expédiée - Cedra"
 	case "shipped":
 		return "📦 Votre commande a été expédiée - Cedra"
 	case "delivered":
@@ -33,6 +38,14 @@ func getStatusEmailSubject(status string) string {
 		return "❌ Commande annulée - Cedra"
 	case "refunded":
 		return "💰 Remboursement effectué - Cedra"
+	case "partially_refunded":
+		return "💰 Remboursement partiel effectué - Cedra"
+	case "payment_processing":
+		return "⏳ Paiement en cours de traitement - Cedra"
+	case "payment_failed":
+		return "⚠️ Échec du paiement - Cedra"
+	case "disputed":
+		return "⚖️ Contestation de paiement - Cedra"
 	default:
 		return "📋 Mise à jour de votre commande - Cedra"
 	}
@@ -105,7 +118,7 @@ func generateStatusEmailHTML(order models.Order, status string) string {
                                                     <strong style="color: #333333;">Montant total:</strong>
                                                 </td>
                                                 <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right; font-weight: 600;">
-                                                    %.2f€
+                                                    %s€
                                                 </td>
                                             </tr>
                                             <tr>
@@ -168,6 +181,10 @@ func getStatusMessage(status string) string {
 	switch status {
 	case "paid":
 		return "Votre paiement a été confirmé avec succès. Nous préparons votre commande."
+	case "invoiced":
+		return "Votre commande est confirmée et en préparation. La facture est payable par virement à son échéance."
+	case "partially_shipped":
+		return "Un premier colis de votre commande est en route. Les articles restants suivront dans un envoi séparé."
 	case "shipped":
 		return "Bonne nouvelle ! Votre commande a été expédiée et est en route vers vous."
 	case "delivered":
@@ -176,6 +193,14 @@ func getStatusMessage(status string) string {
 		return "Votre commande a été annulée. Si vous avez des questions, n'hésitez pas à nous contacter."
 	case "refunded":
 		return "Votre remboursement a été traité. Les fonds seront crédités sur votre compte sous 5-10 jours ouvrés."
+	case "partially_refunded":
+		return "Une partie de votre commande a été remboursée. Les fonds seront crédités sur votre compte sous 5-10 jours ouvrés."
+	case "payment_processing":
+		return "Votre paiement est en cours de traitement. Nous vous préviendrons dès qu'il sera confirmé."
+	case "payment_failed":
+		return "Votre paiement n'a pas pu aboutir. Vous pouvez réessayer avec un autre moyen de paiement."
+	case "disputed":
+		return "Une contestation a été ouverte sur le paiement de cette commande. Notre équipe revient vers vous rapidement."
 	default:
 		return "Le statut de votre commande a été mis à jour."
 	}
@@ -185,7 +210,9 @@ func getStatusIcon(status string) string {
 	switch status {
 	case "paid":
 		return "✅"
-	case "shipped":
+	case "invoiced":
+		return "🧾"
+	case "shipped", "partially_shipped":
 		return "📦"
 	case "delivered":
 		return "🎉"
@@ -193,6 +220,14 @@ func getStatusIcon(status string) string {
 		return "❌"
 	case "refunded":
 		return "💰"
+	case "partially_refunded":
+		return "💰"
+	case "payment_processing":
+		return "⏳"
+	case "payment_failed":
+		return "⚠️"
+	case "disputed":
+		return "⚖️"
 	default:
 		return "📋"
 	}
@@ -200,9 +235,9 @@ func getStatusIcon(status string) string {
 
 func getStatusColor(status string) string {
 	switch status {
-	case "paid":
+	case "paid", "invoiced":
 		return "#10b981" // Green
-	case "shipped":
+	case "shipped", "partially_shipped":
 		return "#3b82f6" // Blue
 	case "delivered":
 		return "#8b5cf6" // Purple
@@ -210,6 +245,12 @@ func getStatusColor(status string) string {
 		return "#ef4444" // Red
 	case "refunded":
 		return "#f59e0b" // Orange
+	case "partially_refunded":
+		return "#f59e0b" // Orange
+	case "payment_processing":
+		return "#3b82f6" // Blue
+	case "payment_failed", "disputed":
+		return "#ef4444" // Red
 	default:
 		return "#6b7280" // Gray
 	}
@@ -260,9 +301,22 @@ func SendRefundRequestEmail(userEmail string, orderID string, reason string) err
 }
 
 // SendRefundApprovedEmail envoie un email de remboursement approuvé
-func SendRefundApprovedEmail(userEmail string, orderID string, amount float64) error {
+func SendRefundApprovedEmail(userEmail string, orderID string, amount models.Money, creditNoteNumber string, creditNotePDF []byte) error {
 	subject := "✅ Remboursement approuvé - Cedra"
 
+	creditNoteRow := ""
+	if creditNoteNumber != "" {
+		creditNoteRow = fmt.Sprintf(`
+                                            <tr>
+                                                <td style="padding: 8px 0; color: #666666; font-size: 14px;">
+                                                    <strong>Note de crédit:</strong>
+                                                </td>
+                                                <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">
+                                                    %s (jointe)
+                                                </td>
+                                            </tr>`, creditNoteNumber)
+	}
+
 	html := fmt.Sprintf(`
 <!DOCTYPE html>
 <html lang="fr">
@@ -303,7 +357,7 @@ func SendRefundApprovedEmail(userEmail string, orderID string, amount float64) e
                                             Montant remboursé
                                         </p>
                                         <p style="margin: 0; color: #047857; font-size: 42px; font-weight: 700;">
-                                            %.2f€
+                                            %s€
                                         </p>
                                     </td>
                                 </tr>
@@ -324,7 +378,7 @@ func SendRefundApprovedEmail(userEmail string, orderID string, amount float64) e
                                                 <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">
                                                     #%s
                                                 </td>
-                                            </tr>
+                                            </tr>%s
                                             <tr>
                                                 <td style="padding: 8px 0; color: #666666; font-size: 14px;">
                                                     <strong>Délai de traitement:</strong>
@@ -378,9 +432,9 @@ func SendRefundApprovedEmail(userEmail string, orderID string, amount float64) e
     </table>
 </body>
 </html>
-`, amount, orderID[:8])
+`, amount, orderID[:8], creditNoteRow)
 
-	return SendConfirmationEmail(userEmail, subject, html, nil)
+	return SendEmailWithAttachment(userEmail, subject, html, "note_de_credit_"+creditNoteNumber+".pdf", creditNotePDF)
 }
 
 // SendRefundRejectedEmail envoie un email de remboursement rejeté
@@ -480,3 +534,394 @@ func SendRefundRejectedEmail(userEmail string, orderID string, reason string) er
 
 	return SendConfirmationEmail(userEmail, subject, html, nil)
 }
+
+// SendReturnRequestEmail envoie un email de confirmation de demande de retour
+func SendReturnRequestEmail(userEmail string, orderID string, items []models.RefundItem) error {
+	subject := "📦 Demande de retour reçue - Cedra"
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .info-box { background: white; padding: 20px; border-radius: 8px; margin: 20px 0; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>📦 Demande de retour</h1>
+        </div>
+        <div class="content">
+            <p>Nous avons bien reçu votre demande de retour.</p>
+
+            <div class="info-box">
+                <h3>Détails</h3>
+                <p><strong>Commande:</strong> %s</p>
+                <ul>%s</ul>
+                <p><strong>Statut:</strong> En attente de validation</p>
+            </div>
+
+            <p>Ne renvoyez pas encore les articles : vous recevrez un numéro de retour et un bon à imprimer dès que la demande sera validée.</p>
+        </div>
+    </div>
+</body>
+</html>
+`, orderID, returnItemsHTML(items))
+
+	return SendConfirmationEmail(userEmail, subject, html, nil)
+}
+
+// SendReturnAuthorizedEmail envoie le numéro d'autorisation de retour et le lien vers le bon de retour
+func SendReturnAuthorizedEmail(userEmail string, orderID string, raNumber string, refundID string, items []models.RefundItem) error {
+	subject := "✅ Retour autorisé " + raNumber + " - Cedra"
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background: linear-gradient(135deg, #10b981 0%%, #059669 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
+        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
+        .info-box { background: white; padding: 20px; border-radius: 8px; margin: 20px 0; }
+        .ra { font-size: 26px; font-weight: bold; letter-spacing: 1px; text-align: center; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>✅ Retour autorisé</h1>
+        </div>
+        <div class="content">
+            <p>Votre demande de retour pour la commande %s a été acceptée.</p>
+
+            <div class="info-box">
+                <p>Numéro de retour</p>
+                <p class="ra">%s</p>
+                <ul>%s</ul>
+                <p><strong>Adresse de retour:</strong> %s</p>
+            </div>
+
+            <p>Imprimez le bon de retour, joignez-le au colis et indiquez le numéro de retour sur l'emballage :</p>
+            <p style="text-align: center;">
+                <a href="http://cedra.eldocam.com:5173/returns/%s/slip" style="display: inline-block; padding: 14px 32px; background-color: #10b981; color: #ffffff; text-decoration: none; border-radius: 6px; font-weight: 600;">
+                    Imprimer le bon de retour
+                </a>
+            </p>
+            <p>Le remboursement sera effectué dès réception et contrôle des articles.</p>
+        </div>
+    </div>
+</body>
+</html>
+`, orderID, raNumber, returnItemsHTML(items), GetReturnAddress(), refundID)
+
+	return SendConfirmationEmail(userEmail, subject, html, nil)
+}
+
+// returnItemsHTML liste les articles d'un retour
+func returnItemsHTML(items []models.RefundItem) string {
+	list := ""
+	for _, item := range items {
+		list += fmt.Sprintf("<li>%s × %d</li>", item.Name, item.Quantity)
+	}
+	return list
+}
+
+// SendPaymentReminderEmail envoie une relance de facture impayée (la dernière relance vaut mise en demeure)
+func SendPaymentReminderEmail(userEmail string, r *models.Receivable, final bool, invoicePDF []byte) error {
+	inv := r.Invoice
+	subject := fmt.Sprintf("🔔 Rappel de paiement - Facture %s - Cedra", inv.Number)
+	title := "🔔 Rappel de paiement"
+	intro := "Sauf erreur de notre part, la facture ci-dessous n'a pas encore été réglée."
+	color := "#f59e0b"
+	if r.DaysOverdue(time.Now()) < 0 {
+		subject = fmt.Sprintf("📅 Échéance prochaine - Facture %s - Cedra", inv.Number)
+		title = "📅 Échéance prochaine"
+		intro = "Pour rappel, la facture ci-dessous arrive bientôt à échéance."
+		color = "#3b82f6"
+	}
+	if final {
+		subject = fmt.Sprintf("⚠️ Mise en demeure - Facture %s - Cedra", inv.Number)
+		title = "⚠️ Mise en demeure"
+		intro = "Malgré nos précédents rappels, la facture ci-dessous reste impayée. Sans règlement de votre part, nous serons contraints d'engager une procédure de recouvrement."
+		color = "#ef4444"
+	}
+
+	dueDate := ""
+	if inv.DueDate != nil {
+		dueDate = inv.DueDate.Format("02/01/2006")
+	}
+	lateFeeRow := ""
+	if !r.LateFee.IsZero() {
+		lateFeeRow = fmt.Sprintf(`
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Frais de retard:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">%s€</td>
+                                </tr>`, r.LateFee)
+	}
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="fr">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Rappel de paiement</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f5;">
+    <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f5f5f5;">
+        <tr>
+            <td style="padding: 40px 20px;">
+                <table role="presentation" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 6px rgba(0,0,0,0.1);">
+                    <tr>
+                        <td style="background-color: %s; padding: 40px 30px; text-align: center; border-radius: 12px 12px 0 0;">
+                            <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: 600;">%s</h1>
+                            <p style="margin: 10px 0 0 0; color: #ffffff; font-size: 16px; opacity: 0.9;">Facture %s</p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 40px 30px;">
+                            <p style="margin: 0 0 25px 0; color: #333333; font-size: 16px; line-height: 1.6;">%s</p>
+                            <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f8f9fa; border-radius: 8px; padding: 20px;">
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Échéance:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">%s</td>
+                                </tr>
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Montant de la facture:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">%s€</td>
+                                </tr>%s
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Total à payer:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 16px; font-weight: 700; text-align: right;">%s€</td>
+                                </tr>
+                            </table>
+                            <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #eff6ff; border-left: 4px solid #3b82f6; border-radius: 8px; margin: 25px 0;">
+                                <tr>
+                                    <td style="padding: 20px; color: #1e40af; font-size: 14px; line-height: 1.6;">
+                                        <strong>Virement:</strong> IBAN %s (BIC %s)<br>
+                                        <strong>Communication:</strong> %s
+                                    </td>
+                                </tr>
+                            </table>
+                            <p style="margin: 0; color: #666666; font-size: 13px; line-height: 1.6;">
+                                Si le paiement a été effectué entre-temps, merci de ne pas tenir compte de ce message.
+                            </p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 30px; background-color: #f8f9fa; border-radius: 0 0 12px 12px; text-align: center;">
+                            <p style="margin: 0; color: #999999; font-size: 12px;">© 2024 Cedra - Tous droits réservés</p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+`, color, title, inv.Number, intro, dueDate, inv.GrossTotal, lateFeeRow, r.AmountDue(), inv.IBAN, inv.BIC, inv.PaymentReference)
+
+	return SendEmailWithAttachment(userEmail, subject, html, "facture_"+inv.Number+".pdf", invoicePDF)
+}
+
+// SendQuoteEmail envoie le devis (PDF joint) à l'acheteur
+func SendQuoteEmail(userEmail string, q *models.Quote, quotePDF []byte) error {
+	subject := fmt.Sprintf("📄 Votre devis %s - Cedra", q.Number)
+
+	validUntil := ""
+	if q.ValidUntil != nil {
+		validUntil = q.ValidUntil.Format("02/01/2006")
+	}
+	staffNote := ""
+	if q.StaffNote != "" {
+		staffNote = fmt.Sprintf(`
+                            <p style="margin: 25px 0 0 0; color: #333333; font-size: 14px; line-height: 1.6;">%s</p>`, q.StaffNote)
+	}
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="fr">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Votre devis</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f5;">
+    <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f5f5f5;">
+        <tr>
+            <td style="padding: 40px 20px;">
+                <table role="presentation" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 6px rgba(0,0,0,0.1);">
+                    <tr>
+                        <td style="background-color: #3b82f6; padding: 40px 30px; text-align: center; border-radius: 12px 12px 0 0;">
+                            <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: 600;">📄 Votre devis</h1>
+                            <p style="margin: 10px 0 0 0; color: #ffffff; font-size: 16px; opacity: 0.9;">Devis %s</p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 40px 30px;">
+                            <p style="margin: 0 0 25px 0; color: #333333; font-size: 16px; line-height: 1.6;">
+                                Vous trouverez ci-joint notre devis. Vous pouvez l'accepter depuis votre espace client : il sera converti en commande aux prix indiqués.
+                            </p>
+                            <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f8f9fa; border-radius: 8px; padding: 20px;">
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Articles:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">%d</td>
+                                </tr>
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Total TTC (hors livraison):</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 16px; font-weight: 700; text-align: right;">%s€</td>
+                                </tr>
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Valable jusqu'au:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">%s</td>
+                                </tr>
+                            </table>%s
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 30px; background-color: #f8f9fa; border-radius: 0 0 12px 12px; text-align: center;">
+                            <p style="margin: 0; color: #999999; font-size: 12px;">© 2024 Cedra - Tous droits réservés</p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+`, q.Number, len(q.Items), q.Total, validUntil, staffNote)
+
+	return SendEmailWithAttachment(userEmail, subject, html, "devis_"+q.Number+".pdf", quotePDF)
+}
+
+// SendOrderApprovalRequestEmail prévient un administrateur de la société qu'une commande dépasse le plafond d'un employé
+func SendOrderApprovalRequestEmail(adminEmail, employeeEmail string, a *models.OrderApproval) error {
+	subject := fmt.Sprintf("🕒 Commande à approuver (%s€) - Cedra", a.Amount)
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="fr">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Commande à approuver</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f5;">
+    <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f5f5f5;">
+        <tr>
+            <td style="padding: 40px 20px;">
+                <table role="presentation" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 6px rgba(0,0,0,0.1);">
+                    <tr>
+                        <td style="background-color: #f59e0b; padding: 40px 30px; text-align: center; border-radius: 12px 12px 0 0;">
+                            <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: 600;">🕒 Commande à approuver</h1>
+                            <p style="margin: 10px 0 0 0; color: #ffffff; font-size: 16px; opacity: 0.9;">Commande #%s</p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 40px 30px;">
+                            <p style="margin: 0 0 25px 0; color: #333333; font-size: 16px; line-height: 1.6;">
+                                <strong>%s</strong> a passé une commande qui dépasse son plafond d'achat. Elle ne sera payée qu'après votre approbation depuis l'espace société.
+                            </p>
+                            <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f8f9fa; border-radius: 8px; padding: 20px;">
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Montant TTC:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 16px; font-weight: 700; text-align: right;">%s€</td>
+                                </tr>
+                                <tr>
+                                    <td style="padding: 8px 0; color: #666666; font-size: 14px;"><strong>Plafond de l'employé:</strong></td>
+                                    <td style="padding: 8px 0; color: #333333; font-size: 14px; text-align: right;">%s€</td>
+                                </tr>
+                            </table>
+                            <table role="presentation" style="width: 100%%; margin: 30px 0;">
+                                <tr>
+                                    <td style="text-align: center;">
+                                        <a href="http://cedra.eldocam.com:5173/company/approvals" style="display: inline-block; padding: 14px 32px; background-color: #667eea; color: #ffffff; text-decoration: none; border-radius: 6px; font-weight: 600; font-size: 15px;">
+                                            Voir la demande
+                                        </a>
+                                    </td>
+                                </tr>
+                            </table>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 30px; background-color: #f8f9fa; border-radius: 0 0 12px 12px; text-align: center;">
+                            <p style="margin: 0; color: #999999; font-size: 12px;">© 2024 Cedra - Tous droits réservés</p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+`, a.OrderID.String()[:8], employeeEmail, a.Amount, a.SpendingLimit)
+
+	return SendConfirmationEmail(adminEmail, subject, html, nil)
+}
+
+// SendOrderApprovalDecisionEmail informe l'employé de la décision sur sa commande (approuvée : il peut la payer)
+func SendOrderApprovalDecisionEmail(userEmail string, a *models.OrderApproval) error {
+	subject := "✅ Commande approuvée - Cedra"
+	title := "✅ Commande approuvée"
+	color := "#10b981"
+	message := "Votre commande a été approuvée par l'administrateur de votre société. Vous pouvez maintenant la régler depuis votre espace client."
+	if a.Status == models.ApprovalStatusRejected {
+		subject = "❌ Commande refusée - Cedra"
+		title = "❌ Commande refusée"
+		color = "#ef4444"
+		message = "Votre commande a été refusée par l'administrateur de votre société et a été annulée."
+	}
+	comment := ""
+	if a.Comment != "" {
+		comment = fmt.Sprintf(`
+                            <p style="margin: 25px 0 0 0; color: #333333; font-size: 14px; line-height: 1.6;"><strong>Commentaire :</strong> %s</p>`, a.Comment)
+	}
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="fr">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Approbation de commande</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f5;">
+    <table role="presentation" style="width: 100%%; border-collapse: collapse; background-color: #f5f5f5;">
+        <tr>
+            <td style="padding: 40px 20px;">
+                <table role="presentation" style="max-width: 600px; margin: 0 auto; background-color: #ffffff; border-radius: 12px; box-shadow: 0 4px 6px rgba(0,0,0,0.1);">
+                    <tr>
+                        <td style="background-color: %s; padding: 40px 30px; text-align: center; border-radius: 12px 12px 0 0;">
+                            <h1 style="margin: 0; color: #ffffff; font-size: 28px; font-weight: 600;">%s</h1>
+                            <p style="margin: 10px 0 0 0; color: #ffffff; font-size: 16px; opacity: 0.9;">Commande #%s - %s€</p>
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 40px 30px;">
+                            <p style="margin: 0; color: #333333; font-size: 16px; line-height: 1.6;">%s</p>%s
+                        </td>
+                    </tr>
+                    <tr>
+                        <td style="padding: 30px; background-color: #f8f9fa; border-radius: 0 0 12px 12px; text-align: center;">
+                            <p style="margin: 0; color: #999999; font-size: 12px;">© 2024 Cedra - Tous droits réservés</p>
+                        </td>
+                    </tr>
+                </table>
+            </td>
+        </tr>
+    </table>
+</body>
+</html>
+`, color, title, a.OrderID.String()[:8], a.Amount, message, comment)
+
+	return SendConfirmationEmail(userEmail, subject, html, nil)
+}
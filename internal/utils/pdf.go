@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Formats de page en points PDF (1 pt = 1/72 pouce)
+const (
+	PageA4Width     = 595.28
+	PageA4Height    = 841.89
+	PageLabelWidth  = 288 // Étiquette transporteur 4x6"
+	PageLabelHeight = 432
+)
+
+// PDFDocument est un générateur PDF minimal en Go pur : texte Helvetica (WinAnsi), traits,
+// rectangles et QR codes vectoriels. Les coordonnées partent du coin supérieur gauche.
+type PDFDocument struct {
+	Width  float64
+	Height float64
+	pages  []*bytes.Buffer
+	page   *bytes.Buffer
+}
+
+// NewPDF crée un document vide au format donné
+func NewPDF(width, height float64) *PDFDocument {
+	return &PDFDocument{Width: width, Height: height}
+}
+
+// AddPage ouvre une nouvelle page ; les appels de dessin suivants s'y appliquent
+func (d *PDFDocument) AddPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+}
+
+// PageCount retourne le nombre de pages du document
+func (d *PDFDocument) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *PDFDocument) current() *bytes.Buffer {
+	if d.page == nil {
+		d.AddPage()
+	}
+	return d.page
+}
+
+// Text écrit une ligne de texte dont la ligne de base est à y
+func (d *PDFDocument) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.current(), "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, d.Height-y, pdfEscape(s))
+}
+
+// TextRight écrit un texte aligné à droite sur x
+func (d *PDFDocument) TextRight(x, y, size float64, bold bool, s string) {
+	d.Text(x-TextWidth(s, size, bold), y, size, bold, s)
+}
+
+// TextCenter écrit un texte centré sur x
+func (d *PDFDocument) TextCenter(x, y, size float64, bold bool, s string) {
+	d.Text(x-TextWidth(s, size, bold)/2, y, size, bold, s)
+}
+
+// Line trace un trait
+func (d *PDFDocument) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.current(), "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, d.Height-y1, x2, d.Height-y2)
+}
+
+// Rect trace un rectangle (plein ou contour) dont (x, y) est le coin supérieur gauche
+func (d *PDFDocument) Rect(x, y, w, h float64, fill bool) {
+	op := "S"
+	if fill {
+		op = "f"
+	}
+	fmt.Fprintf(d.current(), "%.2f %.2f %.2f %.2f re %s\n", x, d.Height-y-h, w, h, op)
+}
+
+// Gray règle la couleur de remplissage et de trait (0 = noir, 1 = blanc)
+func (d *PDFDocument) Gray(level float64) {
+	fmt.Fprintf(d.current(), "%.2f g %.2f G\n", level, level)
+}
+
+// QRCode dessine un QR code vectoriel de côté size (sans marge)
+func (d *PDFDocument) QRCode(x, y, size float64, content string) error {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	qr.DisableBorder = true
+
+	bitmap := qr.Bitmap()
+	if len(bitmap) == 0 {
+		return fmt.Errorf("QR code vide")
+	}
+	module := size / float64(len(bitmap))
+
+	var b strings.Builder
+	for row, line := range bitmap {
+		for col, dark := range line {
+			if dark {
+				fmt.Fprintf(&b, "%.3f %.3f %.3f %.3f re\n", x+float64(col)*module, d.Height-y-float64(row+1)*module, module, module)
+			}
+		}
+	}
+	d.current().WriteString("0 g\n" + b.String() + "f\n")
+	return nil
+}
+
+// Bytes assemble le document PDF
+func (d *PDFDocument) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1: catalogue, 2: arbre des pages, 3-4: polices, puis (contenu, page) par page
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			d.Width, d.Height, 5+2*i))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// pdfEscape convertit en WinAnsi (cp1252) et échappe les caractères réservés
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		c, ok := winAnsi(r)
+		if !ok {
+			c = '?'
+		}
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 32 || c > 126 {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+func winAnsi(r rune) (byte, bool) {
+	switch {
+	case r >= 32 && r <= 126:
+		return byte(r), true
+	case r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	switch r {
+	case '€':
+		return 0x80, true
+	case '‚':
+		return 0x82, true
+	case '…':
+		return 0x85, true
+	case '‘':
+		return 0x91, true
+	case '’':
+		return 0x92, true
+	case '“':
+		return 0x93, true
+	case '”':
+		return 0x94, true
+	case '•':
+		return 0x95, true
+	case '–':
+		return 0x96, true
+	case '—':
+		return 0x97, true
+	}
+	return 0, false
+}
+
+// helveticaWidths : largeurs (1/1000 em) des caractères ASCII 32-126 de Helvetica
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// TextWidth estime la largeur d'un texte en points (Helvetica ; le gras est ~5 % plus large)
+func TextWidth(s string, size float64, bold bool) float64 {
+	total := 0
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			total += helveticaWidths[r-32]
+		} else {
+			total += 556
+		}
+	}
+	width := float64(total) * size / 1000
+	if bold {
+		width *= 1.05
+	}
+	return width
+}
+
+// WrapText découpe un texte en lignes d'au plus maxWidth points
+func WrapText(s string, size, maxWidth float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && TextWidth(candidate, size, false) > maxWidth {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"cedra_back_end/internal/models"
+	"fmt"
+)
+
+// Colonnes du tableau des lignes d'un devis (bord droit des colonnes numériques)
+const (
+	quoteColQty   = 360.0
+	quoteColList  = 430.0
+	quoteColPrice = 495.0
+	quoteColTotal = 555.0
+)
+
+// RenderQuotePDF génère le devis en PDF : mêmes en-tête et mentions que la facture, prix catalogue et prix
+// consentis, date de validité. Les prix sont TTC ; la TVA définitive dépend de l'adresse de livraison.
+func RenderQuotePDF(q *models.Quote, seller, buyer models.InvoiceParty) ([]byte, error) {
+	pdf := NewPDF(PageA4Width, PageA4Height)
+	pdf.AddPage()
+	right := PageA4Width - invoiceMargin
+
+	pdf.Text(invoiceMargin, 60, 18, true, seller.Name)
+	pdf.TextRight(right, 60, 20, true, "DEVIS")
+	pdf.TextRight(right, 80, 10, false, "N° "+q.Number)
+	date := q.CreatedAt
+	if q.SentAt != nil {
+		date = *q.SentAt
+	}
+	pdf.TextRight(right, 94, 10, false, "Date : "+date.Format("02/01/2006"))
+	if q.ValidUntil != nil {
+		pdf.TextRight(right, 108, 10, true, "Valable jusqu'au "+q.ValidUntil.Format("02/01/2006"))
+	}
+
+	y := invoicePartyBlock(pdf, invoiceMargin, 80, seller, "")
+	yBuyer := invoicePartyBlock(pdf, 320, 140, buyer, "CLIENT")
+	if yBuyer > y {
+		y = yBuyer
+	}
+
+	iban, _ := GetBankDetails()
+	footer := func() { invoiceFooter(pdf, seller, iban, q.Number) }
+	y = quoteTableHeader(pdf, y+24)
+	for _, item := range q.Items {
+		description := WrapText(item.Name, 9, quoteColQty-invoiceMargin-40)
+		if len(description) == 0 {
+			description = []string{"-"}
+		}
+		if y+float64(len(description))*12 > PageA4Height-80 {
+			footer()
+			pdf.AddPage()
+			y = quoteTableHeader(pdf, 60)
+		}
+		for i, text := range description {
+			pdf.Text(invoiceMargin, y+float64(i)*12, 9, false, text)
+		}
+		pdf.TextRight(quoteColQty, y, 9, false, fmt.Sprintf("%d", item.Quantity))
+		pdf.TextRight(quoteColList, y, 9, false, item.ListPrice.String())
+		pdf.TextRight(quoteColPrice, y, 9, item.UnitPrice.Amount != item.ListPrice.Amount, item.UnitPrice.String())
+		pdf.TextRight(quoteColTotal, y, 9, false, item.Total().String())
+		y += float64(len(description))*12 + 4
+	}
+	pdf.Line(invoiceMargin, y, right, y, 0.5)
+
+	if y+140 > PageA4Height-60 {
+		footer()
+		pdf.AddPage()
+		y = 60
+	}
+	y += 20
+	y = invoiceTotalRow(pdf, y, true, "Total TTC ("+q.Total.CurrencyCode()+")", q.Total)
+
+	y += 8
+	notes := []string{
+		"Prix TTC. La TVA est recalculée à la commande selon l'adresse de livraison " +
+			"(autoliquidation pour les sociétés assujetties d'un autre État membre). Frais de livraison en sus.",
+		"Pour accepter ce devis, validez-le depuis votre espace client avant sa date de fin de validité.",
+	}
+	if q.StaffNote != "" {
+		notes = append([]string{q.StaffNote}, notes...)
+	}
+	for _, text := range notes {
+		for _, line := range WrapText(text, 9, right-invoiceMargin) {
+			pdf.Text(invoiceMargin, y, 9, false, line)
+			y += 12
+		}
+		y += 4
+	}
+
+	footer()
+	return pdf.Bytes(), nil
+}
+
+// quoteTableHeader imprime l'en-tête du tableau des lignes du devis et retourne la position de la première ligne
+func quoteTableHeader(pdf *PDFDocument, y float64) float64 {
+	pdf.Gray(0.92)
+	pdf.Rect(invoiceMargin, y-12, PageA4Width-2*invoiceMargin, 18, true)
+	pdf.Gray(0)
+	pdf.Text(invoiceMargin+4, y, 8, true, "DÉSIGNATION")
+	pdf.TextRight(quoteColQty, y, 8, true, "QTÉ")
+	pdf.TextRight(quoteColList, y, 8, true, "PRIX CATALOGUE")
+	pdf.TextRight(quoteColPrice, y, 8, true, "PRIX DEVIS")
+	pdf.TextRight(quoteColTotal, y, 8, true, "TOTAL TTC")
+	return y + 22
+}
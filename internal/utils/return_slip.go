@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"cedra_back_end/internal/models"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"os"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// GetReturnAddress retourne l'adresse de l'entrepôt qui reçoit les retours
+func GetReturnAddress() string {
+	if addr := os.Getenv("RETURN_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "Cedra SRL - Service Retours"
+}
+
+// GenerateReturnSlipHTML génère le bon de retour imprimable à joindre au colis.
+// Le QR code contient le numéro RA, scanné par l'entrepôt à la réception.
+func GenerateReturnSlipHTML(r models.Refund, order models.Order) (string, error) {
+	png, err := qrcode.Encode(r.RANumber, qrcode.Medium, 200)
+	if err != nil {
+		return "", fmt.Errorf("erreur génération QR: %v", err)
+	}
+	qr := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+
+	itemsHTML := ""
+	for _, item := range r.Items {
+		itemsHTML += fmt.Sprintf(`
+				<tr>
+					<td style="padding: 8px; border: 1px solid #ddd;">%s</td>
+					<td style="padding: 8px; border: 1px solid #ddd; font-family: monospace;">%s</td>
+					<td style="padding: 8px; border: 1px solid #ddd; text-align: center;">%d</td>
+				</tr>`, html.EscapeString(item.Name), html.EscapeString(item.ProductID), item.Quantity)
+	}
+
+	sender := ""
+	if order.ShippingAddress != nil {
+		a := order.ShippingAddress
+		sender = fmt.Sprintf("%s<br>%s %s", html.EscapeString(a.Street), html.EscapeString(a.PostalCode), html.EscapeString(a.City))
+	}
+
+	approved := ""
+	if r.ApprovedAt != nil {
+		approved = r.ApprovedAt.Format("02/01/2006")
+	}
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="fr">
+<head>
+	<meta charset="UTF-8">
+	<title>Bon de retour %s</title>
+	<style>@media print { .no-print { display: none; } }</style>
+</head>
+<body style="font-family: Arial, sans-serif; padding: 20px;">
+	<div style="max-width: 700px; margin: auto; border: 2px dashed #333; padding: 24px;">
+		<table style="width: 100%%;">
+			<tr>
+				<td>
+					<h1 style="margin: 0;">Bon de retour</h1>
+					<p style="font-size: 22px; font-weight: bold; margin: 8px 0;">%s</p>
+					<p style="margin: 0;">Commande #%s — autorisé le %s</p>
+				</td>
+				<td style="text-align: right;"><img src="%s" alt="%s" width="140" height="140"></td>
+			</tr>
+		</table>
+
+		<table style="width: 100%%; margin: 20px 0;">
+			<tr>
+				<td style="vertical-align: top; width: 50%%;">
+					<strong>Expéditeur</strong><br>%s
+				</td>
+				<td style="vertical-align: top;">
+					<strong>Destinataire</strong><br>%s
+				</td>
+			</tr>
+		</table>
+
+		<table style="width: 100%%; border-collapse: collapse;">
+			<thead>
+				<tr style="background-color: #f0f0f0;">
+					<th style="padding: 8px; border: 1px solid #ddd; text-align: left;">Article</th>
+					<th style="padding: 8px; border: 1px solid #ddd; text-align: left;">Référence</th>
+					<th style="padding: 8px; border: 1px solid #ddd;">Quantité</th>
+				</tr>
+			</thead>
+			<tbody>%s
+			</tbody>
+		</table>
+
+		<p style="margin-top: 20px;"><strong>Motif :</strong> %s</p>
+		<p style="font-size: 13px; color: #555;">
+			Imprimez ce bon, placez-le dans le colis avec les articles et indiquez le numéro %s sur l'emballage.
+			Les colis sans numéro de retour ne peuvent pas être traités.
+		</p>
+		<p class="no-print" style="text-align: center;"><button onclick="window.print()">🖨️ Imprimer</button></p>
+	</div>
+</body>
+</html>`, r.RANumber, r.RANumber, order.ID.String()[:8], approved, qr, r.RANumber, sender,
+		html.EscapeString(GetReturnAddress()), itemsHTML, html.EscapeString(r.Reason), r.RANumber), nil
+}
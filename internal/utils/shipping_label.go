@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ShippingLabel regroupe les informations imprimées sur une étiquette transporteur
+type ShippingLabel struct {
+	CarrierName    string
+	ServiceName    string
+	TrackingNumber string
+	Reference      string // Référence commande
+	RecipientName  string
+	RecipientLines []string // Rue, code postal + ville, pays
+	Weight         float64  // kg
+}
+
+// GetShipperAddress retourne l'adresse d'expédition imprimée sur les étiquettes
+func GetShipperAddress() string {
+	if addr := os.Getenv("SHIPPER_ADDRESS"); addr != "" {
+		return addr
+	}
+	return GetReturnAddress()
+}
+
+// GenerateShippingLabelPDF génère une étiquette 4x6" en PDF.
+// Le QR code contient le numéro de suivi, scanné au dépôt du colis.
+func GenerateShippingLabelPDF(label ShippingLabel) ([]byte, error) {
+	pdf := NewPDF(PageLabelWidth, PageLabelHeight)
+	pdf.AddPage()
+
+	const margin = 14.0
+	right := PageLabelWidth - margin
+
+	// En-tête transporteur
+	pdf.Rect(0, 0, PageLabelWidth, 44, true)
+	pdf.Gray(1)
+	pdf.Text(margin, 28, 18, true, strings.ToUpper(label.CarrierName))
+	pdf.TextRight(right, 28, 10, false, label.ServiceName)
+	pdf.Gray(0)
+
+	// Expéditeur
+	pdf.Text(margin, 62, 7, true, "EXPÉDITEUR")
+	y := 74.0
+	for _, line := range WrapText(GetShipperAddress(), 8, PageLabelWidth-2*margin) {
+		pdf.Text(margin, y, 8, false, line)
+		y += 10
+	}
+	pdf.Line(margin, y, right, y, 0.5)
+
+	// Destinataire
+	y += 16
+	pdf.Text(margin, y, 7, true, "DESTINATAIRE")
+	y += 16
+	pdf.Text(margin, y, 13, true, label.RecipientName)
+	for _, line := range label.RecipientLines {
+		y += 15
+		pdf.Text(margin, y, 12, false, line)
+	}
+	y += 14
+	pdf.Line(margin, y, right, y, 0.5)
+
+	// Suivi
+	y += 12
+	if err := pdf.QRCode(margin, y, 110, label.TrackingNumber); err != nil {
+		return nil, fmt.Errorf("erreur génération QR: %v", err)
+	}
+	pdf.Text(margin+124, y+16, 7, true, "N° DE SUIVI")
+	pdf.Text(margin+124, y+30, 11, true, label.TrackingNumber)
+	pdf.Text(margin+124, y+52, 7, true, "RÉFÉRENCE")
+	pdf.Text(margin+124, y+64, 9, false, label.Reference)
+	pdf.Text(margin+124, y+86, 7, true, "POIDS")
+	pdf.Text(margin+124, y+98, 9, false, fmt.Sprintf("%.2f kg", label.Weight))
+
+	pdf.Line(margin, PageLabelHeight-28, right, PageLabelHeight-28, 0.5)
+	pdf.Text(margin, PageLabelHeight-14, 7, false, "Imprimé le "+time.Now().Format("02/01/2006 15:04"))
+
+	return pdf.Bytes(), nil
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"cedra_back_end/internal/models"
 	"html/template"
 	"log"
 )
@@ -41,7 +42,7 @@ func SendWelcomeEmailFromTemplate(userEmail, userName string) error {
 }
 
 // SendOrderConfirmationFromTemplate envoie un email de confirmation de commande depuis le template React
-func SendOrderConfirmationFromTemplate(userEmail string, orderID string, totalAmount float64) error {
+func SendOrderConfirmationFromTemplate(userEmail string, orderID string, totalAmount models.Money) error {
 	// Charger le template HTML compilé depuis React
 	tmpl, err := template.ParseFiles("internal/templates/order-confirmation.html")
 	if err != nil {